@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/agent"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
+	"github.com/spf13/cobra"
+)
+
+// agentDisableEnvVar makes git-credential and exec skip the agent
+const agentDisableEnvVar = "GH_APP_AUTH_NO_AGENT"
+
+// agentStartTimeout is how long 'agent start' waits for the agent to answer
+const agentStartTimeout = 5 * time.Second
+
+func NewAgentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Manage the long-running credential agent",
+		Long: `Manage a long-running credential agent, similar to ssh-agent.
+
+The agent keeps parsed private keys and installation tokens in memory and
+serves them to git-credential and exec over a Unix domain socket that only
+the current user can access. When the agent is running, short-lived
+credential processes ask it for tokens instead of reading keys from the
+keyring and calling the GitHub API themselves; when it is not, they fall
+back to in-process resolution.
+
+The socket is agent/agent.sock in the extension config directory: the
+directory of the --config file, or extensions/gh-app-auth in gh's config
+directory, which follows GH_CONFIG_DIR and XDG_CONFIG_HOME (by default
+~/.config/gh/extensions/gh-app-auth/agent/agent.sock). Set
+GH_APP_AUTH_AGENT_SOCK to use another path, and GH_APP_AUTH_NO_AGENT=1 to
+bypass the agent for a single command.`,
+		Example: `  # Start the agent in the background
+  gh app-auth agent start
+
+  # Run the agent in the foreground (e.g. under systemd or in a CI job)
+  gh app-auth agent start --foreground
+
+  # Check whether the agent is running
+  gh app-auth agent status
+
+  # Stop the agent
+  gh app-auth agent stop`,
+	}
+
+	cmd.AddCommand(newAgentStartCmd())
+	cmd.AddCommand(newAgentStopCmd())
+	cmd.AddCommand(newAgentStatusCmd())
+
+	return cmd
+}
+
+func newAgentStartCmd() *cobra.Command {
+	var foreground bool
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start the credential agent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socketPath := agent.DefaultSocketPath()
+			if status, err := agent.NewClient(socketPath).Status(); err == nil {
+				fmt.Printf("Agent already running (PID %d) on %s\n", status.PID, status.Socket)
+				return nil
+			}
+
+			if foreground {
+				return runAgentServer(socketPath)
+			}
+			return startAgentInBackground(socketPath)
+		},
+	}
+
+	cmd.Flags().BoolVar(&foreground, "foreground", false, "Run the agent in the foreground instead of detaching")
+
+	return cmd
+}
+
+func newAgentStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the credential agent",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := agent.NewClient(agent.DefaultSocketPath()).Stop()
+			if errors.Is(err, agent.ErrNotRunning) {
+				fmt.Println("Agent is not running")
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to stop agent: %w", err)
+			}
+			fmt.Println("✅ Agent stopped")
+			return nil
+		},
+	}
+}
+
+func newAgentStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the credential agent is running",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := agent.NewClient(agent.DefaultSocketPath()).Status()
+			if errors.Is(err, agent.ErrNotRunning) {
+				fmt.Println("Agent is not running")
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to query agent: %w", err)
+			}
+
+			fmt.Printf("Agent running\n")
+			fmt.Printf("  PID:      %d\n", status.PID)
+			fmt.Printf("  Socket:   %s\n", status.Socket)
+			fmt.Printf("  Uptime:   %s\n", time.Since(status.StartedAt).Round(time.Second))
+			fmt.Printf("  Requests: %d\n", status.Requests)
+			return nil
+		},
+	}
+}
+
+// startAgentInBackground re-executes the extension as a detached foreground
+// agent and waits until it answers on the socket
+func startAgentInBackground(socketPath string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	logDir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		return fmt.Errorf("failed to create agent directory: %w", err)
+	}
+	logPath := filepath.Join(logDir, "agent.log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open agent log: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	args := []string{"agent", "start", "--foreground"}
+	if configFileFlag != "" {
+		args = append(args, "--config", paths.ConfigFile())
+	}
+	// #nosec G204 -- Re-executes this extension's own binary with fixed arguments.
+	child := exec.Command(executable, args...)
+	child.Stdout = logFile
+	child.Stderr = logFile
+	child.SysProcAttr = agent.DetachedProcAttr()
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start agent: %w", err)
+	}
+	_ = child.Process.Release()
+
+	client := agent.NewClient(socketPath)
+	deadline := time.Now().Add(agentStartTimeout)
+	for time.Now().Before(deadline) {
+		if status, err := client.Status(); err == nil {
+			fmt.Printf("✅ Agent started (PID %d) on %s\n", status.PID, status.Socket)
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return fmt.Errorf("agent did not start within %s; see %s", agentStartTimeout, logPath)
+}
+
+// runAgentServer serves credential requests until stopped
+func runAgentServer(socketPath string) error {
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+
+	authenticator := newCredentialAuthenticator(cfg)
+	authenticator.RetainPrivateKeys()
+
+	server := agent.NewServer(socketPath, newAgentTokenHandler(authenticator, loadCredentialConfig))
+	server.SetEvictHandler(newAgentEvictHandler(authenticator, loadCredentialConfig))
+	if err := server.Listen(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			_ = server.Close()
+		}
+	}()
+
+	fmt.Printf("Agent listening on %s (PID %d)\n", socketPath, os.Getpid())
+	return server.Serve()
+}
+
+// newAgentTokenHandler resolves agent token requests against the current
+// configuration using a single long-lived authenticator
+func newAgentTokenHandler(
+	authenticator *auth.Authenticator, loadConfig func() (*config.Config, error),
+) agent.TokenHandler {
+	// Minting is serialised so parallel clones reuse the first token
+	var mu sync.Mutex
+
+	return func(request agent.Request) (*agent.Token, error) {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		app, err := findAgentApp(cfg, request)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		scope := config.TokenScope{Permissions: request.Permissions, Repositories: request.Repositories}
+		token, err := authenticator.GetScopedToken(app, request.Repository, scope)
+		if err != nil {
+			return nil, err
+		}
+		served := &agent.Token{
+			Token:               token.Token,
+			ExpiresAt:           token.ExpiresAt,
+			Permissions:         token.Permissions,
+			RepositorySelection: token.RepositorySelection,
+			Cached:              token.Cached,
+		}
+		if request.Username {
+			served.Username = authenticator.CredentialUsername(app, request.Repository)
+		}
+		return served, nil
+	}
+}
+
+// newAgentEvictHandler evicts an app's tokens, or only the token served for a
+// repository when the request names one
+func newAgentEvictHandler(
+	authenticator *auth.Authenticator, loadConfig func() (*config.Config, error),
+) agent.EvictHandler {
+	return func(request agent.Request) (int, error) {
+		if request.Repository == "" {
+			return authenticator.EvictTokens(request.AppID)
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return 0, err
+		}
+		app, err := findAgentApp(cfg, request)
+		if err != nil {
+			return 0, err
+		}
+		scope := config.TokenScope{Permissions: request.Permissions, Repositories: request.Repositories}
+		return authenticator.EvictToken(app, request.Repository, scope)
+	}
+}
+
+// findAgentApp returns a copy of the configured app named in the request
+func findAgentApp(cfg *config.Config, request agent.Request) (*config.GitHubApp, error) {
+	for _, configured := range cfg.GitHubApps {
+		if configured.Name != request.AppName || configured.AppID != request.AppID {
+			continue
+		}
+		app := configured
+		if request.InstallationID != 0 {
+			app.InstallationID = request.InstallationID
+		}
+		return &app, nil
+	}
+	return nil, fmt.Errorf("no configured GitHub App %q with app ID %d", request.AppName, request.AppID)
+}
+
+// getAppToken returns an installation token for the app narrowed to scope,
+// preferring a running agent and falling back to in-process resolution
+func getAppToken(
+	cfg *config.Config, app *config.GitHubApp, repoURL string, scope config.TokenScope,
+) (*auth.InstallationToken, error) {
+	if token, _, ok := getAppTokenFromAgent(app, repoURL, scope, false); ok {
+		return token, nil
+	}
+	return newCredentialAuthenticator(cfg).GetScopedToken(app, repoURL, scope)
+}
+
+// getAppCredential returns an installation token for the app narrowed to scope
+// and the git username to present it with, the app's cached bot login. Both
+// come from the same source: a running agent, or one in-process authenticator.
+func getAppCredential(
+	cfg *config.Config, app *config.GitHubApp, repoURL string, scope config.TokenScope,
+) (*auth.InstallationToken, string, error) {
+	if token, username, ok := getAppTokenFromAgent(app, repoURL, scope, true); ok {
+		if username == "" {
+			// An agent that predates usernames
+			username = newCredentialAuthenticator(cfg).CredentialUsername(app, repoURL)
+		}
+		return token, username, nil
+	}
+
+	authenticator := newCredentialAuthenticator(cfg)
+	token, err := authenticator.GetScopedToken(app, repoURL, scope)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, authenticator.CredentialUsername(app, repoURL), nil
+}
+
+// getAppTokenFromAgent asks a running agent for a token, and the app's git
+// username when withUsername is set. Any failure is logged and reported as a
+// miss so the caller can fall back.
+func getAppTokenFromAgent(
+	app *config.GitHubApp, repoURL string, scope config.TokenScope, withUsername bool,
+) (*auth.InstallationToken, string, bool) {
+	// The agent serves its own on-disk configuration, not the environment's
+	if os.Getenv(agentDisableEnvVar) != "" || statelessMode() {
+		return nil, "", false
+	}
+
+	token, err := agent.NewClient(agent.DefaultSocketPath()).Token(agent.Request{
+		AppName:        app.Name,
+		AppID:          app.AppID,
+		InstallationID: app.InstallationID,
+		Repository:     repoURL,
+		Permissions:    scope.Permissions,
+		Repositories:   scope.Repositories,
+		Username:       withUsername,
+	})
+	if err != nil {
+		if !errors.Is(err, agent.ErrNotRunning) {
+			logger.FlowStep("agent_fallback", map[string]interface{}{
+				"app_id": app.AppID,
+				"error":  err.Error(),
+			})
+		}
+		return nil, "", false
+	}
+
+	logger.FlowStep("agent_token_received", map[string]interface{}{
+		"app_id":     app.AppID,
+		"token_hash": logger.HashToken(token.Token),
+		"cached":     token.Cached,
+	})
+	return &auth.InstallationToken{
+		Token:               token.Token,
+		ExpiresAt:           token.ExpiresAt,
+		Permissions:         token.Permissions,
+		RepositorySelection: token.RepositorySelection,
+		Cached:              token.Cached,
+	}, token.Username, true
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/agent"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestNewAgentCmd(t *testing.T) {
+	cmd := NewAgentCmd()
+
+	want := map[string]bool{"start": false, "stop": false, "status": false}
+	for _, sub := range cmd.Commands() {
+		if _, ok := want[sub.Name()]; ok {
+			want[sub.Name()] = true
+		}
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("Expected subcommand %q", name)
+		}
+	}
+
+	start, _, err := cmd.Find([]string{"start"})
+	if err != nil {
+		t.Fatalf("Find(start) error = %v", err)
+	}
+	if start.Flags().Lookup("foreground") == nil {
+		t.Error("Expected --foreground flag on start")
+	}
+}
+
+func TestFindAgentApp(t *testing.T) {
+	cfg := &config.Config{
+		GitHubApps: []config.GitHubApp{
+			{Name: "org-app", AppID: 1, InstallationID: 10},
+			{Name: "other-app", AppID: 2, InstallationID: 20},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		request            agent.Request
+		wantErr            bool
+		wantInstallationID int64
+	}{
+		{
+			name:               "matches name and app ID",
+			request:            agent.Request{AppName: "org-app", AppID: 1},
+			wantInstallationID: 10,
+		},
+		{
+			name:               "installation override",
+			request:            agent.Request{AppName: "other-app", AppID: 2, InstallationID: 99},
+			wantInstallationID: 99,
+		},
+		{
+			name:    "app ID mismatch",
+			request: agent.Request{AppName: "org-app", AppID: 2},
+			wantErr: true,
+		},
+		{
+			name:    "unknown app",
+			request: agent.Request{AppName: "missing", AppID: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := findAgentApp(cfg, tt.request)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if app.InstallationID != tt.wantInstallationID {
+				t.Errorf("InstallationID = %d, want %d", app.InstallationID, tt.wantInstallationID)
+			}
+		})
+	}
+
+	if cfg.GitHubApps[1].InstallationID != 20 {
+		t.Error("Expected installation override not to modify the configuration")
+	}
+}
+
+func TestNewAgentTokenHandler_Errors(t *testing.T) {
+	t.Run("config load failure", func(t *testing.T) {
+		handler := newAgentTokenHandler(auth.NewAuthenticator(), func() (*config.Config, error) {
+			return nil, errors.New("boom")
+		})
+		if _, err := handler(agent.Request{AppName: "app", AppID: 1}); err == nil {
+			t.Error("Expected config error")
+		}
+	})
+
+	t.Run("unknown app", func(t *testing.T) {
+		handler := newAgentTokenHandler(auth.NewAuthenticator(), func() (*config.Config, error) {
+			return &config.Config{}, nil
+		})
+		if _, err := handler(agent.Request{AppName: "app", AppID: 1}); err == nil {
+			t.Error("Expected unknown app error")
+		}
+	})
+}
+
+func TestGetAppTokenFromAgent(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socketPath := filepath.Join(dir, "agent.sock")
+	t.Setenv(agent.SocketEnvVar, socketPath)
+	t.Setenv(agentDisableEnvVar, "")
+
+	app := &config.GitHubApp{Name: "org-app", AppID: 1, InstallationID: 10}
+
+	if _, _, ok := getAppTokenFromAgent(app, "github.com/org/repo", config.TokenScope{}, false); ok {
+		t.Fatal("Expected miss when no agent is running")
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := agent.NewServer(socketPath, func(request agent.Request) (*agent.Token, error) {
+		if request.AppName != app.Name || request.Repository != "github.com/org/repo" {
+			return nil, errors.New("unexpected request")
+		}
+		token := &agent.Token{Token: "ghs_agent", ExpiresAt: expiresAt, Cached: true}
+		if request.Username {
+			token.Username = "org-app-slug[bot]"
+		}
+		return token, nil
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() { _ = server.Serve() }()
+	defer func() { _ = server.Close() }()
+
+	token, username, ok := getAppTokenFromAgent(app, "github.com/org/repo", config.TokenScope{}, false)
+	if !ok {
+		t.Fatal("Expected token from agent")
+	}
+	if token.Token != "ghs_agent" || !token.Cached || !token.ExpiresAt.Equal(expiresAt) || username != "" {
+		t.Errorf("getAppTokenFromAgent() = %+v, %q", token, username)
+	}
+	_, username, _ = getAppTokenFromAgent(app, "github.com/org/repo", config.TokenScope{}, true)
+	if username != "org-app-slug[bot]" {
+		t.Errorf("getAppTokenFromAgent() username = %q, want the agent's", username)
+	}
+
+	// Agent errors fall back instead of failing
+	if _, _, ok := getAppTokenFromAgent(app, "github.com/org/other", config.TokenScope{}, false); ok {
+		t.Error("Expected miss when the agent returns an error")
+	}
+
+	t.Setenv(agentDisableEnvVar, "1")
+	if _, _, ok := getAppTokenFromAgent(app, "github.com/org/repo", config.TokenScope{}, false); ok {
+		t.Error("Expected agent to be bypassed when disabled")
+	}
+}
+
+func TestGetAppCredential_Agent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socketPath := filepath.Join(dir, "agent.sock")
+	t.Setenv(agent.SocketEnvVar, socketPath)
+	t.Setenv(agentDisableEnvVar, "")
+
+	// The app has no readable key: only the agent can serve it
+	app := &config.GitHubApp{Name: "org-app", AppID: 1, InstallationID: 10, APIURL: "http://127.0.0.1:1"}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{*app}}
+
+	server := agent.NewServer(socketPath, func(request agent.Request) (*agent.Token, error) {
+		if !request.Username {
+			return nil, errors.New("username not requested")
+		}
+		token := &agent.Token{Token: "ghs_agent", ExpiresAt: time.Now().Add(time.Hour)}
+		// An agent that predates usernames leaves it empty
+		if request.Repository != "github.com/org/legacy" {
+			token.Username = "org-app-slug[bot]"
+		}
+		return token, nil
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() { _ = server.Serve() }()
+	defer func() { _ = server.Close() }()
+
+	token, username, err := getAppCredential(cfg, app, "github.com/org/repo", config.TokenScope{})
+	if err != nil {
+		t.Fatalf("getAppCredential() error = %v", err)
+	}
+	if token.Token != "ghs_agent" || username != "org-app-slug[bot]" {
+		t.Errorf("getAppCredential() = %q, %q, want the agent's token and username", token.Token, username)
+	}
+
+	// Without a username from the agent or a cached identity, the token is
+	// presented as x-access-token
+	if _, username, err := getAppCredential(cfg, app, "github.com/org/legacy", config.TokenScope{}); err != nil ||
+		username != "x-access-token" {
+		t.Errorf("getAppCredential() username = %q, %v, want x-access-token", username, err)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/agent"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/resolver"
+	"github.com/spf13/cobra"
+)
+
+func NewCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage cached installation tokens",
+		Long: `Manage installation tokens cached in memory, in the persistent token cache
+and by a running credential agent.`,
+	}
+
+	cmd.AddCommand(newCacheClearCmd())
+
+	return cmd
+}
+
+func newCacheClearCmd() *cobra.Command {
+	var (
+		repo  string
+		appID int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Evict cached installation tokens",
+		Long: `Evict cached installation tokens so the next git operation mints a fresh one.
+
+Useful after changing an app's permissions or repository access on GitHub,
+when a cached token no longer reflects what the installation grants.
+Without flags, every cached token is evicted.`,
+		Example: `  # Evict every cached token
+  gh app-auth cache clear
+
+  # Evict the token served for a repository
+  gh app-auth cache clear --repo github.com/myorg/private-repo
+
+  # Evict tokens of a specific app
+  gh app-auth cache clear --app-id 123456`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cacheClearRun(repo, appID)
+		},
+	}
+
+	cmd.Flags().StringVar(&repo, "repo", "", "Evict the token served for this repository")
+	cmd.Flags().Int64Var(&appID, "app-id", 0, "Evict tokens of this GitHub App ID")
+	cmd.MarkFlagsMutuallyExclusive("repo", "app-id")
+
+	return cmd
+}
+
+func cacheClearRun(repo string, appID int64) error {
+	if appID < 0 {
+		return fmt.Errorf("invalid app ID: %d", appID)
+	}
+
+	if repo != "" {
+		return cacheClearRepository(repo)
+	}
+
+	removed, err := evictCachedTokens(appID)
+	if err != nil {
+		return err
+	}
+
+	if appID == 0 {
+		fmt.Printf("✅ Cleared %d cached token(s)\n", removed)
+	} else {
+		fmt.Printf("✅ Cleared %d cached token(s) for GitHub App %d\n", removed, appID)
+	}
+	return nil
+}
+
+// cacheClearRepository evicts the token git-credential serves for a repository
+func cacheClearRepository(repo string) error {
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+	repoURL, err := canonicalRepository(repo)
+	if err != nil {
+		return fmt.Errorf("invalid repository %q: %w", repo, err)
+	}
+	decision, err := resolver.Resolve(cfg, resolver.Request{URL: repoURL})
+	if err != nil {
+		return fmt.Errorf("failed to match repository: %w", err)
+	}
+	if decision.PAT != nil {
+		fmt.Printf("Repository %s uses personal access token '%s'; nothing to clear\n", repo, decision.PAT.Name)
+		return nil
+	}
+	if decision.App == nil {
+		return fmt.Errorf("no GitHub App configured for repository: %s", repo)
+	}
+
+	removed, err := evictRepositoryToken(decision.App, repoURL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Cleared %d cached token(s) for %s\n", removed, repo)
+	return nil
+}
+
+// evictCachedTokens removes tokens for appID (every token when appID is 0)
+// from the persistent cache and from a running agent, along with resolved
+// installations and app identities, and returns how many tokens were removed
+func evictCachedTokens(appID int64) (int, error) {
+	// The persistent cache is always cleared, even if it has since been
+	// disabled, so that re-enabling it cannot resurrect stale tokens
+	authenticator := auth.NewAuthenticator()
+	authenticator.EnablePersistentCache()
+	authenticator.PersistResolvedInstallations()
+	authenticator.PersistAppIdentities()
+
+	removed, err := authenticator.EvictTokens(appID)
+	if err != nil {
+		return removed, err
+	}
+
+	evicted, err := evictFromAgent(agent.Request{AppID: appID})
+	return removed + evicted, err
+}
+
+// evictRepositoryToken removes the token git-credential serves for repoURL
+// through app from the persistent cache and from a running agent, leaving the
+// app's other tokens alone, and returns how many tokens were removed
+func evictRepositoryToken(app *config.GitHubApp, repoURL string) (int, error) {
+	scope := matcher.ResolveTokenScope(app, repoURL, app.NarrowsToRepository())
+
+	authenticator := auth.NewAuthenticator()
+	authenticator.EnablePersistentCache()
+	authenticator.PersistResolvedInstallations()
+
+	removed, err := authenticator.EvictToken(app, repoURL, scope)
+	if err != nil {
+		return removed, err
+	}
+
+	evicted, err := evictFromAgent(agent.Request{
+		AppName:        app.Name,
+		AppID:          app.AppID,
+		InstallationID: app.InstallationID,
+		Repository:     repoURL,
+		Permissions:    scope.Permissions,
+		Repositories:   scope.Repositories,
+	})
+	return removed + evicted, err
+}
+
+// evictFromAgent sends an evict request to a running agent and returns how
+// many tokens it dropped; no agent running is not an error
+func evictFromAgent(request agent.Request) (int, error) {
+	if os.Getenv(agentDisableEnvVar) != "" {
+		return 0, nil
+	}
+
+	evicted, err := agent.NewClient(agent.DefaultSocketPath()).EvictToken(request)
+	if err != nil && !errors.Is(err, agent.ErrNotRunning) {
+		logger.FlowStep("agent_evict_failed", map[string]interface{}{
+			"app_id": request.AppID,
+			"error":  err.Error(),
+		})
+		return 0, fmt.Errorf("failed to clear agent cache: %w", err)
+	}
+	return evicted, nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/agent"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// setupTokenCacheTest points HOME at a temporary directory, forces the
+// encrypted filesystem secret store and returns the persistent token cache that
+// evictCachedTokens clears
+func setupTokenCacheTest(t *testing.T) *cache.PersistentCache {
+	t.Helper()
+
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	t.Cleanup(func() { keyring.MockInitWithError(nil) })
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(agentDisableEnvVar, "1")
+	t.Setenv(secrets.PassphraseEnv, "test-passphrase")
+
+	configDir := filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth")
+	return cache.NewPersistentCache(filepath.Join(configDir, "cache", "tokens"), secrets.NewManager(configDir))
+}
+
+func TestNewCacheCmd(t *testing.T) {
+	cmd := NewCacheCmd()
+
+	clear, _, err := cmd.Find([]string{"clear"})
+	if err != nil || clear.Name() != "clear" {
+		t.Fatalf("Find(clear) = %v, %v", clear, err)
+	}
+	for _, flag := range []string{"repo", "app-id"} {
+		if clear.Flags().Lookup(flag) == nil {
+			t.Errorf("Expected --%s flag on clear", flag)
+		}
+	}
+
+	cmd.SetArgs([]string{"clear", "--repo", "github.com/org/repo", "--app-id", "1"})
+	cmd.SetOut(&strings.Builder{})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err == nil {
+		t.Error("Expected --repo and --app-id to be mutually exclusive")
+	}
+}
+
+func TestEvictCachedTokens(t *testing.T) {
+	persistent := setupTokenCacheTest(t)
+
+	for _, key := range []string{cache.CreateCacheKey(1, 10), cache.CreateCacheKey(2, 10)} {
+		if err := persistent.Set(key, "ghs_"+key, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	removed, err := evictCachedTokens(1)
+	if err != nil {
+		t.Fatalf("evictCachedTokens() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("evictCachedTokens() = %d, want 1", removed)
+	}
+	if _, found := persistent.Get(cache.CreateCacheKey(1, 10)); found {
+		t.Error("Expected app 1 token to be evicted")
+	}
+	if _, found := persistent.Get(cache.CreateCacheKey(2, 10)); !found {
+		t.Error("Expected app 2 token to remain")
+	}
+
+	if err := clearAllCachedTokens(); err != nil {
+		t.Fatalf("clearAllCachedTokens() error = %v", err)
+	}
+	if _, found := persistent.Get(cache.CreateCacheKey(2, 10)); found {
+		t.Error("Expected all tokens to be evicted")
+	}
+}
+
+func TestEvictCachedTokens_Agent(t *testing.T) {
+	setupTokenCacheTest(t)
+
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socketPath := filepath.Join(dir, "agent.sock")
+	t.Setenv(agent.SocketEnvVar, socketPath)
+	t.Setenv(agentDisableEnvVar, "")
+
+	server := agent.NewServer(socketPath, nil)
+	var evictedApp int64 = -1
+	server.SetEvictHandler(func(request agent.Request) (int, error) {
+		evictedApp = request.AppID
+		return 2, nil
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() { _ = server.Serve() }()
+	defer func() { _ = server.Close() }()
+
+	removed, err := evictCachedTokens(7)
+	if err != nil {
+		t.Fatalf("evictCachedTokens() error = %v", err)
+	}
+	if removed != 2 || evictedApp != 7 {
+		t.Errorf("evictCachedTokens() = %d for app %d, want 2 for app 7", removed, evictedApp)
+	}
+}
+
+func TestCacheClearRun_Repo(t *testing.T) {
+	persistent := setupTokenCacheTest(t)
+
+	cfg := &config.Config{
+		Version: "1.0",
+		GitHubApps: []config.GitHubApp{
+			{
+				Name:             "Org App",
+				AppID:            1,
+				InstallationID:   10,
+				Patterns:         []string{"github.com/org/*"},
+				PrivateKeySource: config.PrivateKeySourceKeyring,
+			},
+		},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+
+	// git-credential narrows tokens to the repository, so each has its own key
+	repoKey := cache.CreateScopedCacheKey(1, 10, config.TokenScope{Repositories: []string{"repo"}}.Key())
+	otherKey := cache.CreateScopedCacheKey(1, 10, config.TokenScope{Repositories: []string{"other"}}.Key())
+	for _, key := range []string{repoKey, otherKey, cache.CreateCacheKey(2, 10)} {
+		if err := persistent.Set(key, "ghs_"+key, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	if err := cacheClearRun("github.com/org/repo", 0); err != nil {
+		t.Fatalf("cacheClearRun() error = %v", err)
+	}
+	if _, found := persistent.Get(repoKey); found {
+		t.Error("Expected the repository's token to be evicted")
+	}
+	for _, key := range []string{otherKey, cache.CreateCacheKey(2, 10)} {
+		if _, found := persistent.Get(key); !found {
+			t.Errorf("Expected token %s to remain", key)
+		}
+	}
+
+	if err := cacheClearRun("github.com/unmatched/repo", 0); err == nil {
+		t.Error("Expected error for repository without a configured app")
+	}
+	if err := cacheClearRun("", -1); err == nil {
+		t.Error("Expected error for negative app ID")
+	}
+}
@@ -3,8 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"github.com/spf13/cobra"
 )
 
@@ -17,16 +19,29 @@ func NewConfigCmd() *cobra.Command {
 		Short: "Show configuration file location and content",
 		Long: `Display the configuration file path and optionally its content.
 
-The configuration file location follows this priority:
-  1. GH_APP_AUTH_CONFIG environment variable (if set)
-  2. Default: ~/.config/gh/extensions/gh-app-auth/config.yml`,
+Configuration is merged from several files, later ones taking precedence:
+the system file (/etc/gh-app-auth/config.yml or GH_APP_AUTH_SYSTEM_CONFIG),
+the *.yml, *.yaml and *.json fragments in the config.d directory next to the
+user file (in lexical order), the user file, and the .gh-app-auth.yml at the
+root of the current repository, which may only add patterns to existing
+entries. Commands that change the configuration only write the user file,
+which takes precedence over every fragment, so their changes override
+provisioned entries; provisioning tools should own a fragment instead.
+--show prints the merged result, noting which file each entry came from.
+
+The user configuration file location follows this priority:
+  1. The global --config flag
+  2. GH_APP_AUTH_CONFIG environment variable (if set)
+  3. Default: config.yml in gh's configuration directory, under
+     extensions/gh-app-auth. gh's directory is GH_CONFIG_DIR if set, else
+     $XDG_CONFIG_HOME/gh, else ~/.config/gh (%AppData%\GitHub CLI on Windows).`,
 		Example: `  # Show config file path
   gh app-auth config
 
   # Show config file path only
   gh app-auth config --path
 
-  # Show config file content
+  # Show the merged configuration and where each entry came from
   gh app-auth config --show`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return configRun(showPath, showContent)
@@ -34,7 +49,7 @@ The configuration file location follows this priority:
 	}
 
 	cmd.Flags().BoolVarP(&showPath, "path", "p", false, "Show only the config file path")
-	cmd.Flags().BoolVarP(&showContent, "show", "s", false, "Show the config file content")
+	cmd.Flags().BoolVarP(&showContent, "show", "s", false, "Show the merged configuration with the file of each entry")
 
 	return cmd
 }
@@ -54,49 +69,68 @@ func configRun(showPath, showContent bool) error {
 	// Default: show path and status
 	if !showContent {
 		fmt.Printf("📁 Configuration file: %s\n", configPath)
-		if envPath := os.Getenv("GH_APP_AUTH_CONFIG"); envPath != "" {
+		if configFileFlag != "" {
+			fmt.Printf("   (set via --config flag)\n")
+		} else if envPath := os.Getenv(paths.ConfigFileEnv); envPath != "" {
 			fmt.Printf("   (set via GH_APP_AUTH_CONFIG environment variable)\n")
 		}
 		if exists {
 			fmt.Printf("   Status: ✅ exists\n")
 		} else {
 			fmt.Printf("   Status: ⚠️  not found\n")
+		}
+		displayOtherLayers()
+		if !exists {
 			fmt.Printf("\n💡 Run 'gh app-auth setup' to create a configuration.\n")
 		}
 		return nil
 	}
 
-	// Show content
-	if !exists {
+	// Show the merged content of all layers
+	var existing []string
+	for _, layer := range config.NewDefaultLoader().Layers() {
+		if fileExists(layer.Path) {
+			existing = append(existing, layer.Path)
+		}
+	}
+	if len(existing) == 0 {
 		return fmt.Errorf("configuration file not found: %s\nRun 'gh app-auth setup' to create one", configPath)
 	}
 
-	content, err := os.ReadFile(configPath)
+	cfg, err := config.LoadOrCreate()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	content, err := cfg.AnnotatedYAML()
 	if err != nil {
-		return fmt.Errorf("failed to read configuration file: %w", err)
+		return err
 	}
 
-	fmt.Printf("# Configuration file: %s\n", configPath)
+	fmt.Printf("# Configuration file: %s\n", strings.Join(existing, ", "))
 	fmt.Println("---")
 	fmt.Print(string(content))
 
 	return nil
 }
 
-// getConfigPath returns the configuration file path
-func getConfigPath() string {
-	// Check environment variable first
-	if path := os.Getenv("GH_APP_AUTH_CONFIG"); path != "" {
-		return path
-	}
-
-	// Use default path
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return ""
+// displayOtherLayers shows the system, fragment and repository files merged
+// with the user's configuration file
+func displayOtherLayers() {
+	for _, layer := range config.NewDefaultLoader().Layers() {
+		if layer.Layer == config.LayerUser {
+			continue
+		}
+		status := "not found"
+		if fileExists(layer.Path) {
+			status = "✅ merged"
+		}
+		fmt.Printf("   %s layer: %s (%s)\n", layer.Layer, layer.Path, status)
 	}
+}
 
-	return filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth", "config.yml")
+// getConfigPath returns the configuration file path
+func getConfigPath() string {
+	return paths.ConfigFile()
 }
 
 // fileExists checks if a file exists
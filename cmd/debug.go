@@ -11,11 +11,13 @@ import (
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
 const (
-	gitHubAPIHost = "github.com"
+	gitHubAPIHost = hosts.GitHub
 )
 
 func NewDebugCmd() *cobra.Command {
@@ -43,6 +45,7 @@ func newListInstallationsCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to load configuration: %w", err)
 			}
+			factory := transport.FromConfig(cfg)
 
 			apps := make([]*config.GitHubApp, 0, len(cfg.GitHubApps))
 			if cmd.Flags().Changed("app-id") {
@@ -69,6 +72,8 @@ func newListInstallationsCmd() *cobra.Command {
 				fmt.Printf("=== %s (App ID %d) ===\n", appDisplayName(app), app.AppID)
 
 				authenticator := auth.NewAuthenticator()
+				authenticator.SetTransport(factory)
+				authenticator.ConfigureSecretBackends(cfg.SecretBackends)
 				jwtToken, err := authenticator.GenerateJWTForApp(app)
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
@@ -80,7 +85,7 @@ func newListInstallationsCmd() *cobra.Command {
 
 				fmt.Println("  JWT generated")
 
-				installations, err := listInstallations(jwtToken)
+				installations, err := listInstallations(factory, jwtToken, app.APIBaseURL(""))
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return fmt.Errorf("failed to list installations for app %d: %w", app.AppID, err)
@@ -130,6 +135,7 @@ func newListInstallationReposCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to load configuration: %w", err)
 			}
+			factory := transport.FromConfig(cfg)
 
 			apps := make([]*config.GitHubApp, 0, len(cfg.GitHubApps))
 			if cmd.Flags().Changed("app-id") {
@@ -184,6 +190,8 @@ func newListInstallationReposCmd() *cobra.Command {
 				}
 
 				authenticator := auth.NewAuthenticator()
+				authenticator.SetTransport(factory)
+				authenticator.ConfigureSecretBackends(cfg.SecretBackends)
 				jwtToken, err := authenticator.GenerateJWTForApp(app)
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
@@ -194,7 +202,7 @@ func newListInstallationReposCmd() *cobra.Command {
 				}
 
 				repoURL := fmt.Sprintf("https://%s", host)
-				installationToken, err := authenticator.GetInstallationToken(jwtToken, app.InstallationID, repoURL)
+				installationToken, err := authenticator.GetAppInstallationToken(jwtToken, app, repoURL)
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return fmt.Errorf("failed to obtain installation token for app %d: %w", app.AppID, err)
@@ -203,7 +211,7 @@ func newListInstallationReposCmd() *cobra.Command {
 					continue
 				}
 
-				repos, err := listInstallationRepositories(installationToken, host)
+				repos, err := listInstallationRepositories(factory, installationToken.Token, app.APIBaseURL(repoURL))
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return err
@@ -255,8 +263,8 @@ type account struct {
 	Type  string `json:"type"`
 }
 
-func listInstallations(jwtToken string) ([]installation, error) {
-	apiURL := "https://api.github.com/app/installations"
+func listInstallations(factory *transport.Factory, jwtToken, apiBaseURL string) ([]installation, error) {
+	apiURL := apiBaseURL + "/app/installations"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -269,7 +277,10 @@ func listInstallations(jwtToken string) ([]installation, error) {
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
+	client, err := factory.Client(apiURL)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
@@ -302,11 +313,10 @@ type installationRepository struct {
 	HTMLURL     string `json:"html_url"`
 }
 
-func listInstallationRepositories(token, host string) ([]installationRepository, error) {
-	apiURL := fmt.Sprintf("https://%s/api/v3/installation/repositories", host)
-	if host == gitHubAPIHost {
-		apiURL = "https://api.github.com/installation/repositories"
-	}
+func listInstallationRepositories(
+	factory *transport.Factory, token, apiBaseURL string,
+) ([]installationRepository, error) {
+	apiURL := apiBaseURL + "/installation/repositories"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -319,7 +329,10 @@ func listInstallationRepositories(token, host string) ([]installationRepository,
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client := &http.Client{}
+	client, err := factory.Client(apiURL)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
@@ -2,15 +2,18 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
-	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/resolver"
 	"github.com/cli/go-gh/v2/pkg/repository"
 	"github.com/spf13/cobra"
 )
@@ -19,14 +22,22 @@ type execCredentialRequest struct {
 	Repository     string
 	AppID          int64
 	InstallationID int64
+	// Permissions and RepositoryScope narrow GitHub App tokens (empty for config defaults)
+	Permissions     map[string]string
+	RepositoryScope []string
 }
 
 type execCredential struct {
 	Token      string
 	Host       string
 	Repository string
+	// ExpiresAt is the token expiry; zero for credentials without one (PATs)
+	ExpiresAt time.Time
 }
 
+// execTokenExpiryVariable exposes the token expiry to the child process
+const execTokenExpiryVariable = "GH_APP_AUTH_TOKEN_EXPIRES_AT"
+
 type execCredentialResolver func(execCredentialRequest) (execCredential, error)
 
 type execCommandRunner func(
@@ -48,6 +59,8 @@ func newExecCmd(resolveCredential execCredentialResolver, runCommand execCommand
 		repoFlag           string
 		appIDFlag          int64
 		installationIDFlag int64
+		permissionFlags    []string
+		repoScopeFlags     []string
 	)
 
 	cmd := &cobra.Command{
@@ -56,7 +69,8 @@ func newExecCmd(resolveCredential execCredentialResolver, runCommand execCommand
 		Long: `Run a command with a short-lived token from a configured GitHub App
 or PAT. Select credentials by repository, App ID, or installation ID. The token
 is exposed only to the child process through the environment and is never
-printed by gh-app-auth.`,
+printed by gh-app-auth. For GitHub App tokens, GH_APP_AUTH_TOKEN_EXPIRES_AT
+holds the token expiry as an RFC 3339 UTC timestamp.`,
 		Example: `  # Call the GitHub API for the current repository
   gh app-auth exec -- gh api repos/{owner}/{repo}
 
@@ -64,7 +78,11 @@ printed by gh-app-auth.`,
   gh app-auth exec --repo github.com/myorg/myrepo -- gh pr list
 
   # Run a repository-independent API command as a configured App installation
-  gh app-auth exec --app-id 123456 --installation-id 789012 -- gh api /installation/repositories`,
+  gh app-auth exec --app-id 123456 --installation-id 789012 -- gh api /installation/repositories
+
+  # Clone with a token limited to reading one repository
+  gh app-auth exec --repo github.com/myorg/myrepo --permission contents=read --repo-scope myrepo -- \
+    git clone https://github.com/myorg/myrepo`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if cmd.Flags().Changed("app-id") && appIDFlag <= 0 {
@@ -78,6 +96,9 @@ printed by gh-app-auth.`,
 			if err != nil {
 				return err
 			}
+			if err := applyExecTokenScope(&request, permissionFlags, repoScopeFlags); err != nil {
+				return err
+			}
 
 			credential, err := resolveCredential(request)
 			if err != nil {
@@ -111,6 +132,18 @@ printed by gh-app-auth.`,
 	)
 	cmd.Flags().Int64Var(&appIDFlag, "app-id", 0, "Configured GitHub App ID to authenticate with")
 	cmd.Flags().Int64Var(&installationIDFlag, "installation-id", 0, "GitHub App installation ID to authenticate with")
+	cmd.Flags().StringArrayVar(
+		&permissionFlags,
+		"permission",
+		nil,
+		"Narrow the GitHub App token to a permission, as name=level (repeatable, e.g. contents=read)",
+	)
+	cmd.Flags().StringSliceVar(
+		&repoScopeFlags,
+		"repo-scope",
+		nil,
+		"Narrow the GitHub App token to these repositories (repeatable or comma-separated)",
+	)
 
 	return cmd
 }
@@ -146,6 +179,40 @@ func newExecCredentialRequest(repoURL string, appID, installationID int64) (exec
 	}, nil
 }
 
+// applyExecTokenScope parses --permission and --repo-scope into the request
+func applyExecTokenScope(request *execCredentialRequest, permissions, repositories []string) error {
+	if len(permissions) > 0 {
+		request.Permissions = make(map[string]string, len(permissions))
+		for _, permission := range permissions {
+			name, level, found := strings.Cut(permission, "=")
+			if !found {
+				return fmt.Errorf("invalid --permission %q: expected name=level", permission)
+			}
+			request.Permissions[strings.TrimSpace(name)] = strings.TrimSpace(level)
+		}
+	}
+	request.RepositoryScope = repositories
+
+	scope := config.TokenScope{Permissions: request.Permissions, Repositories: request.RepositoryScope}
+	if err := scope.Validate(); err != nil {
+		return fmt.Errorf("invalid token scope: %w", err)
+	}
+	return nil
+}
+
+// execTokenScope resolves the configured scope for the target and applies the
+// command-line overrides on top of it
+func execTokenScope(app *config.GitHubApp, target string, request execCredentialRequest) config.TokenScope {
+	scope := matcher.ResolveTokenScope(app, target, false)
+	if len(request.Permissions) > 0 {
+		scope.Permissions = request.Permissions
+	}
+	if len(request.RepositoryScope) > 0 {
+		scope.Repositories = request.RepositoryScope
+	}
+	return scope
+}
+
 func resolveExecCredential(request execCredentialRequest) (execCredential, error) {
 	cfg, err := loadCredentialConfig()
 	if err != nil {
@@ -153,7 +220,7 @@ func resolveExecCredential(request execCredentialRequest) (execCredential, error
 	}
 
 	if request.AppID == 0 && request.InstallationID == 0 {
-		return resolveRepositoryCredential(cfg, request.Repository)
+		return resolveRepositoryCredential(cfg, request)
 	}
 
 	selectedApp, err := selectExecApp(cfg, request)
@@ -171,12 +238,17 @@ func resolveExecCredential(request execCredentialRequest) (execCredential, error
 		return execCredential{}, err
 	}
 
-	token, _, err := auth.NewAuthenticator().GetCredentials(&app, tokenTarget)
+	token, err := getAppToken(cfg, &app, tokenTarget, execTokenScope(&app, tokenTarget, request))
 	if err != nil {
 		return execCredential{}, fmt.Errorf("failed to get GitHub App credentials: %w", err)
 	}
 
-	return execCredential{Token: token, Host: host, Repository: request.Repository}, nil
+	return execCredential{
+		Token:      token.Token,
+		Host:       host,
+		Repository: request.Repository,
+		ExpiresAt:  token.ExpiresAt,
+	}, nil
 }
 
 func execCredentialTarget(app config.GitHubApp, repoURL string) (string, string, error) {
@@ -198,7 +270,8 @@ func execCredentialTarget(app config.GitHubApp, repoURL string) (string, string,
 	return host, host, nil
 }
 
-func resolveRepositoryCredential(cfg *config.Config, repoURL string) (execCredential, error) {
+func resolveRepositoryCredential(cfg *config.Config, request execCredentialRequest) (execCredential, error) {
+	repoURL := request.Repository
 	matchedApp, matchedPAT, err := findMatchingCredential(cfg, repoURL)
 	if err != nil {
 		return execCredential{}, err
@@ -213,10 +286,12 @@ func resolveRepositoryCredential(cfg *config.Config, repoURL string) (execCreden
 	}
 
 	if matchedPAT != nil {
-		secretManager, managerErr := newDefaultSecretsManager()
-		if managerErr != nil {
-			return execCredential{}, managerErr
+		if len(request.Permissions) > 0 || len(request.RepositoryScope) > 0 {
+			return execCredential{}, fmt.Errorf(
+				"--permission and --repo-scope require a GitHub App, but %s matches PAT %q", repoURL, matchedPAT.Name,
+			)
 		}
+		secretManager := newDefaultSecretsManager(cfg)
 		token, tokenErr := matchedPAT.GetPAT(secretManager)
 		if tokenErr != nil {
 			return execCredential{}, fmt.Errorf("failed to get PAT: %w", tokenErr)
@@ -224,85 +299,27 @@ func resolveRepositoryCredential(cfg *config.Config, repoURL string) (execCreden
 		return execCredential{Token: token, Host: repo.Host, Repository: repoURL}, nil
 	}
 
-	token, _, err := auth.NewAuthenticator().GetCredentials(matchedApp, repoURL)
+	token, err := getAppToken(cfg, matchedApp, repoURL, execTokenScope(matchedApp, repoURL, request))
 	if err != nil {
 		return execCredential{}, fmt.Errorf("failed to get GitHub App credentials: %w", err)
 	}
-	return execCredential{Token: token, Host: repo.Host, Repository: repoURL}, nil
+	return execCredential{Token: token.Token, Host: repo.Host, Repository: repoURL, ExpiresAt: token.ExpiresAt}, nil
 }
 
+// selectExecApp resolves --app-id and --installation-id to a configured app
 func selectExecApp(cfg *config.Config, request execCredentialRequest) (*config.GitHubApp, error) {
-	candidates := execAppCandidates(cfg.GitHubApps, request)
-	if len(candidates) == 0 {
-		return nil, execAppNotFoundError(request)
-	}
-	if len(candidates) == 1 {
-		return &candidates[0], nil
-	}
-
-	if request.Repository != "" {
-		matchedApp, err := matcher.NewMatcher(candidates).Match(request.Repository)
-		if err != nil {
-			return nil, fmt.Errorf("failed to match selected GitHub App to repository: %w", err)
-		}
-		if matchedApp != nil {
-			return matchedApp, nil
-		}
-	}
-
-	return nil, ambiguousExecAppError(request)
-}
-
-func execAppCandidates(apps []config.GitHubApp, request execCredentialRequest) []config.GitHubApp {
-	candidates := matchingExecApps(apps, request)
-	if request.AppID == 0 || request.InstallationID == 0 {
-		return candidates
-	}
-
-	exact := matchingExecInstallations(candidates, request.InstallationID)
-	if len(exact) > 0 {
-		return exact
-	}
-	return candidates
-}
-
-func matchingExecApps(apps []config.GitHubApp, request execCredentialRequest) []config.GitHubApp {
-	candidates := make([]config.GitHubApp, 0, len(apps))
-	for _, app := range apps {
-		if request.AppID != 0 && app.AppID != request.AppID {
-			continue
-		}
-		if request.AppID == 0 && request.InstallationID != 0 && app.InstallationID != request.InstallationID {
-			continue
-		}
-		candidates = append(candidates, app)
-	}
-	return candidates
-}
-
-func matchingExecInstallations(apps []config.GitHubApp, installationID int64) []config.GitHubApp {
-	matches := make([]config.GitHubApp, 0, len(apps))
-	for _, app := range apps {
-		if app.InstallationID == installationID {
-			matches = append(matches, app)
-		}
+	decision, err := resolver.Resolve(cfg, resolver.Request{
+		URL:            request.Repository,
+		AppID:          request.AppID,
+		InstallationID: request.InstallationID,
+	})
+	if errors.Is(err, resolver.ErrAmbiguous) {
+		return nil, ambiguousExecAppError(request)
 	}
-	return matches
-}
-
-func execAppNotFoundError(request execCredentialRequest) error {
-	switch {
-	case request.AppID != 0 && request.InstallationID != 0:
-		return fmt.Errorf(
-			"no configured GitHub App matches app ID %d and installation ID %d",
-			request.AppID,
-			request.InstallationID,
-		)
-	case request.AppID != 0:
-		return fmt.Errorf("no configured GitHub App matches app ID %d", request.AppID)
-	default:
-		return fmt.Errorf("no configured GitHub App matches installation ID %d", request.InstallationID)
+	if err != nil {
+		return nil, err
 	}
+	return decision.App, nil
 }
 
 func ambiguousExecAppError(request execCredentialRequest) error {
@@ -316,24 +333,16 @@ func ambiguousExecAppError(request execCredentialRequest) error {
 	}
 }
 
+// inferExecHost returns the host all patterns of an app share
 func inferExecHost(patterns []string) (string, error) {
 	host := ""
 	for _, pattern := range patterns {
-		candidate := strings.TrimSpace(pattern)
+		candidate := hosts.Normalize(pattern)
 		if candidate == "" {
 			continue
 		}
-
-		info, err := matcher.GetRepositoryInfo(candidate)
-		if err == nil {
-			candidate = info.Host
-		} else {
-			candidate = strings.TrimPrefix(candidate, "https://")
-			candidate = strings.TrimPrefix(candidate, "http://")
-			candidate = strings.TrimSuffix(candidate, "/")
-			if strings.Contains(candidate, "/") || strings.ContainsAny(candidate, "*") {
-				return "", fmt.Errorf("cannot infer host from GitHub App pattern %q; use --repo", pattern)
-			}
+		if strings.Contains(candidate, "*") {
+			return "", fmt.Errorf("cannot infer host from GitHub App pattern %q; use --repo", pattern)
 		}
 
 		if host != "" && candidate != host {
@@ -356,9 +365,10 @@ func execEnvironment(current []string, credential execCredential) []string {
 		"GITHUB_ENTERPRISE_TOKEN": {},
 		"GH_HOST":                 {},
 		"GH_REPO":                 {},
+		execTokenExpiryVariable:   {},
 	}
 
-	env := make([]string, 0, len(current)+3)
+	env := make([]string, 0, len(current)+4)
 	for _, entry := range current {
 		key, _, _ := strings.Cut(entry, "=")
 		if _, found := blocked[key]; !found {
@@ -367,7 +377,7 @@ func execEnvironment(current []string, credential execCredential) []string {
 	}
 
 	tokenVariable := "GH_ENTERPRISE_TOKEN"
-	if credential.Host == gitHubAPIHost || strings.HasSuffix(credential.Host, ".ghe.com") {
+	if !hosts.IsEnterpriseServer(credential.Host) {
 		tokenVariable = "GH_TOKEN"
 	}
 
@@ -375,6 +385,9 @@ func execEnvironment(current []string, credential execCredential) []string {
 	if credential.Repository != "" {
 		env = append(env, "GH_REPO="+credential.Repository)
 	}
+	if !credential.ExpiresAt.IsZero() {
+		env = append(env, execTokenExpiryVariable+"="+credential.ExpiresAt.UTC().Format(time.RFC3339))
+	}
 	return env
 }
 
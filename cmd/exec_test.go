@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil"
 )
 
 func TestExecCommand(t *testing.T) {
@@ -105,6 +108,95 @@ func TestExecCommand(t *testing.T) {
 	})
 }
 
+func TestExecCommandTokenScopeFlags(t *testing.T) {
+	noopRunner := func(context.Context, string, []string, []string, io.Reader, io.Writer, io.Writer) error {
+		return nil
+	}
+
+	t.Run("flags are passed to the resolver", func(t *testing.T) {
+		var resolvedRequest execCredentialRequest
+		cmd := newExecCmd(
+			func(request execCredentialRequest) (execCredential, error) {
+				resolvedRequest = request
+				return execCredential{Token: "scoped-token", Host: gitHubAPIHost}, nil
+			},
+			noopRunner,
+		)
+		cmd.SetArgs([]string{
+			"--repo", "github.com/myorg/myrepo",
+			"--permission", "contents=read",
+			"--permission", "metadata = read",
+			"--repo-scope", "myrepo,other",
+			"--", "git", "fetch",
+		})
+
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		want := map[string]string{"contents": "read", "metadata": "read"}
+		if !reflect.DeepEqual(resolvedRequest.Permissions, want) {
+			t.Errorf("Permissions = %v, want %v", resolvedRequest.Permissions, want)
+		}
+		if got := strings.Join(resolvedRequest.RepositoryScope, ","); got != "myrepo,other" {
+			t.Errorf("RepositoryScope = %q, want %q", got, "myrepo,other")
+		}
+	})
+
+	invalid := []struct {
+		name string
+		args []string
+	}{
+		{name: "missing level", args: []string{"--permission", "contents"}},
+		{name: "unknown level", args: []string{"--permission", "contents=everything"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newExecCmd(
+				func(execCredentialRequest) (execCredential, error) {
+					t.Fatal("resolver should not be called")
+					return execCredential{}, nil
+				},
+				noopRunner,
+			)
+			cmd.SetArgs(append(append([]string{"--repo", "github.com/myorg/myrepo"}, tt.args...), "--", "true"))
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			if err := cmd.Execute(); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestExecTokenScope(t *testing.T) {
+	app := &config.GitHubApp{
+		Name:         "ci-app",
+		Permissions:  map[string]string{"contents": "write"},
+		Repositories: []string{"myrepo", "other"},
+	}
+
+	t.Run("configured scope without overrides", func(t *testing.T) {
+		scope := execTokenScope(app, "github.com/myorg/myrepo", execCredentialRequest{})
+		if scope.Permissions["contents"] != "write" || len(scope.Repositories) != 2 {
+			t.Errorf("execTokenScope() = %+v, want configured scope", scope)
+		}
+	})
+
+	t.Run("flags override configured scope", func(t *testing.T) {
+		scope := execTokenScope(app, "github.com/myorg/myrepo", execCredentialRequest{
+			Permissions:     map[string]string{"contents": "read"},
+			RepositoryScope: []string{"myrepo"},
+		})
+		if scope.Permissions["contents"] != "read" {
+			t.Errorf("Permissions = %v, want contents=read", scope.Permissions)
+		}
+		if len(scope.Repositories) != 1 || scope.Repositories[0] != "myrepo" {
+			t.Errorf("Repositories = %v, want [myrepo]", scope.Repositories)
+		}
+	})
+}
+
 func TestExecCommandRejectsNonPositiveSelectors(t *testing.T) {
 	tests := []struct {
 		name string
@@ -234,6 +326,30 @@ func TestSelectExecApp(t *testing.T) {
 	}
 }
 
+func TestSelectExecApp_Conformance(t *testing.T) {
+	for _, tt := range testutil.ResolutionCases() {
+		if tt.AppID == 0 && tt.InstallationID == 0 {
+			continue // covered by the git-credential resolution
+		}
+		t.Run(tt.Name, func(t *testing.T) {
+			request := execCredentialRequest{Repository: tt.URL, AppID: tt.AppID, InstallationID: tt.InstallationID}
+			app, err := selectExecApp(testutil.ResolutionConfig(), request)
+			if tt.WantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.WantErr) {
+					t.Fatalf("selectExecApp() error = %v, want containing %q", err, tt.WantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectExecApp() error = %v", err)
+			}
+			if app.Name != tt.WantApp {
+				t.Errorf("selected app = %q, want %q", app.Name, tt.WantApp)
+			}
+		})
+	}
+}
+
 func TestInferExecHost(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -246,11 +362,21 @@ func TestInferExecHost(t *testing.T) {
 			patterns: []string{"github.com/org-a/*", "https://github.com/org-b/*"},
 			want:     gitHubAPIHost,
 		},
+		{
+			name:     "GHE.com tenant with scheme and SSH form",
+			patterns: []string{"https://octocorp.ghe.com/org/", "git@octocorp.ghe.com:other/repo.git"},
+			want:     "octocorp.ghe.com",
+		},
 		{
 			name:        "multiple hosts",
 			patterns:    []string{"github.com/org/*", "github.example.com/org/*"},
 			wantErrText: "spans multiple hosts",
 		},
+		{
+			name:        "wildcard host",
+			patterns:    []string{"*"},
+			wantErrText: "cannot infer host",
+		},
 		{
 			name:        "no patterns",
 			wantErrText: "has no host pattern",
@@ -287,11 +413,13 @@ func TestExecEnvironment(t *testing.T) {
 				"GITHUB_ENTERPRISE_TOKEN=old-github-enterprise-token",
 				"GH_HOST=old.example.com",
 				"GH_REPO=old/repo",
+				"GH_APP_AUTH_TOKEN_EXPIRES_AT=2000-01-01T00:00:00Z",
 			},
 			execCredential{
 				Token:      "new-token",
 				Host:       gitHubAPIHost,
 				Repository: "github.com/myorg/myrepo",
+				ExpiresAt:  time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
 			},
 		)
 
@@ -299,6 +427,7 @@ func TestExecEnvironment(t *testing.T) {
 		assertEnvironmentValue(t, env, "GH_TOKEN", "new-token")
 		assertEnvironmentValue(t, env, "GH_HOST", gitHubAPIHost)
 		assertEnvironmentValue(t, env, "GH_REPO", "github.com/myorg/myrepo")
+		assertEnvironmentValue(t, env, "GH_APP_AUTH_TOKEN_EXPIRES_AT", "2030-01-02T03:04:05Z")
 		assertEnvironmentMissing(t, env, "GITHUB_TOKEN")
 		assertEnvironmentMissing(t, env, "GH_ENTERPRISE_TOKEN")
 		assertEnvironmentMissing(t, env, "GITHUB_ENTERPRISE_TOKEN")
@@ -314,6 +443,7 @@ func TestExecEnvironment(t *testing.T) {
 		assertEnvironmentValue(t, env, "GH_HOST", "github.example.com")
 		assertEnvironmentMissing(t, env, "GH_TOKEN")
 		assertEnvironmentMissing(t, env, "GH_REPO")
+		assertEnvironmentMissing(t, env, "GH_APP_AUTH_TOKEN_EXPIRES_AT")
 	})
 
 	t.Run("GitHub Enterprise Cloud data residency", func(t *testing.T) {
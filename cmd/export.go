@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/bundle"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// bundlePassphraseEnv holds the passphrase of export bundles in scripts
+const bundlePassphraseEnv = "GH_APP_AUTH_BUNDLE_PASSPHRASE"
+
+type exportFlags struct {
+	out        string
+	recipients []string
+	appIDs     []int64
+	pats       []string
+}
+
+func NewExportCmd() *cobra.Command {
+	var flags exportFlags
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export configuration entries and their secrets to an encrypted bundle",
+		Long: `Write configured GitHub Apps and PATs, with their private keys and tokens,
+to an encrypted bundle that 'gh app-auth import' restores on another machine.
+
+The bundle is encrypted with age (https://age-encryption.org). By default it
+is encrypted with a passphrase, read from GH_APP_AUTH_BUNDLE_PASSPHRASE or
+asked for on the terminal. With --recipient it is encrypted to age public
+keys instead, and only the matching identities can import it.
+
+Keys read from a command, the environment or an external signer are not
+exported: the entry is, and the target machine must provide the same source.`,
+		Example: `  # Export everything, encrypted with a passphrase
+  gh app-auth export --out bundle.age
+
+  # Export one app for the holder of an age key
+  gh app-auth export --out bundle.age --app-id 123456 \
+    --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+		Args: cobra.NoArgs,
+		RunE: exportRun(&flags),
+	}
+
+	cmd.Flags().StringVarP(&flags.out, "out", "o", "", "Path of the bundle to write")
+	cmd.Flags().StringArrayVarP(&flags.recipients, "recipient", "r", nil,
+		"age public key to encrypt to (repeatable; default: passphrase)")
+	cmd.Flags().Int64SliceVar(&flags.appIDs, "app-id", nil, "Only export the GitHub App with this ID (repeatable)")
+	cmd.Flags().StringArrayVar(&flags.pats, "pat", nil, "Only export the PAT with this name (repeatable)")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func exportRun(flags *exportFlags) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		recipients, err := bundleRecipients(flags.recipients)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		secretMgr := newDefaultSecretsManager(cfg)
+		secretMgr.SetPassphrasePrompt(terminalPassphrasePrompt(false))
+
+		b, err := bundle.Export(cfg, secretMgr, bundle.Selection{AppIDs: flags.appIDs, PATNames: flags.pats})
+		if err != nil {
+			return fmt.Errorf("failed to export: %w", err)
+		}
+
+		if err := writeBundle(flags.out, b, recipients); err != nil {
+			return err
+		}
+
+		fmt.Printf("✅ Exported %d GitHub App(s) and %d PAT(s) to %s\n", len(b.GitHubApps), len(b.PATs), flags.out)
+		for _, app := range b.GitHubApps {
+			if app.PrivateKey == "" && len(app.Keys) == 0 {
+				fmt.Printf("   ℹ️  '%s' has no stored key (%s source): set it up on the target machine\n",
+					app.Config.Name, app.Config.PrivateKeySource)
+			}
+		}
+		fmt.Println("⚠️  The bundle holds secrets: delete it once imported")
+		return nil
+	}
+}
+
+// bundleRecipients parses --recipient values, or falls back to a passphrase
+func bundleRecipients(values []string) ([]age.Recipient, error) {
+	if len(values) > 0 {
+		recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(values, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --recipient: %w", err)
+		}
+		return recipients, nil
+	}
+
+	passphrase, err := bundlePassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid passphrase: %w", err)
+	}
+	return []age.Recipient{recipient}, nil
+}
+
+// bundlePassphrase reads the bundle passphrase from the environment or the
+// terminal
+func bundlePassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(bundlePassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	prompt := terminalPrompt("Bundle passphrase: ", confirm)
+	if prompt == nil {
+		return "", fmt.Errorf("no bundle passphrase: set %s or run from a terminal", bundlePassphraseEnv)
+	}
+	passphrase, err := prompt()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("bundle passphrase cannot be empty")
+	}
+	return passphrase, nil
+}
+
+// writeBundle encrypts b to a new file readable only by its owner
+func writeBundle(path string, b *bundle.Bundle, recipients []age.Recipient) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- path chosen by the user
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	if err := bundle.Encrypt(file, b, recipients...); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
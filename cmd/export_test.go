@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/bundle"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestWriteReadBundle_Passphrase(t *testing.T) {
+	t.Setenv(bundlePassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "bundle.age")
+
+	recipients, err := bundleRecipients(nil)
+	if err != nil {
+		t.Fatalf("bundleRecipients() error = %v", err)
+	}
+	b := &bundle.Bundle{
+		Format: bundle.Format,
+		PATs:   []bundle.PAT{{Config: config.PersonalAccessToken{Name: "pat"}, Token: "ghp_token"}},
+	}
+	if err := writeBundle(path, b, recipients); err != nil {
+		t.Fatalf("writeBundle() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("bundle mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	got, err := readBundle(path, nil)
+	if err != nil {
+		t.Fatalf("readBundle() error = %v", err)
+	}
+	if len(got.PATs) != 1 || got.PATs[0].Token != "ghp_token" {
+		t.Errorf("readBundle() = %+v, want the exported PAT", got)
+	}
+
+	t.Setenv(bundlePassphraseEnv, "wrong")
+	if _, err := readBundle(path, nil); err == nil {
+		t.Error("readBundle() with a wrong passphrase should fail")
+	}
+}
+
+func TestBundleRecipients_Invalid(t *testing.T) {
+	if _, err := bundleRecipients([]string{"not-a-recipient"}); err == nil {
+		t.Error("bundleRecipients() should reject an invalid recipient")
+	}
+}
@@ -6,16 +6,16 @@ import (
 	"io"
 	"net/url"
 	"os"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
-	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/resolver"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
@@ -126,9 +126,9 @@ func handleCredentialGet() error {
 
 	// Generate and output credentials based on what matched
 	if matchedPAT != nil {
-		return generateAndOutputPATCredentials(matchedPAT)
+		return generateAndOutputPATCredentials(cfg, matchedPAT)
 	}
-	return generateAndOutputCredentials(matchedApp, repoURL)
+	return generateAndOutputCredentials(cfg, matchedApp, repoURL)
 }
 
 // processCredentialInput reads and processes git credential input
@@ -169,8 +169,18 @@ func processCredentialInput() (map[string]string, string, error) {
 	return input, repoURL, nil
 }
 
-// loadCredentialConfig loads the GitHub App configuration
+// loadCredentialConfig loads the GitHub App configuration, from the
+// environment in stateless mode
 func loadCredentialConfig() (*config.Config, error) {
+	if statelessMode() {
+		cfg, err := config.LoadFromEnv(configEnvName)
+		if err != nil {
+			logger.FlowError("load_config", err, map[string]interface{}{"stateless": true})
+			return nil, fmt.Errorf("failed to load stateless configuration: %w", err)
+		}
+		return cfg, nil
+	}
+
 	cfg, err := config.LoadOrCreate()
 	if err != nil {
 		logger.FlowError("load_config", err, map[string]interface{}{})
@@ -179,211 +189,55 @@ func loadCredentialConfig() (*config.Config, error) {
 	return cfg, nil
 }
 
-// findMatchingCredential finds the best matching credential provider (PAT or GitHub App) based on priority
+// findMatchingCredential finds the credential provider (PAT or GitHub App)
+// for repoURL
 func findMatchingCredential(
 	cfg *config.Config, repoURL string,
 ) (*config.GitHubApp, *config.PersonalAccessToken, error) {
-	// Find matching apps and PATs
-	var matchedApps []*config.GitHubApp
-	var matchedPATs []*config.PersonalAccessToken
-
-	// Match GitHub Apps
-	app := findAppByPattern(cfg, repoURL)
-	if app != nil {
-		matchedApps = append(matchedApps, app)
-	} else {
-		app, err := findAppByURL(cfg, repoURL)
-		if err != nil {
-			return nil, nil, err
-		}
-		if app != nil {
-			matchedApps = append(matchedApps, app)
-		} else {
-			app, err = doAutomaticSetup(repoURL)
-			if err != nil {
-				return nil, nil, err
-			}
-			if app != nil {
-				matchedApps = append(matchedApps, app)
-			}
-		}
-	}
-
-	// Match PATs
-	for i := range cfg.PATs {
-		pat := &cfg.PATs[i]
-		for _, pattern := range pat.Patterns {
-			if matchesPatternForPAT(pattern, repoURL) {
-				matchedPATs = append(matchedPATs, pat)
-				break
-			}
-		}
-	}
-
-	// No matches found
-	if len(matchedApps) == 0 && len(matchedPATs) == 0 {
-		return nil, nil, nil
-	}
-
-	// Determine best match by priority
-	var bestApp *config.GitHubApp
-	var bestPAT *config.PersonalAccessToken
-	highestPriority := -1
-
-	for _, app := range matchedApps {
-		if app.Priority > highestPriority {
-			highestPriority = app.Priority
-			bestApp = app
-			bestPAT = nil
-		}
-	}
-
-	for _, pat := range matchedPATs {
-		if pat.Priority > highestPriority {
-			highestPriority = pat.Priority
-			bestPAT = pat
-			bestApp = nil
-		}
-	}
-
-	return bestApp, bestPAT, nil
-}
-
-// matchesPatternForPAT checks if a PAT pattern matches the repository URL
-func matchesPatternForPAT(pattern, repoURL string) bool {
-	// Normalize both strings for comparison
-	normalizedPattern := strings.TrimPrefix(strings.TrimSpace(pattern), "https://")
-	normalizedURL := strings.TrimPrefix(strings.TrimSpace(repoURL), "https://")
-
-	// Check if URL starts with pattern
-	return strings.HasPrefix(normalizedURL, normalizedPattern)
+	decision, err := resolveMatchingCredential(cfg, repoURL)
+	return decision.App, decision.PAT, err
 }
 
-// findAppByPattern finds an app using the --pattern flag
-func findAppByPattern(cfg *config.Config, repoURL string) *config.GitHubApp {
-	logger.FlowStep("match_by_pattern", map[string]interface{}{
-		"pattern":  gitCredentialPattern,
-		"repo_url": logger.SanitizeURL(repoURL),
-	})
-
-	// Normalize both pattern and URL for comparison (remove protocol)
-	normalizedPattern := strings.TrimPrefix(strings.TrimPrefix(gitCredentialPattern, "https://"), "http://")
-	normalizedURL := strings.TrimPrefix(strings.TrimPrefix(repoURL, "https://"), "http://")
-
-	// Check if the pattern matches the repository URL
-	patternMatches := strings.HasPrefix(normalizedURL, normalizedPattern) ||
-		strings.HasPrefix(normalizedPattern, normalizedURL)
-	if !patternMatches {
-		logger.FlowStep("no_pattern_match", map[string]interface{}{
-			"pattern":  gitCredentialPattern,
-			"repo_url": logger.SanitizeURL(repoURL),
-			"reason":   "URL prefix mismatch",
-		})
-		return nil
+// resolveMatchingCredential resolves the credential for repoURL like
+// matchCredential. When nothing matches, an app may be set up from the
+// environment.
+func resolveMatchingCredential(cfg *config.Config, repoURL string) (resolver.Decision, error) {
+	decision, err := matchCredential(cfg, repoURL)
+	if err != nil || decision.Found() {
+		return decision, err
 	}
 
-	// Sort apps by pattern length in descending order
-	sort.Slice(cfg.GitHubApps, func(i, j int) bool {
-		return len(cfg.GitHubApps[i].Patterns) > len(cfg.GitHubApps[j].Patterns)
-	})
-
-	for i := range cfg.GitHubApps {
-		app := &cfg.GitHubApps[i]
-		logger.FlowStep("match_by_pattern", map[string]interface{}{
-			"app_id":               app.AppID,
-			"app_name":             app.Name,
-			"pattern":              gitCredentialPattern,
-			"repo_url":             logger.SanitizeURL(repoURL),
-			"gitCredentialPattern": gitCredentialPattern,
-		})
-
-		for _, pattern := range app.Patterns {
-			if matchesPattern(pattern, gitCredentialPattern) {
-				logger.FlowStep("app_matched_by_pattern", map[string]interface{}{
-					"app_id":   app.AppID,
-					"app_name": app.Name,
-					"pattern":  pattern,
-					"repo_url": logger.SanitizeURL(repoURL),
-				})
-				return app
-			}
-		}
+	app, err := doAutomaticSetup(repoURL)
+	if err != nil || app == nil {
+		return resolver.Decision{}, err
 	}
-
-	logger.FlowStep("no_pattern_match", map[string]interface{}{
-		"pattern":  gitCredentialPattern,
-		"repo_url": logger.SanitizeURL(repoURL),
-		"reason":   "pattern not found",
-	})
-	return nil
+	return resolver.Decision{App: app, Pattern: repoURL, Rule: resolver.RuleLongestPrefix}, nil
 }
 
-// findAppByURL finds an app using URL-based matching
-func findAppByURL(cfg *config.Config, repoURL string) (*config.GitHubApp, error) {
-	logger.FlowStep("match_app", map[string]interface{}{
-		"url": logger.SanitizeURL(repoURL),
-	})
-
-	m := matcher.NewMatcher(cfg.GitHubApps)
-	matchedApp, err := m.Match(repoURL)
-
+// matchCredential resolves the configured credential for repoURL with the
+// precedence every command shares, honouring git-credential's --pattern
+func matchCredential(cfg *config.Config, repoURL string) (resolver.Decision, error) {
+	decision, err := resolver.Resolve(cfg, resolver.Request{URL: repoURL, Pattern: gitCredentialPattern})
 	if err != nil {
-		// If URL doesn't have a path (e.g., just host), exit silently
-		if strings.Contains(err.Error(), "no path found") {
-			logger.FlowStep("no_path_exit", map[string]interface{}{
-				"url":   logger.SanitizeURL(repoURL),
-				"error": err.Error(),
-			})
-			return nil, nil
-		}
-		// Other errors should be reported
-		logger.FlowError("match_app", err, map[string]interface{}{
-			"url": logger.SanitizeURL(repoURL),
-		})
-		return nil, err
-	}
-
-	if matchedApp == nil {
-		logger.FlowStep("no_match_exit", map[string]interface{}{
+		logger.FlowError("match_credential", err, map[string]interface{}{
 			"url": logger.SanitizeURL(repoURL),
 		})
-		return nil, nil
+		return resolver.Decision{}, err
 	}
-
-	logger.FlowStep("app_matched", map[string]interface{}{
-		"app_id":   matchedApp.AppID,
-		"app_name": matchedApp.Name,
-		"patterns": matchedApp.Patterns,
-	})
-
-	return matchedApp, nil
-}
-
-// matchesPattern checks if a pattern matches the git credential pattern
-func matchesPattern(appPattern, gitCredPattern string) bool {
-	logger.FlowStep("match_by_pattern", map[string]interface{}{
-		"pattern":                    appPattern,
-		"gitCredentialPattern":       gitCredPattern,
-		"pattern_len":                len(appPattern),
-		"gitCredentialPattern_len":   len(gitCredPattern),
-		"pattern_bytes":              []byte(appPattern),
-		"gitCredentialPattern_bytes": []byte(gitCredPattern),
-		"exact_match":                appPattern == gitCredPattern,
-		"prefix_match":               strings.HasPrefix(gitCredPattern, appPattern),
-		"trimmed_pattern":            strings.TrimSpace(appPattern),
-		"trimmed_gitCredPattern":     strings.TrimSpace(gitCredPattern),
-		"trimmed_match":              strings.TrimSpace(appPattern) == strings.TrimSpace(gitCredPattern),
+	logger.FlowStep("match_credential", map[string]interface{}{
+		"url":      logger.SanitizeURL(repoURL),
+		"pattern":  gitCredentialPattern,
+		"decision": decision.String(),
 	})
-
-	// Normalize both strings for comparison - remove protocol prefix
-	normalizedAppPattern := strings.TrimPrefix(appPattern, "https://")
-	normalizedPattern := strings.TrimPrefix(gitCredPattern, "https://")
-
-	return strings.HasPrefix(normalizedPattern, normalizedAppPattern) || normalizedAppPattern == normalizedPattern
+	return decision, nil
 }
 
-// doAutomaticSetup will automatically configure GitHub App if GH_APP_PRIVATE_KEY_PATH and GH_APP_ID are set
+// doAutomaticSetup will automatically configure GitHub App if GH_APP_PRIVATE_KEY_PATH and GH_APP_ID are set.
+// In stateless mode those variables already define the configuration, which is never saved.
 func doAutomaticSetup(repoURL string) (*config.GitHubApp, error) {
+	if statelessMode() {
+		return nil, nil
+	}
 	if os.Getenv("GH_APP_PRIVATE_KEY_PATH") != "" && os.Getenv("GH_APP_ID") != "" {
 		cfg, err := config.LoadOrCreate()
 		if err != nil {
@@ -416,18 +270,13 @@ func doAutomaticSetup(repoURL string) (*config.GitHubApp, error) {
 }
 
 // generateAndOutputPATCredentials generates PAT credentials and outputs them
-func generateAndOutputPATCredentials(matchedPAT *config.PersonalAccessToken) error {
+func generateAndOutputPATCredentials(cfg *config.Config, matchedPAT *config.PersonalAccessToken) error {
 	logger.FlowStep("generate_pat_credentials", map[string]interface{}{
 		"pat_name": matchedPAT.Name,
 	})
 
 	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	// Retrieve PAT from secure storage
 	token, err := matchedPAT.GetPAT(secretMgr)
@@ -464,31 +313,56 @@ func generateAndOutputPATCredentials(matchedPAT *config.PersonalAccessToken) err
 	return nil
 }
 
+// newCredentialAuthenticator creates an authenticator honouring the configured token cache settings
+func newCredentialAuthenticator(cfg *config.Config) *auth.Authenticator {
+	authenticator := auth.NewAuthenticator()
+	if !statelessMode() {
+		authenticator.PersistResolvedInstallations()
+		authenticator.PersistAppIdentities()
+		if cfg.PersistentTokenCache() {
+			authenticator.EnablePersistentCache()
+		}
+	}
+	if margin, ok := cfg.TokenExpiryMargin(); ok {
+		authenticator.SetExpiryMargin(margin)
+	}
+	authenticator.SetTransport(transport.FromConfig(cfg))
+	authenticator.ConfigureSecretBackends(cfg.SecretBackends)
+	return authenticator
+}
+
 // generateAndOutputCredentials generates authentication credentials and outputs them
-func generateAndOutputCredentials(matchedApp *config.GitHubApp, repoURL string) error {
+func generateAndOutputCredentials(cfg *config.Config, matchedApp *config.GitHubApp, repoURL string) error {
 	logger.FlowStep("generate_credentials", map[string]interface{}{
-		"app_id": matchedApp.AppID,
+		"app_id":           matchedApp.AppID,
+		"persistent_cache": cfg.PersistentTokenCache(),
 	})
 
-	authenticator := auth.NewAuthenticator()
-	token, username, err := authenticator.GetCredentials(matchedApp, repoURL)
+	scope := matcher.ResolveTokenScope(matchedApp, repoURL, matchedApp.NarrowsToRepository())
+	installationToken, username, err := getAppCredential(cfg, matchedApp, repoURL, scope)
 	if err != nil {
 		logger.FlowError("generate_credentials", err, map[string]interface{}{
 			"app_id": matchedApp.AppID,
 		})
 		return fmt.Errorf("failed to get credentials: %w", err)
 	}
+	token := installationToken.Token
 
 	logger.FlowStep("credentials_generated", map[string]interface{}{
 		"app_id":       matchedApp.AppID,
 		"username":     username,
 		"token_hash":   logger.HashToken(token),
 		"token_length": len(token),
+		"cached":       installationToken.Cached,
+		"scope":        scope.Key(),
+		"expires_at":   installationToken.ExpiresAt.Format(time.RFC3339),
 	})
 
-	// Output credentials in git credential format
+	// Output credentials in git credential format; the expiry lets git discard
+	// the token instead of handing a stale one to other helpers
 	fmt.Printf("username=%s\n", username)
 	fmt.Printf("password=%s\n", token)
+	fmt.Printf("password_expiry_utc=%d\n", installationToken.ExpiresAt.Unix())
 
 	logger.FlowStep("output_credentials", map[string]interface{}{
 		"username":   username,
@@ -556,11 +430,39 @@ func handleCredentialErase() error {
 		"url": logger.SanitizeURL(repoURL),
 	})
 
-	// Clear any cached tokens for this repository
-	// This is a placeholder - actual implementation would clear cache
+	// Stateless processes keep nothing beyond their own lifetime
+	if statelessMode() {
+		return nil
+	}
+
+	// Git calls erase when it rejects a credential, e.g. after the app's
+	// permissions changed. Evict the token served for the repository so the
+	// next get mints a fresh one instead of replaying the rejected token.
+	// Nothing is set up from the environment for a credential being erased.
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+	decision, err := matchCredential(cfg, repoURL)
+	if err != nil {
+		return err
+	}
+	matchedApp := decision.App
+	if matchedApp == nil {
+		logger.FlowStep("erase_no_app", map[string]interface{}{
+			"url": logger.SanitizeURL(repoURL),
+		})
+		return nil
+	}
+
+	removed, err := evictRepositoryToken(matchedApp, repoURL)
+	if err != nil {
+		return fmt.Errorf("failed to clear cached token: %w", err)
+	}
 	logger.FlowStep("erase_cache_clear", map[string]interface{}{
-		"url":    logger.SanitizeURL(repoURL),
-		"status": "placeholder",
+		"url":     logger.SanitizeURL(repoURL),
+		"app_id":  matchedApp.AppID,
+		"removed": removed,
 	})
 	return nil
 }
@@ -4,74 +4,6 @@ import (
 	"testing"
 )
 
-func TestMatchesPattern(t *testing.T) {
-	tests := []struct {
-		name           string
-		appPattern     string
-		gitCredPattern string
-		want           bool
-	}{
-		{
-			name:           "exact match",
-			appPattern:     "github.com/myorg/*",
-			gitCredPattern: "github.com/myorg/*",
-			want:           true,
-		},
-		{
-			name:           "url prefix match",
-			appPattern:     "github.com/myorg",
-			gitCredPattern: "https://github.com/myorg",
-			want:           true,
-		},
-		{
-			name:           "url prefix match with trailing slash",
-			appPattern:     "github.com/myorg",
-			gitCredPattern: "https://github.com/myorg/",
-			want:           true,
-		},
-		{
-			name:           "no match - different org",
-			appPattern:     "github.com/myorg",
-			gitCredPattern: "https://github.com/other",
-			want:           false,
-		},
-		{
-			name:           "prefix match with path",
-			appPattern:     "github.com",
-			gitCredPattern: "https://github.com/myorg",
-			want:           true,
-		},
-		{
-			name:           "enterprise github match",
-			appPattern:     "github.enterprise.com/myorg",
-			gitCredPattern: "https://github.enterprise.com/myorg",
-			want:           true,
-		},
-		{
-			name:           "empty git cred pattern",
-			appPattern:     "github.com/myorg",
-			gitCredPattern: "",
-			want:           false,
-		},
-		{
-			name:           "empty app pattern matches anything",
-			appPattern:     "",
-			gitCredPattern: "https://github.com/myorg",
-			want:           true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := matchesPattern(tt.appPattern, tt.gitCredPattern)
-			if got != tt.want {
-				t.Errorf("matchesPattern(%q, %q) = %v, want %v",
-					tt.appPattern, tt.gitCredPattern, got, tt.want)
-			}
-		})
-	}
-}
-
 func TestBuildRepositoryURL_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -77,16 +77,25 @@ github_apps:
 			expectSilent: true,
 		},
 		{
-			name:         "No pattern - falls back to URL matching (should exit silently if no match)",
-			pattern:      "",
-			input:        "protocol=https\nhost=github.com\npath=nonexistent/repo\n\n",
-			expectMatch:  false,
-			expectSilent: true,
+			name:          "No pattern - falls back to URL matching",
+			pattern:       "",
+			input:         "protocol=https\nhost=github.com\npath=nonexistent/repo\n\n",
+			expectMatch:   true,
+			expectedAppID: 333333,
+			expectSilent:  false,
 		},
 		{
-			name:         "No pattern - URL matching not expected to work with URL prefix patterns",
+			name:          "No pattern - URL matching ignores the scheme of URL prefix patterns",
+			pattern:       "",
+			input:         "protocol=https\nhost=github.com\npath=AmadeusITGroup/repo\n\n",
+			expectMatch:   true,
+			expectedAppID: 111111,
+			expectSilent:  false,
+		},
+		{
+			name:         "No pattern - exits silently if no match",
 			pattern:      "",
-			input:        "protocol=https\nhost=github.com\npath=AmadeusITGroup/repo\n\n",
+			input:        "protocol=https\nhost=gitlab.com\npath=group/repo\n\n",
 			expectMatch:  false,
 			expectSilent: true,
 		},
@@ -6,8 +6,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,7 +39,7 @@ func TestGitCredentialRun_GetOperation(t *testing.T) {
 	}
 
 	// Create test key
-	testKey := generateTestRSAKey(t)
+	testKey := testkeys.RSAKeyPEM(t)
 	if err := os.WriteFile(cfg.GitHubApps[0].PrivateKeyPath, []byte(testKey), 0600); err != nil {
 		t.Fatalf("Failed to write test key: %v", err)
 	}
@@ -252,4 +255,85 @@ func TestHandleCredentialErase_Direct(t *testing.T) {
 			t.Errorf("handleCredentialErase should handle missing URL gracefully: %v", err)
 		}
 	})
+
+	t.Run("erase evicts the token of the repository", func(t *testing.T) {
+		persistent := setupTokenCacheTest(t)
+
+		cfg := &config.Config{
+			Version: "1.0",
+			GitHubApps: []config.GitHubApp{
+				{
+					Name:             "Org App",
+					AppID:            1,
+					InstallationID:   10,
+					Patterns:         []string{"github.com/org/*"},
+					PrivateKeySource: config.PrivateKeySourceKeyring,
+				},
+			},
+		}
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			t.Fatalf("Failed to marshal config: %v", err)
+		}
+		configPath := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(configPath, data, 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+		// An unmatched erase must not set an app up from the environment
+		t.Setenv("GH_APP_ID", "99")
+		t.Setenv("GH_APP_PRIVATE_KEY_PATH", filepath.Join(t.TempDir(), "key.pem"))
+
+		rejectedKey := cache.CreateScopedCacheKey(1, 10, config.TokenScope{Repositories: []string{"repo"}}.Key())
+		otherKey := cache.CreateScopedCacheKey(1, 10, config.TokenScope{Repositories: []string{"other"}}.Key())
+		for _, key := range []string{rejectedKey, otherKey} {
+			if err := persistent.Set(key, "ghs_"+key, time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+		}
+
+		oldStdin := os.Stdin
+		defer func() { os.Stdin = oldStdin }()
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Failed to create pipe: %v", err)
+		}
+		os.Stdin = r
+
+		go func() {
+			defer w.Close()
+			w.Write([]byte("protocol=https\nhost=github.com\npath=org/repo\npassword=ghs_rejected\n\n"))
+		}()
+
+		if err := handleCredentialErase(); err != nil {
+			t.Fatalf("handleCredentialErase failed: %v", err)
+		}
+		if _, found := persistent.Get(rejectedKey); found {
+			t.Error("Expected rejected token to be evicted")
+		}
+		if _, found := persistent.Get(otherKey); !found {
+			t.Error("Expected the app's token for another repository to remain")
+		}
+
+		r, w, err = os.Pipe()
+		if err != nil {
+			t.Fatalf("Failed to create pipe: %v", err)
+		}
+		os.Stdin = r
+		go func() {
+			defer w.Close()
+			w.Write([]byte("protocol=https\nhost=github.com\npath=unmatched/repo\n\n"))
+		}()
+		if err := handleCredentialErase(); err != nil {
+			t.Fatalf("handleCredentialErase failed: %v", err)
+		}
+		saved, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if string(saved) != string(data) {
+			t.Errorf("erase changed the configuration:\n%s", saved)
+		}
+	})
 }
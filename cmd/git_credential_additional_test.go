@@ -4,9 +4,10 @@ import (
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil"
 )
 
-func TestFindAppByURL_WithConfig(t *testing.T) {
+func TestFindMatchingCredential_URL(t *testing.T) {
 	cfg := &config.Config{
 		Version: "1",
 		GitHubApps: []config.GitHubApp{
@@ -42,7 +43,7 @@ func TestFindAppByURL_WithConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			app, _ := findAppByURL(cfg, tt.url)
+			app, _, _ := findMatchingCredential(cfg, tt.url)
 
 			if tt.wantNil && app != nil {
 				t.Errorf("Expected nil app, got %v", app)
@@ -54,7 +55,7 @@ func TestFindAppByURL_WithConfig(t *testing.T) {
 	}
 }
 
-func TestFindAppByPattern_WithConfig(t *testing.T) {
+func TestFindMatchingCredential_PatternHint(t *testing.T) {
 	// Set the pattern variable to match the prefix
 	originalPattern := gitCredentialPattern
 	gitCredentialPattern = "https://github.com"
@@ -81,16 +82,45 @@ func TestFindAppByPattern_WithConfig(t *testing.T) {
 	}
 
 	repoURL := "https://github.com/myorg/myrepo"
-	app := findAppByPattern(cfg, repoURL)
+	app, _, err := findMatchingCredential(cfg, repoURL)
+	if err != nil {
+		t.Fatalf("findMatchingCredential() error = %v", err)
+	}
+	// Equal prefixes go to the higher priority
+	if app == nil || app.Name != "HighPriority" {
+		t.Errorf("findMatchingCredential() = %v, want HighPriority", app)
+	}
+}
 
-	if app != nil {
-		// Good - found an app (may be either one)
-		if app.Name != "LowPriority" && app.Name != "HighPriority" {
-			t.Errorf("Got unexpected app: %s", app.Name)
+func TestFindMatchingCredential_Conformance(t *testing.T) {
+	originalPattern := gitCredentialPattern
+	defer func() {
+		gitCredentialPattern = originalPattern
+	}()
+
+	for _, tt := range testutil.ResolutionCases() {
+		if tt.AppID != 0 || tt.InstallationID != 0 {
+			continue // git-credential has no selectors
 		}
+		t.Run(tt.Name, func(t *testing.T) {
+			gitCredentialPattern = tt.Pattern
+			app, pat, err := findMatchingCredential(testutil.ResolutionConfig(), tt.URL)
+			if err != nil {
+				t.Fatalf("findMatchingCredential() error = %v", err)
+			}
+			var gotApp, gotPAT string
+			if app != nil {
+				gotApp = app.Name
+			}
+			if pat != nil {
+				gotPAT = pat.Name
+			}
+			if gotApp != tt.WantApp || gotPAT != tt.WantPAT {
+				t.Errorf("findMatchingCredential() = app %q, PAT %q, want app %q, PAT %q",
+					gotApp, gotPAT, tt.WantApp, tt.WantPAT)
+			}
+		})
 	}
-	// Note: app might be nil if pattern matching logic doesn't match,
-	// which is acceptable for this edge case test
 }
 
 func TestGitCredentialPattern_Variable(t *testing.T) {
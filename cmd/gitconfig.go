@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"github.com/spf13/cobra"
 )
 
@@ -162,7 +163,12 @@ func syncGitConfig(scope string, auto bool) error {
 		if strings.ContainsAny(pattern, "*?[] ") {
 			patternArg = fmt.Sprintf("\"%s\"", pattern)
 		}
-		helperValue := fmt.Sprintf("!%s git-credential --pattern %s", execPath, patternArg)
+		helperCommand := execPath
+		if configFileFlag != "" {
+			// The helper must read the same configuration file
+			helperCommand = fmt.Sprintf("%s --config \"%s\"", execPath, paths.ConfigFile())
+		}
+		helperValue := fmt.Sprintf("!%s git-credential --pattern %s", helperCommand, patternArg)
 		setCmd := exec.Command("git", "config", scope, "--add", credKey, helperValue)
 		if err := setCmd.Run(); err != nil {
 			fmt.Printf("❌ Failed to configure: %s\n", context)
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
+	"github.com/spf13/cobra"
+)
+
+// NewIdentityCmd creates the identity command
+func NewIdentityCmd() *cobra.Command {
+	var (
+		repo         string
+		configureGit bool
+		global       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "identity",
+		Short: "Show or configure the git identity of a GitHub App's bot user",
+		Long: `Show the git author identity of the GitHub App that authenticates a repository.
+
+Commits authored as the app's bot user are attributed to the App on GitHub:
+
+  user.name  = <slug>[bot]
+  user.email = <bot-user-id>+<slug>[bot]@users.noreply.<host>
+
+The app's slug and bot user ID are fetched from GitHub unless cached, and cached for a day;
+git credentials use the cached bot login as username.
+With --configure-git, the identity is written to the repository's git config
+(or to the global git config with --global).`,
+		Example: `  # Show the identity of the app matching the current repository
+  gh app-auth identity
+
+  # Commit as the app in CI
+  gh app-auth identity --repo github.com/myorg/myrepo --configure-git`,
+		RunE: identityRun(&repo, &configureGit, &global),
+	}
+
+	cmd.Flags().StringVar(&repo, "repo", "", "Repository whose app to use (default: current repository)")
+	cmd.Flags().BoolVar(&configureGit, "configure-git", false, "Set user.name and user.email in git config")
+	cmd.Flags().BoolVar(&global, "global", false, "With --configure-git, write the global git config")
+
+	return cmd
+}
+
+func identityRun(repo *string, configureGit, global *bool) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if *global && !*configureGit {
+			return fmt.Errorf("--global requires --configure-git")
+		}
+
+		cfg, err := loadTestConfiguration()
+		if err != nil {
+			return err
+		}
+		repoURL, err := determineRepositoryURL(*repo)
+		if err != nil {
+			return err
+		}
+
+		identity, host, err := resolveAppIdentity(cfg, repoURL)
+		if err != nil {
+			return err
+		}
+		name, email := identity.Login(), identity.Email(host)
+
+		if !*configureGit {
+			fmt.Printf("user.name  = %s\n", name)
+			fmt.Printf("user.email = %s\n", email)
+			return nil
+		}
+
+		scope := "--local"
+		if *global {
+			scope = "--global"
+		}
+		if err := setGitIdentity(scope, name, email); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Configured git (%s) to commit as %s <%s>\n", scope, name, email)
+		return nil
+	}
+}
+
+// resolveAppIdentity returns the bot identity of the app matching repoURL,
+// with the host its noreply email belongs to
+func resolveAppIdentity(cfg *config.Config, repoURL string) (*cache.AppIdentity, string, error) {
+	app, pat, err := findMatchingCredential(cfg, repoURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if app == nil {
+		if pat != nil {
+			return nil, "", fmt.Errorf("%s is authenticated by PAT %q; only GitHub Apps have a bot identity",
+				repoURL, pat.Name)
+		}
+		return nil, "", fmt.Errorf("no GitHub App configured for %s", repoURL)
+	}
+
+	host := hosts.Normalize(repoURL)
+	if host == "" {
+		host = app.Host()
+	}
+
+	// Only a cache miss costs an installation token and requests to GitHub
+	authenticator := newCredentialAuthenticator(cfg)
+	if identity, found := authenticator.CachedAppIdentity(app, repoURL); found {
+		return identity, host, nil
+	}
+	token, err := getAppToken(cfg, app, repoURL, config.TokenScope{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get installation token for app %d: %w", app.AppID, err)
+	}
+	identity, err := authenticator.AppIdentity(app, repoURL, token.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get identity of app %d: %w", app.AppID, err)
+	}
+	return identity, host, nil
+}
+
+// setGitIdentity sets user.name and user.email in the git config of scope
+func setGitIdentity(scope, name, email string) error {
+	for _, setting := range [][2]string{{"user.name", name}, {"user.email", email}} {
+		// #nosec G204 -- scope is a fixed flag and values come from the GitHub API
+		output, err := exec.Command("git", "config", scope, setting[0], setting[1]).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to set %s: %w: %s", setting[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
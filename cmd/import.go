@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/bundle"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type importFlags struct {
+	identities []string
+	onConflict string
+	backend    string
+	dryRun     bool
+}
+
+func NewImportCmd() *cobra.Command {
+	var flags importFlags
+
+	cmd := &cobra.Command{
+		Use:   "import <bundle>",
+		Short: "Import configuration entries and secrets from an encrypted bundle",
+		Long: `Merge the entries of a bundle written by 'gh app-auth export' into the
+configuration, and store their private keys and tokens on this machine.
+
+Secrets go to the OS keyring, falling back to the filesystem, or to the
+secret backend named by --backend. Each imported entry gets a new secret ID.
+
+An app already configured with the same app and installation ID, or a PAT
+with the same name, is a conflict. --on-conflict decides what happens:
+  skip       keep the configured entry (default)
+  overwrite  replace it, and delete its secrets
+  rename     add the imported PAT under a new name; an app keeps its
+             identity under any name, so a conflicting app fails the import
+
+Bundles encrypted with a passphrase read it from GH_APP_AUTH_BUNDLE_PASSPHRASE
+or the terminal; bundles encrypted to age recipients need --identity.`,
+		Example: `  # Import a passphrase-encrypted bundle
+  gh app-auth import bundle.age
+
+  # Import with an age identity, replacing existing entries
+  gh app-auth import bundle.age --identity ~/.config/age/key.txt --on-conflict overwrite
+
+  # Store the secrets in Vault and preview the result
+  gh app-auth import bundle.age --backend vault --dry-run`,
+		Args: cobra.ExactArgs(1),
+		RunE: importRun(&flags),
+	}
+
+	cmd.Flags().StringArrayVarP(&flags.identities, "identity", "i", nil,
+		"File holding age identities to decrypt with (repeatable; default: passphrase)")
+	cmd.Flags().StringVar(&flags.onConflict, "on-conflict", string(bundle.ConflictSkip),
+		"What to do with entries that are already configured: skip, overwrite or rename (PATs only)")
+	cmd.Flags().StringVar(&flags.backend, "backend", "", "Secret backend to store secrets in (default: keyring)")
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "Show what would be imported without changing anything")
+
+	return cmd
+}
+
+func importRun(flags *importFlags) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		policy, err := bundle.ParseConflictPolicy(flags.onConflict)
+		if err != nil {
+			return err
+		}
+
+		b, err := readBundle(args[0], flags.identities)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadOrCreate()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		secretMgr := newDefaultSecretsManager(cfg)
+		secretMgr.SetPassphrasePrompt(terminalPassphrasePrompt(false))
+
+		options := bundle.ImportOptions{OnConflict: policy, Backend: flags.backend, DryRun: flags.dryRun}
+		result, err := bundle.Import(cfg, b, secretMgr, options)
+		if err != nil {
+			return fmt.Errorf("failed to import: %w", err)
+		}
+
+		printImportResult(result, flags.dryRun)
+		if flags.dryRun {
+			return nil
+		}
+
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+		for _, secret := range result.Obsolete {
+			if err := secret.Delete(secretMgr); err != nil {
+				fmt.Printf("⚠️  Could not delete replaced secret %s: %v\n", secret, err)
+			}
+		}
+		return nil
+	}
+}
+
+// readBundle decrypts the bundle at path with the given identity files, or a
+// passphrase when there are none
+func readBundle(path string, identityFiles []string) (*bundle.Bundle, error) {
+	var identities []age.Identity
+	for _, identityFile := range identityFiles {
+		file, err := os.Open(identityFile) // #nosec G304 -- path chosen by the user
+		if err != nil {
+			return nil, fmt.Errorf("failed to open identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %w", identityFile, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(identities) == 0 {
+		passphrase, err := bundlePassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	file, err := os.Open(path) // #nosec G304 -- path chosen by the user
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return bundle.Decrypt(file, identities...)
+}
+
+func printImportResult(result *bundle.Result, dryRun bool) {
+	verbs := map[bundle.Action]string{
+		bundle.ActionAdded:    "Imported",
+		bundle.ActionRenamed:  "Imported",
+		bundle.ActionReplaced: "Replaced",
+	}
+	if dryRun {
+		fmt.Println("🔍 Dry run: nothing is changed")
+		verbs = map[bundle.Action]string{
+			bundle.ActionAdded:    "Would import",
+			bundle.ActionRenamed:  "Would import",
+			bundle.ActionReplaced: "Would replace",
+		}
+	}
+
+	for _, outcome := range result.Outcomes {
+		if outcome.Action == bundle.ActionSkipped {
+			fmt.Printf("⏭️  Skipped %s: already configured as '%s'\n", outcome.Entry, outcome.Name)
+			continue
+		}
+		line := fmt.Sprintf("✅ %s %s", verbs[outcome.Action], outcome.Entry)
+		if outcome.Action == bundle.ActionRenamed {
+			line += fmt.Sprintf(" as '%s'", outcome.Name)
+		}
+		if outcome.Storage != "" {
+			line += fmt.Sprintf(" (stored in %s)", outcome.Storage)
+		}
+		fmt.Println(line)
+	}
+}
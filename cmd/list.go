@@ -10,6 +10,7 @@ import (
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/cli/go-gh/v2/pkg/tableprinter"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -17,9 +18,11 @@ import (
 
 // Status messages for key/token verification
 const (
-	statusNotChecked = "⚠️  Not checked"
-	statusAccessible = "✅ Accessible"
-	statusNotFound   = "❌ Not found"
+	statusNotChecked  = "⚠️  Not checked"
+	statusAccessible  = "✅ Accessible"
+	statusUnencrypted = "⚠️  Accessible (unencrypted)"
+	statusNotFound    = "❌ Not found"
+	statusKeyMismatch = "❌ Key changed (fingerprint mismatch)"
 )
 
 func NewListCmd() *cobra.Command {
@@ -76,9 +79,20 @@ func listRun(format *string, quiet *bool, verifyKeys *bool) func(*cobra.Command,
 		if err != nil {
 			return err
 		}
+		if secretMgr != nil {
+			secretMgr.Configure(cfg.SecretBackends)
+			secretMgr.SetHTTPClientFactory(transport.FromConfig(cfg).Client)
+			secretMgr.SetPassphrasePrompt(terminalPassphrasePrompt(false))
+		}
 
 		// Handle output format
-		return handleOutputFormat(*format, cfg.GitHubApps, cfg.PATs, secretMgr, *verifyKeys)
+		if err := handleOutputFormat(*format, cfg.GitHubApps, cfg.PATs, secretMgr, *verifyKeys); err != nil {
+			return err
+		}
+		if *verifyKeys && *format == "table" {
+			reportSecretIdentityIssues(cfg, secretMgr)
+		}
+		return nil
 	}
 }
 
@@ -111,9 +125,57 @@ func outputTable(
 		fmt.Println("No GitHub Apps or Personal Access Tokens configured.")
 	}
 
+	if verifyKeys && secretMgr != nil {
+		reportUnencryptedSecrets(secretMgr)
+	}
+
 	return nil
 }
 
+// reportUnencryptedSecrets lists the plaintext files left in the filesystem
+// fallback store, including cached tokens that no app row shows
+func reportUnencryptedSecrets(secretMgr *secrets.Manager) {
+	plaintext, err := secretMgr.UnencryptedSecrets()
+	if err != nil {
+		fmt.Printf("\n⚠️  Could not inspect the filesystem fallback store: %v\n", err)
+		return
+	}
+	if len(plaintext) == 0 {
+		return
+	}
+
+	fmt.Printf("\n⚠️  %d secrets in the filesystem fallback store are unencrypted:\n", len(plaintext))
+	for _, ref := range plaintext {
+		fmt.Printf("  • %s (%s)\n", ref.Name, ref.Type)
+	}
+	fmt.Printf("Run 'gh app-auth migrate --encrypt' to encrypt them.\n")
+}
+
+// reportSecretIdentityIssues lists stored secrets that several entries share,
+// and secrets that no entry uses any more
+func reportSecretIdentityIssues(cfg *config.Config, secretMgr *secrets.Manager) {
+	shared := cfg.SharedSecrets()
+	if len(shared) > 0 {
+		fmt.Printf("\n⚠️  %d secrets are shared by several entries:\n", len(shared))
+		for _, secret := range shared {
+			fmt.Printf("  • %s, used by %s\n", secret.Secret, strings.Join(secret.Owners, ", "))
+		}
+		fmt.Printf("Run 'gh app-auth migrate' to give each entry its own secret.\n")
+	}
+
+	orphans, err := cfg.OrphanedSecrets(secretMgr)
+	if err != nil {
+		fmt.Printf("\n⚠️  Could not look for orphaned secrets: %v\n", err)
+	}
+	if len(orphans) > 0 {
+		fmt.Printf("\n⚠️  %d stored secrets are not used by any entry:\n", len(orphans))
+		for _, secret := range orphans {
+			fmt.Printf("  • %s\n", secret)
+		}
+		fmt.Printf("They may be left over from a renamed or removed entry.\n")
+	}
+}
+
 func outputAppsTable(apps []config.GitHubApp, secretMgr *secrets.Manager, verifyKeys bool) error {
 	// Create table printer
 	terminal := os.Stdout
@@ -127,6 +189,7 @@ func outputAppsTable(apps []config.GitHubApp, secretMgr *secrets.Manager, verify
 	tp.AddField("PATTERNS", tableprinter.WithTruncate(nil))
 	tp.AddField("PRIORITY", tableprinter.WithTruncate(nil))
 	tp.AddField("KEY SOURCE", tableprinter.WithTruncate(nil))
+	tp.AddField("KEY FINGERPRINT", tableprinter.WithTruncate(nil))
 	if verifyKeys {
 		tp.AddField("KEY STATUS", tableprinter.WithTruncate(nil))
 	}
@@ -147,9 +210,15 @@ func outputAppsTable(apps []config.GitHubApp, secretMgr *secrets.Manager, verify
 		tp.AddField(fmt.Sprintf("%d", app.Priority), tableprinter.WithTruncate(nil))
 
 		// Display key source
-		keySource := getKeySourceDisplay(app)
+		keySource := getKeySourceDisplay(app) + getKeyCountDisplay(app)
 		tp.AddField(keySource, tableprinter.WithTruncate(nil))
 
+		fingerprint := app.Fingerprint()
+		if fingerprint == "" {
+			fingerprint = "-"
+		}
+		tp.AddField(fingerprint, tableprinter.WithTruncate(nil))
+
 		// Verify key if requested
 		if verifyKeys {
 			keyStatus := verifyKeyAccess(app, secretMgr)
@@ -228,6 +297,18 @@ func getKeySourceDisplay(app config.GitHubApp) string {
 		return "📁 Filesystem"
 	case config.PrivateKeySourceInline:
 		return "⚠️  Inline (migrate)"
+	case config.PrivateKeySourceCommand:
+		return commandSourceDisplay(app.PrivateKeyCommand)
+	case config.PrivateKeySourceEnv:
+		return fmt.Sprintf("🌐 Environment ($%s)", app.PrivateKeyEnv)
+	case config.PrivateKeySourceSigner:
+		if app.PrivateKeyURI != "" {
+			return "🔏 PKCS#11 token"
+		}
+		if app.SignerCommand != nil && len(app.SignerCommand.Args) > 0 {
+			return fmt.Sprintf("🔏 Signer (%s)", filepath.Base(app.SignerCommand.Args[0]))
+		}
+		return "🔏 Signer"
 	case "":
 		// Legacy config - check if path exists
 		if app.PrivateKeyPath != "" {
@@ -235,21 +316,60 @@ func getKeySourceDisplay(app config.GitHubApp) string {
 		}
 		return "❓ Unknown"
 	default:
+		if secrets.IsRegistered(string(app.PrivateKeySource)) {
+			return fmt.Sprintf("🔌 %s", app.PrivateKeySource)
+		}
 		return fmt.Sprintf("❓ %s", app.PrivateKeySource)
 	}
 }
 
+// getKeyCountDisplay summarises the keys of an app that has several
+func getKeyCountDisplay(app config.GitHubApp) string {
+	if len(app.Keys) == 0 {
+		return ""
+	}
+	retiring := 0
+	for _, key := range app.Keys {
+		if key.State == config.KeyStateRetiring {
+			retiring++
+		}
+	}
+	if len(app.Keys) == 1 {
+		return " (1 key)"
+	}
+	if retiring == 0 {
+		return fmt.Sprintf(" (%d keys)", len(app.Keys))
+	}
+	return fmt.Sprintf(" (%d keys, %d retiring)", len(app.Keys), retiring)
+}
+
 func getPATSourceDisplay(pat config.PersonalAccessToken) string {
 	switch pat.TokenSource {
 	case config.PrivateKeySourceKeyring, "":
 		return "🔐 Keyring (encrypted)"
 	case config.PrivateKeySourceFilesystem:
 		return "📁 Filesystem"
+	case config.PrivateKeySourceCommand:
+		return commandSourceDisplay(pat.TokenCommand)
+	case config.PrivateKeySourceEnv:
+		return fmt.Sprintf("🌐 Environment ($%s)", pat.TokenEnv)
 	default:
+		if secrets.IsRegistered(string(pat.TokenSource)) {
+			return fmt.Sprintf("🔌 %s", pat.TokenSource)
+		}
 		return fmt.Sprintf("❓ %s", pat.TokenSource)
 	}
 }
 
+// commandSourceDisplay names the program of a command source; its arguments
+// may identify the secret and are not shown
+func commandSourceDisplay(command *config.SecretCommand) string {
+	if command == nil || len(command.Args) == 0 {
+		return "⚙️  Command"
+	}
+	return fmt.Sprintf("⚙️  Command (%s)", filepath.Base(command.Args[0]))
+}
+
 // verifyKeyAccess checks if the private key is accessible
 func verifyKeyAccess(app config.GitHubApp, secretMgr *secrets.Manager) string {
 	if secretMgr == nil {
@@ -257,24 +377,49 @@ func verifyKeyAccess(app config.GitHubApp, secretMgr *secrets.Manager) string {
 	}
 
 	if app.HasPrivateKey(secretMgr) {
+		if errors.Is(app.VerifyKeyFingerprints(secretMgr), config.ErrKeyMismatch) {
+			return statusKeyMismatch
+		}
+		if isUnencryptedFallback(secretMgr, app.SecretName(), secrets.SecretTypePrivateKey) {
+			return statusUnencrypted
+		}
 		return statusAccessible
 	}
 
 	return statusNotFound
 }
 
+// verifyPATAccess checks if the PAT is accessible from its source
 func verifyPATAccess(pat config.PersonalAccessToken, secretMgr *secrets.Manager) string {
 	if secretMgr == nil {
 		return statusNotChecked
 	}
 
-	if _, _, err := secretMgr.Get(pat.Name, secrets.SecretTypePAT); err == nil {
+	if pat.HasPAT(secretMgr) {
+		if isUnencryptedFallback(secretMgr, pat.SecretName(), secrets.SecretTypePAT) {
+			return statusUnencrypted
+		}
 		return statusAccessible
 	}
 
 	return statusNotFound
 }
 
+// isUnencryptedFallback reports whether a secret is a plaintext file in the
+// filesystem fallback store
+func isUnencryptedFallback(secretMgr *secrets.Manager, name string, secretType secrets.SecretType) bool {
+	plaintext, err := secretMgr.UnencryptedSecrets()
+	if err != nil {
+		return false
+	}
+	for _, ref := range plaintext {
+		if ref.Name == name && ref.Type == secretType {
+			return true
+		}
+	}
+	return false
+}
+
 // loadListConfiguration loads and validates the configuration for listing
 func loadListConfiguration() (*config.Config, error) {
 	cfg, err := config.Load()
@@ -311,12 +456,7 @@ func initializeSecretsManagerIfNeeded(verifyKeys bool) (*secrets.Manager, error)
 		return nil, nil
 	}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	return secrets.NewManager(configDir), nil
+	return newDefaultSecretsManager(nil), nil
 }
 
 // handleOutputFormat handles different output formats
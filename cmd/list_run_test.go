@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,7 +22,7 @@ func TestListRun_Integration(t *testing.T) {
 	keyPath := filepath.Join(tempDir, "test-key.pem")
 
 	// Generate valid test key
-	testKey := generateTestRSAKey(t)
+	testKey := testkeys.RSAKeyPEM(t)
 	if err := os.WriteFile(keyPath, []byte(testKey), 0600); err != nil {
 		t.Fatalf("Failed to write test key: %v", err)
 	}
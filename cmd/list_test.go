@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
 	"gopkg.in/yaml.v3"
 )
 
@@ -61,6 +64,30 @@ func TestGetKeySourceDisplay(t *testing.T) {
 			},
 			want: "❓ Unknown",
 		},
+		{
+			name: "command source",
+			app: config.GitHubApp{
+				PrivateKeySource:  config.PrivateKeySourceCommand,
+				PrivateKeyCommand: &config.SecretCommand{Args: []string{"/usr/bin/op", "read", "op://ci/app/key"}},
+			},
+			want: "⚙️  Command (op)",
+		},
+		{
+			name: "pkcs11 signer",
+			app: config.GitHubApp{
+				PrivateKeySource: config.PrivateKeySourceSigner,
+				PrivateKeyURI:    "pkcs11:token=ci;object=app?pin-value=1234",
+			},
+			want: "🔏 PKCS#11 token",
+		},
+		{
+			name: "signer command",
+			app: config.GitHubApp{
+				PrivateKeySource: config.PrivateKeySourceSigner,
+				SignerCommand:    &config.SecretCommand{Args: []string{"/usr/local/bin/kms-sign", "--key", "app"}},
+			},
+			want: "🔏 Signer (kms-sign)",
+		},
 		{
 			name: "unknown source",
 			app: config.GitHubApp{
@@ -80,6 +107,37 @@ func TestGetKeySourceDisplay(t *testing.T) {
 	}
 }
 
+func TestGetKeyCountDisplay(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []config.AppKey
+		want string
+	}{
+		{name: "single key", want: ""},
+		{
+			name: "rotation in progress",
+			keys: []config.AppKey{
+				{Fingerprint: "SHA256:old", State: config.KeyStateRetiring},
+				{Fingerprint: "SHA256:new", State: config.KeyStateActive},
+			},
+			want: " (2 keys, 1 retiring)",
+		},
+		{
+			name: "rotation done",
+			keys: []config.AppKey{{Fingerprint: "SHA256:new", State: config.KeyStateActive}},
+			want: " (1 key)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getKeyCountDisplay(config.GitHubApp{Keys: tt.keys}); got != tt.want {
+				t.Errorf("getKeyCountDisplay() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestVerifyKeyAccess(t *testing.T) {
 	app := config.GitHubApp{
 		AppID:            123456,
@@ -105,6 +163,94 @@ func TestVerifyKeyAccess(t *testing.T) {
 			t.Errorf("verifyKeyAccess() = %q, want %q", got, want)
 		}
 	})
+
+	t.Run("filesystem fallback", func(t *testing.T) {
+		keyring.MockInitWithError(errors.New("keyring unavailable"))
+		defer keyring.MockInitWithError(nil)
+		t.Setenv(secrets.PassphraseEnv, "")
+		t.Setenv(secrets.PassphraseFDEnv, "")
+
+		app := app
+		app.Name = "ci-app"
+		secretMgr := secrets.NewManager(t.TempDir())
+		if _, err := secretMgr.Store(app.Name, secrets.SecretTypePrivateKey, "key"); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		if got := verifyKeyAccess(app, secretMgr); got != statusUnencrypted {
+			t.Errorf("verifyKeyAccess() plaintext = %q, want %q", got, statusUnencrypted)
+		}
+
+		t.Setenv(secrets.PassphraseEnv, "s3cret")
+		if converted, err := secretMgr.EncryptFilesystemSecrets(); err != nil || converted != 1 {
+			t.Fatalf("EncryptFilesystemSecrets() = %d, %v, want 1", converted, err)
+		}
+		if got := verifyKeyAccess(app, secretMgr); got != statusAccessible {
+			t.Errorf("verifyKeyAccess() encrypted = %q, want %q", got, statusAccessible)
+		}
+	})
+
+	t.Run("fingerprint mismatch", func(t *testing.T) {
+		keyring.MockInit()
+		defer keyring.MockInitWithError(nil)
+
+		app := app
+		app.Name = "swapped-app"
+		secretMgr := secrets.NewManager(t.TempDir())
+		if _, err := app.SetPrivateKey(secretMgr, testkeys.RSAKeyPEM(t)); err != nil {
+			t.Fatalf("SetPrivateKey() error = %v", err)
+		}
+		if err := app.RecordKeyFingerprint(testkeys.RSAKeyPEM(t)); err != nil {
+			t.Fatalf("RecordKeyFingerprint() error = %v", err)
+		}
+		if got := verifyKeyAccess(app, secretMgr); got != statusKeyMismatch {
+			t.Errorf("verifyKeyAccess() = %q, want %q", got, statusKeyMismatch)
+		}
+	})
+}
+
+func TestVerifyPATAccess(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	t.Setenv("CI_PAT", "ghp_env")
+	if _, err := secretMgr.Store("stored", secrets.SecretTypePAT, "ghp_stored"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pat  config.PersonalAccessToken
+		want string
+	}{
+		{
+			name: "env source",
+			pat:  config.PersonalAccessToken{Name: "env", TokenSource: config.PrivateKeySourceEnv, TokenEnv: "CI_PAT"},
+			want: statusAccessible,
+		},
+		{
+			name: "unset env variable",
+			pat:  config.PersonalAccessToken{Name: "unset", TokenSource: config.PrivateKeySourceEnv, TokenEnv: "UNSET_PAT"},
+			want: statusNotFound,
+		},
+		{
+			name: "stored keyring token",
+			pat:  config.PersonalAccessToken{Name: "stored", TokenSource: config.PrivateKeySourceKeyring},
+			want: statusAccessible,
+		},
+		{
+			name: "missing keyring token",
+			pat:  config.PersonalAccessToken{Name: "missing", TokenSource: config.PrivateKeySourceKeyring},
+			want: statusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPATAccess(tt.pat, secretMgr); got != tt.want {
+				t.Errorf("verifyPATAccess() = %q, want %q", got, tt.want)
+			}
+		})
+	}
 }
 
 func TestOutputQuietMode(t *testing.T) {
@@ -358,3 +504,23 @@ func TestLoadListConfiguration(t *testing.T) {
 		}
 	})
 }
+
+func TestReportSecretIdentityIssues(t *testing.T) {
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+	t.Setenv(secrets.PassphraseEnv, "")
+	t.Setenv(secrets.PassphraseFDEnv, "")
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	if _, err := secretMgr.Store("removed-app", secrets.SecretTypePrivateKey, "key"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	app := config.GitHubApp{Name: "shared", AppID: 1, PrivateKeySource: config.PrivateKeySourceKeyring}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{app, app}}
+
+	if shared := cfg.SharedSecrets(); len(shared) != 1 {
+		t.Errorf("SharedSecrets() = %+v, want one shared key", shared)
+	}
+	// This outputs to stdout - just verify it doesn't panic
+	reportSecretIdentityIssues(cfg, secretMgr)
+}
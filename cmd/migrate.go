@@ -1,13 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 const (
@@ -20,6 +21,7 @@ func NewMigrateCmd() *cobra.Command {
 		dryRun  bool
 		storage string
 		force   bool
+		encrypt bool
 	)
 
 	cmd := &cobra.Command{
@@ -32,7 +34,11 @@ the OS-native encrypted keyring (Keychain on macOS, Credential Manager
 on Windows, Secret Service on Linux).
 
 The migration is safe and non-destructive - original key files are kept
-as a fallback unless you specify --force.`,
+as a fallback unless you specify --force.
+
+With --encrypt, secrets already in the filesystem fallback store are
+encrypted in place instead. The passphrase is read from GH_APP_AUTH_PASSPHRASE,
+from the file descriptor named by GH_APP_AUTH_PASSPHRASE_FD, or prompted for.`,
 		Example: `  # Preview migration (dry-run)
   gh app-auth migrate --dry-run
   
@@ -43,19 +49,33 @@ as a fallback unless you specify --force.`,
   gh app-auth migrate --storage filesystem
   
   # Migrate and remove original key files
-  gh app-auth migrate --force`,
-		RunE: migrateRun(&dryRun, &storage, &force),
+  gh app-auth migrate --force
+
+  # Encrypt plaintext secrets in the filesystem fallback store
+  gh app-auth migrate --encrypt`,
+		RunE: migrateRun(&dryRun, &storage, &force, &encrypt),
 	}
 
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview migration without making changes")
 	cmd.Flags().StringVar(&storage, "storage", storageKeyring, "Target storage: keyring or filesystem")
 	cmd.Flags().BoolVar(&force, "force", false, "Remove original key files after successful migration")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt plaintext secrets in the filesystem fallback store in place")
 
 	return cmd
 }
 
-func migrateRun(dryRun *bool, storage *string, force *bool) func(*cobra.Command, []string) error {
+func migrateRun(dryRun *bool, storage *string, force *bool, encrypt *bool) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
+		if *encrypt {
+			cfg, err := config.Load()
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+			secretMgr := newDefaultSecretsManager(cfg)
+			secretMgr.SetPassphrasePrompt(terminalPassphrasePrompt(true))
+			return encryptFallbackSecrets(secretMgr, *dryRun)
+		}
+
 		// Validate storage option
 		if err := validateStorageOption(*storage); err != nil {
 			return err
@@ -70,6 +90,16 @@ func migrateRun(dryRun *bool, storage *string, force *bool) func(*cobra.Command,
 			return nil // Nothing to migrate
 		}
 
+		// Give entries stored under their name a stable secret ID first, so
+		// keys migrated below are stored under it
+		if err := migrateSecretIDs(cfg, secretMgr, *dryRun); err != nil {
+			return err
+		}
+
+		if err := migrateKeyFingerprints(cfg, secretMgr, *dryRun); err != nil {
+			return err
+		}
+
 		// Analyze apps to migrate
 		appsToMigrate, appsUpToDate, appsNeedAttention := analyzeAppsForMigration(cfg.GitHubApps, *storage)
 
@@ -117,12 +147,7 @@ func initializeMigration(storage *string) (*config.Config, *secrets.Manager, err
 	}
 
 	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	// Check keyring availability
 	keyringAvailable := secretMgr.IsAvailable()
@@ -135,6 +160,96 @@ func initializeMigration(storage *string) (*config.Config, *secrets.Manager, err
 	return cfg, secretMgr, nil
 }
 
+// migrateSecretIDs gives apps and PATs without a secret_id one, and moves
+// their stored secrets from the entries named after them
+func migrateSecretIDs(cfg *config.Config, secretMgr *secrets.Manager, dryRun bool) error {
+	var pending []string
+	for _, app := range cfg.GitHubApps {
+		if app.SecretID == "" {
+			pending = append(pending, fmt.Sprintf("%s (ID: %d)", app.Name, app.AppID))
+		}
+	}
+	for _, pat := range cfg.PATs {
+		if pat.SecretID == "" {
+			pending = append(pending, fmt.Sprintf("%s (PAT)", pat.Name))
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	fmt.Printf("🔑 Entries whose secrets are stored under their name:\n")
+	for _, entry := range pending {
+		fmt.Printf("  • %s\n", entry)
+	}
+	if dryRun {
+		fmt.Printf("Their secrets will be moved to a stable secret ID.\n\n")
+		return nil
+	}
+
+	assigned, legacy, assignErr := cfg.AssignSecretIDs(secretMgr)
+	if assigned > 0 {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+		// The copies under the old names are only removed once the IDs are saved
+		for _, secret := range legacy {
+			if err := secret.Delete(secretMgr); err != nil {
+				fmt.Printf("  ⚠️  Failed to remove %s: %v\n", secret, err)
+			}
+		}
+	}
+	fmt.Printf("✅ Moved the secrets of %d entries to a stable secret ID\n", assigned)
+	if assignErr != nil {
+		fmt.Printf("⚠️  %v\n", assignErr)
+	}
+	fmt.Printf("\n")
+	return nil
+}
+
+// migrateKeyFingerprints records the fingerprint of stored keys that have
+// none, so later key swaps are detected
+func migrateKeyFingerprints(cfg *config.Config, secretMgr *secrets.Manager, dryRun bool) error {
+	var pending []*config.GitHubApp
+	for i := range cfg.GitHubApps {
+		if cfg.GitHubApps[i].NeedsKeyFingerprint() {
+			pending = append(pending, &cfg.GitHubApps[i])
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	fmt.Printf("🔏 Apps without a recorded key fingerprint:\n")
+	for _, app := range pending {
+		fmt.Printf("  • %s (ID: %d)\n", app.Name, app.AppID)
+	}
+	if dryRun {
+		fmt.Printf("The fingerprint of their current key will be recorded.\n\n")
+		return nil
+	}
+
+	recorded := 0
+	for _, app := range pending {
+		privateKey, err := app.GetPrivateKey(secretMgr)
+		if err == nil {
+			err = app.RecordKeyFingerprint(privateKey)
+		}
+		if err != nil {
+			fmt.Printf("  ⚠️  %s: %v\n", app.Name, err)
+			continue
+		}
+		recorded++
+	}
+	if recorded > 0 {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+	}
+	fmt.Printf("✅ Recorded the key fingerprint of %d apps\n\n", recorded)
+	return nil
+}
+
 // analyzeAppsForMigration categorizes apps based on their migration needs
 func analyzeAppsForMigration(apps []config.GitHubApp, targetStorage string) (
 	toMigrate, upToDate, needAttention []config.GitHubApp,
@@ -144,6 +259,15 @@ func analyzeAppsForMigration(apps []config.GitHubApp, targetStorage string) (
 		if app.PrivateKeySource == "" {
 			// Legacy config
 			toMigrate = append(toMigrate, app)
+		} else if len(app.Keys) > 0 {
+			// Apps with several keys are managed by rotate-key
+			upToDate = append(upToDate, app)
+		} else if app.PrivateKeySource == config.PrivateKeySourceCommand ||
+			app.PrivateKeySource == config.PrivateKeySourceEnv ||
+			app.PrivateKeySource == config.PrivateKeySourceSigner {
+			// Keys printed by a command, held in the environment or kept by an
+			// external signer are never copied into storage
+			upToDate = append(upToDate, app)
 		} else if targetStorage == storageKeyring && app.PrivateKeySource != config.PrivateKeySourceKeyring {
 			// Needs migration to keyring
 			toMigrate = append(toMigrate, app)
@@ -253,6 +377,18 @@ func performMigration(
 			failed++
 			continue
 		}
+		if err := app.CheckKeyFingerprint(privateKey); err != nil {
+			fmt.Printf("    ❌ %v\n", err)
+			failed++
+			continue
+		}
+		if app.KeyFingerprint == "" {
+			if err := app.RecordKeyFingerprint(privateKey); err != nil {
+				fmt.Printf("    ❌ %v\n", err)
+				failed++
+				continue
+			}
+		}
 
 		// Migrate based on target storage
 		if err := migrateAppToStorage(app, secretMgr, privateKey, storage, force); err != nil {
@@ -361,3 +497,82 @@ func displayMigrationResults(migrated, failed int, force bool, storage string) {
 		}
 	}
 }
+
+// encryptFallbackSecrets encrypts the plaintext secrets of the filesystem
+// fallback store in place
+func encryptFallbackSecrets(secretMgr *secrets.Manager, dryRun bool) error {
+	plaintext, err := secretMgr.UnencryptedSecrets()
+	if err != nil {
+		return fmt.Errorf("failed to inspect filesystem secrets: %w", err)
+	}
+	if len(plaintext) == 0 {
+		fmt.Printf("✅ All secrets in the filesystem fallback store are encrypted.\n")
+		return nil
+	}
+
+	fmt.Printf("🔓 Unencrypted secrets in the filesystem fallback store:\n")
+	for _, ref := range plaintext {
+		fmt.Printf("  • %s (%s)\n", ref.Name, ref.Type)
+	}
+	fmt.Printf("\n")
+
+	if dryRun {
+		fmt.Printf("🔍 Dry-run mode: No changes will be made.\n")
+		return nil
+	}
+
+	converted, err := secretMgr.EncryptFilesystemSecrets()
+	if errors.Is(err, secrets.ErrPassphraseRequired) {
+		return fmt.Errorf("%w: set %s, set %s, or run this command in a terminal",
+			secrets.ErrPassphraseRequired, secrets.PassphraseEnv, secrets.PassphraseFDEnv)
+	}
+	if err != nil {
+		return fmt.Errorf("encrypted %d of %d secrets: %w", converted, len(plaintext), err)
+	}
+
+	fmt.Printf("✅ Encrypted %d secrets.\n", converted)
+	fmt.Printf("\n💡 Commands reading these secrets now need the same passphrase in %s\n", secrets.PassphraseEnv)
+	fmt.Printf("   or %s when the OS keyring is unavailable.\n", secrets.PassphraseFDEnv)
+	return nil
+}
+
+// terminalPassphrasePrompt returns a prompt that reads the passphrase of the
+// encrypted filesystem store from the terminal, or nil when stdin is not a
+// terminal. With confirm, the passphrase is asked for twice.
+func terminalPassphrasePrompt(confirm bool) secrets.PassphrasePrompt {
+	return terminalPrompt("Passphrase for encrypted secrets: ", confirm)
+}
+
+// terminalPrompt returns a prompt that reads a passphrase from the terminal
+// after printing label, or nil when stdin is not a terminal
+func terminalPrompt(label string, confirm bool) secrets.PassphrasePrompt {
+	fd := int(os.Stdin.Fd()) // #nosec G115 -- file descriptors fit in an int
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+
+	read := func(label string) (string, error) {
+		_, _ = fmt.Fprint(os.Stderr, label)
+		passphrase, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return string(passphrase), nil
+	}
+
+	return func() (string, error) {
+		passphrase, err := read(label)
+		if err != nil || !confirm {
+			return passphrase, err
+		}
+		again, err := read("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+		return passphrase, nil
+	}
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
+	"path/filepath"
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
 )
 
 func TestValidateStorageOption(t *testing.T) {
@@ -123,6 +128,30 @@ func TestAnalyzeAppsForMigration(t *testing.T) {
 			wantUpToDateCount:      0,
 			wantNeedAttentionCount: 0,
 		},
+		{
+			name: "command source stays in place",
+			apps: []config.GitHubApp{
+				{Name: "App1", PrivateKeySource: config.PrivateKeySourceCommand},
+				{Name: "App2", PrivateKeySource: config.PrivateKeySourceInline},
+			},
+			targetStorage:          "keyring",
+			wantToMigrateCount:     1,
+			wantUpToDateCount:      1,
+			wantNeedAttentionCount: 0,
+		},
+		{
+			name: "apps with several keys stay in place",
+			apps: []config.GitHubApp{
+				{Name: "App1", PrivateKeySource: config.PrivateKeySourceKeyring, Keys: []config.AppKey{
+					{Fingerprint: "SHA256:new", State: config.KeyStateActive},
+					{Fingerprint: "SHA256:old", State: config.KeyStateRetiring},
+				}},
+			},
+			targetStorage:          "filesystem",
+			wantToMigrateCount:     0,
+			wantUpToDateCount:      1,
+			wantNeedAttentionCount: 0,
+		},
 		{
 			name: "keyring to filesystem with path",
 			apps: []config.GitHubApp{
@@ -307,3 +336,139 @@ func TestDisplayMigrationResults(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptFallbackSecrets(t *testing.T) {
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+	t.Setenv(secrets.PassphraseEnv, "")
+	t.Setenv(secrets.PassphraseFDEnv, "")
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	if _, err := secretMgr.Store("ci-app", secrets.SecretTypePrivateKey, "key"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if err := encryptFallbackSecrets(secretMgr, false); !errors.Is(err, secrets.ErrPassphraseRequired) {
+		t.Errorf("encryptFallbackSecrets() without passphrase error = %v, want ErrPassphraseRequired", err)
+	}
+
+	t.Setenv(secrets.PassphraseEnv, "s3cret")
+	if err := encryptFallbackSecrets(secretMgr, true); err != nil {
+		t.Fatalf("encryptFallbackSecrets() dry-run error = %v", err)
+	}
+	if plaintext, _ := secretMgr.UnencryptedSecrets(); len(plaintext) != 1 {
+		t.Errorf("UnencryptedSecrets() after dry-run = %v, want the secret untouched", plaintext)
+	}
+
+	if err := encryptFallbackSecrets(secretMgr, false); err != nil {
+		t.Fatalf("encryptFallbackSecrets() error = %v", err)
+	}
+	if plaintext, _ := secretMgr.UnencryptedSecrets(); len(plaintext) != 0 {
+		t.Errorf("UnencryptedSecrets() = %v, want none", plaintext)
+	}
+	if value, _, err := secretMgr.Get("ci-app", secrets.SecretTypePrivateKey); err != nil || value != "key" {
+		t.Errorf("Get() = %q, %v, want key", value, err)
+	}
+}
+
+func TestMigrateSecretIDs(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(home, "config.yml"))
+
+	secretMgr := secrets.NewManager(filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth"))
+	cfg := &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{{
+			Name:             "Legacy App",
+			AppID:            123456,
+			Patterns:         []string{"github.com/org/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring,
+		}},
+		PATs: []config.PersonalAccessToken{{Name: "Legacy PAT", Patterns: []string{"github.com/"}}},
+	}
+	if _, err := cfg.GitHubApps[0].SetPrivateKey(secretMgr, "key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if _, err := cfg.PATs[0].SetPAT(secretMgr, "token"); err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+
+	if err := migrateSecretIDs(cfg, secretMgr, true); err != nil {
+		t.Fatalf("migrateSecretIDs() dry-run error = %v", err)
+	}
+	if cfg.GitHubApps[0].SecretID != "" {
+		t.Error("Dry-run should not assign secret IDs")
+	}
+
+	if err := migrateSecretIDs(cfg, secretMgr, false); err != nil {
+		t.Fatalf("migrateSecretIDs() error = %v", err)
+	}
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	app, pat := saved.GitHubApps[0], saved.PATs[0]
+	if app.SecretID == "" || pat.SecretID == "" {
+		t.Fatalf("Saved entries should have secret IDs: app %q, PAT %q", app.SecretID, pat.SecretID)
+	}
+	if got, err := app.GetPrivateKey(secretMgr); err != nil || got != "key" {
+		t.Errorf("GetPrivateKey() = %q, %v, want the moved key", got, err)
+	}
+	if got, err := pat.GetPAT(secretMgr); err != nil || got != "token" {
+		t.Errorf("GetPAT() = %q, %v, want the moved token", got, err)
+	}
+	if _, _, err := secretMgr.Get("Legacy App", secrets.SecretTypePrivateKey); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("The key stored under the app name should be removed, error = %v", err)
+	}
+
+	// Renaming the app no longer loses its key
+	app.Name = "Renamed App"
+	if !app.HasPrivateKey(secretMgr) {
+		t.Error("The key should still be found after renaming the app")
+	}
+}
+
+func TestMigrateKeyFingerprints(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(home, "config.yml"))
+
+	secretMgr := secrets.NewManager(filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth"))
+	privateKey := testkeys.RSAKeyPEM(t)
+	cfg := &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{{
+			Name:             "Unrecorded App",
+			AppID:            123456,
+			SecretID:         config.NewSecretID(),
+			Patterns:         []string{"github.com/org/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring,
+		}},
+	}
+	if _, err := cfg.GitHubApps[0].SetPrivateKey(secretMgr, privateKey); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	if err := migrateKeyFingerprints(cfg, secretMgr, true); err != nil {
+		t.Fatalf("migrateKeyFingerprints() dry-run error = %v", err)
+	}
+	if cfg.GitHubApps[0].KeyFingerprint != "" {
+		t.Error("Dry-run should not record fingerprints")
+	}
+
+	if err := migrateKeyFingerprints(cfg, secretMgr, false); err != nil {
+		t.Fatalf("migrateKeyFingerprints() error = %v", err)
+	}
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := saved.GitHubApps[0].CheckKeyFingerprint(privateKey); err != nil || saved.GitHubApps[0].KeyFingerprint == "" {
+		t.Errorf("Saved key_fingerprint = %q, %v, want the stored key's", saved.GitHubApps[0].KeyFingerprint, err)
+	}
+}
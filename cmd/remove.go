@@ -3,10 +3,8 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
-	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -139,6 +137,9 @@ func removeSingleApp(cfg *config.Config, appID int64, force bool) error {
 	if err != nil {
 		return err
 	}
+	if err := checkRemovable(fmt.Sprintf("GitHub App %d", appID), cfg.AppOrigin(&appToRemove)); err != nil {
+		return err
+	}
 
 	// Confirm removal unless forced
 	if !force {
@@ -152,6 +153,13 @@ func removeSingleApp(cfg *config.Config, appID int64, force bool) error {
 }
 
 func removeAllApps(cfg *config.Config, force bool) error {
+	for i := range cfg.GitHubApps {
+		app := &cfg.GitHubApps[i]
+		if err := checkRemovable(fmt.Sprintf("GitHub App %d", app.AppID), cfg.AppOrigin(app)); err != nil {
+			return err
+		}
+	}
+
 	// Confirm removal unless forced
 	if !force {
 		if !confirmAllAppsRemoval(cfg.GitHubApps) {
@@ -176,6 +184,9 @@ func removeSinglePAT(cfg *config.Config, patName string, force bool) error {
 	if err != nil {
 		return err
 	}
+	if err := checkRemovable(fmt.Sprintf("PAT %q", patName), cfg.PATOrigin(&patToRemove)); err != nil {
+		return err
+	}
 
 	if !force {
 		if !confirmPATRemoval(patToRemove) {
@@ -187,6 +198,13 @@ func removeSinglePAT(cfg *config.Config, patName string, force bool) error {
 }
 
 func removeAllPATs(cfg *config.Config, force bool) error {
+	for i := range cfg.PATs {
+		pat := &cfg.PATs[i]
+		if err := checkRemovable(fmt.Sprintf("PAT %q", pat.Name), cfg.PATOrigin(pat)); err != nil {
+			return err
+		}
+	}
+
 	if !force {
 		if !confirmAllPATsRemoval(cfg.PATs) {
 			return nil
@@ -203,15 +221,13 @@ func removeAllPATs(cfg *config.Config, force bool) error {
 }
 
 func clearCachedTokens(appID int64) error {
-	// Implementation would clear cached tokens for specific app
-	// For now, just a placeholder
-	return nil
+	_, err := evictCachedTokens(appID)
+	return err
 }
 
 func clearAllCachedTokens() error {
-	// Implementation would clear all cached tokens
-	// For now, just a placeholder
-	return nil
+	_, err := evictCachedTokens(0)
+	return err
 }
 
 // findAppByID finds an app by ID and returns its index and the app itself
@@ -245,21 +261,20 @@ func confirmAppRemoval(appToRemove config.GitHubApp) bool {
 // performAppRemoval performs the actual app removal operations
 func performAppRemoval(cfg *config.Config, appIndex int, appToRemove config.GitHubApp, appID int64) error {
 	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
-
-	// Delete private key from secure storage
-	if err := appToRemove.DeletePrivateKey(secretMgr); err != nil {
-		fmt.Printf("⚠️  Warning: failed to delete private key from storage: %v\n", err)
-	}
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	// Remove the app from configuration
 	cfg.GitHubApps = append(cfg.GitHubApps[:appIndex], cfg.GitHubApps[appIndex+1:]...)
 
+	// Delete private key from secure storage, unless an entry without its own
+	// secret ID still uses it
+	keyDeleted := !cfg.UsesSecrets(appToRemove.StoredSecrets())
+	if keyDeleted {
+		if err := appToRemove.DeletePrivateKey(secretMgr); err != nil {
+			fmt.Printf("⚠️  Warning: failed to delete private key from storage: %v\n", err)
+		}
+	}
+
 	// Save configuration
 	if err := cfg.Save(); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
@@ -271,7 +286,11 @@ func performAppRemoval(cfg *config.Config, appIndex int, appToRemove config.GitH
 	}
 
 	fmt.Printf("✅ Successfully removed GitHub App '%s' (ID: %d)\n", appToRemove.Name, appID)
-	fmt.Printf("   🗑️  Private key deleted from secure storage\n")
+	if keyDeleted {
+		fmt.Printf("   🗑️  Private key deleted from secure storage\n")
+	} else {
+		fmt.Printf("   🔑 Private key kept: another entry uses it (run 'gh app-auth migrate' to separate them)\n")
+	}
 	return nil
 }
 
@@ -296,12 +315,7 @@ func confirmAllAppsRemoval(apps []config.GitHubApp) bool {
 // performAllAppsRemoval performs the actual removal of all apps
 func performAllAppsRemoval(cfg *config.Config) error {
 	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	// Delete all private keys from secure storage
 	for _, app := range cfg.GitHubApps {
@@ -332,6 +346,17 @@ func displayAllAppsRemovalSuccess(count int) {
 	fmt.Printf("   🗑️  All private keys deleted from secure storage\n")
 }
 
+// checkRemovable refuses to remove an entry of the system configuration or a
+// config.d fragment, which gh-app-auth does not write and would bring the
+// entry back
+func checkRemovable(entry string, origin config.Origin) error {
+	if origin.Layer.ReadOnly() {
+		return fmt.Errorf("%s is defined in the %s file %s and cannot be removed here",
+			entry, origin.Layer, origin.Path)
+	}
+	return nil
+}
+
 func findPATByName(cfg *config.Config, name string) (int, config.PersonalAccessToken, error) {
 	for i, pat := range cfg.PATs {
 		if pat.Name == name {
@@ -376,12 +401,7 @@ func confirmAllPATsRemoval(pats []config.PersonalAccessToken) bool {
 }
 
 func performPATRemoval(cfg *config.Config, patIndex int, patToRemove config.PersonalAccessToken) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	if err := patToRemove.DeletePAT(secretMgr); err != nil {
 		fmt.Printf("⚠️  Warning: failed to delete PAT from storage: %v\n", err)
@@ -399,12 +419,7 @@ func performPATRemoval(cfg *config.Config, patIndex int, patToRemove config.Pers
 }
 
 func performAllPATsRemoval(cfg *config.Config) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	for _, pat := range cfg.PATs {
 		if err := pat.DeletePAT(secretMgr); err != nil {
@@ -6,6 +6,9 @@ import (
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
 	"gopkg.in/yaml.v3"
 )
 
@@ -101,7 +104,7 @@ func TestRemoveRun_RemoveSingleApp(t *testing.T) {
 	keyPath := filepath.Join(tempDir, "test-key.pem")
 
 	// Generate valid test key
-	testKey := generateTestRSAKey(t)
+	testKey := testkeys.RSAKeyPEM(t)
 	if err := os.WriteFile(keyPath, []byte(testKey), 0600); err != nil {
 		t.Fatalf("Failed to write test key: %v", err)
 	}
@@ -183,7 +186,7 @@ func TestRemoveRun_RemoveAllApps(t *testing.T) {
 	keyPath := filepath.Join(tempDir, "test-key.pem")
 
 	// Generate valid test key
-	testKey := generateTestRSAKey(t)
+	testKey := testkeys.RSAKeyPEM(t)
 	if err := os.WriteFile(keyPath, []byte(testKey), 0600); err != nil {
 		t.Fatalf("Failed to write test key: %v", err)
 	}
@@ -248,3 +251,43 @@ func TestRemoveRun_RemoveAllApps(t *testing.T) {
 		}
 	})
 }
+
+func TestPerformAppRemoval_SharedKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(home, "config.yml"))
+
+	// Two installations stored under one name, as before secret IDs
+	shared := config.GitHubApp{
+		Name:             "Shared App",
+		AppID:            123456,
+		InstallationID:   1,
+		Patterns:         []string{"github.com/org1/"},
+		PrivateKeySource: config.PrivateKeySourceKeyring,
+	}
+	other := shared
+	other.InstallationID = 2
+	other.Patterns = []string{"github.com/org2/"}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{shared, other}}
+
+	secretMgr := secrets.NewManager(filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth"))
+	if _, err := shared.SetPrivateKey(secretMgr, "key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	if err := performAppRemoval(cfg, 0, shared, shared.AppID); err != nil {
+		t.Fatalf("performAppRemoval() error = %v", err)
+	}
+	if got, err := other.GetPrivateKey(secretMgr); err != nil || got != "key" {
+		t.Errorf("The remaining installation lost its key: %q, %v", got, err)
+	}
+
+	if err := performAppRemoval(cfg, 0, other, other.AppID); err != nil {
+		t.Fatalf("performAppRemoval() error = %v", err)
+	}
+	if other.HasPrivateKey(secretMgr) {
+		t.Error("The key should be deleted with the last entry using it")
+	}
+}
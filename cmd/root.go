@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"github.com/spf13/cobra"
 )
 
+// configFileFlag is the global --config flag
+var configFileFlag string
+
 var rootCmd = &cobra.Command{
 	Use:   "gh-app-auth",
 	Short: "GitHub App authentication for GitHub CLI",
@@ -47,10 +51,20 @@ func init() {
 	rootCmd.AddCommand(NewScopeCmd())
 	rootCmd.AddCommand(NewDebugCmd())
 	rootCmd.AddCommand(NewConfigCmd())
+	rootCmd.AddCommand(NewAgentCmd())
+	rootCmd.AddCommand(NewCacheCmd())
+	rootCmd.AddCommand(NewRotateKeyCmd())
+	rootCmd.AddCommand(NewExportCmd())
+	rootCmd.AddCommand(NewImportCmd())
+	rootCmd.AddCommand(NewIdentityCmd())
 
 	// Global flags
 	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug output")
-	rootCmd.PersistentFlags().String("config", "", "Path to configuration file")
+	rootCmd.PersistentFlags().StringVar(&configFileFlag, "config", "",
+		"Path to configuration file; secrets and caches are kept next to it")
+	cobra.OnInitialize(func() { paths.SetConfigFile(configFileFlag) })
+	rootCmd.PersistentFlags().StringVar(&configEnvName, "config-env", "",
+		"Environment variable holding the configuration as JSON (stateless mode)")
 }
 
 // Version information.
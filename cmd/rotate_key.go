@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
+	"github.com/spf13/cobra"
+)
+
+type rotateKeyFlags struct {
+	appID   int64
+	keyFile string
+	prune   bool
+}
+
+func NewRotateKeyCmd() *cobra.Command {
+	var flags rotateKeyFlags
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Rotate a GitHub App private key without downtime",
+		Long: `Add a new private key to a configured GitHub App and retire the old one.
+
+GitHub lets an app hold several private keys at once. Generate a new key in
+the app's settings, then run rotate-key with it: the key is checked against
+GitHub, stored, and made the active key. The previous keys are kept as
+retiring keys, which are only tried when GitHub rejects the active one.
+
+Once the old key is deleted on GitHub, remove the retiring keys with --prune.`,
+		Example: `  # Add and activate a new key
+  gh app-auth rotate-key --app-id 123456 --key-file ~/Downloads/my-app.2024-06-01.private-key.pem
+
+  # Read the new key from the environment
+  GH_APP_PRIVATE_KEY="$(cat new-key.pem)" gh app-auth rotate-key --app-id 123456
+
+  # Remove retiring keys after deleting them on GitHub
+  gh app-auth rotate-key --app-id 123456 --prune`,
+		Args: cobra.NoArgs,
+		RunE: rotateKeyRun(&flags),
+	}
+
+	cmd.Flags().Int64Var(&flags.appID, "app-id", 0, "GitHub App ID")
+	cmd.Flags().StringVarP(&flags.keyFile, "key-file", "k", "", "Path to the new private key file")
+	cmd.Flags().BoolVar(&flags.prune, "prune", false, "Remove retiring keys instead of adding one")
+	cmd.MarkFlagsMutuallyExclusive("key-file", "prune")
+
+	return cmd
+}
+
+func rotateKeyRun(flags *rotateKeyFlags) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if flags.appID <= 0 {
+			return fmt.Errorf("--app-id is required")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		// Every entry of the app (one per installation) holds its own keys
+		var apps []*config.GitHubApp
+		for i := range cfg.GitHubApps {
+			if cfg.GitHubApps[i].AppID == flags.appID {
+				apps = append(apps, &cfg.GitHubApps[i])
+			}
+		}
+		if len(apps) == 0 {
+			return fmt.Errorf("GitHub App with ID %d not found", flags.appID)
+		}
+
+		secretMgr := newDefaultSecretsManager(cfg)
+
+		if flags.prune {
+			return pruneRetiringKeys(cfg, apps, secretMgr)
+		}
+
+		privateKey, _, err := getPrivateKey(flags.keyFile)
+		if err != nil {
+			return err
+		}
+
+		authenticator := auth.NewAuthenticator()
+		authenticator.SetTransport(transport.FromConfig(cfg))
+		if err := authenticator.VerifyAppKey(apps[0], privateKey); err != nil {
+			return fmt.Errorf("GitHub did not accept the new key for app %d: %w", flags.appID, err)
+		}
+
+		return addRotatedKey(cfg, apps, secretMgr, privateKey)
+	}
+}
+
+// addRotatedKey stores the verified key as the active key of apps and retires
+// their other keys
+func addRotatedKey(cfg *config.Config, apps []*config.GitHubApp, secretMgr *secrets.Manager, privateKey string) error {
+	now := time.Now().UTC()
+	var adopted []*config.GitHubApp
+
+	for _, app := range apps {
+		firstRotation := len(app.Keys) == 0
+		fingerprint, backend, err := app.AddKey(secretMgr, privateKey, now)
+		if err != nil {
+			return fmt.Errorf("failed to add key to %s: %w", app.Name, err)
+		}
+		if firstRotation {
+			adopted = append(adopted, app)
+		}
+		retired := app.RetireKeysExcept(fingerprint)
+
+		fmt.Printf("✅ Added key %s to '%s' (stored in %s)\n", fingerprint, app.Name, backend)
+		if retired > 0 {
+			fmt.Printf("   %d previous key(s) retiring\n", retired)
+		}
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	// The single key each app had is now part of its key list
+	for _, app := range adopted {
+		_ = app.DeleteLegacyKey(secretMgr)
+	}
+
+	fmt.Println()
+	fmt.Println("Retiring keys are still tried if GitHub rejects the new key.")
+	fmt.Println("Once the old key is deleted in the app's settings on GitHub, run:")
+	fmt.Printf("  gh app-auth rotate-key --app-id %d --prune\n", apps[0].AppID)
+	return nil
+}
+
+// pruneRetiringKeys deletes the retiring keys of apps
+func pruneRetiringKeys(cfg *config.Config, apps []*config.GitHubApp, secretMgr *secrets.Manager) error {
+	pruned := 0
+	var pruneErr error
+	for _, app := range apps {
+		removed, err := app.RemoveRetiringKeys(secretMgr)
+		for _, key := range removed {
+			fmt.Printf("🗑️  Removed key %s from '%s'\n", key.Fingerprint, app.Name)
+		}
+		pruned += len(removed)
+		if err != nil {
+			pruneErr = fmt.Errorf("failed to remove keys of %s: %w", app.Name, err)
+			break
+		}
+	}
+
+	if pruned > 0 {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+	}
+	if pruneErr != nil {
+		return pruneErr
+	}
+	if pruned == 0 {
+		fmt.Println("No retiring keys to remove")
+	}
+	return nil
+}
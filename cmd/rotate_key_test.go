@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+)
+
+// setupRotateKeyTest configures an app whose key is in the keyring and whose
+// API is served by a fake GitHub answering GET /app with status
+func setupRotateKeyTest(t *testing.T, status int) (*config.GitHubApp, *secrets.Manager) {
+	t.Helper()
+
+	keyring.MockInit()
+	t.Cleanup(func() { keyring.MockInitWithError(nil) })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GH_APP_AUTH_CONFIG", "")
+	t.Setenv("GH_APP_PRIVATE_KEY", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 123456})
+	}))
+	t.Cleanup(server.Close)
+
+	secretMgr := secrets.NewManager(filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth"))
+	app := &config.GitHubApp{
+		Name:             "Rotating App",
+		AppID:            123456,
+		InstallationID:   789012,
+		PrivateKeySource: config.PrivateKeySourceKeyring,
+		Patterns:         []string{"github.com/org/"},
+		APIURL:           server.URL,
+	}
+	if _, err := app.SetPrivateKey(secretMgr, writeRotateTestKey(t, "old.pem")); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{*app}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return app, secretMgr
+}
+
+// writeRotateTestKey writes a new RSA key to a file in a temporary directory
+// and returns its content
+func writeRotateTestKey(t *testing.T, name string) string {
+	t.Helper()
+	content := testkeys.RSAKeyPEM(t)
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), name), []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return content
+}
+
+func TestRotateKeyRun(t *testing.T) {
+	app, secretMgr := setupRotateKeyTest(t, http.StatusOK)
+	newKey := writeRotateTestKey(t, "new.pem")
+
+	flags := &rotateKeyFlags{appID: app.AppID, keyFile: filepath.Join(os.Getenv("HOME"), "new.pem")}
+	if err := rotateKeyRun(flags)(NewRotateKeyCmd(), nil); err != nil {
+		t.Fatalf("rotate-key error = %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	rotated := cfg.GitHubApps[0]
+	if len(rotated.Keys) != 2 {
+		t.Fatalf("Keys = %+v, want the old and the new key", rotated.Keys)
+	}
+	if rotated.Keys[0].State != config.KeyStateRetiring || rotated.Keys[1].State != config.KeyStateActive {
+		t.Errorf("Keys = %+v, want the old key retiring and the new one active", rotated.Keys)
+	}
+	if got, err := rotated.GetPrivateKey(secretMgr); err != nil || got != newKey {
+		t.Errorf("GetPrivateKey() should return the new key, error = %v", err)
+	}
+	if _, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey); err == nil {
+		t.Error("The key stored under the app name should be removed once it is in the key list")
+	}
+
+	flags = &rotateKeyFlags{appID: app.AppID, prune: true}
+	if err := rotateKeyRun(flags)(NewRotateKeyCmd(), nil); err != nil {
+		t.Fatalf("rotate-key --prune error = %v", err)
+	}
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if keys := cfg.GitHubApps[0].Keys; len(keys) != 1 || keys[0].State != config.KeyStateActive {
+		t.Errorf("Keys after prune = %+v, want only the active key", keys)
+	}
+	if !cfg.GitHubApps[0].HasPrivateKey(secretMgr) {
+		t.Error("The active key should still be readable after prune")
+	}
+}
+
+func TestRotateKeyRun_RejectedKey(t *testing.T) {
+	app, secretMgr := setupRotateKeyTest(t, http.StatusUnauthorized)
+	writeRotateTestKey(t, "new.pem")
+
+	flags := &rotateKeyFlags{appID: app.AppID, keyFile: filepath.Join(os.Getenv("HOME"), "new.pem")}
+	if err := rotateKeyRun(flags)(NewRotateKeyCmd(), nil); err == nil {
+		t.Fatal("Expected rotate-key to fail when GitHub rejects the new key")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.GitHubApps[0].Keys) != 0 {
+		t.Errorf("Keys = %+v, want the configuration unchanged", cfg.GitHubApps[0].Keys)
+	}
+	if !cfg.GitHubApps[0].HasPrivateKey(secretMgr) {
+		t.Error("The current key should be left in place")
+	}
+}
+
+func TestRotateKeyRun_Errors(t *testing.T) {
+	setupRotateKeyTest(t, http.StatusOK)
+
+	if err := rotateKeyRun(&rotateKeyFlags{})(NewRotateKeyCmd(), nil); err == nil {
+		t.Error("Expected an error without --app-id")
+	}
+	if err := rotateKeyRun(&rotateKeyFlags{appID: 999})(NewRotateKeyCmd(), nil); err == nil {
+		t.Error("Expected an error for an unknown app")
+	}
+	if err := rotateKeyRun(&rotateKeyFlags{appID: 123456})(NewRotateKeyCmd(), nil); err == nil {
+		t.Error("Expected an error without a new key")
+	}
+}
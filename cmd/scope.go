@@ -2,14 +2,14 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/scope"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/signer"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
@@ -50,15 +50,11 @@ func scopeRun(forceRefresh bool) error {
 	}
 
 	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretsMgr := secrets.NewManager(configDir)
+	secretsMgr := newDefaultSecretsManager(cfg)
 
 	// Initialize scope manager
 	scopeMgr := scope.NewManager()
+	scopeMgr.SetTransport(transport.FromConfig(cfg))
 	jwtGen := jwt.NewGenerator()
 
 	updated := false
@@ -73,17 +69,10 @@ func scopeRun(forceRefresh bool) error {
 		if needsRefresh {
 			fmt.Printf("Fetching scope for %q (App ID: %d)...\n", app.Name, app.AppID)
 
-			// Get private key
-			privateKey, err := app.GetPrivateKey(secretsMgr)
-			if err != nil {
-				fmt.Printf("  ⚠️  Failed to get private key: %v\n", err)
-				continue
-			}
-
 			// Generate JWT
-			jwtToken, err := jwtGen.GenerateTokenFromKey(app.AppID, privateKey)
+			jwtToken, err := scopeJWT(app, secretsMgr, jwtGen)
 			if err != nil {
-				fmt.Printf("  ⚠️  Failed to generate JWT: %v\n", err)
+				fmt.Printf("  ⚠️  %v\n", err)
 				continue
 			}
 
@@ -150,3 +139,29 @@ func displayScope(app *config.GitHubApp) {
 		fmt.Println("   ⚠️  Cache expired - run with --refresh")
 	}
 }
+
+// scopeJWT generates a JWT for app from its private key or external signer
+func scopeJWT(app *config.GitHubApp, secretsMgr *secrets.Manager, jwtGen *jwt.Generator) (string, error) {
+	if app.PrivateKeySource == config.PrivateKeySourceSigner {
+		keySigner, err := app.OpenSigner()
+		if err != nil {
+			return "", fmt.Errorf("failed to open signer: %w", err)
+		}
+		defer func() { _ = signer.Close(keySigner) }()
+		jwtToken, err := jwtGen.GenerateTokenWithSigner(app.AppID, keySigner)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate JWT: %w", err)
+		}
+		return jwtToken, nil
+	}
+
+	privateKey, err := app.GetPrivateKey(secretsMgr)
+	if err != nil {
+		return "", fmt.Errorf("failed to get private key: %w", err)
+	}
+	jwtToken, err := jwtGen.GenerateTokenFromKey(app.AppID, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT: %w", err)
+	}
+	return jwtToken, nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/spf13/cobra"
 )
 
@@ -245,21 +246,31 @@ func setupGitHubApp(
 		// Get the representative pattern for this org (first one)
 		repPattern := orgPatterns[0]
 
+		// Create the GitHub App entry for this org, keeping the API endpoint
+		// of an entry already configured for the app
+		app := createGitHubApp(appID, name, installationID, orgPatterns, priority)
+		app.APIURL = configuredAPIURL(cfg, appID)
+
 		// Auto-detect installation ID if not provided (per org)
 		orgInstallationID := installationID
 		if orgInstallationID == 0 {
-			detectedID, err := autoDetectInstallationID(jwtToken, []string{repPattern})
+			detectedID, err := autoDetectInstallationID(
+				transport.FromConfig(cfg), jwtToken, &app, []string{repPattern},
+			)
 			if err != nil {
 				return nil, fmt.Errorf("failed to auto-detect installation ID for org '%s': %w", org, err)
 			}
 			orgInstallationID = detectedID
+			app.InstallationID = orgInstallationID
 			if !silent {
 				fmt.Printf("🔍 Auto-detected installation ID for '%s': %d\n", org, orgInstallationID)
 			}
 		}
 
-		// Create the GitHub App entry for this org
-		app := createGitHubApp(appID, name, orgInstallationID, orgPatterns, priority)
+		app.SecretID = appSecretID(cfg, appID, orgInstallationID)
+		if err := app.RecordKeyFingerprint(privateKeyContent); err != nil {
+			return nil, err
+		}
 
 		// Store private key and configure storage (only needed once, but we do it for each)
 		backend, err = configureAppStorage(&app, privateKeyContent, expandedKeyFile, useKeyring)
@@ -310,15 +321,10 @@ func setupPAT(
 		Patterns: patterns,
 		Priority: priority,
 		Username: username,
+		SecretID: patSecretID(cfg, name),
 	}
 
-	// Use XDG config directory for secrets
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(cfg)
 
 	// Store PAT
 	backend, err := pat.SetPAT(secretMgr, token)
@@ -450,7 +456,9 @@ func generateJWTForSetup(appID int64, privateKeyContent string) (string, error)
 }
 
 // autoDetectInstallationID finds the installation ID for the GitHub App using the patterns
-func autoDetectInstallationID(jwtToken string, patterns []string) (int64, error) {
+func autoDetectInstallationID(
+	factory *transport.Factory, jwtToken string, app *config.GitHubApp, patterns []string,
+) (int64, error) {
 	if len(patterns) == 0 {
 		return 0, fmt.Errorf("no patterns provided")
 	}
@@ -464,7 +472,7 @@ func autoDetectInstallationID(jwtToken string, patterns []string) (int64, error)
 	}
 
 	// Try to find installation for the org
-	installationID, err := findInstallationForOrg(jwtToken, host, org)
+	installationID, err := findInstallationForOrg(factory, jwtToken, app.APIBaseURL(host), org)
 	if err != nil {
 		return 0, err
 	}
@@ -494,15 +502,11 @@ func parsePatternForInstallation(pattern string) (host, org string, err error) {
 	return host, org, nil
 }
 
-// findInstallationForOrg finds the installation ID for a GitHub App in an organization
-func findInstallationForOrg(jwtToken, host, org string) (int64, error) {
+// findInstallationForOrg finds the installation ID for a GitHub App in an
+// organization through the REST API at apiBaseURL
+func findInstallationForOrg(factory *transport.Factory, jwtToken, apiBaseURL, org string) (int64, error) {
 	// Construct API URL for listing installations
-	var apiURL string
-	if host == gitHubAPIHost {
-		apiURL = "https://api.github.com/app/installations"
-	} else {
-		apiURL = fmt.Sprintf("https://%s/api/v3/app/installations", host)
-	}
+	apiURL := apiBaseURL + "/app/installations"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -515,7 +519,10 @@ func findInstallationForOrg(jwtToken, host, org string) (int64, error) {
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
+	client, err := factory.Client(apiURL)
+	if err != nil {
+		return 0, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("failed to list installations: %w", err)
@@ -580,19 +587,46 @@ func createGitHubApp(
 	}
 }
 
+// configuredAPIURL returns the api_url of an entry already configured for
+// appID, or an empty string
+func configuredAPIURL(cfg *config.Config, appID int64) string {
+	for _, app := range cfg.GitHubApps {
+		if app.AppID == appID && app.APIURL != "" {
+			return app.APIURL
+		}
+	}
+	return ""
+}
+
+// appSecretID returns the secret ID of the entry that setup replaces, so its
+// key is overwritten in place, or a new ID for a new entry
+func appSecretID(cfg *config.Config, appID, installationID int64) string {
+	for _, app := range cfg.GitHubApps {
+		if app.AppID == appID && app.InstallationID == installationID && app.SecretID != "" {
+			return app.SecretID
+		}
+	}
+	return config.NewSecretID()
+}
+
+// patSecretID returns the secret ID of the PAT that setup replaces, or a new one
+func patSecretID(cfg *config.Config, name string) string {
+	for _, pat := range cfg.PATs {
+		if pat.Name == name && pat.SecretID != "" {
+			return pat.SecretID
+		}
+	}
+	return config.NewSecretID()
+}
+
 // configureAppStorage configures the storage for the GitHub App's private key
 func configureAppStorage(
 	app *config.GitHubApp, privateKeyContent, expandedKeyFile string, useKeyring bool,
 ) (secrets.StorageBackend, error) {
-	// Use XDG config directory for secrets
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretMgr := secrets.NewManager(configDir)
+	secretMgr := newDefaultSecretsManager(nil)
 
 	var backend secrets.StorageBackend
+	var err error
 	if useKeyring {
 		// Try keyring storage
 		backend, err = app.SetPrivateKey(secretMgr, privateKeyContent)
@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,25 +12,10 @@ import (
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
 )
 
-// generateTestRSAKey generates a test RSA private key in PEM format
-func generateTestRSAKey(t *testing.T) string {
-	t.Helper()
-
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		t.Fatalf("Failed to generate RSA key: %v", err)
-	}
-
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-
-	return string(pem.EncodeToMemory(privateKeyPEM))
-}
-
 func TestNewSetupCmd(t *testing.T) {
 	cmd := NewSetupCmd()
 
@@ -288,6 +271,27 @@ func TestValidateKeyFile(t *testing.T) {
 	})
 }
 
+func TestAutoDetectInstallationID_APIURL(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_, _ = w.Write([]byte(`[{"id": 42, "account": {"login": "MyOrg", "type": "Organization"}}]`))
+	}))
+	defer server.Close()
+
+	app := &config.GitHubApp{AppID: 1, APIURL: server.URL + "/custom/api"}
+	id, err := autoDetectInstallationID(transport.New(nil), "jwt", app, []string{"ghes.example.com/myorg/*"})
+	if err != nil {
+		t.Fatalf("autoDetectInstallationID() error = %v", err)
+	}
+	if id != 42 {
+		t.Errorf("autoDetectInstallationID() = %d, want 42", id)
+	}
+	if requested != "/custom/api/app/installations" {
+		t.Errorf("requested %q, want the app's api_url", requested)
+	}
+}
+
 func TestCreateGitHubApp(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -416,7 +420,7 @@ func TestExpandPath(t *testing.T) {
 }
 
 func TestGenerateJWTForSetup(t *testing.T) {
-	validKey := generateTestRSAKey(t)
+	validKey := testkeys.RSAKeyPEM(t)
 
 	t.Run("valid JWT generation", func(t *testing.T) {
 		token, err := generateJWTForSetup(123456, validKey)
@@ -617,7 +621,7 @@ func TestSetupRun_Integration(t *testing.T) {
 	keyPath := filepath.Join(tempDir, "test-key.pem")
 
 	// Generate valid test key
-	testKey := generateTestRSAKey(t)
+	testKey := testkeys.RSAKeyPEM(t)
 	if err := os.WriteFile(keyPath, []byte(testKey), 0600); err != nil {
 		t.Fatalf("Failed to write test key: %v", err)
 	}
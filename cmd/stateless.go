@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// configEnvName is the --config-env flag: an environment variable holding the
+// whole configuration as JSON, which also enables stateless mode
+var configEnvName string
+
+// statelessMode reports whether git-credential, exec and test should take
+// their configuration from the environment and leave the disk untouched:
+// no config file is read or written, installation tokens and resolved
+// installations are kept in memory, and the agent is not used.
+func statelessMode() bool {
+	return configEnvName != "" || config.StatelessRequested()
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+)
+
+// useStatelessHome points the home directory and config path at an empty
+// temporary directory, so tests can check that nothing is written there
+func useStatelessHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(home, "config.yml"))
+	for _, name := range []string{
+		config.StatelessEnv, config.AppIDEnv, config.AppNameEnv, config.InstallationIDEnv,
+		config.PrivateKeyEnv, config.PrivateKeyPathEnv, config.PatternsEnv,
+	} {
+		t.Setenv(name, "")
+	}
+	previous := configEnvName
+	t.Cleanup(func() { configEnvName = previous })
+	return home
+}
+
+// assertEmptyDir fails when anything was written to dir
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("stateless mode wrote %s", entry.Name())
+	}
+}
+
+func TestStatelessMode_AppFromEnvironment(t *testing.T) {
+	home := useStatelessHome(t)
+	key := testkeys.RSAKeyPEM(t)
+	t.Setenv(config.StatelessEnv, "1")
+	t.Setenv(config.AppIDEnv, "4242")
+	t.Setenv(config.InstallationIDEnv, "99")
+	t.Setenv(config.PrivateKeyEnv, base64.StdEncoding.EncodeToString([]byte(key)))
+	t.Setenv(config.PatternsEnv, "github.com/ci-org/, github.com/ci-tools/")
+
+	if !statelessMode() {
+		t.Fatal("statelessMode() = false with GH_APP_AUTH_STATELESS set")
+	}
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		t.Fatalf("loadCredentialConfig() error = %v", err)
+	}
+
+	app, pat, err := findMatchingCredential(cfg, "https://github.com/ci-tools/build")
+	if err != nil || app == nil || pat != nil {
+		t.Fatalf("findMatchingCredential() = %v, %v, %v, want the environment app", app, pat, err)
+	}
+	if app.AppID != 4242 || app.InstallationID != 99 || app.Name != "app-4242" {
+		t.Errorf("app = %+v, want the app described by the environment", app)
+	}
+	if got, err := app.GetPrivateKey(secrets.NewManager(home)); err != nil || got != key {
+		t.Errorf("GetPrivateKey() error = %v, want the decoded key", err)
+	}
+
+	// Unmatched repositories must not trigger the automatic setup that saves config.yml
+	t.Setenv(config.PrivateKeyPathEnv, filepath.Join(home, "unused.pem"))
+	app, _, err = findMatchingCredential(cfg, "https://github.com/elsewhere/repo")
+	if err != nil || app != nil {
+		t.Errorf("findMatchingCredential() = %v, %v, want no match", app, err)
+	}
+
+	_ = newCredentialAuthenticator(cfg)
+	assertEmptyDir(t, home)
+}
+
+func TestStatelessMode_ConfigEnv(t *testing.T) {
+	home := useStatelessHome(t)
+	t.Setenv("CI_GH_APP_AUTH", `{
+		"pats": [{
+			"name": "ci-pat",
+			"private_key_source": "env",
+			"token_env": "CI_TOKEN",
+			"patterns": ["bitbucket.example.com/"]
+		}]
+	}`)
+	t.Setenv("CI_TOKEN", "pat-from-env")
+	configEnvName = "CI_GH_APP_AUTH"
+
+	if !statelessMode() {
+		t.Fatal("statelessMode() = false with --config-env")
+	}
+	cfg, err := loadTestConfiguration()
+	if err != nil {
+		t.Fatalf("loadTestConfiguration() error = %v", err)
+	}
+	_, pat, err := findMatchingCredential(cfg, "https://bitbucket.example.com/scm/team/repo")
+	if err != nil || pat == nil {
+		t.Fatalf("findMatchingCredential() = %v, %v, want the PAT from the blob", pat, err)
+	}
+	if token, err := pat.GetPAT(secrets.NewManager(home)); err != nil || token != "pat-from-env" {
+		t.Errorf("GetPAT() = %q, %v, want pat-from-env", token, err)
+	}
+
+	t.Setenv("CI_GH_APP_AUTH", `{"pats": [{"name": "ci-pat", "patterns": ["x/"], "typo": true}]}`)
+	if _, err := loadCredentialConfig(); err == nil {
+		t.Error("Expected error for an unknown field in the configuration blob")
+	}
+
+	configEnvName = "CI_UNSET_VARIABLE"
+	if _, err := loadCredentialConfig(); err == nil {
+		t.Error("Expected error for an empty configuration variable")
+	}
+
+	assertEmptyDir(t, home)
+}
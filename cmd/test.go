@@ -7,15 +7,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/cli/go-gh/v2/pkg/repository"
 	"github.com/spf13/cobra"
 )
@@ -36,6 +39,7 @@ For GitHub Apps this command verifies that:
 2. JWT token generation works with the private key
 3. Installation token can be retrieved
 4. GitHub API access works with the token
+5. The app's bot identity, used as git credential username, can be resolved
 
 For Personal Access Tokens this command verifies that:
 1. A PAT is configured for the repository pattern
@@ -58,13 +62,15 @@ For Personal Access Tokens this command verifies that:
 	return cmd
 }
 
-func newDefaultSecretsManager() (*secrets.Manager, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+// newDefaultSecretsManager creates a secrets manager with the extension's
+// fallback directory and, when cfg is given, its secret backends
+func newDefaultSecretsManager(cfg *config.Config) *secrets.Manager {
+	secretMgr := secrets.NewManager(paths.SecretsDir())
+	if cfg != nil {
+		secretMgr.Configure(cfg.SecretBackends)
+		secretMgr.SetHTTPClientFactory(transport.FromConfig(cfg).Client)
 	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	return secrets.NewManager(configDir), nil
+	return secretMgr
 }
 
 func testRun(repo *string, verbose *bool) func(*cobra.Command, []string) error {
@@ -145,25 +151,24 @@ func canonicalRepository(value string) (string, error) {
 	return fmt.Sprintf("%s/%s/%s", repo.Host, repo.Owner, repo.Name), nil
 }
 
-func testAPIAccess(token, repoURL string, verbose bool) error {
-	// Extract host and owner/repo from URL
-	host := extractHost(repoURL)
+func testAPIAccess(factory *transport.Factory, token, apiBaseURL, repoURL string, verbose bool) error {
+	// Extract owner/repo from URL
 	owner, repo, err := extractOwnerRepo(repoURL)
 	if err != nil {
 		return fmt.Errorf("failed to parse repository URL: %w", err)
 	}
 
 	// Use raw HTTP instead of go-gh to avoid GitHub CLI auth requirement
-	apiURL := fmt.Sprintf("https://%s/api/v3/repos/%s/%s", host, owner, repo)
-	if host == gitHubAPIHost {
-		apiURL = fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
-	}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s", apiBaseURL, owner, repo)
 
 	// Make HTTP request
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	client := &http.Client{}
+	client, err := factory.Client(apiURL)
+	if err != nil {
+		return err
+	}
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -264,6 +269,10 @@ func extractOwnerRepo(repoURL string) (owner, repo string, err error) {
 
 // loadTestConfiguration loads and validates the configuration for testing
 func loadTestConfiguration() (*config.Config, error) {
+	if statelessMode() {
+		return loadCredentialConfig()
+	}
+
 	cfg, err := config.Load()
 	if os.IsNotExist(err) {
 		return nil, fmt.Errorf("no GitHub Apps or Personal Access Tokens configured. Run 'gh app-auth setup' first")
@@ -300,11 +309,14 @@ func runAuthenticationTests(cfg *config.Config, repoURL string, verbose bool) er
 		fmt.Printf("Step 1: Finding matching credential...\n")
 	}
 
-	matchedApp, matchedPAT, err := findMatchingCredential(cfg, repoURL)
+	// Resolve exactly as git-credential does, so the credential tested is the
+	// one git gets
+	decision, err := resolveMatchingCredential(cfg, repoURL)
 	if err != nil {
 		return err
 	}
-	if matchedApp == nil && matchedPAT == nil {
+	matchedApp, matchedPAT := decision.App, decision.PAT
+	if !decision.Found() {
 		return fmt.Errorf("no matching GitHub App or Personal Access Token found for %s", repoURL)
 	}
 
@@ -312,44 +324,101 @@ func runAuthenticationTests(cfg *config.Config, repoURL string, verbose bool) er
 		if verbose {
 			fmt.Printf("✅ Found matching PAT: %s\n", matchedPAT.Name)
 			fmt.Printf("   Patterns: %v\n", matchedPAT.Patterns)
-			fmt.Printf("   Priority: %d\n\n", matchedPAT.Priority)
+			fmt.Printf("   Priority: %d\n", matchedPAT.Priority)
+			fmt.Printf("   Matched by: %s %q\n\n", decision.Rule, decision.Pattern)
 		} else {
 			fmt.Printf("✅ Matched Personal Access Token: %s\n", matchedPAT.Name)
 		}
-		return runPATAuthenticationTests(matchedPAT, repoURL, verbose)
+		factory := transport.FromConfig(cfg)
+		if err := testTransportSettings(factory, matchedPAT.APIBaseURL(repoURL), verbose); err != nil {
+			return err
+		}
+		secretMgr := newDefaultSecretsManager(cfg)
+		return runPATAuthenticationTests(matchedPAT, repoURL, factory, secretMgr, verbose)
 	}
 
 	if verbose {
 		fmt.Printf("✅ Found matching app: %s (ID: %d)\n", matchedApp.Name, matchedApp.AppID)
 		fmt.Printf("   Patterns: %v\n", matchedApp.Patterns)
-		fmt.Printf("   Priority: %d\n\n", matchedApp.Priority)
+		fmt.Printf("   Priority: %d\n", matchedApp.Priority)
+		fmt.Printf("   Matched by: %s %q\n\n", decision.Rule, decision.Pattern)
 	} else {
 		fmt.Printf("✅ Matched GitHub App: %s\n", matchedApp.Name)
 	}
 
-	return runGitHubAppAuthenticationTests(matchedApp, repoURL, verbose)
+	factory := transport.FromConfig(cfg)
+	if err := testTransportSettings(factory, matchedApp.APIBaseURL(repoURL), verbose); err != nil {
+		return err
+	}
+
+	if err := testKeyFingerprint(cfg, matchedApp, verbose); err != nil {
+		return err
+	}
+
+	authenticator := auth.NewAuthenticator()
+	if !statelessMode() {
+		// The bot identity found here becomes the app's git credential username
+		authenticator.PersistAppIdentities()
+	}
+	authenticator.SetTransport(factory)
+	authenticator.ConfigureSecretBackends(cfg.SecretBackends)
+
+	return runGitHubAppAuthenticationTests(matchedApp, repoURL, factory, authenticator, verbose)
 }
 
-func runGitHubAppAuthenticationTests(matchedApp *config.GitHubApp, repoURL string, verbose bool) error {
-	jwtToken, err := testJWTGeneration(matchedApp, verbose)
+func runGitHubAppAuthenticationTests(
+	matchedApp *config.GitHubApp, repoURL string, factory *transport.Factory,
+	authenticator *auth.Authenticator, verbose bool,
+) error {
+	jwtToken, err := testJWTGeneration(authenticator, matchedApp, verbose)
 	if err != nil {
 		return err
 	}
 
-	installationToken, err := testInstallationTokenGeneration(jwtToken, matchedApp, repoURL, verbose)
+	installationToken, err := testInstallationTokenGeneration(authenticator, jwtToken, matchedApp, repoURL, verbose)
 	if err != nil {
 		return err
 	}
 
-	return testGitHubAPIAccess("Step 4: ", installationToken, repoURL, verbose)
+	err = testGitHubAPIAccess(
+		"Step 4: ", factory, installationToken, matchedApp.APIBaseURL(repoURL), repoURL, verbose,
+	)
+	if err != nil {
+		return err
+	}
+
+	testAppIdentity(authenticator, matchedApp, repoURL, installationToken, verbose)
+	return nil
 }
 
-func runPATAuthenticationTests(matchedPAT *config.PersonalAccessToken, repoURL string, verbose bool) error {
-	secretMgr, err := newDefaultSecretsManager()
+// testAppIdentity reports the app's bot identity, fetching it when it is not
+// cached yet. An app without one still works, as x-access-token.
+func testAppIdentity(
+	authenticator *auth.Authenticator, matchedApp *config.GitHubApp, repoURL, installationToken string, verbose bool,
+) {
+	if verbose {
+		fmt.Printf("Step 5: Resolving bot identity...\n")
+	}
+
+	identity, err := authenticator.AppIdentity(matchedApp, repoURL, installationToken)
 	if err != nil {
-		return err
+		fmt.Printf("⚠️  Bot identity unavailable, git credentials use x-access-token: %v\n", err)
+		return
 	}
 
+	if verbose {
+		fmt.Printf("✅ Bot identity resolved\n")
+		fmt.Printf("   Login: %s\n", identity.Login())
+		fmt.Printf("   User ID: %d\n\n", identity.BotUserID)
+	} else {
+		fmt.Printf("✅ Bot identity: %s\n", identity.Login())
+	}
+}
+
+func runPATAuthenticationTests(
+	matchedPAT *config.PersonalAccessToken, repoURL string, factory *transport.Factory,
+	secretMgr *secrets.Manager, verbose bool,
+) error {
 	if verbose {
 		fmt.Printf("Step 2: Retrieving Personal Access Token...\n")
 	}
@@ -365,16 +434,80 @@ func runPATAuthenticationTests(matchedPAT *config.PersonalAccessToken, repoURL s
 		fmt.Printf("✅ PAT retrieved from secure storage\n")
 	}
 
-	return testGitHubAPIAccess("Step 3: ", token, repoURL, verbose)
+	return testGitHubAPIAccess("Step 3: ", factory, token, matchedPAT.APIBaseURL(repoURL), repoURL, verbose)
+}
+
+// testTransportSettings loads the transport settings that apply to apiBaseURL,
+// so a missing CA bundle or unreadable client certificate is reported before
+// any request is made
+func testTransportSettings(factory *transport.Factory, apiBaseURL string, verbose bool) error {
+	host, settings, ok := factory.Lookup(apiBaseURL)
+	if !ok {
+		if verbose {
+			fmt.Printf("   Transport: default (no transport settings for %s)\n\n", apiBaseURL)
+		}
+		return nil
+	}
+
+	if _, err := factory.Client(apiBaseURL); err != nil {
+		return fmt.Errorf("invalid transport settings: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("✅ Transport settings for %s loaded\n", host)
+		if proxyURL, err := url.Parse(settings.Proxy); err == nil && settings.Proxy != "" {
+			fmt.Printf("   Proxy: %s\n", proxyURL.Redacted())
+		}
+		if settings.CAFile != "" {
+			fmt.Printf("   CA bundle: %s\n", settings.CAFile)
+		}
+		if settings.ClientCert != "" {
+			fmt.Printf("   Client certificate: %s\n", settings.ClientCert)
+		}
+		if settings.Timeout != "" {
+			fmt.Printf("   Timeout: %s\n", settings.Timeout)
+		}
+		if settings.InsecureSkipVerify {
+			fmt.Printf("   ⚠️  Certificate verification: DISABLED\n")
+		}
+		fmt.Println()
+	} else {
+		fmt.Printf("✅ Transport settings for %s loaded\n", host)
+	}
+
+	return nil
+}
+
+// testKeyFingerprint checks that the stored key is still the one whose
+// fingerprint setup recorded, so a swapped key is reported as such rather
+// than as a failed JWT exchange
+func testKeyFingerprint(cfg *config.Config, app *config.GitHubApp, verbose bool) error {
+	if app.Fingerprint() == "" || app.PrivateKeySource == config.PrivateKeySourceSigner {
+		return nil
+	}
+
+	secretMgr := newDefaultSecretsManager(cfg)
+	if err := app.VerifyKeyFingerprints(secretMgr); err != nil {
+		if errors.Is(err, config.ErrKeyMismatch) {
+			return fmt.Errorf("%w; re-run 'gh app-auth setup' with the key GitHub shows for app %d", err, app.AppID)
+		}
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("✅ Private key matches fingerprint %s\n\n", app.Fingerprint())
+	} else {
+		fmt.Printf("✅ Private key fingerprint verified\n")
+	}
+	return nil
 }
 
 // testJWTGeneration tests JWT token generation
-func testJWTGeneration(matchedApp *config.GitHubApp, verbose bool) (string, error) {
+func testJWTGeneration(authenticator *auth.Authenticator, matchedApp *config.GitHubApp, verbose bool) (string, error) {
 	if verbose {
 		fmt.Printf("Step 2: Testing JWT generation...\n")
 	}
 
-	authenticator := auth.NewAuthenticator()
 	jwtToken, err := authenticator.GenerateJWTForApp(matchedApp)
 	if err != nil {
 		return "", fmt.Errorf("JWT generation failed: %w", err)
@@ -392,35 +525,62 @@ func testJWTGeneration(matchedApp *config.GitHubApp, verbose bool) (string, erro
 
 // testInstallationTokenGeneration tests installation token generation
 func testInstallationTokenGeneration(
-	jwtToken string, matchedApp *config.GitHubApp, repoURL string, verbose bool,
+	authenticator *auth.Authenticator, jwtToken string, matchedApp *config.GitHubApp, repoURL string, verbose bool,
 ) (string, error) {
 	if verbose {
 		fmt.Printf("Step 3: Testing installation token generation...\n")
 	}
 
-	authenticator := auth.NewAuthenticator()
-	installationToken, err := authenticator.GetInstallationToken(jwtToken, matchedApp.InstallationID, repoURL)
+	installationToken, err := authenticator.GetAppInstallationToken(jwtToken, matchedApp, repoURL)
 	if err != nil {
 		return "", fmt.Errorf("installation token generation failed: %w", err)
 	}
 
+	expiresAt := installationToken.ExpiresAt.Local().Format(time.RFC3339)
+	expiresIn := installationToken.ExpiresIn().Round(time.Second)
 	if verbose {
 		fmt.Printf("✅ Installation token generated successfully\n")
-		fmt.Printf("   Token length: %d characters\n\n", len(installationToken))
+		fmt.Printf("   Token length: %d characters\n", len(installationToken.Token))
+		fmt.Printf("   Expires at: %s (in %s)\n", expiresAt, expiresIn)
+		if installationToken.RepositorySelection != "" {
+			fmt.Printf("   Repository selection: %s\n", installationToken.RepositorySelection)
+		}
+		printTokenPermissions(installationToken.Permissions)
+		fmt.Println()
 	} else {
-		fmt.Printf("✅ Installation token generation successful\n")
+		fmt.Printf("✅ Installation token generation successful (expires %s)\n", expiresAt)
 	}
 
-	return installationToken, nil
+	return installationToken.Token, nil
+}
+
+// printTokenPermissions lists the permissions granted to an installation token
+func printTokenPermissions(permissions map[string]string) {
+	if len(permissions) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(permissions))
+	for name := range permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("   Permissions:\n")
+	for _, name := range names {
+		fmt.Printf("     %s: %s\n", name, permissions[name])
+	}
 }
 
 // testGitHubAPIAccess tests GitHub API access
-func testGitHubAPIAccess(stepLabel string, token, repoURL string, verbose bool) error {
+func testGitHubAPIAccess(
+	stepLabel string, factory *transport.Factory, token, apiBaseURL, repoURL string, verbose bool,
+) error {
 	if verbose {
 		fmt.Printf("%sTesting GitHub API access...\n", stepLabel)
 	}
 
-	if err := testAPIAccess(token, repoURL, verbose); err != nil {
+	if err := testAPIAccess(factory, token, apiBaseURL, repoURL, verbose); err != nil {
 		return fmt.Errorf("GitHub API access test failed: %w", err)
 	}
 
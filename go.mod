@@ -3,9 +3,13 @@ module github.com/AmadeusITGroup/gh-app-auth
 go 1.24.5
 
 require (
+	filippo.io/age v1.2.1
 	github.com/cli/go-gh/v2 v2.12.2
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/spf13/cobra v1.10.2
 	github.com/zalando/go-keyring v0.2.8
+	golang.org/x/crypto v0.36.0
+	golang.org/x/term v0.30.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -33,6 +37,5 @@ require (
 	github.com/thlib/go-timezone-local v0.0.0-20210907160436-ef149e42d28e // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/sys v0.37.0 // indirect
-	golang.org/x/term v0.30.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 )
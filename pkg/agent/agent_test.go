@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestServer starts an agent on a short socket path (Unix socket paths
+// are limited to ~100 bytes, so t.TempDir() can be too long on macOS)
+func startTestServer(t *testing.T, handler TokenHandler) (*Server, string) {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	socketPath := filepath.Join(dir, "agent", "agent.sock")
+	server := NewServer(socketPath, handler)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve() }()
+	t.Cleanup(func() {
+		_ = server.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+
+	return server, socketPath
+}
+
+func TestAgent_Token(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	_, socketPath := startTestServer(t, func(request Request) (*Token, error) {
+		if request.AppName != "my-app" || request.AppID != 42 {
+			return nil, errors.New("unexpected app")
+		}
+		return &Token{Token: "ghs_agent", ExpiresAt: expiresAt}, nil
+	})
+
+	client := NewClient(socketPath)
+	token, err := client.Token(Request{AppName: "my-app", AppID: 42, Repository: "github.com/org/repo"})
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token.Token != "ghs_agent" {
+		t.Errorf("Token = %q, want %q", token.Token, "ghs_agent")
+	}
+	if !token.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v, want %v", token.ExpiresAt, expiresAt)
+	}
+
+	if _, err := client.Token(Request{AppName: "other", AppID: 1}); err == nil || err.Error() != "unexpected app" {
+		t.Errorf("Token() error = %v, want handler error", err)
+	}
+}
+
+func TestAgent_StatusAndStop(t *testing.T) {
+	_, socketPath := startTestServer(t, func(Request) (*Token, error) {
+		return &Token{Token: "ghs_agent"}, nil
+	})
+	client := NewClient(socketPath)
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.PID != os.Getpid() {
+		t.Errorf("PID = %d, want %d", status.PID, os.Getpid())
+	}
+	if status.Socket != socketPath {
+		t.Errorf("Socket = %q, want %q", status.Socket, socketPath)
+	}
+
+	if err := client.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := client.Ping(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Ping() after stop error = %v, want %v", err, ErrNotRunning)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected socket to be removed, stat error = %v", err)
+	}
+}
+
+func TestAgent_SocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions are not enforced on Windows")
+	}
+
+	_, socketPath := startTestServer(t, func(Request) (*Token, error) { return nil, nil })
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Stat(socket) error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	dirInfo, err := os.Stat(filepath.Dir(socketPath))
+	if err != nil {
+		t.Fatalf("Stat(dir) error = %v", err)
+	}
+	if perm := dirInfo.Mode().Perm(); perm != 0700 {
+		t.Errorf("directory permissions = %o, want 700", perm)
+	}
+}
+
+func TestAgent_KeepsExistingDirectoryPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions are not enforced on Windows")
+	}
+
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+
+	server := NewServer(filepath.Join(dir, "agent.sock"), nil)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = server.Close() }()
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat(dir) error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0755 {
+		t.Errorf("existing directory permissions = %o, want 755 left unchanged", perm)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "agent.sock")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket = %v, %v; want mode 600", info, err)
+	}
+}
+
+func TestAgent_RejectsSecondServer(t *testing.T) {
+	_, socketPath := startTestServer(t, func(Request) (*Token, error) { return nil, nil })
+
+	if err := NewServer(socketPath, nil).Listen(); err == nil {
+		t.Error("Expected Listen() to fail while another agent is running")
+	}
+}
+
+func TestAgent_ReplacesStaleSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gaa")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socketPath := filepath.Join(dir, "agent.sock")
+	if err := os.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	server := NewServer(socketPath, nil)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() over stale socket error = %v", err)
+	}
+	_ = server.Close()
+}
+
+func TestAgent_ConcurrentRequests(t *testing.T) {
+	var calls atomic.Int32
+	_, socketPath := startTestServer(t, func(Request) (*Token, error) {
+		calls.Add(1)
+		return &Token{Token: "ghs_agent", Cached: true}, nil
+	})
+	client := NewClient(socketPath)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Token(Request{AppID: 1}); err != nil {
+				t.Errorf("Token() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 20 {
+		t.Errorf("handler calls = %d, want 20", calls.Load())
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Requests != 21 {
+		t.Errorf("Requests = %d, want 21", status.Requests)
+	}
+}
+
+func TestAgent_Evict(t *testing.T) {
+	server, socketPath := startTestServer(t, func(Request) (*Token, error) { return nil, nil })
+	client := NewClient(socketPath)
+
+	if _, err := client.Evict(1); err == nil {
+		t.Error("Expected error when no evict handler is set")
+	}
+
+	var evictedApp int64 = -1
+	var evictedRepository string
+	server.SetEvictHandler(func(request Request) (int, error) {
+		evictedApp, evictedRepository = request.AppID, request.Repository
+		return 3, nil
+	})
+
+	evicted, err := client.Evict(42)
+	if err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	if evicted != 3 || evictedApp != 42 {
+		t.Errorf("Evict() = %d for app %d, want 3 for app 42", evicted, evictedApp)
+	}
+
+	if _, err := client.EvictToken(Request{AppID: 7, Repository: "https://github.com/org/repo"}); err != nil {
+		t.Fatalf("EvictToken() error = %v", err)
+	}
+	if evictedApp != 7 || evictedRepository != "https://github.com/org/repo" {
+		t.Errorf("EvictToken() sent app %d and repository %q", evictedApp, evictedRepository)
+	}
+}
+
+func TestClient_NotRunning(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := client.Token(Request{AppID: 1}); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Token() error = %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestDefaultSocketPath(t *testing.T) {
+	t.Setenv(SocketEnvVar, "/tmp/custom.sock")
+	if got := DefaultSocketPath(); got != "/tmp/custom.sock" {
+		t.Errorf("DefaultSocketPath() = %q, want override", got)
+	}
+
+	t.Setenv(SocketEnvVar, "")
+	if got := DefaultSocketPath(); filepath.Base(got) != "agent.sock" {
+		t.Errorf("DefaultSocketPath() = %q, want agent.sock", got)
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// dialTimeout keeps fallback fast when no agent is listening
+	dialTimeout = time.Second
+	// responseTimeout allows the agent to mint a token on a cache miss
+	responseTimeout = time.Minute
+)
+
+// Client talks to a running agent
+type Client struct {
+	socketPath string
+}
+
+// NewClient creates a client for the agent listening on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{socketPath: socketPath}
+}
+
+// Token requests an installation token for a configured GitHub App
+func (c *Client) Token(request Request) (*Token, error) {
+	request.Action = ActionToken
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Token == nil {
+		return nil, fmt.Errorf("agent returned no token")
+	}
+	return response.Token, nil
+}
+
+// Status returns information about the running agent
+func (c *Client) Status() (*Status, error) {
+	response, err := c.do(Request{Action: ActionStatus})
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == nil {
+		return nil, fmt.Errorf("agent returned no status")
+	}
+	return response.Status, nil
+}
+
+// Ping reports whether an agent is answering on the socket
+func (c *Client) Ping() error {
+	_, err := c.Status()
+	return err
+}
+
+// Evict asks the agent to drop cached tokens for appID (0 for all tokens) and
+// returns how many were dropped
+func (c *Client) Evict(appID int64) (int, error) {
+	response, err := c.do(Request{Action: ActionEvict, AppID: appID})
+	if err != nil {
+		return 0, err
+	}
+	return response.Evicted, nil
+}
+
+// EvictToken asks the agent to drop the token it serves for a token request,
+// leaving the app's other tokens alone, and returns how many were dropped
+func (c *Client) EvictToken(request Request) (int, error) {
+	request.Action = ActionEvict
+	response, err := c.do(request)
+	if err != nil {
+		return 0, err
+	}
+	return response.Evicted, nil
+}
+
+// Stop asks the agent to shut down
+func (c *Client) Stop() error {
+	_, err := c.do(Request{Action: ActionStop})
+	return err
+}
+
+// do sends a request and decodes the response
+func (c *Client) do(request Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.socketPath, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(responseTimeout))
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, fmt.Errorf("failed to send agent request: %w", err)
+	}
+
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to read agent response: %w", err)
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	return &response, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package agent
+
+import "syscall"
+
+// DetachedProcAttr returns process attributes that detach a background agent
+// from the terminal session that started it
+func DetachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
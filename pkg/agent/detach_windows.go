@@ -0,0 +1,14 @@
+//go:build windows
+
+package agent
+
+import "syscall"
+
+// DetachedProcAttr returns process attributes that detach a background agent
+// from the console that started it
+func DetachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
@@ -0,0 +1,99 @@
+// Package agent implements a long-running credential agent that keeps parsed
+// private keys and installation tokens in memory and serves them to short-lived
+// git-credential and exec processes over a Unix domain socket.
+//
+// The protocol is one JSON request followed by one JSON response per
+// connection, similar in spirit to ssh-agent.
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
+)
+
+// Actions understood by the agent
+const (
+	// ActionToken requests an installation token for a configured GitHub App
+	ActionToken = "token"
+	// ActionStatus requests agent status information
+	ActionStatus = "status"
+	// ActionStop asks the agent to shut down
+	ActionStop = "stop"
+	// ActionEvict drops cached tokens for an app (AppID 0 drops all tokens), or
+	// with a Repository only the token ActionToken serves for the same request
+	ActionEvict = "evict"
+)
+
+// SocketEnvVar overrides the default agent socket path
+const SocketEnvVar = "GH_APP_AUTH_AGENT_SOCK"
+
+// Common errors returned by the agent client
+var (
+	ErrNotRunning = errors.New("credential agent is not running")
+)
+
+// Request is sent by clients to the agent
+type Request struct {
+	Action string `json:"action"`
+	// AppName and AppID identify the configured GitHub App (ActionEvict without
+	// Repository uses AppID only)
+	AppName string `json:"app_name,omitempty"`
+	AppID   int64  `json:"app_id,omitempty"`
+	// InstallationID overrides the configured installation (0 uses the config)
+	InstallationID int64 `json:"installation_id,omitempty"`
+	// Repository is the repository URL or host the token is requested for
+	Repository string `json:"repository,omitempty"`
+	// Permissions and Repositories narrow the requested token (empty for defaults)
+	Permissions  map[string]string `json:"permissions,omitempty"`
+	Repositories []string          `json:"repositories,omitempty"`
+	// Username asks for the app's git credential username with the token
+	Username bool `json:"username,omitempty"`
+}
+
+// Token is an installation token served by the agent
+type Token struct {
+	Token               string            `json:"token"`
+	ExpiresAt           time.Time         `json:"expires_at"`
+	Permissions         map[string]string `json:"permissions,omitempty"`
+	RepositorySelection string            `json:"repository_selection,omitempty"`
+	Cached              bool              `json:"cached"`
+	// Username is the app's bot login, set when the request asked for it
+	Username string `json:"username,omitempty"`
+}
+
+// Status describes a running agent
+type Status struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	Requests  int64     `json:"requests"`
+	Socket    string    `json:"socket"`
+}
+
+// Response is returned by the agent for every request
+type Response struct {
+	Error  string  `json:"error,omitempty"`
+	Token  *Token  `json:"token,omitempty"`
+	Status *Status `json:"status,omitempty"`
+	// Evicted is the number of tokens dropped by an ActionEvict request
+	Evicted int `json:"evicted,omitempty"`
+}
+
+// TokenHandler resolves an ActionToken request. It is provided by the command
+// layer, which owns configuration loading and authentication.
+type TokenHandler func(Request) (*Token, error)
+
+// EvictHandler resolves an ActionEvict request and returns the number of
+// tokens removed
+type EvictHandler func(Request) (int, error)
+
+// DefaultSocketPath returns the agent socket path, honouring GH_APP_AUTH_AGENT_SOCK
+func DefaultSocketPath() string {
+	if path := os.Getenv(SocketEnvVar); path != "" {
+		return path
+	}
+	return filepath.Join(paths.ConfigDir(), "agent", "agent.sock")
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+)
+
+// requestTimeout bounds how long a single connection may take
+const requestTimeout = 2 * time.Minute
+
+// Server serves credential requests over a Unix domain socket
+type Server struct {
+	socketPath   string
+	handler      TokenHandler
+	evictHandler EvictHandler
+	startedAt    time.Time
+	requests     atomic.Int64
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// NewServer creates an agent server listening on socketPath once Serve is called
+func NewServer(socketPath string, handler TokenHandler) *Server {
+	return &Server{
+		socketPath: socketPath,
+		handler:    handler,
+	}
+}
+
+// SetEvictHandler enables ActionEvict requests
+func (s *Server) SetEvictHandler(handler EvictHandler) {
+	s.evictHandler = handler
+}
+
+// Listen creates the socket with mode 0600. A parent directory the agent
+// creates is restricted to the current user; an existing one is left as it is.
+// A stale socket left by a crashed agent is replaced; a live one is reported
+// as an error.
+func (s *Server) Listen() error {
+	dir := filepath.Dir(s.socketPath)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create agent directory: %w", err)
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("failed to restrict agent directory: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(s.socketPath); err == nil {
+		if NewClient(s.socketPath).Ping() == nil {
+			return fmt.Errorf("an agent is already listening on %s", s.socketPath)
+		}
+		if err := os.Remove(s.socketPath); err != nil {
+			return fmt.Errorf("failed to remove stale agent socket: %w", err)
+		}
+	}
+
+	var listener net.Listener
+	err := withSocketUmask(func() error {
+		var err error
+		listener, err = net.Listen("unix", s.socketPath)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to listen on agent socket: %w", err)
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.startedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// Serve accepts connections until Close is called or a stop request arrives
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+	if listener == nil {
+		return fmt.Errorf("agent server is not listening")
+	}
+
+	logger.FlowStart("agent_serve", map[string]interface{}{
+		"socket": s.socketPath,
+		"pid":    os.Getpid(),
+	})
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				logger.FlowSuccess("agent_serve", map[string]interface{}{
+					"requests": s.requests.Load(),
+				})
+				return nil
+			}
+			return fmt.Errorf("failed to accept agent connection: %w", err)
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops the server and removes the socket
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.listener == nil {
+		return nil
+	}
+	s.closed = true
+	err := s.listener.Close()
+	_ = os.Remove(s.socketPath)
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// handleConn reads a single request and writes a single response
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	var request Request
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		s.writeResponse(conn, &Response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	s.requests.Add(1)
+
+	response := s.dispatch(request)
+	s.writeResponse(conn, response)
+
+	if request.Action == ActionStop {
+		_ = s.Close()
+	}
+}
+
+// dispatch handles a decoded request
+func (s *Server) dispatch(request Request) *Response {
+	switch request.Action {
+	case ActionStatus, ActionStop:
+		return &Response{Status: s.status()}
+	case ActionToken:
+		token, err := s.handler(request)
+		if err != nil {
+			logger.FlowError("agent_token", err, map[string]interface{}{
+				"app_id":     request.AppID,
+				"repository": logger.SanitizeURL(request.Repository),
+			})
+			return &Response{Error: err.Error()}
+		}
+		if token == nil {
+			return &Response{Error: "no token returned"}
+		}
+		logger.FlowStep("agent_token", map[string]interface{}{
+			"app_id":     request.AppID,
+			"token_hash": logger.HashToken(token.Token),
+			"cached":     token.Cached,
+		})
+		return &Response{Token: token}
+	case ActionEvict:
+		if s.evictHandler == nil {
+			return &Response{Error: "eviction is not supported by this agent"}
+		}
+		evicted, err := s.evictHandler(request)
+		if err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{Evicted: evicted}
+	default:
+		return &Response{Error: fmt.Sprintf("unsupported action: %q", request.Action)}
+	}
+}
+
+func (s *Server) status() *Status {
+	s.mu.Lock()
+	startedAt := s.startedAt
+	s.mu.Unlock()
+
+	return &Status{
+		PID:       os.Getpid(),
+		StartedAt: startedAt,
+		Requests:  s.requests.Load(),
+		Socket:    s.socketPath,
+	}
+}
+
+func (s *Server) writeResponse(conn net.Conn, response *Response) {
+	if err := json.NewEncoder(conn).Encode(response); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.FlowStep("agent_write_failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package agent
+
+import "syscall"
+
+// withSocketUmask runs create with a umask that leaves new files readable and
+// writable by their owner only, so the socket never exists with wider
+// permissions
+func withSocketUmask(create func() error) error {
+	previous := syscall.Umask(0177)
+	defer syscall.Umask(previous)
+	return create()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package agent
+
+// withSocketUmask runs create. Windows has no umask; the socket is protected
+// by the ACL of its directory.
+func withSocketUmask(create func() error) error {
+	return create()
+}
@@ -499,12 +499,12 @@ func TestGetInstallationToken_WithMock(t *testing.T) {
 			}
 
 			if !tt.wantErr {
-				if token == "" {
+				if token.Token == "" {
 					t.Error("Expected non-empty token")
 				}
 
-				if token != mockServer.installationToken {
-					t.Errorf("Token = %q, want %q", token, mockServer.installationToken)
+				if token.Token != mockServer.installationToken {
+					t.Errorf("Token = %q, want %q", token.Token, mockServer.installationToken)
 				}
 			}
 		})
@@ -3,85 +3,496 @@ package auth
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/signer"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/cli/go-gh/v2/pkg/api"
 )
 
-const (
-	gitHubAPIHost = "github.com"
-)
-
 // Authenticator handles GitHub App authentication.
 type Authenticator struct {
 	jwtGenerator   *jwt.Generator
 	tokenCache     *cache.TokenCache
 	secretsManager *secrets.Manager
+	// cacheDir holds the caches shared with other processes
+	cacheDir string
+	// expiryMargin is how long before expiry a cached token stops being served
+	expiryMargin time.Duration
+	// retainKeys reuses parsed private keys instead of reading them from
+	// secure storage on every mint (used by the long-running agent)
+	retainKeys bool
+	// signers holds external signers kept open while keys are retained
+	signers map[int64]crypto.Signer
+	// signersMu serialises the use of external signers
+	signersMu sync.Mutex
+	// persistentCache shares tokens between processes (nil when disabled)
+	persistentCache *cache.PersistentCache
+	// installations remembers the installation serving each owner for apps
+	// configured with installation_id 0
+	installations *cache.InstallationStore
+	// identities remembers the slug and bot user of each app
+	identities *cache.IdentityStore
+	// transport builds HTTP clients honouring per-host proxy and TLS settings
+	transport *transport.Factory
 	// clientFactory creates API clients (can be overridden for testing)
 	clientFactory func(api.ClientOptions) (*api.RESTClient, error)
+	// now returns the current time (can be overridden for testing)
+	now func() time.Time
 }
 
 // NewAuthenticator creates a new authenticator.
 func NewAuthenticator() *Authenticator {
-	// Initialize secrets manager
-	homeDir, _ := os.UserHomeDir()
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-
 	return &Authenticator{
 		jwtGenerator:   jwt.NewGenerator(),
 		tokenCache:     cache.NewTokenCache(),
-		secretsManager: secrets.NewManager(configDir),
+		installations:  cache.NewInstallationStore(),
+		identities:     cache.NewIdentityStore(),
+		secretsManager: secrets.NewManager(paths.SecretsDir()),
+		cacheDir:       paths.CacheDir(),
+		expiryMargin:   DefaultExpiryMargin,
 		clientFactory:  api.NewRESTClient,
+		now:            time.Now,
 	}
 }
 
+// EnablePersistentCache makes the authenticator share installation tokens with
+// other processes through a persistent cache in the extension config directory.
+func (a *Authenticator) EnablePersistentCache() {
+	a.persistentCache = cache.NewPersistentCache(
+		filepath.Join(a.cacheDir, "tokens"), a.secretsManager,
+	)
+}
+
+// PersistResolvedInstallations shares the installations resolved for apps
+// configured with installation_id 0 with other processes, through a file in
+// the extension config directory.
+func (a *Authenticator) PersistResolvedInstallations() {
+	a.installations.Persist(filepath.Join(a.cacheDir, "installations.json"))
+}
+
+// RetainPrivateKeys keeps parsed private keys in memory for the lifetime of the
+// authenticator, so secure storage is read once per app rather than per token.
+func (a *Authenticator) RetainPrivateKeys() {
+	a.retainKeys = true
+}
+
+// SetExpiryMargin sets how long before its expiry a cached token is considered
+// stale and replaced by a freshly minted one.
+func (a *Authenticator) SetExpiryMargin(margin time.Duration) {
+	a.expiryMargin = margin
+}
+
+// SetTransport makes API requests, and requests to secret backends such as
+// Vault, use the proxy, TLS and timeout settings configured for their host.
+func (a *Authenticator) SetTransport(factory *transport.Factory) {
+	a.transport = factory
+	a.secretsManager.SetHTTPClientFactory(factory.Client)
+}
+
+// ConfigureSecretBackends passes the secret_backends settings to the secrets
+// manager, for apps whose private key is in a pluggable backend such as Vault.
+func (a *Authenticator) ConfigureSecretBackends(settings map[string]map[string]string) {
+	a.secretsManager.Configure(settings)
+}
+
 // GetCredentials returns username and token for git credential helper.
 func (a *Authenticator) GetCredentials(app *config.GitHubApp, repoURL string) (token, username string, err error) {
-	// Generate cache key
-	cacheKey := cache.CreateCacheKey(app.AppID, app.InstallationID)
+	installationToken, err := a.GetToken(app, repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	return installationToken.Token, a.CredentialUsername(app, repoURL), nil
+}
+
+// GetToken returns an installation token for the app, served from cache while it
+// remains valid for longer than the expiry margin.
+func (a *Authenticator) GetToken(app *config.GitHubApp, repoURL string) (*InstallationToken, error) {
+	return a.GetScopedToken(app, repoURL, config.TokenScope{})
+}
+
+// GetScopedToken returns an installation token restricted to the repositories
+// and permissions in scope. Tokens with different scopes are cached separately.
+func (a *Authenticator) GetScopedToken(
+	app *config.GitHubApp, repoURL string, scope config.TokenScope,
+) (*InstallationToken, error) {
+	// The JWT is only needed on a cache miss, and at most once per key
+	jwts := a.newAppJWTs(app)
+
+	var installationID int64
+	var installationKey string
+	err := jwts.retry(func() error {
+		var err error
+		installationID, installationKey, err = a.resolveInstallationID(app, repoURL, jwts.get)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := cache.CreateScopedCacheKey(app.AppID, installationID, scope.Key())
 
 	// Check cache first
-	if cachedToken, found := a.tokenCache.Get(cacheKey); found {
-		username = fmt.Sprintf("%s[bot]", app.Name)
-		return cachedToken, username, nil
+	if cached, found := a.lookupCachedToken(cacheKey); found {
+		return cached, nil
+	}
+
+	// Check tokens persisted by other processes
+	if a.persistentCache != nil {
+		if cached, found := a.lookupPersistedToken(cacheKey); found {
+			return cached, nil
+		}
+
+		// Serialise minting so parallel git processes reuse the first token
+		unlock, lockErr := a.persistentCache.Lock(cacheKey)
+		if lockErr != nil {
+			logger.FlowStep("token_cache_lock_failed", map[string]interface{}{
+				"cache_key": cacheKey,
+				"error":     lockErr.Error(),
+			})
+		} else {
+			defer unlock()
+			if cached, found := a.lookupPersistedToken(cacheKey); found {
+				return cached, nil
+			}
+		}
+	}
+
+	// Get installation token from GitHub API
+	var installationToken *InstallationToken
+	err = jwts.retry(func() error {
+		jwtToken, err := jwts.get()
+		if err != nil {
+			return err
+		}
+		installationToken, err = a.requestInstallationToken(
+			jwtToken, app.APIBaseURL(repoURL), installationID, repoURL, scope,
+		)
+		return err
+	})
+	if err != nil {
+		if installationKey != "" {
+			// The app may have been reinstalled; look the installation up again next time
+			_, _ = a.installations.DeleteMatching(func(key string) bool { return key == installationKey })
+		}
+		return nil, fmt.Errorf("failed to get installation token: %w", err)
+	}
+
+	// Cache entries keep the real expiry; the margin is applied when reading
+	a.tokenCache.Set(cacheKey, installationToken.Token, time.Until(installationToken.ExpiresAt))
+
+	if a.persistentCache != nil {
+		if err := a.persistentCache.Set(cacheKey, installationToken.Token, installationToken.ExpiresAt); err != nil {
+			logger.FlowStep("token_cache_persist_failed", map[string]interface{}{
+				"cache_key": cacheKey,
+				"error":     err.Error(),
+			})
+		}
+	}
+
+	return installationToken, nil
+}
+
+// EvictTokens removes cached and persisted tokens for appID (all installations
+// and scopes), or every token when appID is 0. It returns the number of
+// entries removed.
+func (a *Authenticator) EvictTokens(appID int64) (int, error) {
+	match := func(key string) bool {
+		return appID == 0 || cache.KeyBelongsToApp(key, appID)
+	}
+
+	// Resolved installations are forgotten too, so a reinstalled app is found again
+	if _, err := a.installations.DeleteMatching(func(key string) bool {
+		return appID == 0 || cache.StoreKeyBelongsToApp(key, appID)
+	}); err != nil {
+		return 0, fmt.Errorf("failed to evict resolved installations: %w", err)
+	}
+	// And so are identities, so a renamed app's slug is fetched again
+	if _, err := a.identities.DeleteMatching(func(key string) bool {
+		return appID == 0 || cache.StoreKeyBelongsToApp(key, appID)
+	}); err != nil {
+		return 0, fmt.Errorf("failed to evict app identities: %w", err)
+	}
+
+	removed := a.tokenCache.DeleteMatching(match)
+	if a.persistentCache != nil {
+		persisted, err := a.persistentCache.DeleteMatching(match)
+		removed += persisted
+		if err != nil {
+			return removed, fmt.Errorf("failed to evict persisted tokens: %w", err)
+		}
+	}
+
+	logger.FlowStep("token_cache_evict", map[string]interface{}{
+		"app_id":  appID,
+		"removed": removed,
+	})
+	return removed, nil
+}
+
+// EvictToken removes the cached and persisted token GetScopedToken serves for
+// app, repoURL and scope, leaving the app's other tokens alone. It returns the
+// number of entries removed. Installations are not looked up: an app without
+// installation_id has no token to evict until its installation is recorded.
+func (a *Authenticator) EvictToken(app *config.GitHubApp, repoURL string, scope config.TokenScope) (int, error) {
+	installationID := app.InstallationID
+	if installationID == 0 {
+		owner, _, err := parseRepoURL(repoURL)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse repository URL: %w", err)
+		}
+		var found bool
+		installationKey := cache.CreateInstallationKey(app.AppID, hosts.Normalize(repoURL), owner)
+		if installationID, found = a.installations.Get(installationKey); !found {
+			return 0, nil
+		}
+	}
+	cacheKey := cache.CreateScopedCacheKey(app.AppID, installationID, scope.Key())
+	match := func(key string) bool { return key == cacheKey }
+
+	removed := a.tokenCache.DeleteMatching(match)
+	if a.persistentCache != nil {
+		persisted, err := a.persistentCache.DeleteMatching(match)
+		removed += persisted
+		if err != nil {
+			return removed, fmt.Errorf("failed to evict persisted token: %w", err)
+		}
+	}
+
+	logger.FlowStep("token_cache_evict", map[string]interface{}{
+		"app_id":    app.AppID,
+		"cache_key": cacheKey,
+		"removed":   removed,
+	})
+	return removed, nil
+}
+
+// resolveInstallationID returns the installation serving repoURL. Apps with a
+// configured installation_id use it as is. Otherwise the installation of the
+// repository owner is taken from the installation store, or looked up through
+// the API and recorded there; installationKey is then the store key.
+func (a *Authenticator) resolveInstallationID(
+	app *config.GitHubApp, repoURL string, appJWT func() (string, error),
+) (installationID int64, installationKey string, err error) {
+	if app.InstallationID != 0 {
+		return app.InstallationID, "", nil
+	}
+
+	owner, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to parse repository URL: %w", err)
+	}
+	installationKey = cache.CreateInstallationKey(app.AppID, hosts.Normalize(repoURL), owner)
+
+	if installationID, found := a.installations.Get(installationKey); found {
+		logger.FlowStep("installation_resolved", map[string]interface{}{
+			"app_id":          app.AppID,
+			"owner":           owner,
+			"installation_id": installationID,
+			"source":          "cache",
+		})
+		return installationID, installationKey, nil
+	}
+
+	jwtToken, err := appJWT()
+	if err != nil {
+		return 0, "", err
+	}
+	installationID, err = a.findInstallationIDHTTP(jwtToken, app.APIBaseURL(repoURL), repoURL)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to find installation ID: %w", err)
+	}
+
+	logger.FlowStep("installation_resolved", map[string]interface{}{
+		"app_id":          app.AppID,
+		"owner":           owner,
+		"installation_id": installationID,
+		"source":          "api",
+	})
+	if err := a.installations.Set(installationKey, installationID); err != nil {
+		logger.FlowStep("installation_persist_failed", map[string]interface{}{
+			"app_id": app.AppID,
+			"error":  err.Error(),
+		})
+	}
+	return installationID, installationKey, nil
+}
+
+// lookupCachedToken returns a token from the in-memory cache if it is still
+// valid for longer than the expiry margin
+func (a *Authenticator) lookupCachedToken(cacheKey string) (*InstallationToken, bool) {
+	cached, found := a.tokenCache.GetEntry(cacheKey)
+	if !found || !a.usable(cached.ExpiresAt) {
+		return nil, false
+	}
+	return &InstallationToken{Token: cached.Token, ExpiresAt: cached.ExpiresAt, Cached: true}, true
+}
+
+// lookupPersistedToken returns a token persisted by another process and primes
+// the in-memory cache with it
+func (a *Authenticator) lookupPersistedToken(cacheKey string) (*InstallationToken, bool) {
+	cached, found := a.persistentCache.Get(cacheKey)
+	if !found || !a.usable(cached.ExpiresAt) {
+		return nil, false
+	}
+
+	logger.FlowStep("token_cache_hit", map[string]interface{}{
+		"cache_key":  cacheKey,
+		"source":     "persistent",
+		"expires_at": cached.ExpiresAt.Format(time.RFC3339),
+	})
+	a.tokenCache.Set(cacheKey, cached.Token, time.Until(cached.ExpiresAt))
+	return &InstallationToken{Token: cached.Token, ExpiresAt: cached.ExpiresAt, Cached: true}, true
+}
+
+// usable reports whether a token expiring at expiresAt may still be served
+func (a *Authenticator) usable(expiresAt time.Time) bool {
+	return a.now().Add(a.expiryMargin).Before(expiresAt)
+}
+
+// appJWTs generates an app's JWT lazily, at most once per key, and moves on
+// to the app's next key when GitHub rejects one
+type appJWTs struct {
+	authenticator *Authenticator
+	app           *config.GitHubApp
+	// keys are the app's keys in the order they are tried; empty for apps
+	// with a single key
+	keys  []config.AppKey
+	index int
+	token string
+}
+
+func (a *Authenticator) newAppJWTs(app *config.GitHubApp) *appJWTs {
+	return &appJWTs{authenticator: a, app: app, keys: app.SigningKeys()}
+}
+
+// get returns the JWT signed with the current key
+func (j *appJWTs) get() (string, error) {
+	if j.token != "" {
+		return j.token, nil
+	}
+	var key *config.AppKey
+	if len(j.keys) > 0 {
+		key = &j.keys[j.index]
+	}
+	token, err := j.authenticator.generateAppJWT(j.app, key)
+	if err != nil {
+		return "", err
+	}
+	j.token = token
+	return token, nil
+}
+
+// next switches to the app's next key, if any
+func (j *appJWTs) next() bool {
+	if j.index+1 >= len(j.keys) {
+		return false
+	}
+	j.index++
+	j.token = ""
+	logger.FlowStep("app_key_fallback", map[string]interface{}{
+		"app_id":      j.app.AppID,
+		"fingerprint": j.keys[j.index].Fingerprint,
+		"state":       string(j.keys[j.index].State),
+	})
+	return true
+}
+
+// retry calls request, and calls it again with the app's next key for as long
+// as GitHub rejects the JWT
+func (j *appJWTs) retry(request func() error) error {
+	err := request()
+	for isUnauthorized(err) && j.next() {
+		err = request()
+	}
+	return err
+}
+
+// generateAppJWT generates a JWT for the app with key, or with its only key
+// when key is nil, reusing a retained key when allowed
+func (a *Authenticator) generateAppJWT(app *config.GitHubApp, key *config.AppKey) (string, error) {
+	if app.PrivateKeySource == config.PrivateKeySourceSigner {
+		return a.signAppJWT(app)
+	}
+	if key != nil {
+		return a.generateKeyJWT(app, *key)
+	}
+	if a.retainKeys && a.jwtGenerator.HasKey(app.AppID) {
+		return a.jwtGenerator.GenerateTokenFromKey(app.AppID, "")
 	}
 
 	// Get private key from secure storage
 	privateKey, err := app.GetPrivateKey(a.secretsManager)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get private key: %w", err)
+		return "", fmt.Errorf("failed to get private key: %w", err)
 	}
 
 	// Generate JWT token
 	jwtToken, err := a.jwtGenerator.GenerateTokenFromKey(app.AppID, privateKey)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate JWT: %w", err)
+		return "", fmt.Errorf("failed to generate JWT: %w", err)
 	}
+	return jwtToken, nil
+}
 
-	// Get installation token from GitHub API
-	installationToken, err := a.GetInstallationToken(jwtToken, app.InstallationID, repoURL)
+// generateKeyJWT generates a JWT with one of the keys of an app that has several
+func (a *Authenticator) generateKeyJWT(app *config.GitHubApp, key config.AppKey) (string, error) {
+	if a.retainKeys && a.jwtGenerator.HasKeyID(app.AppID, key.Fingerprint) {
+		return a.jwtGenerator.GenerateTokenFromKeyID(app.AppID, key.Fingerprint, "")
+	}
+
+	privateKey, err := app.GetKey(a.secretsManager, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get private key: %w", err)
+	}
+
+	jwtToken, err := a.jwtGenerator.GenerateTokenFromKeyID(app.AppID, key.Fingerprint, privateKey)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get installation token: %w", err)
+		return "", fmt.Errorf("failed to generate JWT: %w", err)
 	}
+	return jwtToken, nil
+}
 
-	// Cache the token for 55 minutes (GitHub tokens valid for 60 minutes, 5-min buffer)
-	// SECURITY: Token stored in memory only, not persisted to disk. See docs/TOKEN_CACHING.md
-	a.tokenCache.Set(cacheKey, installationToken, 55*time.Minute)
+// signAppJWT generates a JWT with the app's external signer. The signer is
+// opened for each JWT, or once when private keys are retained.
+func (a *Authenticator) signAppJWT(app *config.GitHubApp) (string, error) {
+	a.signersMu.Lock()
+	defer a.signersMu.Unlock()
+
+	keySigner, retained := a.signers[app.AppID]
+	if !retained {
+		var err error
+		if keySigner, err = app.OpenSigner(); err != nil {
+			return "", fmt.Errorf("failed to open signer: %w", err)
+		}
+		if a.retainKeys {
+			if a.signers == nil {
+				a.signers = make(map[int64]crypto.Signer)
+			}
+			a.signers[app.AppID] = keySigner
+		} else {
+			defer func() { _ = signer.Close(keySigner) }()
+		}
+	}
 
-	// Return credentials
-	username = fmt.Sprintf("%s[bot]", app.Name)
-	return installationToken, username, nil
+	jwtToken, err := a.jwtGenerator.GenerateTokenWithSigner(app.AppID, keySigner)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT: %w", err)
+	}
+	return jwtToken, nil
 }
 
 // GenerateJWT generates a JWT token for the GitHub App (legacy file-based method).
@@ -91,6 +502,10 @@ func (a *Authenticator) GenerateJWT(appID int64, privateKeyPath string) (string,
 
 // GenerateJWTForApp generates a JWT token using the app's configured private key source.
 func (a *Authenticator) GenerateJWTForApp(app *config.GitHubApp) (string, error) {
+	if app.PrivateKeySource == config.PrivateKeySourceSigner {
+		return a.signAppJWT(app)
+	}
+
 	// Get private key from secure storage
 	privateKey, err := app.GetPrivateKey(a.secretsManager)
 	if err != nil {
@@ -102,41 +517,110 @@ func (a *Authenticator) GenerateJWTForApp(app *config.GitHubApp) (string, error)
 }
 
 // GetInstallationToken exchanges JWT for an installation access token.
-func (a *Authenticator) GetInstallationToken(jwtToken string, installationID int64, repoURL string) (string, error) {
-	// Extract host from repository URL (default to github.com)
-	host := extractHostFromURL(repoURL)
+func (a *Authenticator) GetInstallationToken(
+	jwtToken string, installationID int64, repoURL string,
+) (*InstallationToken, error) {
+	apiURL := hosts.APIBaseURL(repoURL)
+	return a.requestInstallationToken(jwtToken, apiURL, installationID, repoURL, config.TokenScope{})
+}
+
+// VerifyAppKey checks that GitHub accepts privateKey for app, by requesting
+// the app's own metadata (GET /app) with a JWT signed by it
+func (a *Authenticator) VerifyAppKey(app *config.GitHubApp, privateKey string) error {
+	// A separate generator keeps the key out of the authenticator's key cache
+	jwtToken, err := jwt.NewGenerator().GenerateTokenFromKey(app.AppID, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to generate JWT: %w", err)
+	}
+
+	apiURL := app.APIBaseURL("") + "/app"
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client, err := a.transport.Client(apiURL)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get app: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
 
+	var metadata struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if metadata.ID != app.AppID {
+		return fmt.Errorf("key belongs to app %d, not %d", metadata.ID, app.AppID)
+	}
+	return nil
+}
+
+// GetAppInstallationToken exchanges JWT for an installation access token of
+// app, using the app's installation ID and API endpoint.
+func (a *Authenticator) GetAppInstallationToken(
+	jwtToken string, app *config.GitHubApp, repoURL string,
+) (*InstallationToken, error) {
+	return a.requestInstallationToken(
+		jwtToken, app.APIBaseURL(repoURL), app.InstallationID, repoURL, config.TokenScope{},
+	)
+}
+
+// requestInstallationToken exchanges JWT for an installation access token from
+// the REST API at apiBaseURL, narrowed to the repositories and permissions in scope.
+func (a *Authenticator) requestInstallationToken(
+	jwtToken, apiBaseURL string, installationID int64, repoURL string, scope config.TokenScope,
+) (*InstallationToken, error) {
 	// If installation ID is not provided, try to find it
 	if installationID == 0 {
 		var err error
-		installationID, err = a.findInstallationIDHTTP(jwtToken, host, repoURL)
+		installationID, err = a.findInstallationIDHTTP(jwtToken, apiBaseURL, repoURL)
 		if err != nil {
-			return "", fmt.Errorf("failed to find installation ID: %w", err)
+			return nil, fmt.Errorf("failed to find installation ID: %w", err)
 		}
 	}
 
 	// Request installation access token using raw HTTP
-	apiURL := fmt.Sprintf("https://%s/api/v3/app/installations/%d/access_tokens", host, installationID)
-	if host == gitHubAPIHost {
-		apiURL = fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID)
-	}
+	apiURL := fmt.Sprintf("%s/app/installations/%d/access_tokens", apiBaseURL, installationID)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader([]byte("{}")))
+	body, err := json.Marshal(newInstallationTokenRequest(scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client, err := a.transport.Client(apiURL)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get installation token: %w", err)
+		return nil, fmt.Errorf("failed to get installation token: %w", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -145,24 +629,14 @@ func (a *Authenticator) GetInstallationToken(jwtToken string, installationID int
 	}()
 
 	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var tokenResponse struct {
-		Token     string    `json:"token"`
-		ExpiresAt time.Time `json:"expires_at"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return nil, newAPIError(resp)
 	}
 
-	return tokenResponse.Token, nil
+	return parseInstallationTokenResponse(resp.Body, resp.Header.Get("Date"), a.now())
 }
 
 // findInstallationIDHTTP finds the installation ID for a repository using raw HTTP.
-func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (int64, error) {
+func (a *Authenticator) findInstallationIDHTTP(jwtToken, apiBaseURL, repoURL string) (int64, error) {
 	// Extract owner and repo from URL
 	owner, repo, err := parseRepoURL(repoURL)
 	if err != nil {
@@ -170,10 +644,7 @@ func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (
 	}
 
 	// Construct API URL
-	apiURL := fmt.Sprintf("https://%s/api/v3/repos/%s/%s/installation", host, owner, repo)
-	if host == gitHubAPIHost {
-		apiURL = fmt.Sprintf("https://api.github.com/repos/%s/%s/installation", owner, repo)
-	}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/installation", apiBaseURL, owner, repo)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -186,7 +657,10 @@ func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
+	client, err := a.transport.Client(apiURL)
+	if err != nil {
+		return 0, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get installation: %w", err)
@@ -198,8 +672,7 @@ func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+		return 0, newAPIError(resp)
 	}
 
 	var installation struct {
@@ -213,31 +686,6 @@ func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (
 	return installation.ID, nil
 }
 
-// extractHostFromURL extracts the host from a repository URL.
-func extractHostFromURL(repoURL string) string {
-	// Remove protocol and .git suffix
-	repoURL = strings.TrimSuffix(repoURL, ".git")
-	repoURL = strings.TrimPrefix(repoURL, "https://")
-	repoURL = strings.TrimPrefix(repoURL, "http://")
-
-	// Handle SSH format: git@github.com:owner/repo
-	if strings.HasPrefix(repoURL, "git@") {
-		repoURL = strings.TrimPrefix(repoURL, "git@")
-		if colonIdx := strings.Index(repoURL, ":"); colonIdx > 0 {
-			return repoURL[:colonIdx]
-		}
-	}
-
-	// Handle HTTPS format: github.com/owner/repo
-	parts := strings.Split(repoURL, "/")
-	if len(parts) > 0 {
-		return parts[0]
-	}
-
-	// Default to github.com
-	return "github.com"
-}
-
 // parseRepoURL parses a repository URL to extract owner and repo.
 func parseRepoURL(repoURL string) (owner, repo string, err error) {
 	// Remove protocol and .git suffix
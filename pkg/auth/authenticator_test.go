@@ -1,9 +1,19 @@
 package auth
 
 import (
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 )
 
 func TestNewAuthenticator(t *testing.T) {
@@ -207,6 +217,75 @@ func BenchmarkParseRepoURL(b *testing.B) {
 	}
 }
 
+func TestGetToken_APIURL(t *testing.T) {
+	mockServer := newMockGitHubServer(t)
+	defer mockServer.Close()
+
+	for _, installationID := range []int64{789012, 0} {
+		app := &config.GitHubApp{
+			Name:             "Enterprise App",
+			AppID:            123456,
+			InstallationID:   installationID,
+			PrivateKeyPath:   setupTestKeyFile(t),
+			PrivateKeySource: config.PrivateKeySourceFilesystem,
+			Patterns:         []string{"ghes.example.com/org/"},
+			APIURL:           mockServer.URL,
+		}
+
+		token, err := NewAuthenticator().GetToken(app, "https://ghes.example.com/org/repo")
+		if err != nil {
+			t.Fatalf("GetToken(installation %d) error = %v", installationID, err)
+		}
+		if token.Token != mockServer.installationToken {
+			t.Errorf("Token = %q, want %q", token.Token, mockServer.installationToken)
+		}
+	}
+}
+
+func TestGetToken_Transport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_transport",
+			"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		})
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certificate, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	app := &config.GitHubApp{
+		Name:             "Enterprise App",
+		AppID:            123456,
+		InstallationID:   789012,
+		PrivateKeyPath:   setupTestKeyFile(t),
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		Patterns:         []string{"ghes.example.com/org/"},
+		APIURL:           server.URL,
+	}
+
+	if _, err := NewAuthenticator().GetToken(app, "https://ghes.example.com/org/repo"); err == nil {
+		t.Fatal("Expected untrusted certificate to be rejected without transport settings")
+	}
+
+	authenticator := NewAuthenticator()
+	authenticator.SetTransport(transport.New(map[string]config.TransportConfig{
+		strings.TrimPrefix(server.URL, "https://"): {CAFile: caFile},
+	}))
+	token, err := authenticator.GetToken(app, "https://ghes.example.com/org/repo")
+	if err != nil {
+		t.Fatalf("GetToken() with ca_file error = %v", err)
+	}
+	if token.Token != "ghs_transport" {
+		t.Errorf("Token = %q, want %q", token.Token, "ghs_transport")
+	}
+}
+
 // Example showing the authentication flow
 func ExampleAuthenticator_GetCredentials() {
 	// This example shows the expected flow for GetCredentials
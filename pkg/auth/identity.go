@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+)
+
+// PersistAppIdentities shares the app identities fetched from GitHub with
+// other processes, through a file in the extension config directory.
+func (a *Authenticator) PersistAppIdentities() {
+	a.identities.Persist(filepath.Join(a.cacheDir, "identities.json"))
+}
+
+// AppIdentity returns the slug and bot user of app on the host of repoURL,
+// from the identity cache or, when it holds none, from GitHub: GET /app with
+// the app's JWT, then GET /users/<slug>[bot] with installationToken.
+func (a *Authenticator) AppIdentity(
+	app *config.GitHubApp, repoURL, installationToken string,
+) (*cache.AppIdentity, error) {
+	if identity, found := a.CachedAppIdentity(app, repoURL); found {
+		return identity, nil
+	}
+
+	apiBaseURL := app.APIBaseURL(repoURL)
+	var metadata struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	}
+	jwts := a.newAppJWTs(app)
+	err := jwts.retry(func() error {
+		jwtToken, err := jwts.get()
+		if err != nil {
+			return err
+		}
+		return a.getJSON(apiBaseURL+"/app", "Bearer "+jwtToken, &metadata)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app: %w", err)
+	}
+	if metadata.Slug == "" {
+		return nil, fmt.Errorf("GitHub returned no slug for app %d", app.AppID)
+	}
+
+	identity := cache.AppIdentity{Slug: metadata.Slug, Name: metadata.Name}
+	var bot struct {
+		ID int64 `json:"id"`
+	}
+	userURL := apiBaseURL + "/users/" + url.PathEscape(identity.Login())
+	if err := a.getJSON(userURL, "token "+installationToken, &bot); err != nil {
+		return nil, fmt.Errorf("failed to get bot user %s: %w", identity.Login(), err)
+	}
+	identity.BotUserID = bot.ID
+
+	if err := a.identities.Set(appIdentityKey(app, repoURL), identity); err != nil {
+		logger.FlowStep("identity_persist_failed", map[string]interface{}{
+			"app_id": app.AppID,
+			"error":  err.Error(),
+		})
+	}
+	return &identity, nil
+}
+
+// CachedAppIdentity returns the identity of app on the host of repoURL if
+// the identity cache holds one
+func (a *Authenticator) CachedAppIdentity(app *config.GitHubApp, repoURL string) (*cache.AppIdentity, bool) {
+	identity, found := a.identities.Get(appIdentityKey(app, repoURL))
+	if !found {
+		return nil, false
+	}
+	return &identity, true
+}
+
+// tokenUsername is the username GitHub accepts with any installation token
+const tokenUsername = "x-access-token"
+
+// CredentialUsername returns the bot login of app, e.g. my-app[bot], as the
+// username of its git credentials. Only an identity already in the cache is
+// used: credentials never ask GitHub for it, as stateless runs would pay a JWT
+// and two requests on every request. Without one the installation token is
+// presented as x-access-token; gh app-auth identity and test fill the cache.
+func (a *Authenticator) CredentialUsername(app *config.GitHubApp, repoURL string) string {
+	if identity, found := a.CachedAppIdentity(app, repoURL); found {
+		return identity.Login()
+	}
+	return tokenUsername
+}
+
+// appIdentityKey returns the identity cache key of app on the host of repoURL
+func appIdentityKey(app *config.GitHubApp, repoURL string) string {
+	host := hosts.Normalize(repoURL)
+	if host == "" {
+		host = app.Host()
+	}
+	return cache.CreateIdentityKey(app.AppID, host)
+}
+
+// getJSON decodes the response of an authenticated GET request into v
+func (a *Authenticator) getJSON(apiURL, authorization string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client, err := a.transport.Client(apiURL)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
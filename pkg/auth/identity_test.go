@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestAppIdentity(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/app":
+			_ = json.NewEncoder(w).Encode(map[string]string{"slug": "corporate-app", "name": "Corporate App"})
+		case "/users/corporate-app%5Bbot%5D":
+			if r.Header.Get("Authorization") != "token ghs_installation" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]int64{"id": 4242})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	app := &config.GitHubApp{
+		Name:             "Corporate App",
+		AppID:            123456,
+		PrivateKeyPath:   setupTestKeyFile(t),
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		Patterns:         []string{"github.com/"},
+		APIURL:           server.URL,
+	}
+	cacheDir := t.TempDir()
+	newAuth := func() *Authenticator {
+		auth := NewAuthenticator()
+		auth.cacheDir = cacheDir
+		auth.PersistAppIdentities()
+		return auth
+	}
+
+	repoURL := "https://github.com/myorg/repo"
+	if _, found := newAuth().CachedAppIdentity(app, repoURL); found {
+		t.Fatal("CachedAppIdentity() found an identity before any was fetched")
+	}
+	identity, err := newAuth().AppIdentity(app, repoURL, "ghs_installation")
+	if err != nil {
+		t.Fatalf("AppIdentity() error = %v", err)
+	}
+	if identity.Slug != "corporate-app" || identity.BotUserID != 4242 {
+		t.Errorf("AppIdentity() = %+v, want corporate-app with bot user 4242", identity)
+	}
+
+	// Another process reuses the persisted identity
+	if _, err := newAuth().AppIdentity(app, repoURL, "ghs_installation"); err != nil {
+		t.Fatalf("AppIdentity() with a cached identity error = %v", err)
+	}
+	if got := newAuth().CredentialUsername(app, repoURL); got != "corporate-app[bot]" {
+		t.Errorf("CredentialUsername() = %q, want corporate-app[bot]", got)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want the persisted identity to be reused", requests.Load())
+	}
+}
+
+func TestCredentialUsername_Uncached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	app := &config.GitHubApp{
+		Name:             "my-app",
+		AppID:            1,
+		PrivateKeyPath:   setupTestKeyFile(t),
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		APIURL:           server.URL,
+	}
+	auth := NewAuthenticator()
+	if got := auth.CredentialUsername(app, "https://github.com/org/repo"); got != "x-access-token" {
+		t.Errorf("CredentialUsername() = %q, want x-access-token without a cached identity", got)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("requests = %d, want no request to GitHub for a credential username", requests.Load())
+	}
+}
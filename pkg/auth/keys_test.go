@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+// signedBy reports whether the bearer JWT of r is signed by privateKeyPEM
+func signedBy(t *testing.T, r *http.Request, privateKeyPEM string) bool {
+	t.Helper()
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) == nil
+}
+
+func TestGetToken_FallsBackToRetiringKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	oldKey := generateTestRSAKey(t)
+	newKey := generateTestRSAKey(t)
+
+	// GitHub only knows the old key, e.g. the new one was not uploaded yet
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !signedBy(t, r, oldKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"message":"A JSON web token could not be decoded"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      "ghs_fallback",
+			"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		})
+	}))
+	defer server.Close()
+
+	authenticator := NewAuthenticator()
+	authenticator.secretsManager = secrets.NewManager(t.TempDir())
+
+	app := &config.GitHubApp{
+		Name:             "Rotating App",
+		AppID:            123456,
+		InstallationID:   789012,
+		PrivateKeySource: config.PrivateKeySourceKeyring,
+		Patterns:         []string{"github.com/org/"},
+		APIURL:           server.URL,
+	}
+	if _, err := app.SetPrivateKey(authenticator.secretsManager, oldKey); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	fingerprint, _, err := app.AddKey(authenticator.secretsManager, newKey, time.Now())
+	if err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+	app.RetireKeysExcept(fingerprint)
+
+	token, err := authenticator.GetToken(app, "https://github.com/org/repo")
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if token.Token != "ghs_fallback" {
+		t.Errorf("Token = %q, want %q", token.Token, "ghs_fallback")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("GitHub received %d requests, want 2 (new key rejected, then old key)", got)
+	}
+}
+
+func TestGetToken_NoFallbackForSingleKey(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	app := &config.GitHubApp{
+		Name:             "Single Key App",
+		AppID:            123456,
+		InstallationID:   789012,
+		PrivateKeyPath:   setupTestKeyFile(t),
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		Patterns:         []string{"github.com/org/"},
+		APIURL:           server.URL,
+	}
+
+	_, err := NewAuthenticator().GetToken(app, "https://github.com/org/repo")
+	if !isUnauthorized(err) {
+		t.Errorf("GetToken() error = %v, want a 401 APIError", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("GitHub received %d requests, want 1", got)
+	}
+}
+
+func TestVerifyAppKey(t *testing.T) {
+	acceptedKey := generateTestRSAKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !signedBy(t, r, acceptedKey) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 123456, "slug": "rotating-app"})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		appID   int64
+		key     string
+		wantErr bool
+	}{
+		{name: "accepted key", appID: 123456, key: acceptedKey},
+		{name: "unknown key", appID: 123456, key: generateTestRSAKey(t), wantErr: true},
+		{name: "key of another app", appID: 654321, key: acceptedKey, wantErr: true},
+		{name: "invalid key", appID: 123456, key: "not a key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &config.GitHubApp{Name: "app", AppID: tt.appID, APIURL: server.URL}
+			err := NewAuthenticator().VerifyAppKey(app, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyAppKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
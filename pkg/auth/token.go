@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// defaultTokenLifetime is the installation token validity documented by GitHub,
+// used when a response carries no expires_at
+const defaultTokenLifetime = time.Hour
+
+// DefaultExpiryMargin is subtracted from a token's lifetime when deciding how
+// long it may be served from cache
+const DefaultExpiryMargin = 5 * time.Minute
+
+// InstallationToken is a GitHub App installation access token together with
+// the metadata GitHub returned when it was minted.
+type InstallationToken struct {
+	// Token is the installation access token (ghs_...)
+	Token string
+	// ExpiresAt is when the token stops working, expressed in the local clock.
+	// When GitHub sends a Date header, the lifetime is measured against it so a
+	// skewed local clock does not shorten or extend the token's validity.
+	ExpiresAt time.Time
+	// Permissions maps permission names to access levels (e.g. "contents": "read")
+	Permissions map[string]string
+	// RepositorySelection is "all" or "selected"
+	RepositorySelection string
+	// Cached reports whether the token was served from a cache
+	Cached bool
+}
+
+// ExpiresIn returns the remaining validity of the token
+func (t *InstallationToken) ExpiresIn() time.Duration {
+	return time.Until(t.ExpiresAt)
+}
+
+// APIError is a GitHub API response with an unexpected status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// newAPIError reads the body of an unexpected response
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// isUnauthorized reports whether GitHub rejected the app's JWT, as it does
+// for a key that was deleted from the app
+func isUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// installationTokenRequest is the body of POST /app/installations/{id}/access_tokens.
+// Empty fields are omitted so GitHub applies the installation's defaults.
+type installationTokenRequest struct {
+	Repositories []string          `json:"repositories,omitempty"`
+	Permissions  map[string]string `json:"permissions,omitempty"`
+}
+
+// newInstallationTokenRequest builds the request body for a token scope
+func newInstallationTokenRequest(scope config.TokenScope) installationTokenRequest {
+	return installationTokenRequest{
+		Repositories: scope.RepositoryNames(),
+		Permissions:  scope.Permissions,
+	}
+}
+
+// installationTokenResponse is the body of POST /app/installations/{id}/access_tokens
+type installationTokenResponse struct {
+	Token               string            `json:"token"`
+	ExpiresAt           time.Time         `json:"expires_at"`
+	Permissions         map[string]string `json:"permissions"`
+	RepositorySelection string            `json:"repository_selection"`
+}
+
+// parseInstallationTokenResponse decodes an access token response. serverDate is
+// the response Date header and now the local time the response was received.
+func parseInstallationTokenResponse(body io.Reader, serverDate string, now time.Time) (*InstallationToken, error) {
+	var response installationTokenResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response.Token == "" {
+		return nil, fmt.Errorf("response did not contain a token")
+	}
+
+	return &InstallationToken{
+		Token:               response.Token,
+		ExpiresAt:           localExpiry(response.ExpiresAt, serverDate, now),
+		Permissions:         response.Permissions,
+		RepositorySelection: response.RepositorySelection,
+	}, nil
+}
+
+// localExpiry converts GitHub's expires_at into the local clock. The lifetime
+// is computed relative to the server's Date header when it is available.
+func localExpiry(expiresAt time.Time, serverDate string, now time.Time) time.Time {
+	if expiresAt.IsZero() {
+		return now.Add(defaultTokenLifetime)
+	}
+
+	if serverDate != "" {
+		if serverNow, err := http.ParseTime(serverDate); err == nil {
+			return now.Add(expiresAt.Sub(serverNow))
+		}
+	}
+
+	return expiresAt
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestParseInstallationTokenResponse(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		body          string
+		serverDate    string
+		wantExpiresAt time.Time
+		wantErr       bool
+	}{
+		{
+			name:          "expiry without Date header",
+			body:          `{"token":"ghs_abc","expires_at":"2025-01-01T12:45:00Z"}`,
+			wantExpiresAt: time.Date(2025, 1, 1, 12, 45, 0, 0, time.UTC),
+		},
+		{
+			name:          "local clock behind server",
+			body:          `{"token":"ghs_abc","expires_at":"2025-01-01T13:10:00Z"}`,
+			serverDate:    "Wed, 01 Jan 2025 12:10:00 GMT",
+			wantExpiresAt: now.Add(time.Hour),
+		},
+		{
+			name:          "local clock ahead of server",
+			body:          `{"token":"ghs_abc","expires_at":"2025-01-01T12:30:00Z"}`,
+			serverDate:    "Wed, 01 Jan 2025 11:30:00 GMT",
+			wantExpiresAt: now.Add(time.Hour),
+		},
+		{
+			name:          "unparseable Date header",
+			body:          `{"token":"ghs_abc","expires_at":"2025-01-01T12:45:00Z"}`,
+			serverDate:    "yesterday",
+			wantExpiresAt: time.Date(2025, 1, 1, 12, 45, 0, 0, time.UTC),
+		},
+		{
+			name:          "missing expires_at defaults to one hour",
+			body:          `{"token":"ghs_abc"}`,
+			wantExpiresAt: now.Add(time.Hour),
+		},
+		{
+			name:    "missing token",
+			body:    `{"expires_at":"2025-01-01T12:45:00Z"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			body:    `not json`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := parseInstallationTokenResponse(strings.NewReader(tt.body), tt.serverDate, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if token.Token != "ghs_abc" {
+				t.Errorf("Token = %q, want %q", token.Token, "ghs_abc")
+			}
+			if !token.ExpiresAt.Equal(tt.wantExpiresAt) {
+				t.Errorf("ExpiresAt = %v, want %v", token.ExpiresAt, tt.wantExpiresAt)
+			}
+		})
+	}
+}
+
+func TestParseInstallationTokenResponse_Metadata(t *testing.T) {
+	body := `{
+		"token": "ghs_abc",
+		"expires_at": "2025-01-01T13:00:00Z",
+		"permissions": {"contents": "read", "metadata": "read"},
+		"repository_selection": "selected"
+	}`
+
+	token, err := parseInstallationTokenResponse(strings.NewReader(body), "", time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if token.RepositorySelection != "selected" {
+		t.Errorf("RepositorySelection = %q, want %q", token.RepositorySelection, "selected")
+	}
+	if len(token.Permissions) != 2 || token.Permissions["contents"] != "read" {
+		t.Errorf("Permissions = %v, want contents and metadata read", token.Permissions)
+	}
+	if token.Cached {
+		t.Error("Expected freshly parsed token not to be marked as cached")
+	}
+}
+
+func TestGetToken_ExpiryMargin(t *testing.T) {
+	// An app without key source cannot mint tokens, so any cache miss fails
+	app := &config.GitHubApp{Name: "test-app", AppID: 123, InstallationID: 456}
+	cacheKey := cache.CreateCacheKey(app.AppID, app.InstallationID)
+
+	tests := []struct {
+		name      string
+		margin    time.Duration
+		ttl       time.Duration
+		wantCache bool
+	}{
+		{name: "outside default margin", margin: DefaultExpiryMargin, ttl: 30 * time.Minute, wantCache: true},
+		{name: "inside default margin", margin: DefaultExpiryMargin, ttl: 2 * time.Minute, wantCache: false},
+		{name: "outside custom margin", margin: time.Minute, ttl: 2 * time.Minute, wantCache: true},
+		{name: "inside custom margin", margin: 20 * time.Minute, ttl: 10 * time.Minute, wantCache: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuthenticator()
+			auth.SetExpiryMargin(tt.margin)
+			auth.tokenCache.Set(cacheKey, "ghs_cached", tt.ttl)
+
+			token, err := auth.GetToken(app, "https://github.com/org/repo")
+			if !tt.wantCache {
+				if err == nil {
+					t.Error("Expected cached token to be rejected and minting to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if token.Token != "ghs_cached" || !token.Cached {
+				t.Errorf("GetToken() = %+v, want cached token", token)
+			}
+		})
+	}
+}
+
+func TestEvictTokens(t *testing.T) {
+	app := &config.GitHubApp{Name: "test-app", AppID: 123, InstallationID: 456}
+	scope := config.TokenScope{Permissions: map[string]string{"contents": "read"}}
+
+	auth := NewAuthenticator()
+	auth.tokenCache.Set(cache.CreateCacheKey(app.AppID, app.InstallationID), "ghs_default", time.Hour)
+	auth.tokenCache.Set(cache.CreateScopedCacheKey(app.AppID, app.InstallationID, scope.Key()), "ghs_scoped", time.Hour)
+	auth.tokenCache.Set(cache.CreateCacheKey(999, app.InstallationID), "ghs_other", time.Hour)
+
+	removed, err := auth.EvictTokens(app.AppID)
+	if err != nil {
+		t.Fatalf("EvictTokens() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("EvictTokens() = %d, want 2", removed)
+	}
+
+	// The next request misses the cache and must mint, which fails without a key
+	if _, err := auth.GetToken(app, "https://github.com/org/repo"); err == nil {
+		t.Error("Expected evicted token not to be served from cache")
+	}
+	if _, found := auth.tokenCache.Get(cache.CreateCacheKey(999, app.InstallationID)); !found {
+		t.Error("Expected other app's token to remain cached")
+	}
+
+	removed, err = auth.EvictTokens(0)
+	if err != nil {
+		t.Fatalf("EvictTokens(0) error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("EvictTokens(0) = %d, want 1", removed)
+	}
+}
+
+func TestEvictToken(t *testing.T) {
+	app := &config.GitHubApp{Name: "test-app", AppID: 123, InstallationID: 456}
+	scope := config.TokenScope{Repositories: []string{"repo"}}
+	scopedKey := cache.CreateScopedCacheKey(app.AppID, app.InstallationID, scope.Key())
+
+	auth := NewAuthenticator()
+	auth.tokenCache.Set(cache.CreateCacheKey(app.AppID, app.InstallationID), "ghs_default", time.Hour)
+	auth.tokenCache.Set(scopedKey, "ghs_scoped", time.Hour)
+
+	removed, err := auth.EvictToken(app, "https://github.com/org/repo", scope)
+	if err != nil {
+		t.Fatalf("EvictToken() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("EvictToken() = %d, want 1", removed)
+	}
+	if _, found := auth.tokenCache.Get(scopedKey); found {
+		t.Error("Expected the scoped token to be evicted")
+	}
+	if _, found := auth.tokenCache.Get(cache.CreateCacheKey(app.AppID, app.InstallationID)); !found {
+		t.Error("Expected the app's other token to remain cached")
+	}
+
+	// Without a recorded installation there is no token to evict
+	unresolved := &config.GitHubApp{Name: "auto", AppID: 123}
+	if removed, err := auth.EvictToken(unresolved, "https://github.com/org/repo", scope); err != nil || removed != 0 {
+		t.Errorf("EvictToken() without installation = %d, %v; want 0, nil", removed, err)
+	}
+}
+
+func TestNewInstallationTokenRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope config.TokenScope
+		want  string
+	}{
+		{
+			name:  "empty scope keeps installation defaults",
+			scope: config.TokenScope{},
+			want:  `{}`,
+		},
+		{
+			name: "repositories and permissions",
+			scope: config.TokenScope{
+				Repositories: []string{"myorg/repo-b", "repo-a", "repo-b"},
+				Permissions:  map[string]string{"contents": "read"},
+			},
+			want: `{"repositories":["repo-a","repo-b"],"permissions":{"contents":"read"}}`,
+		},
+		{
+			name:  "permissions only",
+			scope: config.TokenScope{Permissions: map[string]string{"metadata": "read"}},
+			want:  `{"permissions":{"metadata":"read"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(newInstallationTokenRequest(tt.scope))
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetScopedToken_SeparateCacheEntries(t *testing.T) {
+	app := &config.GitHubApp{Name: "test-app", AppID: 123, InstallationID: 456}
+	readOnly := config.TokenScope{Permissions: map[string]string{"contents": "read"}}
+
+	auth := NewAuthenticator()
+	auth.tokenCache.Set(cache.CreateScopedCacheKey(app.AppID, app.InstallationID, readOnly.Key()), "ghs_read", time.Hour)
+
+	token, err := auth.GetScopedToken(app, "https://github.com/org/repo", readOnly)
+	if err != nil {
+		t.Fatalf("GetScopedToken() error = %v", err)
+	}
+	if token.Token != "ghs_read" {
+		t.Errorf("Token = %q, want %q", token.Token, "ghs_read")
+	}
+
+	// An unscoped request does not reuse the scoped token
+	if _, err := auth.GetToken(app, "https://github.com/org/repo"); err == nil {
+		t.Error("Expected unscoped request to miss the scoped cache entry")
+	}
+}
+
+func TestGetToken_AutoDetectedInstallations(t *testing.T) {
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/installation"):
+			lookups.Add(1)
+			installationID := map[string]int64{"org-a": 100, "org-b": 200}[strings.Split(r.URL.Path, "/")[2]]
+			_ = json.NewEncoder(w).Encode(map[string]int64{"id": installationID})
+		case strings.HasSuffix(r.URL.Path, "/access_tokens"):
+			installationID := strings.Split(r.URL.Path, "/")[3]
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"token":      "ghs_inst_" + installationID,
+				"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	app := &config.GitHubApp{
+		Name:             "multi-org-app",
+		AppID:            123456,
+		PrivateKeyPath:   setupTestKeyFile(t),
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		Patterns:         []string{"github.com/"},
+		APIURL:           server.URL,
+	}
+	cacheDir := t.TempDir()
+	newAuth := func() *Authenticator {
+		auth := NewAuthenticator()
+		auth.cacheDir = cacheDir
+		auth.PersistResolvedInstallations()
+		return auth
+	}
+
+	auth := newAuth()
+	for _, tc := range []struct{ repo, want string }{
+		{"https://github.com/org-a/one", "ghs_inst_100"},
+		{"https://github.com/org-b/two", "ghs_inst_200"},
+		{"https://github.com/org-a/three", "ghs_inst_100"},
+	} {
+		token, err := auth.GetToken(app, tc.repo)
+		if err != nil {
+			t.Fatalf("GetToken(%s) error = %v", tc.repo, err)
+		}
+		if token.Token != tc.want {
+			t.Errorf("GetToken(%s) = %q, want %q", tc.repo, token.Token, tc.want)
+		}
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("installation lookups = %d, want one per owner", lookups.Load())
+	}
+
+	// Another process reuses the persisted installations
+	if _, err := newAuth().GetToken(app, "https://github.com/org-b/four"); err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("installation lookups = %d, want persisted installation to be reused", lookups.Load())
+	}
+
+	// Evicting the app forgets its installations
+	if _, err := auth.EvictTokens(app.AppID); err != nil {
+		t.Fatalf("EvictTokens() error = %v", err)
+	}
+	if _, err := newAuth().GetToken(app, "https://github.com/org-a/one"); err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if lookups.Load() != 3 {
+		t.Errorf("installation lookups = %d, want a fresh lookup after eviction", lookups.Load())
+	}
+}
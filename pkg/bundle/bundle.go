@@ -0,0 +1,197 @@
+// Package bundle moves configuration entries and their secrets between
+// machines. A bundle is a JSON document encrypted with age
+// (https://age-encryption.org), either to a passphrase or to age recipients,
+// so it can be copied to a new build host like any other file.
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// Format identifies the bundle format and its version
+const Format = "gh-app-auth-bundle/v1"
+
+// maxBundleSize bounds what is read from a decrypted bundle
+const maxBundleSize = 16 << 20
+
+// ErrWrongFormat is returned when a decrypted file is not a bundle
+var ErrWrongFormat = errors.New("not a gh-app-auth bundle")
+
+// Bundle holds configuration entries with their secrets
+type Bundle struct {
+	Format     string    `json:"format"`
+	Created    time.Time `json:"created"`
+	GitHubApps []App     `json:"github_apps,omitempty"`
+	PATs       []PAT     `json:"pats,omitempty"`
+}
+
+// App is a GitHub App entry and its private keys. Apps whose key is read from
+// a command, the environment or an external signer carry no key: the target
+// machine must provide the same source.
+type App struct {
+	Config config.GitHubApp `json:"config"`
+	// PrivateKey is the app's key when it has a single one
+	PrivateKey string `json:"private_key,omitempty"`
+	// Keys holds the keys of an app with several, in the order of Config.Keys
+	Keys []string `json:"keys,omitempty"`
+}
+
+// PAT is a Personal Access Token entry and its token
+type PAT struct {
+	Config config.PersonalAccessToken `json:"config"`
+	Token  string                     `json:"token,omitempty"`
+}
+
+// Selection restricts which entries are exported. Empty fields select all
+// entries of their kind.
+type Selection struct {
+	AppIDs   []int64
+	PATNames []string
+}
+
+// Export builds a bundle of the selected entries of cfg, reading their
+// secrets through secretMgr
+func Export(cfg *config.Config, secretMgr *secrets.Manager, selection Selection) (*Bundle, error) {
+	b := &Bundle{Format: Format, Created: time.Now().UTC()}
+
+	for _, app := range cfg.GitHubApps {
+		if !selectsApp(selection, app.AppID) {
+			continue
+		}
+		entry, err := exportApp(app, secretMgr)
+		if err != nil {
+			return nil, fmt.Errorf("app %s (ID %d): %w", app.Name, app.AppID, err)
+		}
+		b.GitHubApps = append(b.GitHubApps, entry)
+	}
+
+	for _, pat := range cfg.PATs {
+		if !selectsPAT(selection, pat.Name) {
+			continue
+		}
+		entry := PAT{Config: pat}
+		entry.Config.SecretID = ""
+		if len(pat.StoredSecrets()) > 0 {
+			token, err := pat.GetPAT(secretMgr)
+			if err != nil {
+				return nil, fmt.Errorf("PAT %s: %w", pat.Name, err)
+			}
+			entry.Token = token
+		}
+		b.PATs = append(b.PATs, entry)
+	}
+
+	if len(b.GitHubApps) == 0 && len(b.PATs) == 0 {
+		return nil, fmt.Errorf("no configuration entries selected")
+	}
+	return b, nil
+}
+
+// exportApp copies an app entry and its keys. The secret ID and key path only
+// make sense on this machine and are dropped.
+func exportApp(app config.GitHubApp, secretMgr *secrets.Manager) (App, error) {
+	entry := App{Config: app}
+	entry.Config.SecretID = ""
+	entry.Config.PrivateKeyPath = ""
+
+	switch app.PrivateKeySource {
+	case config.PrivateKeySourceCommand, config.PrivateKeySourceEnv, config.PrivateKeySourceSigner:
+		return entry, nil
+	}
+
+	if len(app.Keys) > 0 {
+		for _, key := range app.Keys {
+			value, err := app.GetKey(secretMgr, key)
+			if err != nil {
+				return App{}, err
+			}
+			entry.Keys = append(entry.Keys, value)
+		}
+		return entry, nil
+	}
+
+	key, err := app.GetPrivateKey(secretMgr)
+	if err != nil {
+		return App{}, err
+	}
+	entry.PrivateKey = key
+	return entry, nil
+}
+
+func selectsApp(selection Selection, appID int64) bool {
+	if len(selection.AppIDs) == 0 && len(selection.PATNames) == 0 {
+		return true
+	}
+	for _, id := range selection.AppIDs {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
+
+func selectsPAT(selection Selection, name string) bool {
+	if len(selection.AppIDs) == 0 && len(selection.PATNames) == 0 {
+		return true
+	}
+	for _, selected := range selection.PATNames {
+		if selected == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypt writes b to w, encrypted to recipients. A passphrase is used
+// through age.NewScryptRecipient, which must then be the only recipient.
+func Encrypt(w io.Writer, b *Bundle, recipients ...age.Recipient) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	encrypted, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt bundle: %w", err)
+	}
+	if _, err := encrypted.Write(data); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// Decrypt reads a bundle written by Encrypt with one of identities
+func Decrypt(r io.Reader, identities ...age.Identity) (*Bundle, error) {
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(decrypted, maxBundleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+	if len(data) > maxBundleSize {
+		return nil, fmt.Errorf("bundle is larger than %d bytes", maxBundleSize)
+	}
+
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongFormat, err)
+	}
+	if b.Format != Format {
+		return nil, fmt.Errorf("%w: format %q", ErrWrongFormat, b.Format)
+	}
+	return &b, nil
+}
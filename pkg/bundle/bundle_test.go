@@ -0,0 +1,324 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
+)
+
+func newPassphraseRecipient(t *testing.T, passphrase string) *age.ScryptRecipient {
+	t.Helper()
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		t.Fatalf("NewScryptRecipient() error = %v", err)
+	}
+	recipient.SetWorkFactor(10) // keep the test fast
+	return recipient
+}
+
+// newSourceConfig stores secrets for a keyring app, an app with two keys, a
+// command-source app and a PAT
+func newSourceConfig(t *testing.T, secretMgr *secrets.Manager) *config.Config {
+	t.Helper()
+	cfg := &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{
+			{
+				Name: "keyring-app", AppID: 1, InstallationID: 10, SecretID: config.NewSecretID(),
+				PrivateKeySource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/one/*"},
+			},
+			{
+				Name: "rotated-app", AppID: 2, InstallationID: 20, SecretID: config.NewSecretID(),
+				PrivateKeySource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/two/*"},
+			},
+			{
+				Name: "command-app", AppID: 3, InstallationID: 30,
+				PrivateKeySource:  config.PrivateKeySourceCommand,
+				PrivateKeyCommand: &config.SecretCommand{Args: []string{"vault", "kv", "get", "-field=key", "secret/app"}},
+				Patterns:          []string{"github.com/three/*"},
+			},
+		},
+		PATs: []config.PersonalAccessToken{{
+			Name: "pat", SecretID: config.NewSecretID(),
+			TokenSource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/four/*"},
+		}},
+	}
+	if _, err := cfg.GitHubApps[0].SetPrivateKey(secretMgr, testkeys.RSAKeyPEM(t)); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if _, err := cfg.GitHubApps[1].SetPrivateKey(secretMgr, testkeys.RSAKeyPEM(t)); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if _, _, err := cfg.GitHubApps[1].AddKey(secretMgr, testkeys.RSAKeyPEM(t), time.Now()); err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+	if _, err := cfg.PATs[0].SetPAT(secretMgr, "ghp_token"); err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+	return cfg
+}
+
+func TestExportEncryptDecrypt(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	cfg := newSourceConfig(t, secretMgr)
+
+	b, err := Export(cfg, secretMgr, Selection{})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	passphrase, err := age.NewScryptIdentity("correct horse")
+	if err != nil {
+		t.Fatalf("NewScryptIdentity() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		recipient age.Recipient
+		identity  age.Identity
+		wantErr   bool
+	}{
+		{"passphrase", newPassphraseRecipient(t, "correct horse"), passphrase, false},
+		{"recipient", x25519.Recipient(), x25519, false},
+		{"wrong identity", x25519.Recipient(), other, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encrypt(&buf, b, tt.recipient); err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if strings.Contains(buf.String(), "ghp_token") {
+				t.Fatal("Encrypted bundle holds the token in clear")
+			}
+
+			got, err := Decrypt(&buf, tt.identity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(got.GitHubApps) != 3 || len(got.PATs) != 1 {
+				t.Fatalf("Decrypt() = %d apps, %d PATs, want 3 and 1", len(got.GitHubApps), len(got.PATs))
+			}
+			if got.GitHubApps[0].PrivateKey == "" || got.GitHubApps[0].Config.SecretID != "" {
+				t.Errorf("keyring app = %+v, want its key and no secret_id", got.GitHubApps[0])
+			}
+			if len(got.GitHubApps[1].Keys) != 2 || got.GitHubApps[1].PrivateKey != "" {
+				t.Errorf("rotated app exported %d keys, want both", len(got.GitHubApps[1].Keys))
+			}
+			if got.GitHubApps[2].PrivateKey != "" || got.GitHubApps[2].Config.PrivateKeyCommand == nil {
+				t.Errorf("command app = %+v, want its command and no key", got.GitHubApps[2])
+			}
+			if got.PATs[0].Token != "ghp_token" {
+				t.Errorf("PAT token = %q, want ghp_token", got.PATs[0].Token)
+			}
+		})
+	}
+}
+
+func TestExport_Selection(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	cfg := newSourceConfig(t, secretMgr)
+
+	b, err := Export(cfg, secretMgr, Selection{AppIDs: []int64{1}})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(b.GitHubApps) != 1 || b.GitHubApps[0].Config.AppID != 1 || len(b.PATs) != 0 {
+		t.Errorf("Export(app 1) = %+v, want only app 1", b)
+	}
+
+	if _, err := Export(cfg, secretMgr, Selection{PATNames: []string{"missing"}}); err == nil {
+		t.Error("Export() with nothing selected should fail")
+	}
+}
+
+func TestDecrypt_WrongFormat(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+
+	for _, content := range []string{"not json", `{"format":"something-else/v1"}`} {
+		var buf bytes.Buffer
+		w, err := age.Encrypt(&buf, identity.Recipient())
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		_, _ = w.Write([]byte(content))
+		_ = w.Close()
+
+		if _, err := Decrypt(&buf, identity); !errors.Is(err, ErrWrongFormat) {
+			t.Errorf("Decrypt(%q) error = %v, want ErrWrongFormat", content, err)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	source := secrets.NewManager(t.TempDir())
+	b, err := Export(newSourceConfig(t, source), source, Selection{})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	tests := []struct {
+		policy       ConflictPolicy
+		wantApps     int
+		wantName     string
+		wantAction   Action
+		wantObsolete int
+	}{
+		{ConflictSkip, 3, "existing", ActionSkipped, 0},
+		{ConflictOverwrite, 3, "keyring-app", ActionReplaced, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			secretMgr := secrets.NewManager(t.TempDir())
+			existing := config.GitHubApp{
+				Name: "existing", AppID: 1, InstallationID: 10, SecretID: config.NewSecretID(),
+				PrivateKeySource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/one/*"},
+			}
+			if _, err := existing.SetPrivateKey(secretMgr, "old-key"); err != nil {
+				t.Fatalf("SetPrivateKey() error = %v", err)
+			}
+			cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{existing}}
+
+			result, err := Import(cfg, b, secretMgr, ImportOptions{OnConflict: tt.policy})
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+
+			if len(cfg.GitHubApps) != tt.wantApps || len(cfg.PATs) != 1 {
+				t.Errorf("Import() left %d apps, %d PATs, want %d and 1", len(cfg.GitHubApps), len(cfg.PATs), tt.wantApps)
+			}
+			if first := result.Outcomes[0]; first.Action != tt.wantAction || first.Name != tt.wantName {
+				t.Errorf("Import() outcome = %+v, want %s as %q", first, tt.wantAction, tt.wantName)
+			}
+			if len(result.Obsolete) != tt.wantObsolete {
+				t.Errorf("Import() obsolete = %v, want %d secrets", result.Obsolete, tt.wantObsolete)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate() after Import() error = %v", err)
+			}
+
+			for _, app := range cfg.GitHubApps {
+				if app.PrivateKeySource == config.PrivateKeySourceCommand {
+					continue
+				}
+				if app.SecretID == "" || !app.HasPrivateKey(secretMgr) {
+					t.Errorf("app %s has secret_id %q and no readable key", app.Name, app.SecretID)
+				}
+			}
+			if token, err := cfg.PATs[0].GetPAT(secretMgr); err != nil || token != "ghp_token" {
+				t.Errorf("GetPAT() = %q, %v, want the imported token", token, err)
+			}
+		})
+	}
+}
+
+func TestImport_Rename(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	source := secrets.NewManager(t.TempDir())
+	b, err := Export(newSourceConfig(t, source), source, Selection{})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	// An app keeps its identity, app and installation ID, under any name
+	conflicting := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{{
+		Name: "existing", AppID: 1, InstallationID: 10, SecretID: config.NewSecretID(),
+		PrivateKeySource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/one/*"},
+	}}}
+	_, err = Import(conflicting, b, secretMgr, ImportOptions{OnConflict: ConflictRename})
+	if !errors.Is(err, ErrRenameApp) {
+		t.Errorf("Import(rename) with a conflicting app error = %v, want ErrRenameApp", err)
+	}
+	if len(conflicting.GitHubApps) != 1 || len(conflicting.PATs) != 0 {
+		t.Errorf("Import(rename) changed the configuration: %+v", conflicting)
+	}
+
+	cfg := &config.Config{Version: "1", PATs: []config.PersonalAccessToken{{
+		Name: "pat", SecretID: config.NewSecretID(),
+		TokenSource: config.PrivateKeySourceKeyring, Patterns: []string{"github.com/five/*"},
+	}}}
+	result, err := Import(cfg, b, secretMgr, ImportOptions{OnConflict: ConflictRename})
+	if err != nil {
+		t.Fatalf("Import(rename) error = %v", err)
+	}
+	last := result.Outcomes[len(result.Outcomes)-1]
+	if last.Action != ActionRenamed || last.Name != "pat (imported)" {
+		t.Errorf("Import(rename) PAT outcome = %+v, want renamed to %q", last, "pat (imported)")
+	}
+	if len(cfg.GitHubApps) != 3 || len(cfg.PATs) != 2 {
+		t.Errorf("Import(rename) left %d apps, %d PATs, want 3 and 2", len(cfg.GitHubApps), len(cfg.PATs))
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() after Import() error = %v", err)
+	}
+}
+
+func TestImport_DryRun(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	source := secrets.NewManager(t.TempDir())
+	b, err := Export(newSourceConfig(t, source), source, Selection{})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	cfg := &config.Config{Version: "1"}
+	result, err := Import(cfg, b, secrets.NewManager(t.TempDir()), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if len(result.Outcomes) != 4 || len(cfg.GitHubApps) != 0 || len(cfg.PATs) != 0 {
+		t.Errorf("Import(dry run) = %+v, config %+v, want 4 outcomes and no change", result.Outcomes, cfg)
+	}
+
+	if _, err := Import(cfg, b, source, ImportOptions{Backend: "nope"}); err == nil {
+		t.Error("Import() with an unknown backend should fail")
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, value := range []string{"skip", "overwrite", "rename"} {
+		if _, err := ParseConflictPolicy(value); err != nil {
+			t.Errorf("ParseConflictPolicy(%q) error = %v", value, err)
+		}
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Error("ParseConflictPolicy(merge) should fail")
+	}
+}
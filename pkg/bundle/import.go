@@ -0,0 +1,286 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// ConflictPolicy says what happens to a bundle entry that is already
+// configured: an app with the same app and installation ID, or a PAT with
+// the same name
+type ConflictPolicy string
+
+// ErrRenameApp is returned when --on-conflict rename meets an app that is
+// already configured. An app is identified by its app and installation ID, not
+// its name, so a renamed copy would still be the same app.
+var ErrRenameApp = errors.New("apps cannot be imported under a new name")
+
+const (
+	// ConflictSkip keeps the configured entry and ignores the bundle's
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the configured entry and its secrets
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename adds the bundle's entry under a new name. It only applies
+	// to PATs: Import fails with ErrRenameApp if an app conflicts.
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ParseConflictPolicy validates a --on-conflict value
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(value); policy {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q (must be skip, overwrite or rename)", value)
+	}
+}
+
+// ImportOptions control how a bundle is merged into a configuration
+type ImportOptions struct {
+	OnConflict ConflictPolicy
+	// Backend is the secret backend new secrets are stored in. Empty selects
+	// the OS keyring, falling back to the filesystem.
+	Backend string
+	// DryRun reports what would happen without storing anything
+	DryRun bool
+}
+
+// Action is what Import did with one bundle entry
+type Action string
+
+const (
+	ActionAdded    Action = "added"
+	ActionReplaced Action = "replaced"
+	ActionRenamed  Action = "renamed"
+	ActionSkipped  Action = "skipped"
+)
+
+// Outcome describes what happened to one bundle entry
+type Outcome struct {
+	// Entry describes the entry, e.g. "app my-app (ID 123)"
+	Entry  string
+	Action Action
+	// Name is the entry's name in the configuration, which differs from the
+	// bundle's when it was renamed
+	Name string
+	// Storage is where its secret was stored, if it has one
+	Storage secrets.StorageBackend
+}
+
+// Result lists the outcome of each bundle entry
+type Result struct {
+	Outcomes []Outcome
+	// Obsolete are the secrets of replaced entries, to delete once the
+	// configuration is saved
+	Obsolete []config.StoredSecret
+}
+
+// Import merges b into cfg and stores the secrets of new entries through
+// secretMgr. Each imported entry gets a new secret ID. cfg is only changed in
+// memory: the caller saves it, then deletes Result.Obsolete.
+func Import(cfg *config.Config, b *Bundle, secretMgr *secrets.Manager, options ImportOptions) (*Result, error) {
+	if options.OnConflict == "" {
+		options.OnConflict = ConflictSkip
+	}
+	if options.Backend != "" && !secrets.IsRegistered(options.Backend) {
+		return nil, fmt.Errorf("unknown secret backend: %s", options.Backend)
+	}
+
+	if options.OnConflict == ConflictRename {
+		for _, entry := range b.GitHubApps {
+			if existing := findApp(cfg, entry.Config); existing >= 0 {
+				return nil, fmt.Errorf("app %s (ID %d) is already configured as %s: %w; use skip or overwrite",
+					entry.Config.Name, entry.Config.AppID, cfg.GitHubApps[existing].Name, ErrRenameApp)
+			}
+		}
+	}
+
+	result := &Result{}
+	for _, entry := range b.GitHubApps {
+		outcome, err := importApp(cfg, entry, secretMgr, options, result)
+		if err != nil {
+			return result, fmt.Errorf("app %s (ID %d): %w", entry.Config.Name, entry.Config.AppID, err)
+		}
+		result.Outcomes = append(result.Outcomes, outcome)
+	}
+	for _, entry := range b.PATs {
+		outcome, err := importPAT(cfg, entry, secretMgr, options, result)
+		if err != nil {
+			return result, fmt.Errorf("PAT %s: %w", entry.Config.Name, err)
+		}
+		result.Outcomes = append(result.Outcomes, outcome)
+	}
+	return result, nil
+}
+
+func importApp(
+	cfg *config.Config, entry App, secretMgr *secrets.Manager, options ImportOptions, result *Result,
+) (Outcome, error) {
+	app := entry.Config
+	outcome := Outcome{Entry: fmt.Sprintf("app %s (ID %d)", app.Name, app.AppID), Action: ActionAdded}
+
+	existing := findApp(cfg, app)
+	if existing >= 0 {
+		switch options.OnConflict {
+		case ConflictSkip:
+			outcome.Action, outcome.Name = ActionSkipped, cfg.GitHubApps[existing].Name
+			return outcome, nil
+		case ConflictOverwrite:
+			outcome.Action = ActionReplaced
+		case ConflictRename:
+			return outcome, ErrRenameApp
+		}
+	}
+	outcome.Name = app.Name
+
+	app.SecretID = config.NewSecretID()
+	app.PrivateKeyPath = ""
+	hasKey := entry.PrivateKey != "" || len(entry.Keys) > 0
+	if hasKey {
+		app.PrivateKeySource = storageSource(options.Backend)
+	}
+	if len(entry.Keys) != len(app.Keys) {
+		return outcome, fmt.Errorf("bundle holds %d keys for %d key entries", len(entry.Keys), len(app.Keys))
+	}
+	if err := app.Validate(); err != nil {
+		return outcome, fmt.Errorf("invalid entry: %w", err)
+	}
+	if options.DryRun {
+		return outcome, nil
+	}
+
+	if hasKey {
+		storage, err := storeAppKeys(&app, entry, secretMgr)
+		if err != nil {
+			return outcome, err
+		}
+		outcome.Storage = storage
+	}
+
+	if existing >= 0 {
+		replaced := cfg.GitHubApps[existing]
+		cfg.GitHubApps[existing] = app
+		if !cfg.UsesSecrets(replaced.StoredSecrets()) {
+			result.Obsolete = append(result.Obsolete, replaced.StoredSecrets()...)
+		}
+	} else {
+		cfg.GitHubApps = append(cfg.GitHubApps, app)
+	}
+	return outcome, nil
+}
+
+// findApp returns the index of the configured app with app's app and
+// installation ID, or -1
+func findApp(cfg *config.Config, app config.GitHubApp) int {
+	for i, configured := range cfg.GitHubApps {
+		if configured.AppID == app.AppID && configured.InstallationID == app.InstallationID {
+			return i
+		}
+	}
+	return -1
+}
+
+// storeAppKeys stores the key or keys of an imported app
+func storeAppKeys(app *config.GitHubApp, entry App, secretMgr *secrets.Manager) (secrets.StorageBackend, error) {
+	if len(entry.Keys) == 0 {
+		return app.SetPrivateKey(secretMgr, entry.PrivateKey)
+	}
+	var storage secrets.StorageBackend
+	for _, key := range entry.Keys {
+		backend, err := app.StoreKey(secretMgr, key)
+		if err != nil {
+			return "", err
+		}
+		storage = backend
+	}
+	return storage, nil
+}
+
+func importPAT(
+	cfg *config.Config, entry PAT, secretMgr *secrets.Manager, options ImportOptions, result *Result,
+) (Outcome, error) {
+	pat := entry.Config
+	outcome := Outcome{Entry: fmt.Sprintf("PAT %s", pat.Name), Action: ActionAdded}
+
+	existing := -1
+	for i, configured := range cfg.PATs {
+		if configured.Name == pat.Name {
+			existing = i
+			break
+		}
+	}
+	if existing >= 0 {
+		switch options.OnConflict {
+		case ConflictSkip:
+			outcome.Action, outcome.Name = ActionSkipped, pat.Name
+			return outcome, nil
+		case ConflictOverwrite:
+			outcome.Action = ActionReplaced
+		case ConflictRename:
+			outcome.Action = ActionRenamed
+			pat.Name = uniqueName(pat.Name, func(name string) bool {
+				for _, configured := range cfg.PATs {
+					if configured.Name == name {
+						return true
+					}
+				}
+				return false
+			})
+			existing = -1
+		}
+	}
+	outcome.Name = pat.Name
+
+	pat.SecretID = config.NewSecretID()
+	if entry.Token != "" {
+		pat.TokenSource = storageSource(options.Backend)
+	}
+	if err := pat.Validate(); err != nil {
+		return outcome, fmt.Errorf("invalid entry: %w", err)
+	}
+	if options.DryRun {
+		return outcome, nil
+	}
+
+	if entry.Token != "" {
+		storage, err := pat.SetPAT(secretMgr, entry.Token)
+		if err != nil {
+			return outcome, err
+		}
+		outcome.Storage = storage
+	}
+
+	if existing >= 0 {
+		replaced := cfg.PATs[existing]
+		cfg.PATs[existing] = pat
+		if !cfg.UsesSecrets(replaced.StoredSecrets()) {
+			result.Obsolete = append(result.Obsolete, replaced.StoredSecrets()...)
+		}
+	} else {
+		cfg.PATs = append(cfg.PATs, pat)
+	}
+	return outcome, nil
+}
+
+// storageSource returns the private_key_source of secrets stored in backend
+func storageSource(backend string) config.PrivateKeySource {
+	if backend == "" {
+		return config.PrivateKeySourceKeyring
+	}
+	return config.PrivateKeySource(backend)
+}
+
+// uniqueName returns name, or name followed by " (imported)" and a number,
+// whichever is not taken yet
+func uniqueName(name string, taken func(string) bool) string {
+	base := strings.TrimSpace(name) + " (imported)"
+	candidate := base
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s %d", base, i)
+	}
+	return candidate
+}
@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,10 +15,11 @@ import (
 // SECURITY NOTE: This cache stores installation tokens IN MEMORY ONLY. Tokens are
 // NOT persisted to disk or encrypted storage. This design prioritizes security over
 // convenience - tokens expire with process lifetime, reducing attack surface.
+// Sharing tokens between processes is opt-in through PersistentCache.
 //
-// Installation tokens have 1-hour validity from GitHub and are cached for 55 minutes
-// (5-minute safety buffer). This reduces API calls to GitHub by ~98% while ensuring
-// tokens are never stale.
+// Installation tokens are cached until the expiry reported by GitHub (typically one
+// hour); callers stop serving them a safety margin before that point. This reduces
+// API calls to GitHub by ~98% while ensuring tokens are never stale.
 //
 // For detailed security analysis, see docs/TOKEN_CACHING.md
 type TokenCache struct {
@@ -31,7 +35,7 @@ type TokenCache struct {
 // - Caching reduces GitHub API load and improves performance
 type CachedToken struct {
 	Token     string    // GitHub installation token (ghs_...)
-	ExpiresAt time.Time // When this token expires (55-min from creation)
+	ExpiresAt time.Time // When this token expires
 	CreatedAt time.Time // When this token was cached
 }
 
@@ -67,6 +71,21 @@ func (c *TokenCache) Get(key string) (string, bool) {
 	return cached.Token, true
 }
 
+// GetEntry retrieves a copy of a cached token, including its expiry, if it exists
+// and is not expired
+func (c *TokenCache) GetEntry(key string) (*CachedToken, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, exists := c.cache[key]
+	if !exists || time.Now().After(cached.ExpiresAt) {
+		return nil, false
+	}
+
+	entry := *cached
+	return &entry, true
+}
+
 // Set stores a token in the cache with the specified TTL
 func (c *TokenCache) Set(key, token string, ttl time.Duration) {
 	c.mu.Lock()
@@ -92,6 +111,23 @@ func (c *TokenCache) Delete(key string) {
 	}
 }
 
+// DeleteMatching removes every token whose key satisfies match and returns how
+// many were removed
+func (c *TokenCache) DeleteMatching(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, cached := range c.cache {
+		if match(key) {
+			c.zeroToken(cached.Token)
+			delete(c.cache, key)
+			removed++
+		}
+	}
+	return removed
+}
+
 // Clear removes all tokens from the cache
 func (c *TokenCache) Clear() {
 	c.mu.Lock()
@@ -197,3 +233,21 @@ func (c *TokenCache) zeroToken(token string) {
 func CreateCacheKey(appID, installationID int64) string {
 	return fmt.Sprintf("app_%d_inst_%d", appID, installationID)
 }
+
+// KeyBelongsToApp reports whether a key created by CreateCacheKey or
+// CreateScopedCacheKey belongs to appID, for any installation and scope
+func KeyBelongsToApp(key string, appID int64) bool {
+	return strings.HasPrefix(key, fmt.Sprintf("app_%d_inst_", appID))
+}
+
+// CreateScopedCacheKey creates a cache key for a token narrowed to a scope. The
+// scope is hashed so the key stays short and safe to use as a file name. An
+// empty scope yields the same key as CreateCacheKey.
+func CreateScopedCacheKey(appID, installationID int64, scope string) string {
+	key := CreateCacheKey(appID, installationID)
+	if scope == "" {
+		return key
+	}
+	sum := sha256.Sum256([]byte(scope))
+	return fmt.Sprintf("%s_scope_%s", key, hex.EncodeToString(sum[:8]))
+}
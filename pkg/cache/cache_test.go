@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -276,6 +277,73 @@ func TestCreateCacheKey(t *testing.T) {
 	}
 }
 
+func TestCreateScopedCacheKey(t *testing.T) {
+	unscoped := CreateScopedCacheKey(1, 2, "")
+	if unscoped != CreateCacheKey(1, 2) {
+		t.Errorf("CreateScopedCacheKey() with empty scope = %v, want %v", unscoped, CreateCacheKey(1, 2))
+	}
+
+	readOnly := CreateScopedCacheKey(1, 2, "repos:;perms:contents=read")
+	if readOnly == unscoped {
+		t.Error("Expected scoped key to differ from unscoped key")
+	}
+	if readOnly != CreateScopedCacheKey(1, 2, "repos:;perms:contents=read") {
+		t.Error("Expected scoped key to be deterministic")
+	}
+	if readOnly == CreateScopedCacheKey(1, 2, "repos:;perms:contents=write") {
+		t.Error("Expected different scopes to yield different keys")
+	}
+	if strings.ContainsAny(readOnly, "/:;=,") {
+		t.Errorf("Expected scoped key to be file-name safe, got %q", readOnly)
+	}
+}
+
+func TestTokenCache_DeleteMatching(t *testing.T) {
+	tc := NewTokenCache()
+	defer tc.Clear()
+
+	keys := []string{
+		CreateCacheKey(1, 10),
+		CreateScopedCacheKey(1, 20, "repos:a;perms:"),
+		CreateCacheKey(12, 10),
+		CreateCacheKey(2, 10),
+	}
+	for _, key := range keys {
+		tc.Set(key, "token-"+key, time.Hour)
+	}
+
+	removed := tc.DeleteMatching(func(key string) bool { return KeyBelongsToApp(key, 1) })
+	if removed != 2 {
+		t.Errorf("DeleteMatching() = %d, want 2", removed)
+	}
+	for i, key := range keys {
+		_, found := tc.Get(key)
+		if want := i >= 2; found != want {
+			t.Errorf("Get(%s) found = %v, want %v", key, found, want)
+		}
+	}
+}
+
+func TestKeyBelongsToApp(t *testing.T) {
+	tests := []struct {
+		key   string
+		appID int64
+		want  bool
+	}{
+		{key: CreateCacheKey(1, 2), appID: 1, want: true},
+		{key: CreateScopedCacheKey(1, 2, "repos:a;perms:"), appID: 1, want: true},
+		{key: CreateCacheKey(12, 2), appID: 1, want: false},
+		{key: CreateCacheKey(1, 2), appID: 12, want: false},
+		{key: "unrelated", appID: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := KeyBelongsToApp(tt.key, tt.appID); got != tt.want {
+			t.Errorf("KeyBelongsToApp(%q, %d) = %v, want %v", tt.key, tt.appID, got, tt.want)
+		}
+	}
+}
+
 func TestTokenCache_OverwriteExisting(t *testing.T) {
 	cache := NewTokenCache()
 	defer cache.Clear()
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultIdentityTTL is how long a fetched app identity is trusted before it
+// is fetched again, matching the scope cache
+const DefaultIdentityTTL = 24 * time.Hour
+
+// AppIdentity is what GitHub knows a GitHub App as: the slug of its URL and
+// the bot user that commits and comments on its behalf
+type AppIdentity struct {
+	Slug string `json:"slug"`
+	// Name is the app's display name on GitHub
+	Name        string    `json:"name"`
+	BotUserID   int64     `json:"bot_user_id"`
+	ResolvedAt  time.Time `json:"resolved_at"`
+	CacheExpiry time.Time `json:"cache_expiry"`
+}
+
+func (i AppIdentity) expiresAt() time.Time {
+	return i.CacheExpiry
+}
+
+// Login returns the login of the app's bot user, e.g. my-app[bot]
+func (i AppIdentity) Login() string {
+	return i.Slug + "[bot]"
+}
+
+// Email returns the noreply address GitHub attributes to the app's bot user
+// on host, e.g. 41898282+my-app[bot]@users.noreply.github.com
+func (i AppIdentity) Email(host string) string {
+	return fmt.Sprintf("%d+%s@users.noreply.%s", i.BotUserID, i.Login(), host)
+}
+
+// IdentityStore remembers the identity of GitHub Apps, so the bot login used
+// as git credential username is available without requests to GitHub.
+//
+// Like InstallationStore, entries are kept in memory and, once Persist is
+// called, in a JSON file shared between processes. Identities are public.
+type IdentityStore struct {
+	jsonStore[AppIdentity]
+}
+
+// NewIdentityStore creates an in-memory identity store
+func NewIdentityStore() *IdentityStore {
+	return &IdentityStore{newJSONStore[AppIdentity]("identity cache", DefaultIdentityTTL)}
+}
+
+// CreateIdentityKey creates the store key for the identity of appID on host
+func CreateIdentityKey(appID int64, host string) string {
+	return storeKey(appID, host)
+}
+
+// Get returns the identity recorded for key if it has not expired
+func (s *IdentityStore) Get(key string) (AppIdentity, bool) {
+	return s.get(key)
+}
+
+// Set records identity for key
+func (s *IdentityStore) Set(key string, identity AppIdentity) error {
+	return s.set(key, func(resolvedAt, expiry time.Time) AppIdentity {
+		identity.ResolvedAt, identity.CacheExpiry = resolvedAt, expiry
+		return identity
+	})
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppIdentity_LoginEmail(t *testing.T) {
+	identity := AppIdentity{Slug: "my-app", BotUserID: 41898282}
+	if got := identity.Login(); got != "my-app[bot]" {
+		t.Errorf("Login() = %q, want my-app[bot]", got)
+	}
+	want := "41898282+my-app[bot]@users.noreply.github.example.com"
+	if got := identity.Email("github.example.com"); got != want {
+		t.Errorf("Email() = %q, want %q", got, want)
+	}
+}
+
+func TestIdentityStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "identities.json")
+	key := CreateIdentityKey(1, "GitHub.com")
+
+	writer := NewIdentityStore()
+	writer.Persist(path)
+	if err := writer.Set(key, AppIdentity{Slug: "app-one", BotUserID: 10}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := writer.Set(CreateIdentityKey(2, "github.com"), AppIdentity{Slug: "app-two", BotUserID: 20}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	reader := NewIdentityStore()
+	reader.Persist(path)
+	identity, found := reader.Get(CreateIdentityKey(1, "github.com"))
+	if !found || identity.Slug != "app-one" || identity.BotUserID != 10 {
+		t.Errorf("Get() = %+v, %v, want app-one from file", identity, found)
+	}
+
+	removed, err := reader.DeleteMatching(func(key string) bool { return StoreKeyBelongsToApp(key, 1) })
+	if err != nil || removed != 1 {
+		t.Errorf("DeleteMatching() = %d, %v, want 1", removed, err)
+	}
+
+	fresh := NewIdentityStore()
+	fresh.Persist(path)
+	if _, found := fresh.Get(key); found {
+		t.Error("Expected deleted identity to be gone from file")
+	}
+	if _, found := fresh.Get(CreateIdentityKey(2, "github.com")); !found {
+		t.Error("Expected other app's identity to remain")
+	}
+
+	fresh.now = func() time.Time { return time.Now().Add(DefaultIdentityTTL + time.Minute) }
+	if _, found := fresh.Get(CreateIdentityKey(2, "github.com")); found {
+		t.Error("Expected expired identity to be ignored")
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import "time"
+
+// DefaultInstallationTTL is how long a resolved installation is trusted before
+// it is looked up again, matching the scope cache
+const DefaultInstallationTTL = 24 * time.Hour
+
+// ResolvedInstallation records the installation that serves a repository owner
+type ResolvedInstallation struct {
+	InstallationID int64     `json:"installation_id"`
+	ResolvedAt     time.Time `json:"resolved_at"`
+	CacheExpiry    time.Time `json:"cache_expiry"`
+}
+
+func (r ResolvedInstallation) expiresAt() time.Time {
+	return r.CacheExpiry
+}
+
+// InstallationStore remembers which installation of a GitHub App serves each
+// repository owner, so apps configured with installation_id 0 look their
+// installation up once per owner rather than on every token request.
+//
+// Entries are kept in memory and, once Persist is called, in a JSON file shared
+// between processes. Installation IDs are not secret, so the file is written
+// directly rather than through the secrets manager.
+type InstallationStore struct {
+	jsonStore[ResolvedInstallation]
+}
+
+// NewInstallationStore creates an in-memory installation store
+func NewInstallationStore() *InstallationStore {
+	return &InstallationStore{newJSONStore[ResolvedInstallation]("installation cache", DefaultInstallationTTL)}
+}
+
+// CreateInstallationKey creates the store key for the installation of appID
+// that serves owner on host
+func CreateInstallationKey(appID int64, host, owner string) string {
+	return storeKey(appID, host, owner)
+}
+
+// Get returns the installation ID recorded for key if it has not expired
+func (s *InstallationStore) Get(key string) (int64, bool) {
+	entry, found := s.get(key)
+	return entry.InstallationID, found
+}
+
+// Set records the installation ID serving key
+func (s *InstallationStore) Set(key string, installationID int64) error {
+	return s.set(key, func(resolvedAt, expiry time.Time) ResolvedInstallation {
+		return ResolvedInstallation{InstallationID: installationID, ResolvedAt: resolvedAt, CacheExpiry: expiry}
+	})
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstallationStore_GetSet(t *testing.T) {
+	store := NewInstallationStore()
+	key := CreateInstallationKey(1, "GitHub.com", "MyOrg")
+
+	if _, found := store.Get(key); found {
+		t.Fatal("Expected empty store")
+	}
+	if err := store.Set(key, 42); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if id, found := store.Get(CreateInstallationKey(1, "github.com", "myorg")); !found || id != 42 {
+		t.Errorf("Get() = %d, %v, want 42 with case-insensitive key", id, found)
+	}
+	if _, found := store.Get(CreateInstallationKey(1, "github.com", "other")); found {
+		t.Error("Expected other owner to be unresolved")
+	}
+
+	store.now = func() time.Time { return time.Now().Add(DefaultInstallationTTL + time.Minute) }
+	if _, found := store.Get(key); found {
+		t.Error("Expected expired installation to be ignored")
+	}
+}
+
+func TestInstallationStore_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "installations.json")
+
+	writer := NewInstallationStore()
+	writer.Persist(path)
+	if err := writer.Set(CreateInstallationKey(1, "github.com", "org-a"), 100); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := writer.Set(CreateInstallationKey(2, "github.com", "org-a"), 200); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file permissions = %o, want 600", perm)
+	}
+
+	reader := NewInstallationStore()
+	reader.Persist(path)
+	if id, found := reader.Get(CreateInstallationKey(1, "github.com", "org-a")); !found || id != 100 {
+		t.Errorf("Get() = %d, %v, want 100 from file", id, found)
+	}
+
+	removed, err := reader.DeleteMatching(func(key string) bool { return StoreKeyBelongsToApp(key, 1) })
+	if err != nil {
+		t.Fatalf("DeleteMatching() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("DeleteMatching() = %d, want 1", removed)
+	}
+
+	fresh := NewInstallationStore()
+	fresh.Persist(path)
+	if _, found := fresh.Get(CreateInstallationKey(1, "github.com", "org-a")); found {
+		t.Error("Expected deleted installation to be gone from file")
+	}
+	if id, found := fresh.Get(CreateInstallationKey(2, "github.com", "org-a")); !found || id != 200 {
+		t.Errorf("Get() = %d, %v, want other app's installation to remain", id, found)
+	}
+}
+
+func TestInstallationStore_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "installations.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	store := NewInstallationStore()
+	store.Persist(path)
+	if _, found := store.Get(CreateInstallationKey(1, "github.com", "org")); found {
+		t.Error("Expected corrupt file to be ignored")
+	}
+	if err := store.Set(CreateInstallationKey(1, "github.com", "org"), 7); err != nil {
+		t.Fatalf("Set() over corrupt file error = %v", err)
+	}
+
+	reader := NewInstallationStore()
+	reader.Persist(path)
+	if id, found := reader.Get(CreateInstallationKey(1, "github.com", "org")); !found || id != 7 {
+		t.Errorf("Get() = %d, %v, want 7 after rewrite", id, found)
+	}
+}
+
+func TestStoreKeyBelongsToApp(t *testing.T) {
+	for _, key := range []string{CreateInstallationKey(12, "github.com", "org"), CreateIdentityKey(12, "github.com")} {
+		if !StoreKeyBelongsToApp(key, 12) {
+			t.Errorf("Expected %s to belong to app 12", key)
+		}
+		if StoreKeyBelongsToApp(key, 1) {
+			t.Errorf("Expected %s not to belong to app 1", key)
+		}
+	}
+}
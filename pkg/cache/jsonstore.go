@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/fileutil"
+)
+
+// expiringEntry is a value a jsonStore can hold
+type expiringEntry interface {
+	expiresAt() time.Time
+}
+
+// jsonStore holds expiring entries in memory and, once Persist is called, in a
+// JSON file shared between processes. It backs InstallationStore and
+// IdentityStore, whose entries are not secret, so the file is written directly
+// rather than through the secrets manager.
+type jsonStore[T expiringEntry] struct {
+	// name describes the store in error messages, e.g. "installation cache"
+	name        string
+	ttl         time.Duration
+	lockTimeout time.Duration
+
+	mu      sync.Mutex
+	path    string
+	entries map[string]T
+	// now returns the current time (can be overridden for testing)
+	now func() time.Time
+}
+
+// storeKey creates a jsonStore key for appID, e.g. app_1/github.com/org
+func storeKey(appID int64, parts ...string) string {
+	return fmt.Sprintf("app_%d/%s", appID, strings.ToLower(strings.Join(parts, "/")))
+}
+
+// StoreKeyBelongsToApp reports whether a key created by CreateInstallationKey
+// or CreateIdentityKey belongs to appID
+func StoreKeyBelongsToApp(key string, appID int64) bool {
+	return strings.HasPrefix(key, fmt.Sprintf("app_%d/", appID))
+}
+
+func newJSONStore[T expiringEntry](name string, ttl time.Duration) jsonStore[T] {
+	return jsonStore[T]{
+		name:        name,
+		ttl:         ttl,
+		lockTimeout: defaultLockTimeout,
+		entries:     make(map[string]T),
+		now:         time.Now,
+	}
+}
+
+// Persist makes the store read and write its entries in the JSON file at path
+func (s *jsonStore[T]) Persist(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+}
+
+// get returns the entry recorded for key if it has not expired
+func (s *jsonStore[T]) get(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, found := s.entries[key]
+	if !found && s.path != "" {
+		persisted, err := s.readFile()
+		if err == nil {
+			entry, found = persisted[key]
+		}
+	}
+	if !found || !s.now().Before(entry.expiresAt()) {
+		var zero T
+		return zero, false
+	}
+
+	s.entries[key] = entry
+	return entry, true
+}
+
+// set records the entry built by stamp for key. stamp receives the current
+// time and the expiry the store's TTL gives the entry.
+func (s *jsonStore[T]) set(key string, stamp func(resolvedAt, expiry time.Time) T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry := stamp(now, now.Add(s.ttl))
+	s.entries[key] = entry
+
+	return s.updateFile(func(persisted map[string]T) int {
+		persisted[key] = entry
+		return 1
+	})
+}
+
+// DeleteMatching removes every entry whose key satisfies match and returns how
+// many were removed
+func (s *jsonStore[T]) DeleteMatching(match func(key string) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for key := range s.entries {
+		if match(key) {
+			delete(s.entries, key)
+			removed++
+		}
+	}
+
+	persistedRemoved := 0
+	err := s.updateFile(func(persisted map[string]T) int {
+		for key := range persisted {
+			if match(key) {
+				delete(persisted, key)
+				persistedRemoved++
+			}
+		}
+		return persistedRemoved
+	})
+	if s.path == "" {
+		return removed, nil
+	}
+	// Entries read from the file are also held in memory; count them once
+	return persistedRemoved, err
+}
+
+// updateFile applies update to the persisted entries under a cross-process
+// lock, dropping expired entries. update returns the number of changes; the
+// file is only rewritten when there are any. Callers must hold s.mu.
+func (s *jsonStore[T]) updateFile(update func(map[string]T) int) error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", s.name, err)
+	}
+
+	unlock, err := acquireFileLock(s.path+".lock", s.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// A missing or corrupt file only costs extra lookups; start over
+	persisted, _ := s.readFile()
+
+	changes := update(persisted)
+	now := s.now()
+	for key, entry := range persisted {
+		if !now.Before(entry.expiresAt()) {
+			delete(persisted, key)
+			changes++
+		}
+	}
+	if changes == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", s.name, err)
+	}
+	if err := fileutil.WriteFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// readFile reads the persisted entries, returning an empty map with any error
+func (s *jsonStore[T]) readFile() (map[string]T, error) {
+	persisted := make(map[string]T)
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return persisted, err
+	}
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return make(map[string]T), fmt.Errorf("failed to parse %s: %w", s.name, err)
+	}
+	return persisted, nil
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/fileutil"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// ErrLockTimeout is returned when a cache entry lock cannot be acquired in time
+var ErrLockTimeout = errors.New("timed out waiting for token cache lock")
+
+const (
+	// defaultLockTimeout bounds how long a process waits for another process
+	// to finish minting a token for the same cache key
+	defaultLockTimeout = 30 * time.Second
+)
+
+// PersistentCache shares installation tokens between short-lived processes.
+//
+// git starts a fresh `gh app-auth git-credential` process for every request, so the
+// in-memory TokenCache never sees a second lookup. PersistentCache stores the token
+// value through the secrets manager (OS keyring, or the encrypted filesystem store)
+// using SecretTypeInstallToken, and keeps a small metadata file per entry in its directory
+// holding the expiry. Tokens are never returned after their recorded expiry, and
+// never written to disk as plaintext: without a keyring or a passphrase, Set fails.
+//
+// Lock serialises token minting per cache key across processes, so parallel git
+// processes (e.g. submodule fetches) wait for the first one instead of each minting
+// their own token.
+type PersistentCache struct {
+	dir         string
+	secrets     *secrets.Manager
+	lockTimeout time.Duration
+}
+
+// persistedEntry is the non-secret metadata stored on disk for each cached token
+type persistedEntry struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewPersistentCache creates a persistent cache rooted at dir, storing token values
+// through the given secrets manager
+func NewPersistentCache(dir string, secretMgr *secrets.Manager) *PersistentCache {
+	return &PersistentCache{
+		dir:         dir,
+		secrets:     secretMgr,
+		lockTimeout: defaultLockTimeout,
+	}
+}
+
+// Get retrieves a token if it exists and has not expired. Expired entries are removed.
+func (p *PersistentCache) Get(key string) (*CachedToken, bool) {
+	entry, err := p.readEntry(key)
+	if err != nil {
+		return nil, false
+	}
+
+	if !time.Now().Before(entry.ExpiresAt) {
+		_ = p.Delete(key)
+		return nil, false
+	}
+
+	token, _, err := p.secrets.Get(key, secrets.SecretTypeInstallToken)
+	if err != nil || token == "" {
+		return nil, false
+	}
+
+	return &CachedToken{
+		Token:     token,
+		ExpiresAt: entry.ExpiresAt,
+		CreatedAt: entry.CreatedAt,
+	}, true
+}
+
+// Set stores a token until expiresAt
+func (p *PersistentCache) Set(key, token string, expiresAt time.Time) error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+
+	if _, err := p.secrets.StoreEncrypted(key, secrets.SecretTypeInstallToken, token); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+
+	entry := persistedEntry{
+		Key:       key,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	if err := fileutil.WriteFileAtomic(p.entryPath(key), data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a token and its metadata
+func (p *PersistentCache) Delete(key string) error {
+	if err := os.Remove(p.entryPath(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cache entry: %w", err)
+	}
+
+	// Best effort: without its metadata file the secret is never served again
+	_ = p.secrets.Delete(key, secrets.SecretTypeInstallToken)
+	return nil
+}
+
+// Keys returns the keys of all persisted entries, including expired ones
+func (p *PersistentCache) Keys() ([]string, error) {
+	files, err := os.ReadDir(p.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache directory: %w", err)
+	}
+
+	var keys []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(name, ".json"))
+	}
+	return keys, nil
+}
+
+// DeleteMatching removes every persisted token whose key satisfies match and
+// returns how many were removed
+func (p *PersistentCache) DeleteMatching(match func(key string) bool) (int, error) {
+	keys, err := p.Keys()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		if !match(key) {
+			continue
+		}
+		if err := p.Delete(key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Lock acquires an exclusive cross-process lock for a cache key. The returned
+// function releases it.
+func (p *PersistentCache) Lock(key string) (func(), error) {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+	return acquireFileLock(p.lockPath(key), p.lockTimeout)
+}
+
+// readEntry reads the metadata for a key
+func (p *PersistentCache) readEntry(key string) (*persistedEntry, error) {
+	data, err := os.ReadFile(p.entryPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry persistedEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// entryPath returns the metadata file path for a key
+func (p *PersistentCache) entryPath(key string) string {
+	return filepath.Join(p.dir, filepath.Base(key)+".json")
+}
+
+// acquireFileLock takes the lock file at path, polling until timeout
+func acquireFileLock(path string, timeout time.Duration) (func(), error) {
+	unlock, err := fileutil.Lock(path, timeout)
+	if errors.Is(err, fileutil.ErrLockTimeout) {
+		return nil, ErrLockTimeout
+	}
+	return unlock, err
+}
+
+// lockPath returns the lock file path for a key
+func (p *PersistentCache) lockPath(key string) string {
+	return filepath.Join(p.dir, filepath.Base(key)+".lock")
+}
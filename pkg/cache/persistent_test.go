@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+func newTestPersistentCache(t *testing.T) *PersistentCache {
+	t.Helper()
+
+	// Force the filesystem fallback so tests never touch the real keyring
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	t.Cleanup(func() { keyring.MockInitWithError(nil) })
+	t.Setenv(secrets.PassphraseEnv, "test-passphrase")
+
+	dir := t.TempDir()
+	return NewPersistentCache(dir+"/cache/tokens", secrets.NewManager(dir))
+}
+
+func TestPersistentCache_SetAndGet(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	key := CreateCacheKey(123, 456)
+
+	if _, found := pc.Get(key); found {
+		t.Fatal("Expected cache miss on empty cache")
+	}
+
+	expiresAt := time.Now().Add(30 * time.Minute)
+	if err := pc.Set(key, "ghs_persisted", expiresAt); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// A second cache instance simulates another git-credential process
+	other := NewPersistentCache(pc.dir, pc.secrets)
+	cached, found := other.Get(key)
+	if !found {
+		t.Fatal("Expected cache hit from another instance")
+	}
+	if cached.Token != "ghs_persisted" {
+		t.Errorf("Token = %q, want %q", cached.Token, "ghs_persisted")
+	}
+	if !cached.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v, want %v", cached.ExpiresAt, expiresAt)
+	}
+}
+
+func TestPersistentCache_Overwrite(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	key := CreateCacheKey(1, 2)
+
+	if err := pc.Set(key, "first", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := pc.Set(key, "second", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Set() overwrite error = %v", err)
+	}
+
+	cached, found := pc.Get(key)
+	if !found || cached.Token != "second" {
+		t.Errorf("Get() = %v, %v; want second token", cached, found)
+	}
+}
+
+func TestPersistentCache_Expired(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	key := CreateCacheKey(1, 2)
+
+	if err := pc.Set(key, "expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if _, found := pc.Get(key); found {
+		t.Error("Expected expired token to be rejected")
+	}
+
+	keys, err := pc.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected expired entry to be removed, got keys %v", keys)
+	}
+}
+
+func TestPersistentCache_DeleteAndKeys(t *testing.T) {
+	pc := newTestPersistentCache(t)
+
+	for _, key := range []string{CreateCacheKey(1, 1), CreateCacheKey(1, 2)} {
+		if err := pc.Set(key, "token-"+key, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	keys, err := pc.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Keys() = %v, want 2 entries", keys)
+	}
+
+	if err := pc.Delete(CreateCacheKey(1, 1)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, found := pc.Get(CreateCacheKey(1, 1)); found {
+		t.Error("Expected deleted token to be gone")
+	}
+	if _, found := pc.Get(CreateCacheKey(1, 2)); !found {
+		t.Error("Expected other token to remain")
+	}
+
+	// Deleting a missing key is not an error
+	if err := pc.Delete("missing"); err != nil {
+		t.Errorf("Delete(missing) error = %v", err)
+	}
+}
+
+func TestPersistentCache_DeleteMatching(t *testing.T) {
+	pc := newTestPersistentCache(t)
+
+	keys := []string{CreateCacheKey(1, 1), CreateScopedCacheKey(1, 2, "repos:a;perms:"), CreateCacheKey(2, 1)}
+	for _, key := range keys {
+		if err := pc.Set(key, "token-"+key, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+
+	removed, err := pc.DeleteMatching(func(key string) bool { return KeyBelongsToApp(key, 1) })
+	if err != nil {
+		t.Fatalf("DeleteMatching() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("DeleteMatching() = %d, want 2", removed)
+	}
+
+	remaining, err := pc.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(remaining) != 1 || remaining[0] != CreateCacheKey(2, 1) {
+		t.Errorf("Keys() after DeleteMatching = %v, want [%s]", remaining, CreateCacheKey(2, 1))
+	}
+}
+
+func TestPersistentCache_LockSerialisesMinting(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	key := CreateCacheKey(7, 8)
+
+	var minted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := pc.Lock(key)
+			if err != nil {
+				t.Errorf("Lock() error = %v", err)
+				return
+			}
+			defer unlock()
+
+			if _, found := pc.Get(key); found {
+				return
+			}
+			atomic.AddInt32(&minted, 1)
+			if err := pc.Set(key, "minted", time.Now().Add(time.Hour)); err != nil {
+				t.Errorf("Set() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if minted != 1 {
+		t.Errorf("Expected exactly one token to be minted, got %d", minted)
+	}
+}
+
+func TestPersistentCache_LockTimeout(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	pc.lockTimeout = 100 * time.Millisecond
+	key := CreateCacheKey(9, 9)
+
+	unlock, err := pc.Lock(key)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer unlock()
+
+	if _, err := pc.Lock(key); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Second Lock() error = %v, want %v", err, ErrLockTimeout)
+	}
+}
+
+func TestPersistentCache_RefusesPlaintext(t *testing.T) {
+	pc := newTestPersistentCache(t)
+	t.Setenv(secrets.PassphraseEnv, "")
+	pc.secrets = secrets.NewManager(t.TempDir())
+	key := CreateCacheKey(3, 4)
+
+	err := pc.Set(key, "ghs_plaintext", time.Now().Add(time.Hour))
+	if !errors.Is(err, secrets.ErrStorageUnavailable) {
+		t.Fatalf("Set() error = %v, want %v", err, secrets.ErrStorageUnavailable)
+	}
+	if refs, _ := pc.secrets.FallbackSecrets(); len(refs) != 0 {
+		t.Errorf("Set() wrote %v to the filesystem store", refs)
+	}
+	if _, found := pc.Get(key); found {
+		t.Error("Expected no token after a refused Set()")
+	}
+}
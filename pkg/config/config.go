@@ -3,16 +3,21 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
 )
 
 // Common errors returned by config
 var (
 	ErrNoGitHubAppDefined = errors.New("at least one github_app or pat is required")
+	// ErrExternalSigner is returned when reading a key kept by an external signer
+	ErrExternalSigner = errors.New("private key is held by an external signer and cannot be read")
 )
 
 // CurrentConfigVersion is the latest configuration schema version
@@ -23,6 +28,69 @@ type Config struct {
 	Version    string                `yaml:"version" json:"version"`
 	GitHubApps []GitHubApp           `yaml:"github_apps" json:"github_apps"`
 	PATs       []PersonalAccessToken `yaml:"pats,omitempty" json:"pats,omitempty"`
+	TokenCache *TokenCacheConfig     `yaml:"token_cache,omitempty" json:"token_cache,omitempty"`
+	// Transport holds HTTP settings keyed by GitHub host (e.g. github.example.com)
+	Transport map[string]TransportConfig `yaml:"transport,omitempty" json:"transport,omitempty"`
+	// Retry controls retries of failed GitHub API requests
+	Retry *RetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// SecretBackends holds settings for pluggable secret backends, keyed by
+	// backend name (e.g. vault)
+	SecretBackends map[string]map[string]string `yaml:"secret_backends,omitempty" json:"secret_backends,omitempty"`
+
+	// provenance records the layer each entry came from when the configuration
+	// was merged from several files (nil for a single file)
+	provenance *provenance
+	// loaded is the user file's part of the configuration as last loaded or
+	// saved, which Save compares against to write only this process's changes
+	// (nil for a configuration built in memory)
+	loaded *Config
+}
+
+// TokenCacheConfig controls how installation tokens are cached between invocations
+type TokenCacheConfig struct {
+	// Persistent shares installation tokens between git-credential processes
+	// through the secrets manager instead of keeping them in process memory only
+	Persistent bool `yaml:"persistent" json:"persistent"`
+	// ExpiryMargin is how long before expiry a cached token is replaced, as a
+	// Go duration string (e.g. "5m"). Defaults to five minutes when empty.
+	ExpiryMargin string `yaml:"expiry_margin,omitempty" json:"expiry_margin,omitempty"`
+}
+
+// maxTokenExpiryMargin keeps the margin below the one-hour installation token lifetime
+const maxTokenExpiryMargin = 30 * time.Minute
+
+// PersistentTokenCache reports whether installation tokens should be persisted
+func (c *Config) PersistentTokenCache() bool {
+	return c != nil && c.TokenCache != nil && c.TokenCache.Persistent
+}
+
+// TokenExpiryMargin returns the configured cache expiry margin. The boolean is
+// false when no valid margin is configured and the default should be used.
+func (c *Config) TokenExpiryMargin() (time.Duration, bool) {
+	if c == nil || c.TokenCache == nil || c.TokenCache.ExpiryMargin == "" {
+		return 0, false
+	}
+	margin, err := time.ParseDuration(c.TokenCache.ExpiryMargin)
+	if err != nil {
+		return 0, false
+	}
+	return margin, true
+}
+
+// Validate validates the token cache configuration
+func (t *TokenCacheConfig) Validate() error {
+	if t.ExpiryMargin == "" {
+		return nil
+	}
+
+	margin, err := time.ParseDuration(t.ExpiryMargin)
+	if err != nil {
+		return fmt.Errorf("invalid expiry_margin: %w", err)
+	}
+	if margin < 0 || margin > maxTokenExpiryMargin {
+		return fmt.Errorf("expiry_margin must be between 0s and %s", maxTokenExpiryMargin)
+	}
+	return nil
 }
 
 // PrivateKeySource indicates where the private key is stored
@@ -35,8 +103,59 @@ const (
 	PrivateKeySourceFilesystem PrivateKeySource = "filesystem"
 	// PrivateKeySourceInline indicates the key was provided inline (legacy)
 	PrivateKeySourceInline PrivateKeySource = "inline"
+	// PrivateKeySourceVault indicates the key is in HashiCorp Vault. Any other
+	// backend registered with the secrets package can be named the same way.
+	PrivateKeySourceVault PrivateKeySource = "vault"
+	// PrivateKeySourceCommand indicates the key is printed by an external
+	// program, configured with private_key_command or token_command
+	PrivateKeySourceCommand PrivateKeySource = "command"
+	// PrivateKeySourceEnv indicates the key is held in an environment
+	// variable, named by private_key_env or token_env
+	PrivateKeySourceEnv PrivateKeySource = "env"
+	// PrivateKeySourceSigner indicates the key never leaves an external
+	// signer: a PKCS#11 token named by private_key_uri, or a program
+	// configured with signer_command
+	PrivateKeySourceSigner PrivateKeySource = "signer"
 )
 
+// SecretCommand runs an external program that prints a secret on stdout, in
+// the manner of AWS's credential_process
+type SecretCommand struct {
+	// Args is the program and its arguments, executed without a shell
+	Args []string `yaml:"args" json:"args"`
+	// Timeout bounds the program, as a Go duration string. Defaults to 30s.
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Cache keeps the output in the memory of a long-running process such as
+	// the agent for this long, as a Go duration string. Empty disables it.
+	Cache string `yaml:"cache,omitempty" json:"cache,omitempty"`
+}
+
+// Validate checks the program and durations of the command
+func (c *SecretCommand) Validate() error {
+	if len(c.Args) == 0 || strings.TrimSpace(c.Args[0]) == "" {
+		return fmt.Errorf("args must name a program")
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive")
+		}
+	}
+	if c.Cache != "" {
+		cache, err := time.ParseDuration(c.Cache)
+		if err != nil {
+			return fmt.Errorf("invalid cache: %w", err)
+		}
+		if cache < 0 {
+			return fmt.Errorf("cache cannot be negative")
+		}
+	}
+	return nil
+}
+
 // InstallationScope represents cached GitHub App installation scope information
 type InstallationScope struct {
 	// Core scope information
@@ -69,6 +188,55 @@ type GitHubApp struct {
 	Patterns         []string           `yaml:"patterns" json:"patterns"`
 	Priority         int                `yaml:"priority" json:"priority"` // Deprecated: Ignored in favor of longest prefix
 	Scope            *InstallationScope `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// PrivateKeyCommand prints the private key when private_key_source is command
+	PrivateKeyCommand *SecretCommand `yaml:"private_key_command,omitempty" json:"private_key_command,omitempty"`
+	// PrivateKeyEnv names the environment variable holding the key when
+	// private_key_source is env
+	PrivateKeyEnv string `yaml:"private_key_env,omitempty" json:"private_key_env,omitempty"`
+	// PrivateKeyURI names the key in a PKCS#11 token (pkcs11:token=...;object=...)
+	// when private_key_source is signer
+	PrivateKeyURI string `yaml:"private_key_uri,omitempty" json:"private_key_uri,omitempty"`
+	// SignerCommand signs JWTs with an external program when private_key_source
+	// is signer
+	SignerCommand *SecretCommand `yaml:"signer_command,omitempty" json:"signer_command,omitempty"`
+	// Keys lists the app's private keys when it has several, as during a
+	// rotation; each is stored separately (see AppKey)
+	Keys []AppKey `yaml:"keys,omitempty" json:"keys,omitempty"`
+	// KeyFingerprint is the SHA-256 fingerprint GitHub shows for the app's
+	// private key, recorded by setup and migrate to detect a swapped key.
+	// Apps with several keys record one per key instead.
+	KeyFingerprint string `yaml:"key_fingerprint,omitempty" json:"key_fingerprint,omitempty"`
+	// SecretID names the app's secrets in storage, so that renaming the app
+	// or giving two apps the same name leaves its keys alone. Entries without
+	// one are stored under their name; migrate assigns one.
+	SecretID string `yaml:"secret_id,omitempty" json:"secret_id,omitempty"`
+
+	// Permissions narrows installation tokens to these permissions (e.g. contents: read)
+	Permissions map[string]string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	// Repositories narrows installation tokens to these repositories
+	Repositories []string `yaml:"repositories,omitempty" json:"repositories,omitempty"`
+	// PatternScopes override Permissions and Repositories for matching repositories
+	PatternScopes []PatternScope `yaml:"pattern_scopes,omitempty" json:"pattern_scopes,omitempty"`
+	// NarrowToRepository set to false makes git-credential request tokens for
+	// the configured scope rather than the single repository being accessed
+	NarrowToRepository *bool `yaml:"narrow_to_repository,omitempty" json:"narrow_to_repository,omitempty"`
+	// APIURL overrides the REST API base URL derived from the repository host
+	// (e.g. https://ghes.example.com/api/v3)
+	APIURL string `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+}
+
+// TokenScope restricts the repositories and permissions of an installation token.
+// Empty fields leave the installation's defaults in place.
+type TokenScope struct {
+	Permissions  map[string]string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	Repositories []string          `yaml:"repositories,omitempty" json:"repositories,omitempty"`
+}
+
+// PatternScope applies a token scope to repositories matching a URL prefix
+type PatternScope struct {
+	Pattern      string            `yaml:"pattern" json:"pattern"`
+	Permissions  map[string]string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
+	Repositories []string          `yaml:"repositories,omitempty" json:"repositories,omitempty"`
 }
 
 type PersonalAccessToken struct {
@@ -78,6 +246,15 @@ type PersonalAccessToken struct {
 	Priority    int              `yaml:"priority" json:"priority"`
 	// Username for HTTP basic auth (optional, defaults to "x-access-token" for GitHub)
 	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	// APIURL overrides the REST API base URL derived from the repository host
+	APIURL string `yaml:"api_url,omitempty" json:"api_url,omitempty"`
+	// TokenCommand prints the token when private_key_source is command
+	TokenCommand *SecretCommand `yaml:"token_command,omitempty" json:"token_command,omitempty"`
+	// TokenEnv names the environment variable holding the token when
+	// private_key_source is env
+	TokenEnv string `yaml:"token_env,omitempty" json:"token_env,omitempty"`
+	// SecretID names the token in storage, like GitHubApp.SecretID
+	SecretID string `yaml:"secret_id,omitempty" json:"secret_id,omitempty"`
 }
 
 // Validate validates the configuration
@@ -102,6 +279,26 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.TokenCache != nil {
+		if err := c.TokenCache.Validate(); err != nil {
+			return fmt.Errorf("token_cache: %w", err)
+		}
+	}
+
+	if err := validateTransport(c.Transport); err != nil {
+		return fmt.Errorf("transport: %w", err)
+	}
+
+	if c.Retry != nil {
+		if err := c.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+
+	if err := validateSecretBackends(c.SecretBackends); err != nil {
+		return fmt.Errorf("secret_backends: %w", err)
+	}
+
 	return nil
 }
 
@@ -118,7 +315,17 @@ func (g *GitHubApp) Validate() error {
 	}
 
 	// Validate patterns
-	return g.validatePatterns()
+	if err := g.validatePatterns(); err != nil {
+		return err
+	}
+
+	// Validate API URL override
+	if err := validateAPIURL(g.APIURL); err != nil {
+		return err
+	}
+
+	// Validate token scopes
+	return g.validateTokenScopes()
 }
 
 // expandPath expands ~ to home directory in file paths
@@ -200,6 +407,10 @@ func (g *GitHubApp) validatePrivateKeyConfig() error {
 		g.PrivateKeySource = PrivateKeySourceFilesystem
 	}
 
+	if len(g.Keys) > 0 {
+		return g.validateKeys()
+	}
+
 	// Validate based on source type
 	switch g.PrivateKeySource {
 	case PrivateKeySourceFilesystem:
@@ -209,11 +420,52 @@ func (g *GitHubApp) validatePrivateKeyConfig() error {
 		return nil
 	case PrivateKeySourceInline:
 		return fmt.Errorf("inline private keys must be migrated to keyring or filesystem")
+	case PrivateKeySourceCommand:
+		if g.PrivateKeyCommand == nil {
+			return fmt.Errorf("private_key_command is required when using command source")
+		}
+		if err := g.PrivateKeyCommand.Validate(); err != nil {
+			return fmt.Errorf("private_key_command: %w", err)
+		}
+		return nil
+	case PrivateKeySourceEnv:
+		if strings.TrimSpace(g.PrivateKeyEnv) == "" {
+			return fmt.Errorf("private_key_env is required when using env source")
+		}
+		return nil
+	case PrivateKeySourceSigner:
+		return g.validateSignerConfig()
 	default:
+		if g.PrivateKeySource.isBackend() {
+			// Key is in a pluggable secret backend, path not needed
+			return nil
+		}
 		return fmt.Errorf("invalid private_key_source: %s", g.PrivateKeySource)
 	}
 }
 
+// validateSignerConfig validates external signer configuration
+func (g *GitHubApp) validateSignerConfig() error {
+	switch {
+	case g.PrivateKeyURI == "" && g.SignerCommand == nil:
+		return fmt.Errorf("private_key_uri or signer_command is required when using signer source")
+	case g.PrivateKeyURI != "" && g.SignerCommand != nil:
+		return fmt.Errorf("private_key_uri and signer_command are mutually exclusive")
+	case g.PrivateKeyURI != "":
+		if !strings.HasPrefix(g.PrivateKeyURI, "pkcs11:") {
+			return fmt.Errorf("private_key_uri must be a pkcs11: URI")
+		}
+		return nil
+	}
+	if g.SignerCommand.Cache != "" {
+		return fmt.Errorf("signer_command: cache is not supported")
+	}
+	if err := g.SignerCommand.Validate(); err != nil {
+		return fmt.Errorf("signer_command: %w", err)
+	}
+	return nil
+}
+
 // validateFilesystemKeyConfig validates filesystem-based private key configuration
 func (g *GitHubApp) validateFilesystemKeyConfig() error {
 	if g.PrivateKeyPath == "" {
@@ -244,6 +496,141 @@ func (g *GitHubApp) validatePatterns() error {
 	return nil
 }
 
+// validateAPIURL checks that an explicit API URL is an absolute HTTP(S) URL
+func validateAPIURL(apiURL string) error {
+	if apiURL == "" {
+		return nil
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("api_url must be an absolute http(s) URL, got %q", apiURL)
+	}
+	return nil
+}
+
+// Host returns the git host of the app's first pattern (e.g. github.com), or
+// an empty string when no pattern names a host
+func (g *GitHubApp) Host() string {
+	return patternsHost(g.Patterns)
+}
+
+// NarrowsToRepository reports whether git-credential tokens are narrowed to the
+// repository being accessed, which they are unless narrow_to_repository is false
+func (g *GitHubApp) NarrowsToRepository() bool {
+	return g.NarrowToRepository == nil || *g.NarrowToRepository
+}
+
+// APIBaseURL returns the REST API base URL for requests about repoURL: the
+// configured api_url, or the endpoint of repoURL's host, falling back to the
+// host of the app's patterns when repoURL is empty
+func (g *GitHubApp) APIBaseURL(repoURL string) string {
+	return resolveAPIBaseURL(g.APIURL, repoURL, g.Patterns)
+}
+
+// APIBaseURL returns the REST API base URL for requests about repoURL, like
+// GitHubApp.APIBaseURL
+func (p *PersonalAccessToken) APIBaseURL(repoURL string) string {
+	return resolveAPIBaseURL(p.APIURL, repoURL, p.Patterns)
+}
+
+func resolveAPIBaseURL(apiURL, repoURL string, patterns []string) string {
+	host := hosts.Normalize(repoURL)
+	if host == "" {
+		host = patternsHost(patterns)
+	}
+	return hosts.Resolve(apiURL, host)
+}
+
+// patternsHost returns the host of the first pattern that names one
+func patternsHost(patterns []string) string {
+	for _, pattern := range patterns {
+		if host := hosts.Normalize(pattern); host != "" && host != "*" {
+			return host
+		}
+	}
+	return ""
+}
+
+// validateTokenScopes validates the app-level and per-pattern token scopes
+func (g *GitHubApp) validateTokenScopes() error {
+	if err := (TokenScope{Permissions: g.Permissions, Repositories: g.Repositories}).Validate(); err != nil {
+		return err
+	}
+
+	for i, patternScope := range g.PatternScopes {
+		if strings.TrimSpace(patternScope.Pattern) == "" {
+			return fmt.Errorf("pattern_scopes[%d]: pattern cannot be empty", i)
+		}
+		scope := TokenScope{Permissions: patternScope.Permissions, Repositories: patternScope.Repositories}
+		if err := scope.Validate(); err != nil {
+			return fmt.Errorf("pattern_scopes[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks permission levels and repository names
+func (s TokenScope) Validate() error {
+	for name, level := range s.Permissions {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("permission name cannot be empty")
+		}
+		switch level {
+		case "read", "write", "admin":
+		default:
+			return fmt.Errorf("invalid access level %q for permission %q (want read, write or admin)", level, name)
+		}
+	}
+
+	for i, repo := range s.Repositories {
+		if strings.TrimSpace(repo) == "" {
+			return fmt.Errorf("repositories[%d] cannot be empty", i)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the scope leaves the installation's defaults in place
+func (s TokenScope) IsEmpty() bool {
+	return len(s.Permissions) == 0 && len(s.Repositories) == 0
+}
+
+// RepositoryNames returns the repository names in the form expected by the
+// GitHub API (owner prefixes removed), sorted and de-duplicated
+func (s TokenScope) RepositoryNames() []string {
+	seen := make(map[string]bool, len(s.Repositories))
+	names := make([]string, 0, len(s.Repositories))
+	for _, repo := range s.Repositories {
+		name := strings.TrimSuffix(strings.TrimSpace(repo), ".git")
+		if idx := strings.LastIndex(name, "/"); idx >= 0 {
+			name = name[idx+1:]
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Key returns a canonical representation of the scope, used to keep tokens with
+// different scopes apart in caches. It is empty for an empty scope.
+func (s TokenScope) Key() string {
+	if s.IsEmpty() {
+		return ""
+	}
+
+	permissions := make([]string, 0, len(s.Permissions))
+	for name, level := range s.Permissions {
+		permissions = append(permissions, name+"="+level)
+	}
+	sort.Strings(permissions)
+
+	return "repos:" + strings.Join(s.RepositoryNames(), ",") + ";perms:" + strings.Join(permissions, ",")
+}
+
 func (p *PersonalAccessToken) Validate() error {
 	if strings.TrimSpace(p.Name) == "" {
 		return fmt.Errorf("name is required")
@@ -259,9 +646,22 @@ func (p *PersonalAccessToken) Validate() error {
 		}
 	}
 
-	if p.TokenSource != "" && p.TokenSource != PrivateKeySourceKeyring && p.TokenSource != PrivateKeySourceFilesystem {
+	switch {
+	case p.TokenSource == PrivateKeySourceCommand:
+		if p.TokenCommand == nil {
+			return fmt.Errorf("token_command is required when using command source")
+		}
+		if err := p.TokenCommand.Validate(); err != nil {
+			return fmt.Errorf("token_command: %w", err)
+		}
+	case p.TokenSource == PrivateKeySourceEnv:
+		if strings.TrimSpace(p.TokenEnv) == "" {
+			return fmt.Errorf("token_env is required when using env source")
+		}
+	case p.TokenSource != "" && p.TokenSource != PrivateKeySourceKeyring &&
+		p.TokenSource != PrivateKeySourceFilesystem && !p.TokenSource.isBackend():
 		return fmt.Errorf("invalid private_key_source: %s", p.TokenSource)
 	}
 
-	return nil
+	return validateAPIURL(p.APIURL)
 }
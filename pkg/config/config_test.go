@@ -74,6 +74,59 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "github_apps[0]: name is required",
 		},
+		{
+			name: "valid token cache expiry margin",
+			config: Config{
+				Version: "1.0",
+				GitHubApps: []GitHubApp{
+					{
+						Name:           "test-app",
+						AppID:          12345,
+						InstallationID: 67890,
+						PrivateKeyPath: "/tmp/key.pem",
+						Patterns:       []string{"github.com/org/*"},
+					},
+				},
+				TokenCache: &TokenCacheConfig{ExpiryMargin: "10m"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unparseable token cache expiry margin",
+			config: Config{
+				Version: "1.0",
+				GitHubApps: []GitHubApp{
+					{
+						Name:           "test-app",
+						AppID:          12345,
+						InstallationID: 67890,
+						PrivateKeyPath: "/tmp/key.pem",
+						Patterns:       []string{"github.com/org/*"},
+					},
+				},
+				TokenCache: &TokenCacheConfig{ExpiryMargin: "soon"},
+			},
+			wantErr: true,
+			errMsg:  `token_cache: invalid expiry_margin: time: invalid duration "soon"`,
+		},
+		{
+			name: "token cache expiry margin too large",
+			config: Config{
+				Version: "1.0",
+				GitHubApps: []GitHubApp{
+					{
+						Name:           "test-app",
+						AppID:          12345,
+						InstallationID: 67890,
+						PrivateKeyPath: "/tmp/key.pem",
+						Patterns:       []string{"github.com/org/*"},
+					},
+				},
+				TokenCache: &TokenCacheConfig{ExpiryMargin: "1h"},
+			},
+			wantErr: true,
+			errMsg:  "token_cache: expiry_margin must be between 0s and 30m0s",
+		},
 	}
 
 	for _, tt := range tests {
@@ -197,6 +250,31 @@ func TestGitHubApp_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "patterns[1] cannot be empty",
 		},
+		{
+			name: "valid api_url",
+			app: GitHubApp{
+				Name:           "test-app",
+				AppID:          12345,
+				InstallationID: 67890,
+				PrivateKeyPath: "/tmp/key.pem",
+				Patterns:       []string{"ghes.example.com/org/*"},
+				APIURL:         "https://ghes.example.com/api/v3",
+			},
+			wantErr: false,
+		},
+		{
+			name: "relative api_url",
+			app: GitHubApp{
+				Name:           "test-app",
+				AppID:          12345,
+				InstallationID: 67890,
+				PrivateKeyPath: "/tmp/key.pem",
+				Patterns:       []string{"ghes.example.com/org/*"},
+				APIURL:         "ghes.example.com/api/v3",
+			},
+			wantErr: true,
+			errMsg:  `api_url must be an absolute http(s) URL, got "ghes.example.com/api/v3"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -213,6 +291,92 @@ func TestGitHubApp_Validate(t *testing.T) {
 	}
 }
 
+func TestGitHubApp_Host(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     string
+	}{
+		{patterns: []string{"github.com/org/*"}, want: "github.com"},
+		{patterns: []string{"https://ghes.example.com/org/"}, want: "ghes.example.com"},
+		{patterns: []string{"*", "ghes.example.com"}, want: "ghes.example.com"},
+		{patterns: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		app := GitHubApp{Patterns: tt.patterns}
+		if got := app.Host(); got != tt.want {
+			t.Errorf("Host() with patterns %v = %q, want %q", tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestGitHubApp_NarrowsToRepository(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		narrow *bool
+		want   bool
+	}{
+		{narrow: nil, want: true},
+		{narrow: &enabled, want: true},
+		{narrow: &disabled, want: false},
+	}
+
+	for _, tt := range tests {
+		app := GitHubApp{NarrowToRepository: tt.narrow}
+		if got := app.NarrowsToRepository(); got != tt.want {
+			t.Errorf("NarrowsToRepository() with %v = %v, want %v", tt.narrow, got, tt.want)
+		}
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiURL   string
+		patterns []string
+		repoURL  string
+		want     string
+	}{
+		{
+			name:     "github.com from repository",
+			patterns: []string{"github.com/org/"},
+			repoURL:  "https://github.com/org/repo",
+			want:     "https://api.github.com",
+		},
+		{
+			name:     "GHES from repository",
+			patterns: []string{"github.com/org/"},
+			repoURL:  "ghes.example.com/org/repo",
+			want:     "https://ghes.example.com/api/v3",
+		},
+		{
+			name:     "ghe.com from patterns",
+			patterns: []string{"octocorp.ghe.com/org/"},
+			want:     "https://api.octocorp.ghe.com",
+		},
+		{
+			name:     "explicit api_url wins",
+			apiURL:   "https://ghes.example.com/github/api/v3/",
+			patterns: []string{"ghes.example.com/org/"},
+			repoURL:  "ghes.example.com/org/repo",
+			want:     "https://ghes.example.com/github/api/v3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := GitHubApp{APIURL: tt.apiURL, Patterns: tt.patterns}
+			if got := app.APIBaseURL(tt.repoURL); got != tt.want {
+				t.Errorf("GitHubApp.APIBaseURL() = %q, want %q", got, tt.want)
+			}
+			pat := PersonalAccessToken{APIURL: tt.apiURL, Patterns: tt.patterns}
+			if got := pat.APIBaseURL(tt.repoURL); got != tt.want {
+				t.Errorf("PersonalAccessToken.APIBaseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestExpandPath(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -324,3 +488,98 @@ func TestConfig_GetByPriority(t *testing.T) {
 		t.Error("GetByPriority() modified the original config")
 	}
 }
+
+func TestGitHubApp_ValidateTokenScopes(t *testing.T) {
+	base := func() GitHubApp {
+		return GitHubApp{
+			Name:           "test-app",
+			AppID:          12345,
+			PrivateKeyPath: "/tmp/key.pem",
+			Patterns:       []string{"github.com/org/"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*GitHubApp)
+		wantErr string
+	}{
+		{
+			name: "valid app and pattern scopes",
+			modify: func(app *GitHubApp) {
+				app.Permissions = map[string]string{"contents": "read"}
+				app.Repositories = []string{"org/repo"}
+				app.PatternScopes = []PatternScope{
+					{Pattern: "github.com/org/infra-", Permissions: map[string]string{"contents": "write"}},
+				}
+			},
+		},
+		{
+			name: "invalid access level",
+			modify: func(app *GitHubApp) {
+				app.Permissions = map[string]string{"contents": "full"}
+			},
+			wantErr: `invalid access level "full" for permission "contents" (want read, write or admin)`,
+		},
+		{
+			name: "empty repository",
+			modify: func(app *GitHubApp) {
+				app.Repositories = []string{" "}
+			},
+			wantErr: "repositories[0] cannot be empty",
+		},
+		{
+			name: "pattern scope without pattern",
+			modify: func(app *GitHubApp) {
+				app.PatternScopes = []PatternScope{{Permissions: map[string]string{"contents": "read"}}}
+			},
+			wantErr: "pattern_scopes[0]: pattern cannot be empty",
+		},
+		{
+			name: "invalid pattern scope permission",
+			modify: func(app *GitHubApp) {
+				app.PatternScopes = []PatternScope{{Pattern: "github.com/org/", Permissions: map[string]string{"": "read"}}}
+			},
+			wantErr: "pattern_scopes[0]: permission name cannot be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := base()
+			tt.modify(&app)
+			err := app.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenScope_Key(t *testing.T) {
+	empty := TokenScope{}
+	if empty.Key() != "" || !empty.IsEmpty() {
+		t.Errorf("Expected empty scope to have empty key, got %q", empty.Key())
+	}
+
+	a := TokenScope{
+		Repositories: []string{"org/b", "a"},
+		Permissions:  map[string]string{"contents": "read", "issues": "write"},
+	}
+	b := TokenScope{
+		Repositories: []string{"a", "b", "b.git"},
+		Permissions:  map[string]string{"issues": "write", "contents": "read"},
+	}
+	if a.Key() != b.Key() {
+		t.Errorf("Expected equivalent scopes to share a key: %q != %q", a.Key(), b.Key())
+	}
+	if want := "repos:a,b;perms:contents=read,issues=write"; a.Key() != want {
+		t.Errorf("Key() = %q, want %q", a.Key(), want)
+	}
+}
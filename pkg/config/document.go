@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIndent is the indentation of new YAML files, as written by yaml.Marshal
+const defaultIndent = 4
+
+// identityKeys lists, in order of preference, the fields identifying an entry
+// of a list, so that an updated entry is matched to the one already in the file
+// whatever its position
+var identityKeys = [][]string{
+	{"app_id", "installation_id"},
+	{"fingerprint"},
+	{"pattern"},
+	{"full_name"},
+	{"name"},
+}
+
+// encodeDocument encodes value in the format of path, YAML or JSON. When
+// existing holds the current content of the file, it is updated in place:
+// comments, key order and entry order are kept and only the values that
+// changed are touched.
+func encodeDocument(existing []byte, value interface{}, path string) ([]byte, error) {
+	var fresh yaml.Node
+	if err := fresh.Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&fresh}}
+
+	var current yaml.Node
+	if len(bytes.TrimSpace(existing)) > 0 && yaml.Unmarshal(existing, &current) == nil &&
+		current.Kind == yaml.DocumentNode && len(current.Content) == 1 {
+		current.Content[0] = mergeNode(current.Content[0], &fresh)
+		doc = &current
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var buf bytes.Buffer
+		encodeJSONNode(&buf, doc.Content[0], "")
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+
+	data, err := encodeYAMLNode(doc, detectIndent(existing))
+	if err != nil && doc.Content[0] != &fresh {
+		// Aliases into replaced nodes cannot be written; start afresh
+		data, err = encodeYAMLNode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&fresh}}, defaultIndent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// mergeNode updates current to the value of fresh and returns it, keeping the
+// comments, order and styles of current where the value is unchanged
+func mergeNode(current, fresh *yaml.Node) *yaml.Node {
+	if current.Kind != fresh.Kind {
+		fresh.HeadComment = current.HeadComment
+		fresh.LineComment = current.LineComment
+		fresh.FootComment = current.FootComment
+		return fresh
+	}
+
+	switch current.Kind {
+	case yaml.MappingNode:
+		mergeMapping(current, fresh)
+	case yaml.SequenceNode:
+		mergeSequence(current, fresh)
+	case yaml.ScalarNode:
+		if current.ShortTag() != fresh.ShortTag() {
+			current.Tag, current.Style = fresh.Tag, fresh.Style
+		}
+		current.Value = fresh.Value
+	}
+	return current
+}
+
+// mergeMapping keeps the keys of current still present in fresh, in their
+// order, and appends the keys fresh adds. Keys left out of current stay out
+// while their value is the zero value they decode to.
+func mergeMapping(current, fresh *yaml.Node) {
+	content := make([]*yaml.Node, 0, len(fresh.Content))
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		if value := mappingValue(fresh, current.Content[i].Value); value != nil {
+			content = append(content, current.Content[i], mergeNode(current.Content[i+1], value))
+		}
+	}
+	for i := 0; i+1 < len(fresh.Content); i += 2 {
+		if mappingValue(current, fresh.Content[i].Value) == nil && !isZeroScalar(fresh.Content[i+1]) {
+			content = append(content, fresh.Content[i], fresh.Content[i+1])
+		}
+	}
+	current.Content = content
+}
+
+// isZeroScalar reports whether node is a null, zero, false or empty scalar
+func isZeroScalar(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return true
+	case "!!int", "!!float":
+		return node.Value == "0"
+	case "!!bool":
+		return node.Value == "false"
+	case "!!str":
+		return node.Value == ""
+	}
+	return false
+}
+
+// mergeSequence keeps the items of current still present in fresh, in their
+// order, and appends the items fresh adds. Items are matched by identity (see
+// identityKeys), or by position when they have none.
+func mergeSequence(current, fresh *yaml.Node) {
+	matches := make([]*yaml.Node, len(current.Content))
+	var added []*yaml.Node
+	for i, item := range fresh.Content {
+		j := matchItem(current.Content, matches, item, i)
+		if j < 0 {
+			added = append(added, item)
+			continue
+		}
+		matches[j] = item
+	}
+
+	content := make([]*yaml.Node, 0, len(fresh.Content))
+	for j, item := range current.Content {
+		if matches[j] != nil {
+			content = append(content, mergeNode(item, matches[j]))
+		}
+	}
+	current.Content = append(content, added...)
+}
+
+// matchItem returns the index of the unmatched item of items with the same
+// identity as item, or -1
+func matchItem(items, matches []*yaml.Node, item *yaml.Node, position int) int {
+	identity := nodeIdentity(item)
+	if identity == "" {
+		if position < len(items) && matches[position] == nil && nodeIdentity(items[position]) == "" {
+			return position
+		}
+		return -1
+	}
+	for j, candidate := range items {
+		if matches[j] == nil && nodeIdentity(candidate) == identity {
+			return j
+		}
+	}
+	return -1
+}
+
+// nodeIdentity returns what identifies a list item: its value for a scalar,
+// its identity fields for a mapping, or "" when it has none
+func nodeIdentity(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return "=" + node.Value
+	case yaml.MappingNode:
+		for _, keys := range identityKeys {
+			if mappingValue(node, keys[0]) == nil {
+				continue
+			}
+			values := make([]string, 0, len(keys))
+			for _, key := range keys {
+				if value := mappingValue(node, key); value != nil {
+					values = append(values, key+"="+value.Value)
+				}
+			}
+			return strings.Join(values, ",")
+		}
+	}
+	return ""
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// encodeYAMLNode encodes a document node with the given indentation
+func encodeYAMLNode(doc *yaml.Node, indent int) (data []byte, err error) {
+	defer func() {
+		// The encoder panics on some malformed node trees
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// detectIndent returns the indentation of a YAML file: the smallest indent of
+// its content lines, or defaultIndent
+func detectIndent(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || len(trimmed) == len(line) {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent == 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent < 2 || indent > 8 {
+		return defaultIndent
+	}
+	return indent
+}
+
+// encodeJSONNode writes node as indented JSON, keeping the order of its keys
+func encodeJSONNode(buf *bytes.Buffer, node *yaml.Node, prefix string) {
+	const indent = "  "
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			encodeJSONNode(buf, node.Content[0], prefix)
+			return
+		}
+		buf.WriteString("null")
+	case yaml.AliasNode:
+		encodeJSONNode(buf, node.Alias, prefix)
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			buf.WriteString(prefix + indent)
+			writeJSONString(buf, node.Content[i].Value)
+			buf.WriteString(": ")
+			encodeJSONNode(buf, node.Content[i+1], prefix+indent)
+			if i+2 < len(node.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(prefix + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range node.Content {
+			buf.WriteString(prefix + indent)
+			encodeJSONNode(buf, item, prefix+indent)
+			if i+1 < len(node.Content) {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(prefix + "]")
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!bool", "!!int", "!!float":
+			if json.Valid([]byte(node.Value)) {
+				buf.WriteString(node.Value)
+				return
+			}
+			writeJSONString(buf, node.Value)
+		default:
+			writeJSONString(buf, node.Value)
+		}
+	}
+}
+
+// writeJSONString writes s as a JSON string
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setupConfigFile writes content as the only configuration file and returns
+// its path
+func setupConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_SYSTEM_CONFIG", filepath.Join(dir, "no-system.yml"))
+	t.Setenv("GH_APP_AUTH_CONFIG", path)
+	t.Chdir(dir)
+	return path
+}
+
+func TestSave_PreservesComments(t *testing.T) {
+	path := setupConfigFile(t, "config.yml", `# Team configuration, reviewed quarterly
+version: "1"
+github_apps:
+  # Deploy bot, owned by the platform team
+  - name: Deploy App
+    app_id: 2
+    installation_id: 20
+    private_key_source: keyring
+    patterns:
+      - github.com/myorg/ # every repository
+  - name: Docs App
+    app_id: 3
+    installation_id: 30
+    private_key_source: keyring
+    patterns:
+      - github.com/myorg/docs
+`)
+
+	cfg, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	cfg.GitHubApps[1].Patterns = append(cfg.GitHubApps[1].Patterns, "github.com/myorg/wiki")
+	cfg.AddOrUpdateApp(&GitHubApp{
+		Name: "New App", AppID: 4, InstallationID: 40, PrivateKeySource: PrivateKeySourceKeyring,
+		Patterns: []string{"github.com/new/"},
+	})
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	saved := string(data)
+	for _, want := range []string{
+		"# Team configuration, reviewed quarterly\n",
+		"  # Deploy bot, owned by the platform team\n  - name: Deploy App\n",
+		"      - github.com/myorg/ # every repository\n",
+		"      - github.com/myorg/docs\n      - github.com/myorg/wiki\n",
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved file missing %q:\n%s", want, saved)
+		}
+	}
+	if strings.Count(saved, "priority") != 1 {
+		t.Errorf("saved file adds default values to untouched entries:\n%s", saved)
+	}
+	deploy, docs := strings.Index(saved, "Deploy App"), strings.Index(saved, "Docs App")
+	if added := strings.Index(saved, "New App"); deploy >= docs || docs >= added {
+		t.Errorf("saved file does not keep the entry order:\n%s", saved)
+	}
+
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(reloaded.GitHubApps) != 3 || len(reloaded.GitHubApps[1].Patterns) != 2 {
+		t.Errorf("Load() after Save() = %+v, want the changes kept", reloaded.GitHubApps)
+	}
+}
+
+func TestSave_KeepsJSON(t *testing.T) {
+	path := setupConfigFile(t, "config.json", `{
+  "version": "1",
+  "pats": [
+    {"name": "personal", "private_key_source": "keyring", "patterns": ["bitbucket.example.com/"], "priority": 0}
+  ],
+  "github_apps": [
+    {"name": "Deploy App", "app_id": 2, "installation_id": 20, "private_key_source": "keyring",
+     "patterns": ["github.com/myorg/"], "priority": 0}
+  ]
+}
+`)
+
+	cfg, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	cfg.PATs[0].Patterns = append(cfg.PATs[0].Patterns, "gitlab.example.com/")
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var saved Config
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("saved file is not JSON: %v\n%s", err, data)
+	}
+	if len(saved.PATs) != 1 || len(saved.PATs[0].Patterns) != 2 || len(saved.GitHubApps) != 1 {
+		t.Errorf("saved config = %+v, want the change kept", saved)
+	}
+	if strings.Index(string(data), `"pats"`) > strings.Index(string(data), `"github_apps"`) {
+		t.Errorf("saved file does not keep the key order:\n%s", data)
+	}
+}
+
+func TestSave_Concurrent(t *testing.T) {
+	path := setupConfigFile(t, "config.yml", `version: "1"
+github_apps: []
+`)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cfg := &Config{Version: "1", GitHubApps: []GitHubApp{{
+				Name: fmt.Sprintf("App %d", i), AppID: int64(i + 1), PrivateKeySource: PrivateKeySourceKeyring,
+				Patterns: []string{fmt.Sprintf("github.com/org%d/", i)},
+			}}}
+			errs <- cfg.Save()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Save() error = %v", err)
+		}
+	}
+
+	cfg, err := NewLoader(path).Load()
+	if err != nil {
+		t.Fatalf("Load() after concurrent saves error = %v", err)
+	}
+	if len(cfg.GitHubApps) != 1 {
+		t.Errorf("Load() = %+v, want one writer's configuration", cfg.GitHubApps)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".config.yml-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestSave_Interleaved(t *testing.T) {
+	path := setupConfigFile(t, "config.yml", `version: "1"
+github_apps:
+  - name: Shared App
+    app_id: 1
+    installation_id: 10
+    private_key_source: keyring
+    patterns:
+      - github.com/shared/
+  - name: Old App
+    app_id: 2
+    installation_id: 20
+    private_key_source: keyring
+    patterns:
+      - github.com/old/
+`)
+
+	// Two commands load the same file, then save one after the other
+	first, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	second, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+
+	first.AddOrUpdateApp(&GitHubApp{
+		Name: "First App", AppID: 3, PrivateKeySource: PrivateKeySourceKeyring, Patterns: []string{"github.com/first/"},
+	})
+	if err := first.Save(); err != nil {
+		t.Fatalf("first Save() error = %v", err)
+	}
+
+	second.RemoveApp(2)
+	second.GitHubApps[0].Patterns = append(second.GitHubApps[0].Patterns, "github.com/shared-mirror/")
+	second.AddOrUpdatePAT(&PersonalAccessToken{
+		Name: "second-pat", TokenSource: PrivateKeySourceKeyring, Patterns: []string{"gitlab.example.com/"},
+	})
+	if err := second.Save(); err != nil {
+		t.Fatalf("second Save() error = %v", err)
+	}
+
+	// A later save of the first command keeps what the second one changed
+	first.Retry = &RetryConfig{MaxAttempts: 2}
+	if err := first.Save(); err != nil {
+		t.Fatalf("first Save() again error = %v", err)
+	}
+
+	cfg, err := NewLoader(path).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var names []string
+	for _, app := range cfg.GitHubApps {
+		names = append(names, app.Name)
+	}
+	if strings.Join(names, ",") != "Shared App,First App" {
+		t.Errorf("apps = %v, want Old App removed and First App added", names)
+	}
+	if len(cfg.GitHubApps) > 0 && len(cfg.GitHubApps[0].Patterns) != 2 {
+		t.Errorf("Shared App patterns = %v, want the second command's change", cfg.GitHubApps[0].Patterns)
+	}
+	if len(cfg.PATs) != 1 || cfg.PATs[0].Name != "second-pat" {
+		t.Errorf("PATs = %+v, want second-pat", cfg.PATs)
+	}
+	if cfg.Retry == nil || cfg.Retry.MaxAttempts != 2 {
+		t.Errorf("retry = %+v, want the first command's setting", cfg.Retry)
+	}
+}
+
+func TestEncodeDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		value    interface{}
+		want     string
+	}{
+		{
+			name:  "new file",
+			value: map[string]interface{}{"version": "1"},
+			want:  "version: \"1\"\n",
+		},
+		{
+			name: "entries matched by identity",
+			existing: `apps:
+  - app_id: 1 # first
+  - app_id: 2 # second
+`,
+			value: map[string]interface{}{"apps": []map[string]int{{"app_id": 2}, {"app_id": 3}}},
+			want: `apps:
+  - app_id: 2 # second
+  - app_id: 3
+`,
+		},
+		{
+			name:     "changed type",
+			existing: "priority: \"5\" # quoted\n",
+			value:    map[string]int{"priority": 5},
+			want:     "priority: 5 # quoted\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeDocument([]byte(tt.existing), tt.value, "config.yml")
+			if err != nil {
+				t.Fatalf("encodeDocument() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("encodeDocument() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
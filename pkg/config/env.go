@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables describing a single GitHub App in stateless mode
+const (
+	// StatelessEnv enables stateless mode: the configuration comes from the
+	// environment only and nothing is written to disk
+	StatelessEnv = "GH_APP_AUTH_STATELESS"
+	// AppIDEnv holds the app ID
+	AppIDEnv = "GH_APP_ID"
+	// AppNameEnv holds the app name, defaulting to app-<id>
+	AppNameEnv = "GH_APP_NAME"
+	// InstallationIDEnv holds the installation ID, resolved per owner when unset
+	InstallationIDEnv = "GH_APP_INSTALLATION_ID"
+	// PrivateKeyEnv holds the PEM private key, optionally base64-encoded
+	PrivateKeyEnv = "GH_APP_PRIVATE_KEY"
+	// PrivateKeyPathEnv holds the path of the PEM private key
+	PrivateKeyPathEnv = "GH_APP_PRIVATE_KEY_PATH"
+	// PatternsEnv holds comma-separated patterns, defaulting to github.com/
+	PatternsEnv = "GH_APP_PATTERNS"
+)
+
+// defaultEnvPattern matches every repository on github.com
+const defaultEnvPattern = "github.com/"
+
+// StatelessRequested reports whether GH_APP_AUTH_STATELESS enables stateless mode
+func StatelessRequested() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(StatelessEnv))
+	return err == nil && enabled
+}
+
+// LoadFromEnv builds the configuration of stateless mode. When configEnv is
+// set, it names an environment variable holding the whole configuration as
+// JSON; otherwise a single app is described by the GH_APP_* variables.
+func LoadFromEnv(configEnv string) (*Config, error) {
+	if configEnv != "" {
+		return loadJSONFromEnv(configEnv)
+	}
+
+	app, err := appFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{Version: CurrentConfigVersion, GitHubApps: []GitHubApp{*app}}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid app from environment: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadJSONFromEnv parses the configuration held in the named variable
+func loadJSONFromEnv(name string) (*Config, error) {
+	data := os.Getenv(name)
+	if strings.TrimSpace(data) == "" {
+		return nil, fmt.Errorf("environment variable %s is empty", name)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration from %s: %w", name, err)
+	}
+	if cfg.Version == "" {
+		cfg.Version = CurrentConfigVersion
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// appFromEnv describes the app configured by the GH_APP_* variables
+func appFromEnv() (*GitHubApp, error) {
+	rawID := os.Getenv(AppIDEnv)
+	if rawID == "" {
+		return nil, fmt.Errorf("%s is required in stateless mode (or use --config-env)", AppIDEnv)
+	}
+	appID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", AppIDEnv, err)
+	}
+
+	app := &GitHubApp{
+		Name:     os.Getenv(AppNameEnv),
+		AppID:    appID,
+		Patterns: []string{defaultEnvPattern},
+	}
+	if app.Name == "" {
+		app.Name = fmt.Sprintf("app-%d", appID)
+	}
+
+	if raw := os.Getenv(InstallationIDEnv); raw != "" {
+		if app.InstallationID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", InstallationIDEnv, err)
+		}
+	}
+
+	switch {
+	case os.Getenv(PrivateKeyEnv) != "":
+		app.PrivateKeySource = PrivateKeySourceEnv
+		app.PrivateKeyEnv = PrivateKeyEnv
+	case os.Getenv(PrivateKeyPathEnv) != "":
+		app.PrivateKeySource = PrivateKeySourceFilesystem
+		app.PrivateKeyPath = os.Getenv(PrivateKeyPathEnv)
+	default:
+		return nil, fmt.Errorf("%s or %s is required in stateless mode", PrivateKeyEnv, PrivateKeyPathEnv)
+	}
+
+	if raw := os.Getenv(PatternsEnv); raw != "" {
+		app.Patterns = nil
+		for _, pattern := range strings.Split(raw, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				app.Patterns = append(app.Patterns, pattern)
+			}
+		}
+	}
+
+	return app, nil
+}
+
+// readSecretEnv returns the secret held in the named environment variable
+func readSecretEnv(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("no environment variable configured")
+	}
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is empty", name)
+	}
+	return value, nil
+}
+
+// readPrivateKeyEnv returns the PEM private key held in the named environment
+// variable. CI systems often cannot hold multi-line values, so keys encoded
+// in base64 or with escaped newlines are accepted too.
+func readPrivateKeyEnv(name string) (string, error) {
+	value, err := readSecretEnv(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		if !strings.Contains(value, "\n") {
+			value = strings.ReplaceAll(value, `\n`, "\n")
+		}
+		return value, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || !bytes.Contains(decoded, []byte("-----BEGIN")) {
+		return "", fmt.Errorf("environment variable %s does not hold a PEM or base64-encoded PEM key", name)
+	}
+	return string(decoded), nil
+}
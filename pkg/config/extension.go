@@ -7,39 +7,34 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/fileutil"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"gopkg.in/yaml.v3"
 )
 
+// saveLockTimeout bounds how long Save waits for another process writing the
+// configuration file
+const saveLockTimeout = 30 * time.Second
+
 // LoadOrCreate loads existing configuration or creates a new one
 func LoadOrCreate() (*Config, error) {
-	cfg, err := Load()
+	cfg, err := NewDefaultLoader().read()
 	if err != nil {
 		// Check if error is due to file not existing
-		if os.IsNotExist(err) || strings.Contains(err.Error(), "configuration file not found") {
-			// Create new config
+		if errors.Is(err, ErrConfigNotExists) {
+			// Create new config; everything in it is this process's change
 			return &Config{
 				Version:    "1.0",
 				GitHubApps: []GitHubApp{},
+				loaded:     &Config{},
 			}, nil
 		}
-		// Check if error is due to empty apps (valid during setup)
-		if errors.Is(err, ErrNoGitHubAppDefined) {
-			// Load the file without validation
-			loader := NewDefaultLoader()
-			data, readErr := os.ReadFile(loader.GetConfigPath())
-			if readErr != nil {
-				return nil, fmt.Errorf("failed to read configuration file: %w", readErr)
-			}
-			// Parse without validation
-			var config Config
-			if parseErr := yaml.Unmarshal(data, &config); parseErr != nil {
-				return nil, fmt.Errorf("failed to parse configuration: %w", parseErr)
-			}
-			// Return the empty config (valid during setup)
-			return &config, nil
-		}
+		return nil, err
+	}
+	// A configuration without apps is valid during setup
+	if err := cfg.Validate(); err != nil && !errors.Is(err, ErrNoGitHubAppDefined) {
 		return nil, err
 	}
 	return cfg, nil
@@ -51,7 +46,11 @@ func Load() (*Config, error) {
 	return loader.Load()
 }
 
-// Save saves the configuration to the default location
+// Save saves the configuration to the default location. The file is updated
+// in place, keeping its format, comments and ordering, and replaced atomically
+// under a lock so that concurrent commands cannot corrupt it. For a loaded
+// configuration only the changes made since Load are applied to the file as
+// it is now, so entries another command saved in the meantime are kept.
 func (c *Config) Save() error {
 	configPath := getDefaultConfigPath()
 
@@ -60,16 +59,49 @@ func (c *Config) Save() error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	// Save as YAML
-	data, err := yaml.Marshal(c)
+	unlock, err := fileutil.Lock(configPath+".lock", saveLockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock()
+
+	existing, err := os.ReadFile(configPath) // #nosec G304 -- path is the configuration file
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Leave out what other layers provide
+	layer := c.userLayer()
+	if c.loaded != nil {
+		current := &Config{}
+		if existing != nil {
+			if current, err = NewLoader(configPath).parseConfig(existing, configPath); err != nil {
+				return fmt.Errorf("failed to parse config file: %w", err)
+			}
+		}
+		layer = rebase(c.loaded, layer, current)
+	}
+	data, err := encodeDocument(existing, layer, configPath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
+	if err := fileutil.WriteFileAtomic(configPath, data); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
+	// Later saves apply the changes made from here on
+	return c.snapshotUserLayer()
+}
+
+// snapshotUserLayer records the user file's part of the configuration as the
+// base of the changes Save applies
+func (c *Config) snapshotUserLayer() error {
+	loaded, err := cloneConfig(c.userLayer())
+	if err != nil {
+		return err
+	}
+	c.loaded = loaded
 	return nil
 }
 
@@ -178,19 +210,5 @@ func OutputYAML(w io.Writer, apps []GitHubApp) error {
 
 // getDefaultConfigPath returns the default config path for the extension
 func getDefaultConfigPath() string {
-	// Check environment variable first
-	if path := os.Getenv("GH_APP_AUTH_CONFIG"); path != "" {
-		if expanded, err := expandPath(path); err == nil {
-			return expanded
-		}
-		return path
-	}
-
-	// Use GitHub CLI extension config directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return ""
-	}
-
-	return filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth", "config.yml")
+	return paths.ConfigFile()
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// ErrKeyMismatch is returned when a stored private key is not the key whose
+// fingerprint the configuration records, as after a keyring entry is
+// overwritten or a key file is replaced
+var ErrKeyMismatch = errors.New("private key does not match the recorded fingerprint")
+
+// Fingerprint returns the fingerprint of the key that signs the app's JWTs,
+// or "" when none is recorded
+func (app *GitHubApp) Fingerprint() string {
+	if len(app.Keys) > 0 {
+		return app.SigningKeys()[0].Fingerprint
+	}
+	return app.KeyFingerprint
+}
+
+// RecordKeyFingerprint records the fingerprint of privateKey as the app's
+func (app *GitHubApp) RecordKeyFingerprint(privateKey string) error {
+	fingerprint, err := jwt.KeyFingerprint(privateKey)
+	if err != nil {
+		return err
+	}
+	app.KeyFingerprint = fingerprint
+	return nil
+}
+
+// NeedsKeyFingerprint reports whether the app's single key is kept in
+// storage but its fingerprint is not recorded yet, as for entries created
+// before fingerprints were recorded
+func (app *GitHubApp) NeedsKeyFingerprint() bool {
+	return len(app.Keys) == 0 && app.KeyFingerprint == "" && app.PrivateKeySource.storesKeys()
+}
+
+// CheckKeyFingerprint reports ErrKeyMismatch when privateKey is not the key
+// recorded for an app with a single key. Apps without a recorded fingerprint
+// accept any key.
+func (app *GitHubApp) CheckKeyFingerprint(privateKey string) error {
+	if app.KeyFingerprint == "" {
+		return nil
+	}
+	return checkFingerprint(privateKey, app.KeyFingerprint)
+}
+
+// VerifyKeyFingerprints reads the app's stored keys and checks each against
+// its recorded fingerprint. Keys kept by an external signer cannot be read
+// and are not checked.
+func (app *GitHubApp) VerifyKeyFingerprints(secretMgr *secrets.Manager) error {
+	if app.PrivateKeySource == PrivateKeySourceSigner {
+		return nil
+	}
+
+	if len(app.Keys) > 0 {
+		for _, key := range app.Keys {
+			value, err := app.GetKey(secretMgr, key)
+			if err != nil {
+				return err
+			}
+			if err := checkFingerprint(value, key.Fingerprint); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if app.KeyFingerprint == "" {
+		return nil
+	}
+	value, err := app.GetPrivateKey(secretMgr)
+	if err != nil {
+		return err
+	}
+	return app.CheckKeyFingerprint(value)
+}
+
+func checkFingerprint(privateKey, want string) error {
+	got, err := jwt.KeyFingerprint(privateKey)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%w: found %s, expected %s", ErrKeyMismatch, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
+)
+
+func TestVerifyKeyFingerprints(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	original, replacement := testkeys.RSAKeyPEM(t), testkeys.RSAKeyPEM(t)
+	app := &GitHubApp{Name: "app", AppID: 1, SecretID: NewSecretID(), PrivateKeySource: PrivateKeySourceKeyring}
+	if _, err := app.SetPrivateKey(secretMgr, original); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	if err := app.VerifyKeyFingerprints(secretMgr); err != nil {
+		t.Errorf("VerifyKeyFingerprints() without a fingerprint error = %v", err)
+	}
+	if !app.NeedsKeyFingerprint() {
+		t.Error("NeedsKeyFingerprint() = false, want true before recording")
+	}
+
+	if err := app.RecordKeyFingerprint(original); err != nil {
+		t.Fatalf("RecordKeyFingerprint() error = %v", err)
+	}
+	want, _ := jwt.KeyFingerprint(original)
+	if app.Fingerprint() != want || app.NeedsKeyFingerprint() {
+		t.Errorf("Fingerprint() = %q, want %q", app.Fingerprint(), want)
+	}
+	if err := app.VerifyKeyFingerprints(secretMgr); err != nil {
+		t.Errorf("VerifyKeyFingerprints() error = %v", err)
+	}
+
+	// The keyring entry is overwritten behind gh-app-auth's back
+	if _, err := secretMgr.Store(app.SecretName(), secrets.SecretTypePrivateKey, replacement); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := app.VerifyKeyFingerprints(secretMgr); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("VerifyKeyFingerprints() after overwrite error = %v, want ErrKeyMismatch", err)
+	}
+	if _, _, err := app.AddKey(secretMgr, testkeys.RSAKeyPEM(t), time.Now()); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("AddKey() with a replaced current key error = %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestVerifyKeyFingerprints_SwappedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pem")
+	original := testkeys.RSAKeyPEM(t)
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	app := &GitHubApp{Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceFilesystem, PrivateKeyPath: path}
+	if err := app.RecordKeyFingerprint(original); err != nil {
+		t.Fatalf("RecordKeyFingerprint() error = %v", err)
+	}
+	secretMgr := secrets.NewManager(t.TempDir())
+	if err := app.VerifyKeyFingerprints(secretMgr); err != nil {
+		t.Errorf("VerifyKeyFingerprints() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(testkeys.RSAKeyPEM(t)), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := app.VerifyKeyFingerprints(secretMgr); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("VerifyKeyFingerprints() after swap error = %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestVerifyKeyFingerprints_Keys(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := &GitHubApp{Name: "app", AppID: 1, SecretID: NewSecretID(), PrivateKeySource: PrivateKeySourceKeyring}
+	first := testkeys.RSAKeyPEM(t)
+	if _, err := app.SetPrivateKey(secretMgr, first); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if err := app.RecordKeyFingerprint(first); err != nil {
+		t.Fatalf("RecordKeyFingerprint() error = %v", err)
+	}
+	fingerprint, _, err := app.AddKey(secretMgr, testkeys.RSAKeyPEM(t), time.Now())
+	if err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+	app.RetireKeysExcept(fingerprint)
+	if app.KeyFingerprint != "" || app.Fingerprint() != fingerprint {
+		t.Errorf("Fingerprint() = %q (key_fingerprint %q), want the new key %s",
+			app.Fingerprint(), app.KeyFingerprint, fingerprint)
+	}
+	if err := app.VerifyKeyFingerprints(secretMgr); err != nil {
+		t.Errorf("VerifyKeyFingerprints() error = %v", err)
+	}
+
+	// Replace the retiring key's secret
+	retiring := app.SigningKeys()[1]
+	if _, err := secretMgr.Store(app.keySecretName(retiring.Fingerprint), secrets.SecretTypePrivateKey,
+		testkeys.RSAKeyPEM(t)); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := app.VerifyKeyFingerprints(secretMgr); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("VerifyKeyFingerprints() error = %v, want ErrKeyMismatch", err)
+	}
+}
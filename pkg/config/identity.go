@@ -0,0 +1,378 @@
+package config
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// NewSecretID returns a random identifier (a version 4 UUID) under which the
+// secrets of an app or PAT are stored
+func NewSecretID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(fmt.Sprintf("failed to generate secret ID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// SecretName returns the name the app's secrets are stored under: its
+// secret_id, or its name for entries written before secret_id existed
+func (g *GitHubApp) SecretName() string {
+	if g.SecretID != "" {
+		return g.SecretID
+	}
+	return g.Name
+}
+
+// SecretName returns the name the PAT is stored under: its secret_id, or its
+// name for entries written before secret_id existed
+func (p *PersonalAccessToken) SecretName() string {
+	if p.SecretID != "" {
+		return p.SecretID
+	}
+	return p.Name
+}
+
+// StoredSecret is a secret kept in storage for a configuration entry. Source
+// is the entry's private_key_source, which selects the storage.
+type StoredSecret struct {
+	Source PrivateKeySource
+	Name   string
+	Type   secrets.SecretType
+}
+
+// Location names the storage holding the secret: keyring for the OS keyring
+// and its filesystem fallback, or the name of a secret backend
+func (s StoredSecret) Location() string {
+	if s.Source.isBackend() {
+		return string(s.Source)
+	}
+	return string(PrivateKeySourceKeyring)
+}
+
+// String describes the secret for messages
+func (s StoredSecret) String() string {
+	return fmt.Sprintf("%s: %s (%s)", s.Location(), s.Name, s.Type)
+}
+
+func (s StoredSecret) get(secretMgr *secrets.Manager) (string, error) {
+	if s.Source.isBackend() {
+		return getFromBackend(secretMgr, s.Source, s.Name, s.Type)
+	}
+	value, _, err := secretMgr.Get(s.Name, s.Type)
+	return value, err
+}
+
+func (s StoredSecret) store(secretMgr *secrets.Manager, value string) error {
+	if s.Source.isBackend() {
+		return storeInBackend(secretMgr, s.Source, s.Name, s.Type, value)
+	}
+	_, err := secretMgr.Store(s.Name, s.Type, value)
+	return err
+}
+
+// Delete removes the secret from its storage
+func (s StoredSecret) Delete(secretMgr *secrets.Manager) error {
+	if s.Source.isBackend() {
+		return deleteFromBackend(secretMgr, s.Source, s.Name, s.Type)
+	}
+	return secretMgr.Delete(s.Name, s.Type)
+}
+
+// StoredSecrets returns the secrets gh-app-auth keeps for the app. Keys read
+// from private_key_path, a command, the environment or an external signer
+// are not among them.
+func (g *GitHubApp) StoredSecrets() []StoredSecret {
+	var stored []StoredSecret
+	switch {
+	case len(g.Keys) > 0:
+		for _, key := range g.Keys {
+			stored = append(stored, StoredSecret{
+				Source: g.PrivateKeySource,
+				Name:   g.keySecretName(key.Fingerprint),
+				Type:   secrets.SecretTypePrivateKey,
+			})
+		}
+	case g.PrivateKeySource == PrivateKeySourceKeyring || g.PrivateKeySource.isBackend():
+		stored = append(stored, StoredSecret{
+			Source: g.PrivateKeySource,
+			Name:   g.SecretName(),
+			Type:   secrets.SecretTypePrivateKey,
+		})
+	}
+	return stored
+}
+
+// StoredSecrets returns the token gh-app-auth keeps for the PAT, if any
+func (p *PersonalAccessToken) StoredSecrets() []StoredSecret {
+	switch p.TokenSource {
+	case PrivateKeySourceCommand, PrivateKeySourceEnv:
+		return nil
+	}
+	return []StoredSecret{{Source: p.TokenSource, Name: p.SecretName(), Type: secrets.SecretTypePAT}}
+}
+
+// AssignSecretIDs gives every app and PAT without a secret_id a new one and
+// copies its stored secrets from their name-keyed entries. It returns how many
+// entries were given an ID and the name-keyed entries no entry uses any more,
+// which should be deleted once the configuration is saved. Entries whose
+// secrets cannot be read or copied keep their name and are reported in the
+// error.
+func (c *Config) AssignSecretIDs(secretMgr *secrets.Manager) (int, []StoredSecret, error) {
+	assigned := 0
+	var moved []StoredSecret
+	var errs []error
+
+	for i := range c.GitHubApps {
+		app := &c.GitHubApps[i]
+		if app.SecretID != "" {
+			continue
+		}
+		copied, err := moveSecrets(secretMgr, app.StoredSecrets, func(id string) { app.SecretID = id })
+		if err != nil {
+			errs = append(errs, fmt.Errorf("app %s: %w", app.Name, err))
+			continue
+		}
+		moved = append(moved, copied...)
+		assigned++
+	}
+	for i := range c.PATs {
+		pat := &c.PATs[i]
+		if pat.SecretID != "" {
+			continue
+		}
+		copied, err := moveSecrets(secretMgr, pat.StoredSecrets, func(id string) { pat.SecretID = id })
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PAT %s: %w", pat.Name, err))
+			continue
+		}
+		moved = append(moved, copied...)
+		assigned++
+	}
+
+	// Entries sharing a name each received a copy; keep what is still used
+	owners := c.secretOwners()
+	seen := make(map[storedSecretKey]bool)
+	var unused []StoredSecret
+	for _, secret := range moved {
+		key := secretKey(secret)
+		if owners[key] == nil && !seen[key] {
+			seen[key] = true
+			unused = append(unused, secret)
+		}
+	}
+	return assigned, unused, errors.Join(errs...)
+}
+
+// moveSecrets sets a new secret ID with setID and copies the secrets listed by
+// stored to their new names. It returns the previous entries of the copied
+// secrets. On failure the copies are removed and the ID is cleared again.
+func moveSecrets(
+	secretMgr *secrets.Manager, stored func() []StoredSecret, setID func(string),
+) ([]StoredSecret, error) {
+	before := stored()
+	setID(NewSecretID())
+	after := stored()
+
+	var moved, copies []StoredSecret
+	for i, secret := range before {
+		// A missing secret is an error too: the keyring may just be locked
+		value, err := secret.get(secretMgr)
+		if err == nil {
+			err = after[i].store(secretMgr, value)
+		}
+		if err != nil {
+			for _, secret := range copies {
+				_ = secret.Delete(secretMgr)
+			}
+			setID("")
+			return nil, fmt.Errorf("failed to move %s: %w", secret, err)
+		}
+		moved = append(moved, secret)
+		copies = append(copies, after[i])
+	}
+	return moved, nil
+}
+
+// UsesSecrets reports whether any entry uses one of stored
+func (c *Config) UsesSecrets(stored []StoredSecret) bool {
+	owners := c.secretOwners()
+	for _, secret := range stored {
+		if owners[secretKey(secret)] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// SharedSecret is a stored secret that several configuration entries use, so
+// storing or deleting it for one entry affects the others
+type SharedSecret struct {
+	Secret StoredSecret
+	Owners []string
+}
+
+// SharedSecrets returns the stored secrets used by more than one entry, which
+// happens when entries without a secret_id share a name or when a secret_id
+// is copied between entries
+func (c *Config) SharedSecrets() []SharedSecret {
+	var shared []SharedSecret
+	for _, usage := range c.secretOwners() {
+		if len(usage.owners) > 1 {
+			shared = append(shared, SharedSecret{Secret: usage.secret, Owners: usage.owners})
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool { return shared[i].Secret.String() < shared[j].Secret.String() })
+	return shared
+}
+
+// OrphanedSecrets returns stored private keys and PATs that no entry uses:
+// entries left under the name of an app or PAT that now has a secret_id, and
+// unused entries of the storage that can be listed (the filesystem fallback
+// and secret backends such as vault). OS keyrings cannot be listed, so other
+// orphans there go unnoticed.
+func (c *Config) OrphanedSecrets(secretMgr *secrets.Manager) ([]StoredSecret, error) {
+	owners := c.secretOwners()
+	seen := make(map[storedSecretKey]bool)
+	var orphans []StoredSecret
+	report := func(secret StoredSecret) {
+		key := secretKey(secret)
+		if owners[key] == nil && !seen[key] {
+			seen[key] = true
+			orphans = append(orphans, secret)
+		}
+	}
+
+	// Secrets left under the names entries were stored by before secret_id
+	var legacy []StoredSecret
+	for _, app := range c.GitHubApps {
+		if app.SecretID != "" {
+			app.SecretID = ""
+			legacy = append(legacy, app.StoredSecrets()...)
+		}
+	}
+	for _, pat := range c.PATs {
+		if pat.SecretID != "" {
+			pat.SecretID = ""
+			legacy = append(legacy, pat.StoredSecrets()...)
+		}
+	}
+	for _, secret := range legacy {
+		if _, err := secret.get(secretMgr); err == nil {
+			report(secret)
+		}
+	}
+
+	// The filesystem fallback directory also holds the encrypted-filesystem
+	// backend's secrets
+	fallback, err := secretMgr.FallbackSecrets()
+	if err != nil {
+		return orphans, err
+	}
+	encrypted := PrivateKeySource(secrets.StorageBackendEncryptedFilesystem)
+	for _, ref := range fallback {
+		inEncrypted := StoredSecret{Source: encrypted, Name: ref.Name, Type: ref.Type}
+		if isCredentialSecret(ref.Type) && owners[secretKey(inEncrypted)] == nil {
+			report(StoredSecret{Source: PrivateKeySourceKeyring, Name: ref.Name, Type: ref.Type})
+		}
+	}
+
+	for _, source := range c.backendSources() {
+		if source == encrypted {
+			continue
+		}
+		backend, err := secretMgr.Backend(string(source))
+		if err != nil {
+			return orphans, err
+		}
+		refs, err := backend.List()
+		if errors.Is(err, secrets.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			return orphans, fmt.Errorf("failed to list %s: %w", source, err)
+		}
+		for _, ref := range refs {
+			if isCredentialSecret(ref.Type) {
+				report(StoredSecret{Source: source, Name: ref.Name, Type: ref.Type})
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].String() < orphans[j].String() })
+	return orphans, nil
+}
+
+// isCredentialSecret reports whether secrets of this type belong to a
+// configuration entry; cached tokens are managed by the token cache
+func isCredentialSecret(secretType secrets.SecretType) bool {
+	return secretType == secrets.SecretTypePrivateKey || secretType == secrets.SecretTypePAT
+}
+
+// storedSecretKey identifies a stored secret regardless of which source of
+// the same storage names it
+type storedSecretKey struct {
+	location   string
+	name       string
+	secretType secrets.SecretType
+}
+
+func secretKey(secret StoredSecret) storedSecretKey {
+	return storedSecretKey{location: secret.Location(), name: secret.Name, secretType: secret.Type}
+}
+
+// secretUsage lists the entries using a stored secret
+type secretUsage struct {
+	secret StoredSecret
+	owners []string
+}
+
+// secretOwners maps each stored secret to the entries using it
+func (c *Config) secretOwners() map[storedSecretKey]*secretUsage {
+	usages := make(map[storedSecretKey]*secretUsage)
+	add := func(secret StoredSecret, owner string) {
+		key := secretKey(secret)
+		if usages[key] == nil {
+			usages[key] = &secretUsage{secret: secret}
+		}
+		usages[key].owners = append(usages[key].owners, owner)
+	}
+	for _, app := range c.GitHubApps {
+		for _, secret := range app.StoredSecrets() {
+			add(secret, fmt.Sprintf("app %s (ID %d)", app.Name, app.AppID))
+		}
+	}
+	for _, pat := range c.PATs {
+		for _, secret := range pat.StoredSecrets() {
+			add(secret, fmt.Sprintf("PAT %s", pat.Name))
+		}
+	}
+	return usages
+}
+
+// backendSources returns the secret backends used by configuration entries
+func (c *Config) backendSources() []PrivateKeySource {
+	seen := make(map[PrivateKeySource]bool)
+	var sources []PrivateKeySource
+	add := func(source PrivateKeySource) {
+		if source.isBackend() && !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	for _, app := range c.GitHubApps {
+		add(app.PrivateKeySource)
+	}
+	for _, pat := range c.PATs {
+		add(pat.TokenSource)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i] < sources[j] })
+	return sources
+}
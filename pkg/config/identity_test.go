@@ -0,0 +1,208 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
+)
+
+func TestNewSecretID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := NewSecretID(), NewSecretID()
+	if !uuid.MatchString(first) {
+		t.Errorf("NewSecretID() = %q, want a version 4 UUID", first)
+	}
+	if first == second {
+		t.Errorf("NewSecretID() returned %q twice", first)
+	}
+}
+
+func TestSecretName(t *testing.T) {
+	app := GitHubApp{Name: "my-app"}
+	if got := app.SecretName(); got != "my-app" {
+		t.Errorf("SecretName() without secret_id = %q, want the app name", got)
+	}
+	app.SecretID = "5f0c6b1e-8a47-4c55-9d7e-0b6f1a2c3d4e"
+	if got := app.SecretName(); got != app.SecretID {
+		t.Errorf("SecretName() = %q, want the secret_id", got)
+	}
+
+	pat := PersonalAccessToken{Name: "my-pat"}
+	if got := pat.SecretName(); got != "my-pat" {
+		t.Errorf("PAT SecretName() without secret_id = %q, want the PAT name", got)
+	}
+}
+
+func TestSecretIDSurvivesRename(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := &GitHubApp{Name: "before", SecretID: NewSecretID(), PrivateKeySource: PrivateKeySourceKeyring}
+	if _, err := app.SetPrivateKey(secretMgr, "key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	app.Name = "after"
+	if got, err := app.GetPrivateKey(secretMgr); err != nil || got != "key" {
+		t.Errorf("GetPrivateKey() after rename = %q, %v, want the stored key", got, err)
+	}
+}
+
+func TestAssignSecretIDs(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	rsaKey := testkeys.RSAKeyPEM(t)
+	rotated := GitHubApp{Name: "rotated", AppID: 3, PrivateKeySource: PrivateKeySourceKeyring}
+	if _, err := rotated.SetPrivateKey(secretMgr, rsaKey); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if _, _, err := rotated.AddKey(secretMgr, testkeys.RSAKeyPEM(t), time.Now()); err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+	if err := rotated.DeleteLegacyKey(secretMgr); err != nil {
+		t.Fatalf("DeleteLegacyKey() error = %v", err)
+	}
+
+	// Two installations of one app sharing a name, and thus a key
+	cfg := &Config{
+		Version: "1",
+		GitHubApps: []GitHubApp{
+			{Name: "shared", AppID: 1, InstallationID: 10, PrivateKeySource: PrivateKeySourceKeyring},
+			{Name: "shared", AppID: 1, InstallationID: 20, PrivateKeySource: PrivateKeySourceKeyring},
+			{Name: "from-file", AppID: 2, PrivateKeySource: PrivateKeySourceFilesystem, PrivateKeyPath: "/tmp/key.pem"},
+			rotated,
+		},
+		PATs: []PersonalAccessToken{{Name: "pat", TokenSource: PrivateKeySourceKeyring}},
+	}
+	if _, err := cfg.GitHubApps[0].SetPrivateKey(secretMgr, "shared-key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if _, err := cfg.PATs[0].SetPAT(secretMgr, "token"); err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+	if shared := cfg.SharedSecrets(); len(shared) != 1 || len(shared[0].Owners) != 2 {
+		t.Fatalf("SharedSecrets() = %+v, want the key of the two 'shared' entries", shared)
+	}
+
+	assigned, legacy, err := cfg.AssignSecretIDs(secretMgr)
+	if err != nil {
+		t.Fatalf("AssignSecretIDs() error = %v", err)
+	}
+	if assigned != 5 {
+		t.Errorf("AssignSecretIDs() assigned = %d, want 5", assigned)
+	}
+	// The shared key once, both keys of the rotated app and the PAT
+	if len(legacy) != 4 {
+		t.Errorf("AssignSecretIDs() legacy = %v, want 4 secrets", legacy)
+	}
+	for _, secret := range legacy {
+		if err := secret.Delete(secretMgr); err != nil {
+			t.Errorf("Delete(%s) error = %v", secret, err)
+		}
+	}
+
+	if cfg.GitHubApps[0].SecretID == cfg.GitHubApps[1].SecretID {
+		t.Error("Entries sharing a name should get different secret IDs")
+	}
+	for i := range cfg.GitHubApps[:2] {
+		if got, err := cfg.GitHubApps[i].GetPrivateKey(secretMgr); err != nil || got != "shared-key" {
+			t.Errorf("GetPrivateKey(%d) = %q, %v, want the moved key", i, got, err)
+		}
+	}
+	if !cfg.GitHubApps[3].HasPrivateKey(secretMgr) {
+		t.Error("The keys of the rotated app should be moved")
+	}
+	if got, err := cfg.PATs[0].GetPAT(secretMgr); err != nil || got != "token" {
+		t.Errorf("GetPAT() = %q, %v, want the moved token", got, err)
+	}
+	if shared := cfg.SharedSecrets(); len(shared) != 0 {
+		t.Errorf("SharedSecrets() after AssignSecretIDs = %+v, want none", shared)
+	}
+}
+
+func TestAssignSecretIDs_Failure(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	cfg := &Config{
+		Version:    "1",
+		GitHubApps: []GitHubApp{{Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceKeyring}},
+	}
+	if _, err := cfg.GitHubApps[0].SetPrivateKey(secretMgr, "key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	keyring.MockInitWithError(errors.New("keyring locked"))
+	assigned, legacy, err := cfg.AssignSecretIDs(secretMgr)
+	if err == nil {
+		t.Fatal("AssignSecretIDs() should report the key that cannot be read")
+	}
+	if assigned != 0 || len(legacy) != 0 || cfg.GitHubApps[0].SecretID != "" {
+		t.Errorf("AssignSecretIDs() = %d, %v, secret_id %q, want the entry left unchanged",
+			assigned, legacy, cfg.GitHubApps[0].SecretID)
+	}
+}
+
+func TestOrphanedSecrets(t *testing.T) {
+	// Without a keyring, secrets land in the filesystem fallback, which can be listed
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+	t.Setenv(secrets.PassphraseEnv, "")
+	t.Setenv(secrets.PassphraseFDEnv, "")
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := GitHubApp{Name: "renamed", AppID: 1, SecretID: NewSecretID(), PrivateKeySource: PrivateKeySourceKeyring}
+	cfg := &Config{Version: "1", GitHubApps: []GitHubApp{app}}
+	stored := map[string]secrets.SecretType{
+		app.SecretID:   secrets.SecretTypePrivateKey, // in use
+		app.Name:       secrets.SecretTypePrivateKey, // left under the old name
+		"removed-app":  secrets.SecretTypePrivateKey, // no entry
+		"removed-pat":  secrets.SecretTypePAT,        // no entry
+		"1:2:cached":   secrets.SecretTypeInstallToken,
+		"other-cached": secrets.SecretTypeInstallToken,
+	}
+	for name, secretType := range stored {
+		if _, err := secretMgr.Store(name, secretType, "value"); err != nil {
+			t.Fatalf("Store(%s) error = %v", name, err)
+		}
+	}
+
+	orphans, err := cfg.OrphanedSecrets(secretMgr)
+	if err != nil {
+		t.Fatalf("OrphanedSecrets() error = %v", err)
+	}
+	var names []string
+	for _, secret := range orphans {
+		names = append(names, secret.Name)
+	}
+	want := []string{"removed-app", "removed-pat", "renamed"}
+	if len(names) != len(want) {
+		t.Fatalf("OrphanedSecrets() = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("OrphanedSecrets()[%d] = %s, want %s", i, names[i], want[i])
+		}
+	}
+}
+
+func TestUsesSecrets(t *testing.T) {
+	cfg := &Config{GitHubApps: []GitHubApp{{Name: "shared", PrivateKeySource: PrivateKeySourceKeyring}}}
+	removed := GitHubApp{Name: "shared", PrivateKeySource: PrivateKeySourceKeyring}
+	if !cfg.UsesSecrets(removed.StoredSecrets()) {
+		t.Error("UsesSecrets() = false, want true for a key shared by name")
+	}
+	removed.SecretID = NewSecretID()
+	if cfg.UsesSecrets(removed.StoredSecrets()) {
+		t.Error("UsesSecrets() = true, want false for an entry with its own secret ID")
+	}
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// KeyState is the rotation state of one of an app's private keys
+type KeyState string
+
+const (
+	// KeyStateActive keys sign the app's JWTs
+	KeyStateActive KeyState = "active"
+	// KeyStateRetiring keys are only tried when GitHub rejects the active
+	// ones, until they are pruned
+	KeyStateRetiring KeyState = "retiring"
+)
+
+// AppKey is one of several private keys registered for an app. GitHub lets an
+// app hold several keys at once, so a new key can be put in place before the
+// old one is deleted. Each key is stored under its own secret name, in the
+// storage named by the app's private_key_source.
+type AppKey struct {
+	// Fingerprint is the SHA-256 fingerprint GitHub shows for the key
+	Fingerprint string `yaml:"fingerprint" json:"fingerprint"`
+	// Added is when the key was stored
+	Added time.Time `yaml:"added" json:"added"`
+	// State is active or retiring
+	State KeyState `yaml:"state" json:"state"`
+}
+
+// validateKeys validates the key list of an app with several keys
+func (g *GitHubApp) validateKeys() error {
+	if !g.PrivateKeySource.storesKeys() {
+		return fmt.Errorf("keys require a keyring, filesystem or secret backend source, got %q", g.PrivateKeySource)
+	}
+
+	seen := make(map[string]bool)
+	active := false
+	for _, key := range g.Keys {
+		if key.Fingerprint == "" {
+			return fmt.Errorf("keys: fingerprint is required")
+		}
+		if seen[key.Fingerprint] {
+			return fmt.Errorf("keys: duplicate key %s", key.Fingerprint)
+		}
+		seen[key.Fingerprint] = true
+
+		switch key.State {
+		case KeyStateActive:
+			active = true
+		case KeyStateRetiring:
+		default:
+			return fmt.Errorf("keys: invalid state %q for key %s", key.State, key.Fingerprint)
+		}
+	}
+	if !active {
+		return fmt.Errorf("keys: at least one key must be active")
+	}
+	return nil
+}
+
+// storesKeys reports whether keys of this source are kept in storage that
+// gh-app-auth writes to, and can therefore be rotated
+func (s PrivateKeySource) storesKeys() bool {
+	switch s {
+	case PrivateKeySourceKeyring, PrivateKeySourceFilesystem:
+		return true
+	default:
+		return s.isBackend()
+	}
+}
+
+// SigningKeys returns the app's keys in the order they are tried: active keys
+// before retiring ones, newest first
+func (app *GitHubApp) SigningKeys() []AppKey {
+	keys := append([]AppKey(nil), app.Keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].State != keys[j].State {
+			return keys[i].State == KeyStateActive
+		}
+		return keys[i].Added.After(keys[j].Added)
+	})
+	return keys
+}
+
+// GetKey retrieves one of the app's keys from secure storage
+func (app *GitHubApp) GetKey(secretMgr *secrets.Manager, key AppKey) (string, error) {
+	name := app.keySecretName(key.Fingerprint)
+	if app.PrivateKeySource.isBackend() {
+		return getFromBackend(secretMgr, app.PrivateKeySource, name, secrets.SecretTypePrivateKey)
+	}
+	value, _, err := secretMgr.Get(name, secrets.SecretTypePrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %s: %w", key.Fingerprint, err)
+	}
+	return value, nil
+}
+
+// AddKey stores privateKey as a new active key of the app and returns its
+// fingerprint. The first time, the app's current key is moved into the key
+// list so both can be used during the rotation.
+func (app *GitHubApp) AddKey(
+	secretMgr *secrets.Manager, privateKey string, now time.Time,
+) (string, secrets.StorageBackend, error) {
+	fingerprint, err := jwt.KeyFingerprint(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(app.Keys) == 0 {
+		if err := app.adoptCurrentKey(secretMgr, now); err != nil {
+			return "", "", err
+		}
+	}
+	for _, key := range app.Keys {
+		if key.Fingerprint == fingerprint {
+			return "", "", fmt.Errorf("key %s is already registered for app %s", fingerprint, app.Name)
+		}
+	}
+
+	backend, err := app.storeKey(secretMgr, fingerprint, privateKey)
+	if err != nil {
+		return "", "", err
+	}
+	app.Keys = append(app.Keys, AppKey{Fingerprint: fingerprint, Added: now, State: KeyStateActive})
+	return fingerprint, backend, nil
+}
+
+// adoptCurrentKey copies the app's single key into the key list. The copy
+// kept under the app's secret name is left for DeleteLegacyKey, once the new
+// key list is saved.
+func (app *GitHubApp) adoptCurrentKey(secretMgr *secrets.Manager, now time.Time) error {
+	if app.PrivateKeySource == "" && app.PrivateKeyPath != "" {
+		app.PrivateKeySource = PrivateKeySourceFilesystem
+	}
+	if !app.PrivateKeySource.storesKeys() {
+		return fmt.Errorf("keys read from a %s source cannot be rotated", app.PrivateKeySource)
+	}
+
+	current, err := app.GetPrivateKey(secretMgr)
+	if err != nil {
+		return fmt.Errorf("failed to read current key: %w", err)
+	}
+	if err := app.CheckKeyFingerprint(current); err != nil {
+		return fmt.Errorf("current key: %w", err)
+	}
+	fingerprint, err := jwt.KeyFingerprint(current)
+	if err != nil {
+		return fmt.Errorf("current key: %w", err)
+	}
+	if _, err := app.storeKey(secretMgr, fingerprint, current); err != nil {
+		return err
+	}
+
+	// The key list records the fingerprint from now on
+	app.PrivateKeyPath = ""
+	app.KeyFingerprint = ""
+	app.Keys = []AppKey{{Fingerprint: fingerprint, Added: now, State: KeyStateActive}}
+	return nil
+}
+
+// DeleteLegacyKey removes the key stored under the app's secret name, which
+// the key list replaces once AddKey has copied it. Key files named by
+// private_key_path are never touched.
+func (app *GitHubApp) DeleteLegacyKey(secretMgr *secrets.Manager) error {
+	if app.PrivateKeySource.isBackend() {
+		return deleteFromBackend(secretMgr, app.PrivateKeySource, app.SecretName(), secrets.SecretTypePrivateKey)
+	}
+	return secretMgr.Delete(app.SecretName(), secrets.SecretTypePrivateKey)
+}
+
+// StoreKey stores privateKey as the key of app.Keys it matches, as when an
+// app with several keys is imported on another machine
+func (app *GitHubApp) StoreKey(secretMgr *secrets.Manager, privateKey string) (secrets.StorageBackend, error) {
+	fingerprint, err := jwt.KeyFingerprint(privateKey)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range app.Keys {
+		if key.Fingerprint == fingerprint {
+			return app.storeKey(secretMgr, fingerprint, privateKey)
+		}
+	}
+	return "", fmt.Errorf("key %s is not one of the keys of app %s", fingerprint, app.Name)
+}
+
+// storeKey stores one key under its own secret name
+func (app *GitHubApp) storeKey(
+	secretMgr *secrets.Manager, fingerprint, privateKey string,
+) (secrets.StorageBackend, error) {
+	name := app.keySecretName(fingerprint)
+	if app.PrivateKeySource.isBackend() {
+		err := storeInBackend(secretMgr, app.PrivateKeySource, name, secrets.SecretTypePrivateKey, privateKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to store key %s: %w", fingerprint, err)
+		}
+		return secrets.StorageBackend(app.PrivateKeySource), nil
+	}
+
+	backend, err := secretMgr.Store(name, secrets.SecretTypePrivateKey, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to store key %s: %w", fingerprint, err)
+	}
+	if backend == secrets.StorageBackendKeyring {
+		app.PrivateKeySource = PrivateKeySourceKeyring
+	} else {
+		app.PrivateKeySource = PrivateKeySourceFilesystem
+	}
+	return backend, nil
+}
+
+// RetireKeysExcept marks every key but fingerprint as retiring and returns
+// how many keys changed state
+func (app *GitHubApp) RetireKeysExcept(fingerprint string) int {
+	retired := 0
+	for i := range app.Keys {
+		if app.Keys[i].Fingerprint != fingerprint && app.Keys[i].State != KeyStateRetiring {
+			app.Keys[i].State = KeyStateRetiring
+			retired++
+		}
+	}
+	return retired
+}
+
+// RemoveRetiringKeys deletes the app's retiring keys from storage and from the
+// key list, and returns them
+func (app *GitHubApp) RemoveRetiringKeys(secretMgr *secrets.Manager) ([]AppKey, error) {
+	var kept, removed []AppKey
+	for _, key := range app.Keys {
+		if key.State != KeyStateRetiring {
+			kept = append(kept, key)
+			continue
+		}
+		if err := app.deleteKey(secretMgr, key); err != nil {
+			app.Keys = append(kept, app.Keys[len(kept)+len(removed):]...)
+			return removed, err
+		}
+		removed = append(removed, key)
+	}
+	app.Keys = kept
+	return removed, nil
+}
+
+// deleteKey removes one key from storage
+func (app *GitHubApp) deleteKey(secretMgr *secrets.Manager, key AppKey) error {
+	name := app.keySecretName(key.Fingerprint)
+	if app.PrivateKeySource.isBackend() {
+		return deleteFromBackend(secretMgr, app.PrivateKeySource, name, secrets.SecretTypePrivateKey)
+	}
+	return secretMgr.Delete(name, secrets.SecretTypePrivateKey)
+}
+
+// keySecretName returns the secret name of one of the app's keys: the app's
+// secret name followed by a filesystem-safe prefix of the fingerprint
+func (app *GitHubApp) keySecretName(fingerprint string) string {
+	id := strings.NewReplacer("/", "_", "+", "-").Replace(strings.TrimPrefix(fingerprint, "SHA256:"))
+	if len(id) > 16 {
+		id = id[:16]
+	}
+	return app.SecretName() + "@" + id
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+	"github.com/zalando/go-keyring"
+)
+
+func TestGitHubApp_Validate_Keys(t *testing.T) {
+	added := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	active := AppKey{Fingerprint: "SHA256:new", Added: added, State: KeyStateActive}
+	retiring := AppKey{Fingerprint: "SHA256:old", Added: added, State: KeyStateRetiring}
+
+	tests := []struct {
+		name    string
+		source  PrivateKeySource
+		keys    []AppKey
+		wantErr bool
+	}{
+		{"keyring with active and retiring keys", PrivateKeySourceKeyring, []AppKey{active, retiring}, false},
+		{"filesystem without private_key_path", PrivateKeySourceFilesystem, []AppKey{active}, false},
+		{"no active key", PrivateKeySourceKeyring, []AppKey{retiring}, true},
+		{"duplicate key", PrivateKeySourceKeyring, []AppKey{active, active}, true},
+		{"missing fingerprint", PrivateKeySourceKeyring, []AppKey{{State: KeyStateActive}}, true},
+		{"invalid state", PrivateKeySourceKeyring, []AppKey{{Fingerprint: "SHA256:x", State: "revoked"}}, true},
+		{"env source", PrivateKeySourceEnv, []AppKey{active}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := GitHubApp{
+				Name: "app", AppID: 1, Patterns: []string{"github.com/org/"},
+				PrivateKeySource: tt.source, PrivateKeyEnv: "KEY", Keys: tt.keys,
+			}
+			if err := app.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitHubApp_SigningKeys(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+	app := GitHubApp{Keys: []AppKey{
+		{Fingerprint: "oldest-retiring", Added: day(1), State: KeyStateRetiring},
+		{Fingerprint: "active", Added: day(2), State: KeyStateActive},
+		{Fingerprint: "newer-retiring", Added: day(3), State: KeyStateRetiring},
+		{Fingerprint: "newest-active", Added: day(4), State: KeyStateActive},
+	}}
+
+	want := []string{"newest-active", "active", "newer-retiring", "oldest-retiring"}
+	got := app.SigningKeys()
+	for i := range want {
+		if got[i].Fingerprint != want[i] {
+			t.Fatalf("SigningKeys() order = %v, want %v", got, want)
+		}
+	}
+	if app.Keys[0].Fingerprint != "oldest-retiring" {
+		t.Error("SigningKeys() should not reorder the configured keys")
+	}
+}
+
+func TestGitHubApp_KeyRotation(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	oldKey, newKey := testkeys.RSAKeyPEM(t), testkeys.RSAKeyPEM(t)
+	oldFingerprint, _ := jwt.KeyFingerprint(oldKey)
+
+	app := GitHubApp{
+		Name: "app", AppID: 1, Patterns: []string{"github.com/org/"},
+		PrivateKeySource: PrivateKeySourceKeyring,
+	}
+	if _, err := app.SetPrivateKey(secretMgr, oldKey); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	// The first rotation moves the current key into the key list
+	newFingerprint, backend, err := app.AddKey(secretMgr, newKey, time.Now())
+	if err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+	if backend != secrets.StorageBackendKeyring {
+		t.Errorf("AddKey() backend = %s, want keyring", backend)
+	}
+	if len(app.Keys) != 2 || app.Keys[0].Fingerprint != oldFingerprint || app.Keys[1].Fingerprint != newFingerprint {
+		t.Fatalf("Keys = %+v, want the old then the new key", app.Keys)
+	}
+	if _, _, err := app.AddKey(secretMgr, newKey, time.Now()); err == nil {
+		t.Error("AddKey() should reject a key that is already registered")
+	}
+
+	if retired := app.RetireKeysExcept(newFingerprint); retired != 1 {
+		t.Errorf("RetireKeysExcept() = %d, want 1", retired)
+	}
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() after rotation error = %v", err)
+	}
+	if got, err := app.GetPrivateKey(secretMgr); err != nil || got != newKey {
+		t.Errorf("GetPrivateKey() should return the new key, error = %v", err)
+	}
+
+	// The copy under the app name is no longer needed once the config is saved
+	if err := app.DeleteLegacyKey(secretMgr); err != nil {
+		t.Errorf("DeleteLegacyKey() error = %v", err)
+	}
+	if _, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("legacy key still stored, error = %v", err)
+	}
+	if got, err := app.GetKey(secretMgr, app.SigningKeys()[1]); err != nil || got != oldKey {
+		t.Errorf("GetKey(retiring) should return the old key, error = %v", err)
+	}
+
+	removed, err := app.RemoveRetiringKeys(secretMgr)
+	if err != nil {
+		t.Fatalf("RemoveRetiringKeys() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0].Fingerprint != oldFingerprint || len(app.Keys) != 1 {
+		t.Errorf("RemoveRetiringKeys() = %+v, Keys = %+v", removed, app.Keys)
+	}
+
+	if err := app.DeletePrivateKey(secretMgr); err != nil {
+		t.Fatalf("DeletePrivateKey() error = %v", err)
+	}
+	if app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() should be false after DeletePrivateKey()")
+	}
+}
+
+func TestGitHubApp_AddKey_Errors(t *testing.T) {
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := GitHubApp{Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceEnv, PrivateKeyEnv: "KEY"}
+	t.Setenv("KEY", testkeys.RSAKeyPEM(t))
+	if _, _, err := app.AddKey(secretMgr, testkeys.RSAKeyPEM(t), time.Now()); err == nil {
+		t.Error("AddKey() should fail for an env source")
+	}
+
+	app = GitHubApp{Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceKeyring}
+	if _, _, err := app.AddKey(secretMgr, "not a key", time.Now()); err == nil {
+		t.Error("AddKey() should fail for invalid key content")
+	}
+}
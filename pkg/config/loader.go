@@ -6,16 +6,27 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 	"gopkg.in/yaml.v3"
 )
 
 // Loader handles loading GitHub App configurations from files
 type Loader struct {
 	configPath string
+	// systemPath, fragmentsDir and repositoryPath are the files merged below
+	// and above configPath; all are empty for a loader of a single file
+	systemPath     string
+	fragmentsDir   string
+	repositoryPath string
 }
 
+// FragmentsDirName is the directory next to the user configuration file whose
+// *.yml, *.yaml and *.json fragments are merged below it
+const FragmentsDirName = "config.d"
+
 // Common errors returned by the loader
 var (
 	ErrConfigNotExists  = errors.New("configuration file not found: ")
@@ -31,42 +42,147 @@ func NewLoader(configPath string) *Loader {
 	}
 }
 
-// NewDefaultLoader creates a loader with the default configuration path
+// NewDefaultLoader creates a loader that merges the system configuration,
+// the config.d fragments, the user configuration at the default path and the
+// current repository's configuration, in that order of precedence
 func NewDefaultLoader() *Loader {
-	defaultPath := getDefaultConfigPath()
-	return NewLoader(defaultPath)
+	loader := NewLoader(getDefaultConfigPath())
+	loader.systemPath = paths.SystemConfigFile()
+	loader.fragmentsDir = filepath.Join(filepath.Dir(loader.configPath), FragmentsDirName)
+	loader.repositoryPath = paths.RepositoryConfigFile()
+	return loader
+}
+
+// Layers returns the files the loader merges, lowest precedence first. The
+// system, user and repository files may not exist.
+func (l *Loader) Layers() []Origin {
+	var layers []Origin
+	if l.systemPath != "" {
+		layers = append(layers, Origin{Layer: LayerSystem, Path: l.systemPath})
+	}
+	for _, path := range l.fragments() {
+		layers = append(layers, Origin{Layer: LayerFragment, Path: path})
+	}
+	layers = append(layers, Origin{Layer: LayerUser, Path: l.configPath})
+	if l.repositoryPath != "" {
+		layers = append(layers, Origin{Layer: LayerRepository, Path: l.repositoryPath})
+	}
+	return layers
 }
 
 // Load loads the configuration from the configured path
 func (l *Loader) Load() (*Config, error) {
+	config, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return config, nil
+}
+
+// read reads and merges the configuration files without validating the result
+func (l *Loader) read() (*Config, error) {
 	if l.configPath == "" {
 		return nil, fmt.Errorf("no configuration path specified")
 	}
+	if l.systemPath == "" && l.fragmentsDir == "" && l.repositoryPath == "" {
+		return l.readFile(l.configPath)
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(l.configPath); os.IsNotExist(err) {
+	config := &Config{provenance: newProvenance()}
+	found := false
+	for _, origin := range l.Layers() {
+		if origin.Layer == LayerRepository {
+			continue
+		}
+		if origin.Layer == LayerUser {
+			// Keep an independent copy of what Save leaves out
+			base, err := cloneConfig(config)
+			if err != nil {
+				return nil, err
+			}
+			config.provenance.base = base
+		}
+
+		data, err := readLayerFile(origin.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", origin.Path, err)
+		}
+		if data == nil {
+			continue
+		}
+		layer, err := l.parseConfig(data, origin.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", origin.Path, ErrConfigUnparsable)
+		}
+		config.mergeLayer(layer, origin)
+		found = true
+	}
+	if !found {
 		return nil, fmt.Errorf("%s: %w", l.configPath, ErrConfigNotExists)
 	}
+	if err := config.snapshotUserLayer(); err != nil {
+		return nil, err
+	}
+
+	repositoryData, err := readLayerFile(l.repositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.repositoryPath, err)
+	}
+	if repositoryData != nil {
+		repository, err := parseRepositoryLayer(repositoryData)
+		if err == nil {
+			err = config.applyRepositoryLayer(repository, Origin{Layer: LayerRepository, Path: l.repositoryPath})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.repositoryPath, err)
+		}
+	}
+	return config, nil
+}
+
+// fragments returns the configuration fragments in lexical order
+func (l *Loader) fragments() []string {
+	if l.fragmentsDir == "" {
+		return nil
+	}
+	var fragments []string
+	for _, pattern := range []string{"*.yml", "*.yaml", "*.json"} {
+		matches, _ := filepath.Glob(filepath.Join(l.fragmentsDir, pattern))
+		fragments = append(fragments, matches...)
+	}
+	sort.Strings(fragments)
+	return fragments
+}
+
+// readFile reads the configuration from a single file
+func (l *Loader) readFile(path string) (*Config, error) {
+	// Check if file exists
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", path, ErrConfigNotExists)
+	}
 
 	// Note: We don't check file extension here, parseConfig will handle different formats
 
 	// Read file content
-	data, err := os.ReadFile(l.configPath)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("%w", ErrConfigUnreadable)
 	}
 
 	// Parse based on file extension
-	config, err := l.parseConfig(data, l.configPath)
+	config, err := l.parseConfig(data, path)
 	if err != nil {
 		return nil, fmt.Errorf("%w", ErrConfigUnparsable)
 	}
-
-	// Validate configuration
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("%w", err)
+	if err := config.snapshotUserLayer(); err != nil {
+		return nil, err
 	}
-
 	return config, nil
 }
 
@@ -10,23 +10,59 @@ import (
 func (p *PersonalAccessToken) GetPAT(secretMgr *secrets.Manager) (string, error) {
 	switch p.TokenSource {
 	case PrivateKeySourceKeyring, "": // Empty defaults to keyring
-		token, _, err := secretMgr.Get(p.Name, secrets.SecretTypePAT)
+		token, _, err := secretMgr.Get(p.SecretName(), secrets.SecretTypePAT)
 		if err == nil {
 			return token, nil
 		}
 		return "", fmt.Errorf("failed to get PAT from keyring: %w", err)
 
 	case PrivateKeySourceFilesystem:
-		return "", fmt.Errorf("filesystem storage for PATs is not yet implemented")
+		token, _, err := secretMgr.Get(p.SecretName(), secrets.SecretTypePAT)
+		if err != nil {
+			return "", fmt.Errorf("failed to get PAT from filesystem: %w", err)
+		}
+		return token, nil
+
+	case PrivateKeySourceCommand:
+		token, err := runSecretCommand(secretMgr, p.TokenCommand)
+		if err != nil {
+			return "", fmt.Errorf("failed to get PAT from token_command: %w", err)
+		}
+		return token, nil
+
+	case PrivateKeySourceEnv:
+		return readSecretEnv(p.TokenEnv)
 
 	default:
+		if p.TokenSource.isBackend() {
+			return getFromBackend(secretMgr, p.TokenSource, p.SecretName(), secrets.SecretTypePAT)
+		}
 		return "", fmt.Errorf("unknown token source: %s", p.TokenSource)
 	}
 }
 
+// HasPAT reports whether the Personal Access Token can be read from its source
+func (p *PersonalAccessToken) HasPAT(secretMgr *secrets.Manager) bool {
+	_, err := p.GetPAT(secretMgr)
+	return err == nil
+}
+
 // SetPAT stores the Personal Access Token securely
 func (p *PersonalAccessToken) SetPAT(secretMgr *secrets.Manager, token string) (secrets.StorageBackend, error) {
-	backend, err := secretMgr.Store(p.Name, secrets.SecretTypePAT, token)
+	switch p.TokenSource {
+	case PrivateKeySourceCommand:
+		return "", fmt.Errorf("cannot store a PAT that is read from token_command")
+	case PrivateKeySourceEnv:
+		return "", fmt.Errorf("cannot store a PAT that is read from %s", p.TokenEnv)
+	}
+	if p.TokenSource.isBackend() {
+		if err := storeInBackend(secretMgr, p.TokenSource, p.SecretName(), secrets.SecretTypePAT, token); err != nil {
+			return "", fmt.Errorf("failed to store PAT: %w", err)
+		}
+		return secrets.StorageBackend(p.TokenSource), nil
+	}
+
+	backend, err := secretMgr.Store(p.SecretName(), secrets.SecretTypePAT, token)
 	if err != nil {
 		return "", fmt.Errorf("failed to store PAT: %w", err)
 	}
@@ -41,7 +77,14 @@ func (p *PersonalAccessToken) SetPAT(secretMgr *secrets.Manager, token string) (
 	return backend, nil
 }
 
-// DeletePAT removes the PAT from secure storage
+// DeletePAT removes the PAT from secure storage. Tokens printed by a command
+// or held in the environment are not stored, so there is nothing to delete.
 func (p *PersonalAccessToken) DeletePAT(secretMgr *secrets.Manager) error {
-	return secretMgr.Delete(p.Name, secrets.SecretTypePAT)
+	if p.TokenSource == PrivateKeySourceCommand || p.TokenSource == PrivateKeySourceEnv {
+		return nil
+	}
+	if p.TokenSource.isBackend() {
+		return deleteFromBackend(secretMgr, p.TokenSource, p.SecretName(), secrets.SecretTypePAT)
+	}
+	return secretMgr.Delete(p.SecretName(), secrets.SecretTypePAT)
 }
@@ -0,0 +1,99 @@
+package config
+
+import "fmt"
+
+// rebase applies the changes from base to ours onto theirs, the user file as
+// another process may have rewritten it since base was loaded. Entries and
+// settings this process did not touch keep their value in theirs, so
+// concurrent commands each keep the changes of the other.
+func rebase(base, ours, theirs *Config) *Config {
+	result := *theirs
+	if ours.Version != base.Version {
+		result.Version = ours.Version
+	}
+	result.GitHubApps = rebaseEntries(base.GitHubApps, ours.GitHubApps, theirs.GitHubApps, appEntryKey)
+	result.PATs = rebaseEntries(base.PATs, ours.PATs, theirs.PATs, patEntryKey)
+	if !sameYAML(ours.TokenCache, base.TokenCache) {
+		result.TokenCache = ours.TokenCache
+	}
+	if !sameYAML(ours.Retry, base.Retry) {
+		result.Retry = ours.Retry
+	}
+	result.Transport = rebaseMap(base.Transport, ours.Transport, theirs.Transport)
+	result.SecretBackends = rebaseMap(base.SecretBackends, ours.SecretBackends, theirs.SecretBackends)
+	return &result
+}
+
+// rebaseEntries rebases a list of apps or PATs. Entries are matched by key and,
+// when several share a key, by their rank among them: an entry removed since
+// base is removed from theirs, a changed or added one replaces or joins it.
+func rebaseEntries[T any](base, ours, theirs []T, entryKey func(*T) string) []T {
+	baseByID := entriesByID(base, entryKey)
+	oursByID := entriesByID(ours, entryKey)
+
+	result := make([]T, 0, len(theirs))
+	inTheirs := make(map[string]bool)
+	for i, id := range entryIDs(theirs, entryKey) {
+		inTheirs[id] = true
+		baseEntry, inBase := baseByID[id]
+		ourEntry, inOurs := oursByID[id]
+		switch {
+		case inBase && !inOurs:
+			continue
+		case inOurs && (!inBase || !sameYAML(ourEntry, baseEntry)):
+			result = append(result, ourEntry)
+		default:
+			result = append(result, theirs[i])
+		}
+	}
+	for i, id := range entryIDs(ours, entryKey) {
+		baseEntry, inBase := baseByID[id]
+		if !inTheirs[id] && (!inBase || !sameYAML(ours[i], baseEntry)) {
+			result = append(result, ours[i])
+		}
+	}
+	return result
+}
+
+// entryIDs returns the ID of each entry: its key and its rank among the
+// entries sharing that key
+func entryIDs[T any](entries []T, entryKey func(*T) string) []string {
+	ids := make([]string, len(entries))
+	seen := make(map[string]int)
+	for i := range entries {
+		key := entryKey(&entries[i])
+		ids[i] = fmt.Sprintf("%s#%d", key, seen[key])
+		seen[key]++
+	}
+	return ids
+}
+
+func entriesByID[T any](entries []T, entryKey func(*T) string) map[string]T {
+	byID := make(map[string]T, len(entries))
+	for i, id := range entryIDs(entries, entryKey) {
+		byID[id] = entries[i]
+	}
+	return byID
+}
+
+// rebaseMap rebases the transport or secret backend settings, by key
+func rebaseMap[V any](base, ours, theirs map[string]V) map[string]V {
+	result := make(map[string]V, len(theirs))
+	for key, value := range theirs {
+		result[key] = value
+	}
+	for key := range base {
+		if _, kept := ours[key]; !kept {
+			delete(result, key)
+		}
+	}
+	for key, value := range ours {
+		if baseValue, inBase := base[key]; !inBase || !sameYAML(value, baseValue) {
+			result[key] = value
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -1,18 +1,26 @@
 package config
 
 import (
+	"crypto"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/signer"
 )
 
 // GetPrivateKey retrieves the private key from the appropriate source
 // based on the PrivateKeySource configuration
 func (app *GitHubApp) GetPrivateKey(secretMgr *secrets.Manager) (string, error) {
+	if len(app.Keys) > 0 {
+		return app.GetKey(secretMgr, app.SigningKeys()[0])
+	}
+
 	switch app.PrivateKeySource {
 	case PrivateKeySourceKeyring:
-		key, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey)
+		key, _, err := secretMgr.Get(app.SecretName(), secrets.SecretTypePrivateKey)
 		if err == nil {
 			return key, nil
 		}
@@ -28,7 +36,23 @@ func (app *GitHubApp) GetPrivateKey(secretMgr *secrets.Manager) (string, error)
 	case PrivateKeySourceInline:
 		return "", fmt.Errorf("inline private keys should be migrated to secure storage")
 
+	case PrivateKeySourceCommand:
+		key, err := runSecretCommand(secretMgr, app.PrivateKeyCommand)
+		if err != nil {
+			return "", fmt.Errorf("failed to get private key from private_key_command: %w", err)
+		}
+		return key, nil
+
+	case PrivateKeySourceEnv:
+		return readPrivateKeyEnv(app.PrivateKeyEnv)
+
+	case PrivateKeySourceSigner:
+		return "", ErrExternalSigner
+
 	default:
+		if app.PrivateKeySource.isBackend() {
+			return getFromBackend(secretMgr, app.PrivateKeySource, app.SecretName(), secrets.SecretTypePrivateKey)
+		}
 		return "", fmt.Errorf("unknown private key source: %s", app.PrivateKeySource)
 	}
 }
@@ -53,9 +77,26 @@ func (app *GitHubApp) getPrivateKeyFromFilesystem() (string, error) {
 }
 
 // SetPrivateKey stores the private key securely
-// It attempts to use keyring first, falling back to filesystem if unavailable
+// It attempts to use keyring first, falling back to filesystem if unavailable.
+// Apps whose source is a pluggable backend store the key in that backend.
 func (app *GitHubApp) SetPrivateKey(secretMgr *secrets.Manager, privateKey string) (secrets.StorageBackend, error) {
-	backend, err := secretMgr.Store(app.Name, secrets.SecretTypePrivateKey, privateKey)
+	switch app.PrivateKeySource {
+	case PrivateKeySourceCommand:
+		return "", fmt.Errorf("cannot store a private key for an app whose key is read from private_key_command")
+	case PrivateKeySourceEnv:
+		return "", fmt.Errorf("cannot store a private key for an app whose key is read from %s", app.PrivateKeyEnv)
+	case PrivateKeySourceSigner:
+		return "", fmt.Errorf("cannot store a private key for an app using an external signer")
+	}
+	if app.PrivateKeySource.isBackend() {
+		err := storeInBackend(secretMgr, app.PrivateKeySource, app.SecretName(), secrets.SecretTypePrivateKey, privateKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to store private key: %w", err)
+		}
+		return secrets.StorageBackend(app.PrivateKeySource), nil
+	}
+
+	backend, err := secretMgr.Store(app.SecretName(), secrets.SecretTypePrivateKey, privateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to store private key: %w", err)
 	}
@@ -74,15 +115,39 @@ func (app *GitHubApp) SetPrivateKey(secretMgr *secrets.Manager, privateKey strin
 }
 
 // DeletePrivateKey removes the private key from secure storage
+// Keys printed by a command, held in the environment or kept by an external
+// signer are not stored, so there is nothing to delete.
 func (app *GitHubApp) DeletePrivateKey(secretMgr *secrets.Manager) error {
-	return secretMgr.Delete(app.Name, secrets.SecretTypePrivateKey)
+	switch app.PrivateKeySource {
+	case PrivateKeySourceCommand, PrivateKeySourceEnv, PrivateKeySourceSigner:
+		return nil
+	}
+	if len(app.Keys) > 0 {
+		for _, key := range app.Keys {
+			if err := app.deleteKey(secretMgr, key); err != nil {
+				return err
+			}
+		}
+		// A copy left under the app name by an interrupted rotation goes too
+		_ = app.DeleteLegacyKey(secretMgr)
+		return nil
+	}
+	if app.PrivateKeySource.isBackend() {
+		return deleteFromBackend(secretMgr, app.PrivateKeySource, app.SecretName(), secrets.SecretTypePrivateKey)
+	}
+	return secretMgr.Delete(app.SecretName(), secrets.SecretTypePrivateKey)
 }
 
 // HasPrivateKey checks if the app has a private key configured
 func (app *GitHubApp) HasPrivateKey(secretMgr *secrets.Manager) bool {
+	if len(app.Keys) > 0 {
+		_, err := app.GetPrivateKey(secretMgr)
+		return err == nil
+	}
+
 	switch app.PrivateKeySource {
 	case PrivateKeySourceKeyring:
-		_, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey)
+		_, _, err := secretMgr.Get(app.SecretName(), secrets.SecretTypePrivateKey)
 		return err == nil
 	case PrivateKeySourceFilesystem:
 		if app.PrivateKeyPath == "" {
@@ -94,7 +159,118 @@ func (app *GitHubApp) HasPrivateKey(secretMgr *secrets.Manager) bool {
 		}
 		_, err = os.Stat(expandedPath)
 		return err == nil
+	case PrivateKeySourceCommand:
+		_, err := runSecretCommand(secretMgr, app.PrivateKeyCommand)
+		return err == nil
+	case PrivateKeySourceEnv:
+		_, err := readPrivateKeyEnv(app.PrivateKeyEnv)
+		return err == nil
+	case PrivateKeySourceSigner:
+		keySigner, err := app.OpenSigner()
+		if err != nil {
+			return false
+		}
+		_ = signer.Close(keySigner)
+		return true
 	default:
+		if app.PrivateKeySource.isBackend() {
+			_, err := getFromBackend(secretMgr, app.PrivateKeySource, app.SecretName(), secrets.SecretTypePrivateKey)
+			return err == nil
+		}
 		return false
 	}
 }
+
+// OpenSigner opens the external signer of an app whose private_key_source is
+// signer. Callers should release it with signer.Close.
+func (app *GitHubApp) OpenSigner() (crypto.Signer, error) {
+	switch {
+	case app.PrivateKeySource != PrivateKeySourceSigner:
+		return nil, fmt.Errorf("app %s does not use an external signer", app.Name)
+	case app.PrivateKeyURI != "":
+		return signer.Open(app.PrivateKeyURI)
+	case app.SignerCommand != nil:
+		// The timeout was checked by Validate; an unparsable one falls back to the default
+		timeout, _ := time.ParseDuration(app.SignerCommand.Timeout)
+		return signer.NewCommandSigner(app.SignerCommand.Args, timeout), nil
+	default:
+		return nil, fmt.Errorf("app %s has no private_key_uri or signer_command", app.Name)
+	}
+}
+
+// isBackend reports whether the source names a pluggable secret backend
+// registered with the secrets package, rather than one of the built-in sources
+func (s PrivateKeySource) isBackend() bool {
+	switch s {
+	case "", PrivateKeySourceKeyring, PrivateKeySourceFilesystem, PrivateKeySourceInline,
+		PrivateKeySourceCommand, PrivateKeySourceEnv, PrivateKeySourceSigner:
+		return false
+	default:
+		return secrets.IsRegistered(string(s))
+	}
+}
+
+// runSecretCommand runs a private_key_command or token_command
+func runSecretCommand(secretMgr *secrets.Manager, command *SecretCommand) (string, error) {
+	if command == nil {
+		return "", fmt.Errorf("no command configured")
+	}
+
+	// Durations were checked by Validate; unparsable ones fall back to defaults
+	timeout, _ := time.ParseDuration(command.Timeout)
+	cacheTTL, _ := time.ParseDuration(command.Cache)
+	return secretMgr.RunCommand(secrets.Command{
+		Args:     command.Args,
+		Timeout:  timeout,
+		CacheTTL: cacheTTL,
+	})
+}
+
+// getFromBackend reads a secret from the backend named by source
+func getFromBackend(
+	secretMgr *secrets.Manager, source PrivateKeySource, name string, secretType secrets.SecretType,
+) (string, error) {
+	backend, err := secretMgr.Backend(string(source))
+	if err != nil {
+		return "", err
+	}
+	value, err := backend.Get(name, secretType)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s from %s: %w", secretType, source, err)
+	}
+	return value, nil
+}
+
+// storeInBackend writes a secret to the backend named by source
+func storeInBackend(
+	secretMgr *secrets.Manager, source PrivateKeySource, name string, secretType secrets.SecretType, value string,
+) error {
+	backend, err := secretMgr.Backend(string(source))
+	if err != nil {
+		return err
+	}
+	return backend.Store(name, secretType, value)
+}
+
+// deleteFromBackend removes a secret from the backend named by source
+func deleteFromBackend(
+	secretMgr *secrets.Manager, source PrivateKeySource, name string, secretType secrets.SecretType,
+) error {
+	backend, err := secretMgr.Backend(string(source))
+	if err != nil {
+		return err
+	}
+	return backend.Delete(name, secretType)
+}
+
+// validateSecretBackends checks that every secret_backends entry names a
+// registered backend
+func validateSecretBackends(settings map[string]map[string]string) error {
+	for name := range settings {
+		if !secrets.IsRegistered(name) {
+			return fmt.Errorf("unknown backend %q (registered: %s)",
+				name, strings.Join(secrets.RegisteredBackends(), ", "))
+		}
+	}
+	return nil
+}
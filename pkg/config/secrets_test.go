@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/signer"
 	"github.com/zalando/go-keyring"
 )
 
@@ -269,6 +270,26 @@ func TestGitHubApp_HasPrivateKey_Filesystem(t *testing.T) {
 	}
 }
 
+func TestPersonalAccessToken_FilesystemFallback(t *testing.T) {
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+	t.Setenv(secrets.PassphraseEnv, "test-passphrase")
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	pat := &PersonalAccessToken{Name: "ci-pat", Patterns: []string{"github.com/"}}
+
+	backend, err := pat.SetPAT(secretMgr, "ghp_filesystem")
+	if err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+	if backend != secrets.StorageBackendFilesystem || pat.TokenSource != PrivateKeySourceFilesystem {
+		t.Fatalf("SetPAT() backend = %v, source = %v, want filesystem", backend, pat.TokenSource)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "ghp_filesystem" {
+		t.Errorf("GetPAT() = %q, %v, want ghp_filesystem", token, err)
+	}
+}
+
 func TestGitHubApp_Validate_WithPrivateKeySource(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -349,3 +370,279 @@ func TestGitHubApp_Validate_WithPrivateKeySource(t *testing.T) {
 		})
 	}
 }
+
+// recordingBackend is a pluggable secrets backend kept in memory
+type recordingBackend struct {
+	values map[string]string
+}
+
+func (b *recordingBackend) Name() string    { return "config-test" }
+func (b *recordingBackend) Available() bool { return true }
+
+func (b *recordingBackend) Get(name string, secretType secrets.SecretType) (string, error) {
+	value, ok := b.values[name+"/"+string(secretType)]
+	if !ok {
+		return "", secrets.ErrNotFound
+	}
+	return value, nil
+}
+
+func (b *recordingBackend) Store(name string, secretType secrets.SecretType, value string) error {
+	b.values[name+"/"+string(secretType)] = value
+	return nil
+}
+
+func (b *recordingBackend) Delete(name string, secretType secrets.SecretType) error {
+	delete(b.values, name+"/"+string(secretType))
+	return nil
+}
+
+func (b *recordingBackend) List() ([]secrets.SecretRef, error) {
+	return nil, secrets.ErrUnsupported
+}
+
+func TestGitHubApp_PluggableBackend(t *testing.T) {
+	backend := &recordingBackend{values: make(map[string]string)}
+	secrets.Register("config-test", func(secrets.BackendOptions) (secrets.Backend, error) {
+		return backend, nil
+	})
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := &GitHubApp{
+		Name:             "vaulted-app",
+		AppID:            12345,
+		PrivateKeySource: "config-test",
+		Patterns:         []string{"github.com/org/*"},
+	}
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want registered backend accepted", err)
+	}
+	if app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() = true before storing")
+	}
+
+	stored, err := app.SetPrivateKey(secretMgr, "pem-data")
+	if err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	if stored != "config-test" || app.PrivateKeySource != "config-test" {
+		t.Errorf("SetPrivateKey() backend = %v, source = %v, want the app's backend", stored, app.PrivateKeySource)
+	}
+	if backend.values["vaulted-app/private_key"] != "pem-data" {
+		t.Errorf("backend values = %v, want key stored in the app's backend", backend.values)
+	}
+
+	key, err := app.GetPrivateKey(secretMgr)
+	if err != nil || key != "pem-data" {
+		t.Errorf("GetPrivateKey() = %q, %v, want pem-data", key, err)
+	}
+	if !app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() = false after storing")
+	}
+
+	if err := app.DeletePrivateKey(secretMgr); err != nil {
+		t.Fatalf("DeletePrivateKey() error = %v", err)
+	}
+	if _, err := app.GetPrivateKey(secretMgr); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("GetPrivateKey() after delete error = %v, want ErrNotFound", err)
+	}
+
+	pat := &PersonalAccessToken{Name: "vaulted-pat", TokenSource: "config-test", Patterns: []string{"github.com/"}}
+	if err := pat.Validate(); err != nil {
+		t.Fatalf("PAT Validate() error = %v", err)
+	}
+	if _, err := pat.SetPAT(secretMgr, "ghp_token"); err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "ghp_token" {
+		t.Errorf("GetPAT() = %q, %v, want ghp_token", token, err)
+	}
+}
+
+func TestConfig_Validate_SecretBackends(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			Version: "1",
+			GitHubApps: []GitHubApp{{
+				Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceVault, Patterns: []string{"github.com/org/*"},
+			}},
+		}
+	}
+
+	cfg := base()
+	cfg.SecretBackends = map[string]map[string]string{"vault": {"address": "https://vault.example.com"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want vault settings accepted", err)
+	}
+
+	cfg = base()
+	cfg.SecretBackends = map[string]map[string]string{"sops": {}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unregistered secret backend")
+	}
+
+	cfg = base()
+	cfg.GitHubApps[0].PrivateKeySource = "unregistered"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unregistered private_key_source")
+	}
+}
+
+// secretCommandHelperEnv makes the test binary print a secret
+const secretCommandHelperEnv = "GH_APP_AUTH_TEST_PRINT_SECRET"
+
+// TestSecretCommandHelper is not a test: it is the program run by
+// private_key_command and token_command in the tests below
+func TestSecretCommandHelper(t *testing.T) {
+	if value := os.Getenv(secretCommandHelperEnv); value != "" {
+		_, _ = os.Stdout.WriteString(value + "\n")
+		os.Exit(0)
+	}
+}
+
+func TestSecretCommandSource(t *testing.T) {
+	t.Setenv(secretCommandHelperEnv, "printed-secret")
+	command := &SecretCommand{
+		Args:    []string{os.Args[0], "-test.run=^TestSecretCommandHelper$"},
+		Timeout: "10s",
+		Cache:   "5m",
+	}
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := &GitHubApp{
+		Name:              "command-app",
+		AppID:             12345,
+		PrivateKeySource:  PrivateKeySourceCommand,
+		PrivateKeyCommand: command,
+		Patterns:          []string{"github.com/org/*"},
+	}
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if key, err := app.GetPrivateKey(secretMgr); err != nil || key != "printed-secret" {
+		t.Errorf("GetPrivateKey() = %q, %v, want command output", key, err)
+	}
+	if !app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() = false for a working command")
+	}
+	if _, err := app.SetPrivateKey(secretMgr, "pem-data"); err == nil {
+		t.Error("Expected error storing a key for a command source")
+	}
+	if err := app.DeletePrivateKey(secretMgr); err != nil {
+		t.Errorf("DeletePrivateKey() error = %v, want nothing to delete", err)
+	}
+
+	pat := &PersonalAccessToken{
+		Name:         "command-pat",
+		TokenSource:  PrivateKeySourceCommand,
+		TokenCommand: command,
+		Patterns:     []string{"github.com/"},
+	}
+	if err := pat.Validate(); err != nil {
+		t.Fatalf("PAT Validate() error = %v", err)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "printed-secret" {
+		t.Errorf("GetPAT() = %q, %v, want command output", token, err)
+	}
+	if _, err := pat.SetPAT(secretMgr, "ghp_token"); err == nil {
+		t.Error("Expected error storing a PAT for a command source")
+	}
+}
+
+func TestSecretCommand_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		command *SecretCommand
+		wantErr bool
+	}{
+		{"valid", &SecretCommand{Args: []string{"op", "read", "op://ci/app/key"}, Timeout: "5s", Cache: "1h"}, false},
+		{"missing command", nil, true},
+		{"empty args", &SecretCommand{}, true},
+		{"empty program", &SecretCommand{Args: []string{" "}}, true},
+		{"invalid timeout", &SecretCommand{Args: []string{"pass"}, Timeout: "soon"}, true},
+		{"zero timeout", &SecretCommand{Args: []string{"pass"}, Timeout: "0s"}, true},
+		{"negative cache", &SecretCommand{Args: []string{"pass"}, Cache: "-1m"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := GitHubApp{
+				Name: "app", AppID: 1, Patterns: []string{"github.com/org/*"},
+				PrivateKeySource: PrivateKeySourceCommand, PrivateKeyCommand: tt.command,
+			}
+			if err := app.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("GitHubApp.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			pat := PersonalAccessToken{
+				Name: "pat", Patterns: []string{"github.com/"},
+				TokenSource: PrivateKeySourceCommand, TokenCommand: tt.command,
+			}
+			if err := pat.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("PersonalAccessToken.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignerSource(t *testing.T) {
+	command := &SecretCommand{Args: []string{"gh-app-signer", "--key", "ci"}}
+	tests := []struct {
+		name    string
+		app     GitHubApp
+		wantErr bool
+	}{
+		{"pkcs11 uri", GitHubApp{PrivateKeyURI: "pkcs11:token=ci;object=app"}, false},
+		{"signer command", GitHubApp{SignerCommand: command}, false},
+		{"signer command with timeout", GitHubApp{SignerCommand: &SecretCommand{Args: []string{"s"}, Timeout: "5s"}}, false},
+		{"nothing configured", GitHubApp{}, true},
+		{"both configured", GitHubApp{PrivateKeyURI: "pkcs11:token=ci;object=app", SignerCommand: command}, true},
+		{"not a pkcs11 uri", GitHubApp{PrivateKeyURI: "file:///key.pem"}, true},
+		{"empty signer command", GitHubApp{SignerCommand: &SecretCommand{}}, true},
+		{"signer command with cache", GitHubApp{SignerCommand: &SecretCommand{Args: []string{"s"}, Cache: "1h"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app
+			app.Name, app.AppID, app.Patterns = "app", 1, []string{"github.com/org/*"}
+			app.PrivateKeySource = PrivateKeySourceSigner
+			if err := app.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("GitHubApp.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := GitHubApp{Name: "app", AppID: 1, PrivateKeySource: PrivateKeySourceSigner, SignerCommand: command}
+
+	if _, err := app.GetPrivateKey(secretMgr); !errors.Is(err, ErrExternalSigner) {
+		t.Errorf("GetPrivateKey() error = %v, want ErrExternalSigner", err)
+	}
+	if _, err := app.SetPrivateKey(secretMgr, "key"); err == nil {
+		t.Error("Expected error storing a key for a signer source")
+	}
+	if err := app.DeletePrivateKey(secretMgr); err != nil {
+		t.Errorf("DeletePrivateKey() error = %v", err)
+	}
+	if !app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() should be true for a configured signer command")
+	}
+
+	keySigner, err := app.OpenSigner()
+	if err != nil {
+		t.Fatalf("OpenSigner() error = %v", err)
+	}
+	if _, ok := keySigner.(*signer.CommandSigner); !ok {
+		t.Errorf("OpenSigner() = %T, want *signer.CommandSigner", keySigner)
+	}
+
+	t.Setenv(signer.PKCS11ModuleEnv, "")
+	app.SignerCommand, app.PrivateKeyURI = nil, "pkcs11:token=ci;object=app"
+	if _, err := app.OpenSigner(); err == nil {
+		t.Error("OpenSigner() should fail without a PKCS#11 module")
+	}
+	if app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() should be false when the signer cannot be opened")
+	}
+}
@@ -217,3 +217,17 @@ func TestConfig_GetAppCount(t *testing.T) {
 		t.Errorf("Expected 0 apps in empty config, got %d", count)
 	}
 }
+
+func TestPersonalAccessToken_Validate_APIURL(t *testing.T) {
+	pat := PersonalAccessToken{Name: "ghes-pat", Patterns: []string{"ghes.example.com/"}}
+
+	pat.APIURL = "https://ghes.example.com/api/v3"
+	if err := pat.Validate(); err != nil {
+		t.Errorf("Validate() with absolute api_url error = %v", err)
+	}
+
+	pat.APIURL = "/api/v3"
+	if err := pat.Validate(); err == nil {
+		t.Error("Expected error for relative api_url")
+	}
+}
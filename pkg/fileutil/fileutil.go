@@ -0,0 +1,42 @@
+// Package fileutil provides the file locking and atomic writes shared by the
+// caches and the configuration file, which several gh-app-auth processes may
+// update at once.
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is returned when a lock cannot be acquired in time
+var ErrLockTimeout = errors.New("timed out waiting for file lock")
+
+// lockPollInterval is the delay between lock acquisition attempts
+const lockPollInterval = 50 * time.Millisecond
+
+// WriteFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never see a partial file. The file is
+// created with mode 0600.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package hosts maps git hosts to the GitHub REST API endpoints that serve
+// them. It is the single place that knows how github.com, GHE.com data
+// residency tenants and GitHub Enterprise Server lay out their APIs.
+package hosts
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// GitHub is the git host of github.com
+	GitHub = "github.com"
+	// gitHubAPI is the REST endpoint of github.com
+	gitHubAPI = "https://api.github.com"
+	// tenancySuffix identifies GHE.com data residency tenants, whose API is
+	// served from api.<tenant>.ghe.com
+	tenancySuffix = ".ghe.com"
+)
+
+// Normalize returns the lowercase host of a repository URL, SSH remote,
+// pattern or bare host, without scheme, user information or path
+func Normalize(value string) string {
+	value = strings.TrimSpace(value)
+	if scheme := strings.Index(value, "://"); scheme >= 0 {
+		value = value[scheme+3:]
+	}
+	if at := strings.Index(value, "@"); at >= 0 && !strings.Contains(value[:at], "/") {
+		value = value[at+1:]
+	}
+	if end := strings.IndexAny(value, "/:"); end >= 0 {
+		// Keep a port (host:8443/...) but drop an SSH path (host:owner/repo)
+		if value[end] == ':' && isPort(value[end+1:]) {
+			if slash := strings.Index(value, "/"); slash >= 0 {
+				value = value[:slash]
+			}
+		} else {
+			value = value[:end]
+		}
+	}
+	return strings.ToLower(value)
+}
+
+// isPort reports whether s starts with a port number followed by a path or
+// nothing at all
+func isPort(s string) bool {
+	digits := 0
+	for digits < len(s) && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	return digits > 0 && (digits == len(s) || s[digits] == '/')
+}
+
+// IsTenancy reports whether host is a GHE.com data residency tenant
+func IsTenancy(host string) bool {
+	return strings.HasSuffix(Normalize(host), tenancySuffix)
+}
+
+// IsEnterpriseServer reports whether host is a GitHub Enterprise Server
+// instance, i.e. neither github.com nor a GHE.com tenant
+func IsEnterpriseServer(host string) bool {
+	host = Normalize(host)
+	return host != "" && host != GitHub && !IsTenancy(host)
+}
+
+// APIBaseURL returns the REST API base URL, without trailing slash, for a git
+// host:
+//
+//	github.com        -> https://api.github.com
+//	<tenant>.ghe.com  -> https://api.<tenant>.ghe.com
+//	ghes.example.com  -> https://ghes.example.com/api/v3
+//
+// An empty host resolves to github.com.
+func APIBaseURL(host string) string {
+	host = Normalize(host)
+	switch {
+	case host == "" || host == GitHub:
+		return gitHubAPI
+	case IsTenancy(host):
+		return fmt.Sprintf("https://api.%s", host)
+	default:
+		return fmt.Sprintf("https://%s/api/v3", host)
+	}
+}
+
+// Resolve returns apiURL, an explicit api_url from the configuration, when it
+// is set, and the API base URL derived from host otherwise. Use it for GHES
+// instances whose API is not served from /api/v3.
+func Resolve(apiURL, host string) string {
+	if apiURL = strings.TrimSpace(apiURL); apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/")
+	}
+	return APIBaseURL(host)
+}
@@ -0,0 +1,98 @@
+package hosts
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "github.com", want: "github.com"},
+		{value: "GitHub.com/Org/Repo", want: "github.com"},
+		{value: "https://github.com/org/repo.git", want: "github.com"},
+		{value: "git@github.com:org/repo.git", want: "github.com"},
+		{value: "ssh://git@ghes.example.com/org/repo", want: "ghes.example.com"},
+		{value: "https://ghes.example.com:8443/org/repo", want: "ghes.example.com:8443"},
+		{value: "octo.ghe.com/org/*", want: "octo.ghe.com"},
+		{value: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.value); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "github.com", host: "github.com", want: "https://api.github.com"},
+		{name: "github.com repository URL", host: "https://github.com/org/repo", want: "https://api.github.com"},
+		{name: "empty host", host: "", want: "https://api.github.com"},
+		{name: "GHES", host: "ghes.example.com", want: "https://ghes.example.com/api/v3"},
+		{name: "GHES with port", host: "ghes.example.com:8443", want: "https://ghes.example.com:8443/api/v3"},
+		{name: "ghe.com tenant", host: "octocorp.ghe.com", want: "https://api.octocorp.ghe.com"},
+		{name: "ghe.com tenant URL", host: "https://OctoCorp.ghe.com/org/repo", want: "https://api.octocorp.ghe.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := APIBaseURL(tt.host); got != tt.want {
+				t.Errorf("APIBaseURL(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiURL string
+		host   string
+		want   string
+	}{
+		{name: "derived for github.com", host: "github.com", want: "https://api.github.com"},
+		{name: "derived for GHES", host: "ghes.example.com", want: "https://ghes.example.com/api/v3"},
+		{name: "derived for ghe.com", host: "octocorp.ghe.com", want: "https://api.octocorp.ghe.com"},
+		{
+			name:   "explicit GHES path",
+			apiURL: "https://ghes.example.com/github/api/v3/",
+			host:   "ghes.example.com",
+			want:   "https://ghes.example.com/github/api/v3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.apiURL, tt.host); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %q, want %q", tt.apiURL, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostKinds(t *testing.T) {
+	tests := []struct {
+		host       string
+		tenancy    bool
+		enterprise bool
+	}{
+		{host: "github.com"},
+		{host: "octocorp.ghe.com", tenancy: true},
+		{host: "ghes.example.com", enterprise: true},
+		{host: ""},
+	}
+
+	for _, tt := range tests {
+		if got := IsTenancy(tt.host); got != tt.tenancy {
+			t.Errorf("IsTenancy(%q) = %v, want %v", tt.host, got, tt.tenancy)
+		}
+		if got := IsEnterpriseServer(tt.host); got != tt.enterprise {
+			t.Errorf("IsEnterpriseServer(%q) = %v, want %v", tt.host, got, tt.enterprise)
+		}
+	}
+}
@@ -52,6 +52,31 @@ func TestKeyCache(t *testing.T) {
 	}
 }
 
+func TestHasKey(t *testing.T) {
+	gen := NewGenerator()
+	appID := int64(123456)
+
+	if gen.HasKey(appID) {
+		t.Fatal("Expected no key before first use")
+	}
+
+	if _, err := gen.GenerateTokenFromKey(appID, generateTestKeyPEM(t)); err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+	if !gen.HasKey(appID) {
+		t.Fatal("Expected key to be held after first use")
+	}
+
+	// A held key is used without the key content being supplied again
+	token, err := gen.GenerateTokenFromKey(appID, "")
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKey() with held key error = %v", err)
+	}
+	if err := gen.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+}
+
 func TestMultipleApps(t *testing.T) {
 	gen := NewGenerator()
 
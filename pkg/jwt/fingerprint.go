@@ -0,0 +1,30 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of a public key, in the form
+// GitHub shows for App private keys (SHA256:<base64 digest of the DER key>)
+func Fingerprint(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	digest := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(digest[:]), nil
+}
+
+// KeyFingerprint parses a PEM-encoded RSA private key and returns the
+// fingerprint of its public key
+func KeyFingerprint(privateKeyContent string) (string, error) {
+	privateKey, err := NewGenerator().parsePrivateKey([]byte(privateKeyContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return Fingerprint(&privateKey.PublicKey)
+}
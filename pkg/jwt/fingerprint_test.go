@@ -0,0 +1,57 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate test key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	digest := sha256.Sum256(der)
+	want := "SHA256:" + base64.StdEncoding.EncodeToString(digest[:])
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to encode PKCS8 key: %v", err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER})
+
+	for name, content := range map[string][]byte{"PKCS1": pkcs1, "PKCS8": pkcs8} {
+		got, err := KeyFingerprint(string(content))
+		if err != nil {
+			t.Fatalf("KeyFingerprint(%s) error = %v", name, err)
+		}
+		if got != want {
+			t.Errorf("KeyFingerprint(%s) = %q, want %q", name, got, want)
+		}
+	}
+
+	other, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate test key: %v", err)
+	}
+	if got, _ := Fingerprint(&other.PublicKey); got == want {
+		t.Error("Different keys should have different fingerprints")
+	}
+}
+
+func TestKeyFingerprint_Errors(t *testing.T) {
+	if _, err := KeyFingerprint("not a key"); err == nil {
+		t.Error("Expected error for invalid key content")
+	}
+	if _, err := Fingerprint(&rsa.PublicKey{}); err == nil {
+		t.Error("Expected error for an invalid public key")
+	}
+}
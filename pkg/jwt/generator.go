@@ -19,7 +19,7 @@ import (
 
 type Generator struct {
 	// keyCache stores loaded keys in memory for the session
-	keyCache map[string]*rsa.PrivateKey
+	keyCache map[string]crypto.Signer
 	// mu protects keyCache from concurrent access
 	mu sync.RWMutex
 }
@@ -27,7 +27,7 @@ type Generator struct {
 // NewGenerator creates a new JWT token generator
 func NewGenerator() *Generator {
 	return &Generator{
-		keyCache: make(map[string]*rsa.PrivateKey),
+		keyCache: make(map[string]crypto.Signer),
 	}
 }
 
@@ -49,8 +49,15 @@ func (g *Generator) GenerateToken(appID int64, privateKeyPath string) (string, e
 
 // GenerateTokenFromKey generates a GitHub App JWT token from private key content
 func (g *Generator) GenerateTokenFromKey(appID int64, privateKeyContent string) (string, error) {
+	return g.GenerateTokenFromKeyID(appID, "", privateKeyContent)
+}
+
+// GenerateTokenFromKeyID generates a GitHub App JWT token from the content of
+// one of the app's keys, identified by keyID (its fingerprint). Parsed keys are
+// cached per app and key.
+func (g *Generator) GenerateTokenFromKeyID(appID int64, keyID, privateKeyContent string) (string, error) {
 	// Check cache first (read lock)
-	cacheKey := fmt.Sprintf("%d", appID)
+	cacheKey := keyCacheKey(appID, keyID)
 	g.mu.RLock()
 	cachedKey, exists := g.keyCache[cacheKey]
 	g.mu.RUnlock()
@@ -78,6 +85,39 @@ func (g *Generator) GenerateTokenFromKey(appID int64, privateKeyContent string)
 	return token, nil
 }
 
+// GenerateTokenWithSigner generates a GitHub App JWT token signed by signer,
+// such as a key held in a PKCS#11 token. The signer is not cached.
+func (g *Generator) GenerateTokenWithSigner(appID int64, signer crypto.Signer) (string, error) {
+	token, err := g.createJWT(appID, signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return token, nil
+}
+
+// HasKey reports whether a parsed private key for appID is held in memory, in
+// which case GenerateTokenFromKey does not need the key content again
+func (g *Generator) HasKey(appID int64) bool {
+	return g.HasKeyID(appID, "")
+}
+
+// HasKeyID reports whether the app's key identified by keyID is held in
+// memory, like HasKey
+func (g *Generator) HasKeyID(appID int64, keyID string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_, exists := g.keyCache[keyCacheKey(appID, keyID)]
+	return exists
+}
+
+// keyCacheKey identifies a parsed key; keyID is empty for an app's only key
+func keyCacheKey(appID int64, keyID string) string {
+	if keyID == "" {
+		return fmt.Sprintf("%d", appID)
+	}
+	return fmt.Sprintf("%d/%s", appID, keyID)
+}
+
 // loadPrivateKey loads and parses an RSA private key from a PEM file
 func (g *Generator) loadPrivateKey(keyPath string) (*rsa.PrivateKey, error) {
 	// Check file permissions before reading
@@ -144,8 +184,16 @@ func (g *Generator) parsePrivateKey(keyData []byte) (*rsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// createJWT creates a GitHub App JWT token
-func (g *Generator) createJWT(appID int64, privateKey *rsa.PrivateKey) (string, error) {
+// createJWT creates a GitHub App JWT token. The signer is usually the parsed
+// private key, but may keep the key outside process memory.
+func (g *Generator) createJWT(appID int64, signer crypto.Signer) (string, error) {
+	// Signers that cannot report their public key are assumed to be RSA
+	if public := signer.Public(); public != nil {
+		if _, ok := public.(*rsa.PublicKey); !ok {
+			return "", fmt.Errorf("GitHub App keys must be RSA, got %T", public)
+		}
+	}
+
 	// JWT Header
 	header := map[string]interface{}{
 		"alg": "RS256",
@@ -179,7 +227,7 @@ func (g *Generator) createJWT(appID int64, privateKey *rsa.PrivateKey) (string,
 	signingInput := headerB64 + "." + payloadB64
 
 	// Sign the token
-	signature, err := g.signRS256(signingInput, privateKey)
+	signature, err := g.signRS256(signingInput, signer)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign JWT: %w", err)
 	}
@@ -191,14 +239,14 @@ func (g *Generator) createJWT(appID int64, privateKey *rsa.PrivateKey) (string,
 }
 
 // signRS256 signs data using RS256 algorithm
-func (g *Generator) signRS256(data string, privateKey *rsa.PrivateKey) (string, error) {
+func (g *Generator) signRS256(data string, signer crypto.Signer) (string, error) {
 	// Create hash
 	hasher := sha256.New()
 	hasher.Write([]byte(data))
 	hash := hasher.Sum(nil)
 
 	// Sign hash
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash)
+	signature, err := signer.Sign(rand.Reader, hash, crypto.SHA256)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign: %w", err)
 	}
@@ -1,9 +1,14 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"os"
 	"path/filepath"
@@ -489,3 +494,44 @@ func TestTokenExpiration(t *testing.T) {
 		t.Errorf("Token expiration = %v, want %v (10 minutes after iat)", exp, expectedExp)
 	}
 }
+
+func TestGenerator_GenerateTokenWithSigner(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate test key: %v", err)
+	}
+
+	generator := NewGenerator()
+	token, err := generator.GenerateTokenWithSigner(12345, key)
+	if err != nil {
+		t.Fatalf("GenerateTokenWithSigner() error = %v", err)
+	}
+	if err := generator.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Signature does not verify: %v", err)
+	}
+
+	if generator.HasKey(12345) {
+		t.Error("Signers should not be cached")
+	}
+}
+
+func TestGenerator_GenerateTokenWithSigner_RejectsNonRSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate test key: %v", err)
+	}
+
+	if _, err := NewGenerator().GenerateTokenWithSigner(12345, key); err == nil {
+		t.Error("Expected error for a non-RSA signer")
+	}
+}
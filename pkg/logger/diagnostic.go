@@ -8,6 +8,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/paths"
 )
 
 // DiagnosticLogger provides conditional logging for debugging git credential flows
@@ -32,8 +34,7 @@ func Initialize() {
 	logPath := os.Getenv("GH_APP_AUTH_DEBUG_LOG")
 	if logPath == "" {
 		// Default log path
-		homeDir, _ := os.UserHomeDir()
-		logPath = filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth", "debug.log")
+		logPath = filepath.Join(paths.ConfigDir(), "debug.log")
 	}
 
 	// Ensure log directory exists
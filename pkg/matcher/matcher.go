@@ -36,6 +36,9 @@ type RepositoryInfo struct {
 // Match finds the best matching GitHub App for the given repository URL
 // Uses longest prefix matching - the app with the longest matching path prefix wins
 // If scope information is available, validates that the repo is within the app's installation scope
+//
+// Deprecated: Use resolver.Resolve, which also considers PATs, the
+// git-credential pattern hint and app selectors.
 func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
 	if len(m.apps) == 0 {
 		return nil, nil
@@ -110,6 +113,13 @@ func (m *Matcher) matchByHost(host string) *config.GitHubApp {
 	return nil
 }
 
+// InScope reports whether the repository at repoPath (host/owner/repo) is
+// within the app's cached installation scope. Apps without one cover every
+// repository.
+func InScope(app *config.GitHubApp, repoPath string) bool {
+	return app.Scope == nil || isInScope(repoPath, app.Scope)
+}
+
 // isInScope checks if a repository is within the app's installation scope
 func isInScope(repoPath string, scope *config.InstallationScope) bool {
 	if scope.RepositorySelection == "all" {
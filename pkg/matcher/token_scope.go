@@ -0,0 +1,73 @@
+package matcher
+
+import (
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/patterns"
+)
+
+// ResolveTokenScope returns the token scope to request for a repository.
+//
+// The app-level permissions and repositories apply by default. The pattern scope
+// with the longest prefix matching the repository overrides the fields it sets.
+// With narrow set, the scope is further restricted to the repository itself,
+// provided it is within the configured repositories (if any).
+func ResolveTokenScope(app *config.GitHubApp, repositoryURL string, narrow bool) config.TokenScope {
+	scope := config.TokenScope{
+		Permissions:  app.Permissions,
+		Repositories: app.Repositories,
+	}
+
+	repoInfo, err := parseRepositoryURL(repositoryURL)
+	if err != nil {
+		// Host-only targets cannot match pattern scopes or be narrowed
+		return scope
+	}
+
+	if patternScope := matchPatternScope(app.PatternScopes, repoInfo.FullPath); patternScope != nil {
+		if len(patternScope.Permissions) > 0 {
+			scope.Permissions = patternScope.Permissions
+		}
+		if len(patternScope.Repositories) > 0 {
+			scope.Repositories = patternScope.Repositories
+		}
+	}
+
+	if narrow && allowsRepository(scope, repoInfo.Repository) {
+		scope.Repositories = []string{repoInfo.Repository}
+	}
+
+	return scope
+}
+
+// matchPatternScope returns the pattern scope with the longest matching prefix,
+// matched like the app patterns that select the credential
+func matchPatternScope(patternScopes []config.PatternScope, repoPath string) *config.PatternScope {
+	var bestMatch *config.PatternScope
+	longestPrefixLen := 0
+
+	for i := range patternScopes {
+		prefix := patterns.Normalize(patternScopes[i].Pattern)
+		if prefix == "" || !patterns.HasPathPrefix(repoPath, prefix) {
+			continue
+		}
+		if len(prefix) > longestPrefixLen {
+			longestPrefixLen = len(prefix)
+			bestMatch = &patternScopes[i]
+		}
+	}
+
+	return bestMatch
+}
+
+// allowsRepository reports whether narrowing to repo stays within the scope
+func allowsRepository(scope config.TokenScope, repo string) bool {
+	if len(scope.Repositories) == 0 {
+		return true
+	}
+	for _, name := range scope.RepositoryNames() {
+		if name == repo {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestResolveTokenScope(t *testing.T) {
+	app := &config.GitHubApp{
+		Name:         "ci-app",
+		Permissions:  map[string]string{"contents": "read"},
+		Repositories: nil,
+		PatternScopes: []config.PatternScope{
+			{
+				Pattern:     "github.com/myorg/",
+				Permissions: map[string]string{"contents": "read", "pull_requests": "write"},
+			},
+			{
+				Pattern:      "github.com/infra/*",
+				Repositories: []string{"infra/live", "modules"},
+			},
+			{
+				Pattern:     "https://github.com/secure/*",
+				Permissions: map[string]string{"contents": "write"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		repoURL          string
+		narrow           bool
+		wantPermissions  map[string]string
+		wantRepositories []string
+	}{
+		{
+			name:            "app defaults outside pattern scopes",
+			repoURL:         "https://github.com/otherorg/repo",
+			wantPermissions: map[string]string{"contents": "read"},
+		},
+		{
+			name:            "pattern scope overrides permissions",
+			repoURL:         "https://github.com/myorg/service",
+			wantPermissions: map[string]string{"contents": "read", "pull_requests": "write"},
+		},
+		{
+			name:             "longest pattern scope overrides repositories only",
+			repoURL:          "https://github.com/infra/live",
+			wantPermissions:  map[string]string{"contents": "read"},
+			wantRepositories: []string{"infra/live", "modules"},
+		},
+		{
+			name:             "narrow to repository",
+			repoURL:          "https://github.com/myorg/service.git",
+			narrow:           true,
+			wantPermissions:  map[string]string{"contents": "read", "pull_requests": "write"},
+			wantRepositories: []string{"service"},
+		},
+		{
+			name:             "narrow within configured repositories",
+			repoURL:          "https://github.com/infra/modules",
+			narrow:           true,
+			wantPermissions:  map[string]string{"contents": "read"},
+			wantRepositories: []string{"modules"},
+		},
+		{
+			name:             "narrow outside configured repositories keeps the list",
+			repoURL:          "https://github.com/infra/other",
+			narrow:           true,
+			wantPermissions:  map[string]string{"contents": "read"},
+			wantRepositories: []string{"infra/live", "modules"},
+		},
+		{
+			name:            "pattern scope ends at an owner boundary",
+			repoURL:         "https://github.com/myorg-evil/repo",
+			wantPermissions: map[string]string{"contents": "read"},
+		},
+		{
+			name:            "pattern scope with a scheme",
+			repoURL:         "https://github.com/secure/repo",
+			wantPermissions: map[string]string{"contents": "write"},
+		},
+		{
+			name:            "host-only target is not narrowed",
+			repoURL:         "github.com",
+			narrow:          true,
+			wantPermissions: map[string]string{"contents": "read"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := ResolveTokenScope(app, tt.repoURL, tt.narrow)
+			if !reflect.DeepEqual(scope.Permissions, tt.wantPermissions) {
+				t.Errorf("Permissions = %v, want %v", scope.Permissions, tt.wantPermissions)
+			}
+			if !reflect.DeepEqual(scope.Repositories, tt.wantRepositories) {
+				t.Errorf("Repositories = %v, want %v", scope.Repositories, tt.wantRepositories)
+			}
+		})
+	}
+}
+
+func TestResolveTokenScope_Unscoped(t *testing.T) {
+	app := &config.GitHubApp{Name: "plain-app"}
+
+	scope := ResolveTokenScope(app, "https://github.com/org/repo", false)
+	if !scope.IsEmpty() {
+		t.Errorf("Expected empty scope, got %+v", scope)
+	}
+}
@@ -0,0 +1,169 @@
+// Package paths resolves where gh-app-auth keeps its configuration, secrets
+// and caches. It is the single place that knows the extension's directory,
+// which lives in the GitHub CLI's configuration directory and follows gh's
+// rules for finding it.
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// ConfigFileEnv selects the configuration file, like --config
+	ConfigFileEnv = "GH_APP_AUTH_CONFIG"
+	// GHConfigDirEnv overrides gh's configuration directory
+	GHConfigDirEnv = "GH_CONFIG_DIR"
+	// XDGConfigHomeEnv is the XDG base directory for configuration files
+	XDGConfigHomeEnv = "XDG_CONFIG_HOME"
+	// SystemConfigFileEnv overrides the machine-wide configuration file
+	SystemConfigFileEnv = "GH_APP_AUTH_SYSTEM_CONFIG"
+	// RepositoryConfigFileName is the configuration file a repository may
+	// commit at the root of its working tree
+	RepositoryConfigFileName = ".gh-app-auth.yml"
+
+	appDataEnv     = "AppData"
+	programDataEnv = "ProgramData"
+	extensionName  = "gh-app-auth"
+	configFile     = "config.yml"
+)
+
+var (
+	mu             sync.RWMutex
+	configFileFlag string
+)
+
+// SetConfigFile records the configuration file given with the global --config
+// flag. Unlike GH_APP_AUTH_CONFIG, the flag also moves the secrets fallback
+// directory and the caches next to the file, so each file is a self-contained
+// profile. An empty path restores the defaults.
+func SetConfigFile(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	configFileFlag = path
+}
+
+// GHConfigDir returns the GitHub CLI's configuration directory: GH_CONFIG_DIR,
+// $XDG_CONFIG_HOME/gh, %AppData%\GitHub CLI on Windows, or ~/.config/gh.
+//
+// Earlier releases always used ~/.config/gh, so an extension directory there
+// is kept until the directory gh's rules select has one of its own.
+func GHConfigDir() string {
+	homeDir, _ := os.UserHomeDir()
+	legacyDir := filepath.Join(homeDir, ".config", "gh")
+
+	dir := legacyDir
+	if envDir := os.Getenv(GHConfigDirEnv); envDir != "" {
+		dir = expandHome(envDir)
+	} else if xdgDir := os.Getenv(XDGConfigHomeEnv); xdgDir != "" {
+		dir = filepath.Join(expandHome(xdgDir), "gh")
+	} else if appData := os.Getenv(appDataEnv); runtime.GOOS == "windows" && appData != "" {
+		dir = filepath.Join(appData, "GitHub CLI")
+	}
+
+	if dir != legacyDir && !hasExtensionDir(dir) && hasExtensionDir(legacyDir) {
+		return legacyDir
+	}
+	return dir
+}
+
+// hasExtensionDir reports whether ghConfigDir holds the extension's directory
+func hasExtensionDir(ghConfigDir string) bool {
+	info, err := os.Stat(filepath.Join(ghConfigDir, "extensions", extensionName))
+	return err == nil && info.IsDir()
+}
+
+// ConfigDir returns the extension's directory, which holds its default
+// configuration file, filesystem secrets, caches, agent socket and debug log
+func ConfigDir() string {
+	mu.RLock()
+	flag := configFileFlag
+	mu.RUnlock()
+	if flag != "" {
+		return filepath.Dir(absolute(expandHome(flag)))
+	}
+	return filepath.Join(GHConfigDir(), "extensions", extensionName)
+}
+
+// ConfigFile returns the configuration file: --config, GH_APP_AUTH_CONFIG, or
+// config.yml in ConfigDir
+func ConfigFile() string {
+	mu.RLock()
+	flag := configFileFlag
+	mu.RUnlock()
+	if flag != "" {
+		return absolute(expandHome(flag))
+	}
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return absolute(expandHome(path))
+	}
+	return filepath.Join(ConfigDir(), configFile)
+}
+
+// SystemConfigFile returns the machine-wide configuration file:
+// GH_APP_AUTH_SYSTEM_CONFIG, %ProgramData%\gh-app-auth\config.yml on Windows,
+// or /etc/gh-app-auth/config.yml
+func SystemConfigFile() string {
+	if path := os.Getenv(SystemConfigFileEnv); path != "" {
+		return absolute(expandHome(path))
+	}
+	if programData := os.Getenv(programDataEnv); runtime.GOOS == "windows" && programData != "" {
+		return filepath.Join(programData, extensionName, configFile)
+	}
+	return filepath.Join("/etc", extensionName, configFile)
+}
+
+// RepositoryConfigFile returns the repository configuration file at the root
+// of the git working tree containing the current directory, or "" outside a
+// working tree. The file may not exist.
+func RepositoryConfigFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return filepath.Join(dir, RepositoryConfigFileName)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// SecretsDir returns the directory secrets are kept in when they are not
+// stored in the OS keyring
+func SecretsDir() string {
+	return ConfigDir()
+}
+
+// CacheDir returns the directory of the token, installation and identity
+// caches
+func CacheDir() string {
+	return filepath.Join(ConfigDir(), "cache")
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
+// absolute returns path made absolute, or path itself if that fails
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
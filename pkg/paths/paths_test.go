@@ -0,0 +1,173 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestConfigDir(t *testing.T) {
+	home := t.TempDir()
+
+	tests := []struct {
+		name          string
+		ghConfigDir   string
+		xdgConfigHome string
+		want          string
+	}{
+		{
+			name: "default",
+			want: filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth"),
+		},
+		{
+			name:          "XDG_CONFIG_HOME",
+			xdgConfigHome: "/xdg",
+			want:          filepath.Join("/xdg", "gh", "extensions", "gh-app-auth"),
+		},
+		{
+			name:          "GH_CONFIG_DIR wins over XDG_CONFIG_HOME",
+			ghConfigDir:   "/gh-config",
+			xdgConfigHome: "/xdg",
+			want:          filepath.Join("/gh-config", "extensions", "gh-app-auth"),
+		},
+		{
+			name:        "GH_CONFIG_DIR with tilde",
+			ghConfigDir: "~/gh",
+			want:        filepath.Join(home, "gh", "extensions", "gh-app-auth"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" {
+				t.Skip("default directory differs on Windows")
+			}
+			t.Setenv("HOME", home)
+			t.Setenv(GHConfigDirEnv, tt.ghConfigDir)
+			t.Setenv(XDGConfigHomeEnv, tt.xdgConfigHome)
+			t.Setenv(ConfigFileEnv, "")
+
+			if got := ConfigDir(); got != tt.want {
+				t.Errorf("ConfigDir() = %q, want %q", got, tt.want)
+			}
+			if got := ConfigFile(); got != filepath.Join(tt.want, "config.yml") {
+				t.Errorf("ConfigFile() = %q, want config.yml in %q", got, tt.want)
+			}
+			if got := SecretsDir(); got != tt.want {
+				t.Errorf("SecretsDir() = %q, want %q", got, tt.want)
+			}
+			if got := CacheDir(); got != filepath.Join(tt.want, "cache") {
+				t.Errorf("CacheDir() = %q, want cache in %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGHConfigDir_LegacyDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("default directory differs on Windows")
+	}
+	home := t.TempDir()
+	legacyDir := filepath.Join(home, ".config", "gh")
+	if err := os.MkdirAll(filepath.Join(legacyDir, "extensions", "gh-app-auth"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	migrated := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(migrated, "gh", "extensions", "gh-app-auth"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ghConfigDir   string
+		xdgConfigHome string
+		want          string
+	}{
+		{
+			name:          "XDG_CONFIG_HOME without an extension directory",
+			xdgConfigHome: "/xdg",
+			want:          legacyDir,
+		},
+		{
+			name:        "GH_CONFIG_DIR without an extension directory",
+			ghConfigDir: "/gh-config",
+			want:        legacyDir,
+		},
+		{
+			name:          "XDG_CONFIG_HOME with an extension directory",
+			xdgConfigHome: migrated,
+			want:          filepath.Join(migrated, "gh"),
+		},
+		{
+			name:        "GH_CONFIG_DIR with an extension directory",
+			ghConfigDir: filepath.Join(migrated, "gh"),
+			want:        filepath.Join(migrated, "gh"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			t.Setenv(GHConfigDirEnv, tt.ghConfigDir)
+			t.Setenv(XDGConfigHomeEnv, tt.xdgConfigHome)
+
+			if got := GHConfigDir(); got != tt.want {
+				t.Errorf("GHConfigDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFile_Overrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(GHConfigDirEnv, "")
+	t.Setenv(XDGConfigHomeEnv, "")
+	defaultDir := ConfigDir()
+
+	// GH_APP_AUTH_CONFIG only selects the file
+	envFile := filepath.Join(home, "env", "config.yml")
+	t.Setenv(ConfigFileEnv, envFile)
+	if got := ConfigFile(); got != envFile {
+		t.Errorf("ConfigFile() = %q, want %q", got, envFile)
+	}
+	if got := SecretsDir(); got != defaultDir {
+		t.Errorf("SecretsDir() = %q, want the default %q", got, defaultDir)
+	}
+
+	// --config wins and moves secrets and caches next to the file
+	SetConfigFile("~/profiles/ci/config.yml")
+	t.Cleanup(func() { SetConfigFile("") })
+	profileDir := filepath.Join(home, "profiles", "ci")
+	if got := ConfigFile(); got != filepath.Join(profileDir, "config.yml") {
+		t.Errorf("ConfigFile() = %q, want config.yml in %q", got, profileDir)
+	}
+	if got := SecretsDir(); got != profileDir {
+		t.Errorf("SecretsDir() = %q, want %q", got, profileDir)
+	}
+	if got := CacheDir(); got != filepath.Join(profileDir, "cache") {
+		t.Errorf("CacheDir() = %q, want cache in %q", got, profileDir)
+	}
+}
+
+func TestRepositoryConfigFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "src", "pkg")
+	if err := os.MkdirAll(nested, 0700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	t.Chdir(nested)
+	if got := RepositoryConfigFile(); got != "" && filepath.Dir(got) == root {
+		t.Errorf("RepositoryConfigFile() outside a working tree = %q", got)
+	}
+
+	// A .git file marks worktrees and submodules
+	if err := os.WriteFile(filepath.Join(root, ".git"), []byte("gitdir: elsewhere\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if got, want := RepositoryConfigFile(), filepath.Join(root, RepositoryConfigFileName); got != want {
+		t.Errorf("RepositoryConfigFile() = %q, want %q", got, want)
+	}
+}
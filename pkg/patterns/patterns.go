@@ -0,0 +1,33 @@
+// Package patterns matches repository paths against the URL prefixes
+// configured as app and PAT patterns. Credential resolution, token scopes and
+// repository configuration files all match patterns through it, so they agree
+// on what a pattern covers.
+package patterns
+
+import "strings"
+
+// Normalize strips the scheme and trailing "/*" of a pattern, leaving a prefix
+// such as github.com/myorg
+func Normalize(pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	pattern = strings.TrimPrefix(pattern, "https://")
+	pattern = strings.TrimPrefix(pattern, "http://")
+	return strings.TrimSuffix(pattern, "/*")
+}
+
+// HasPathPrefix reports whether path starts with prefix at a segment boundary:
+// github.com/myorg covers github.com/myorg/repo but not github.com/myorg-evil/repo,
+// and github.com does not cover github.com.evil.net
+func HasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// Covers reports whether pattern matches path, a normalized repository path
+// such as github.com/myorg/repo
+func Covers(pattern, path string) bool {
+	prefix := Normalize(pattern)
+	return prefix != "" && HasPathPrefix(path, prefix)
+}
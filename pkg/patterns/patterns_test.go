@@ -0,0 +1,41 @@
+package patterns
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"github.com/myorg/*":         "github.com/myorg",
+		"https://github.com/myorg/*": "github.com/myorg",
+		" http://ghes.example.com/ ": "ghes.example.com/",
+		"github.com/myorg/repo":      "github.com/myorg/repo",
+		"https://github.com/*":       "github.com",
+		"":                           "",
+	}
+	for pattern, want := range tests {
+		if got := Normalize(pattern); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"github.com/myorg/*", "github.com/myorg/repo", true},
+		{"https://github.com/myorg/*", "github.com/myorg/repo", true},
+		{"github.com/myorg/", "github.com/myorg/repo", true},
+		{"github.com/myorg", "github.com/myorg", true},
+		{"github.com/myorg/*", "github.com/myorg-evil/repo", false},
+		{"github.com/*", "github.com.evil.net/org/repo", false},
+		{"github.com", "github.com.evil.net", false},
+		{"", "github.com/myorg/repo", false},
+	}
+	for _, tt := range tests {
+		if got := Covers(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package resolver chooses the credential, a GitHub App or a personal access
+// token, that serves a request. git-credential, exec, test and every other
+// command resolve through it, so they always agree on the credential.
+//
+// Precedence:
+//
+//  1. Selectors. With an app or installation ID, only the GitHub Apps with
+//     those IDs are candidates and PATs never are. Several candidates are
+//     told apart by the repository URL as in rule 3, and are ambiguous
+//     without one.
+//  2. Pattern hint. git-credential is registered per URL prefix with
+//     --pattern. When git asks about a URL less specific than that prefix
+//     (a bare host), the prefix stands in for the URL. A URL within the
+//     prefix is resolved on its own, as any other command would, and a URL
+//     outside it gets no credential from that helper.
+//  3. Longest prefix. Every pattern of every GitHub App and PAT is compared
+//     with the URL, normalized to host/owner/repo. Patterns are compared
+//     without their scheme and trailing "/*". The longest matching pattern
+//     wins. Apps whose cached installation scope excludes the repository are
+//     skipped.
+//  4. Ties. Between patterns of the same length, the highest priority wins,
+//     then GitHub Apps over PATs, then the entry listed first.
+//  5. Host. A bare host that no pattern covers is served by the first GitHub
+//     App with a pattern on that host.
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/patterns"
+)
+
+// ErrAmbiguous is returned when selectors match several GitHub Apps and the
+// request has no repository URL that tells them apart
+var ErrAmbiguous = errors.New("multiple GitHub App configurations match")
+
+// Request describes what a credential is needed for
+type Request struct {
+	// URL is the repository, as https://host/owner/repo, git@host:owner/repo
+	// or host/owner/repo. It may be a bare host, or empty with selectors.
+	URL string
+	// Pattern is the URL prefix git-credential was registered for (--pattern)
+	Pattern string
+	// AppID and InstallationID select configured GitHub Apps
+	AppID          int64
+	InstallationID int64
+}
+
+// Rule names the precedence rule that decided
+type Rule string
+
+const (
+	RuleSelector      Rule = "selector"
+	RulePatternHint   Rule = "pattern hint"
+	RuleLongestPrefix Rule = "longest prefix"
+	RuleHost          Rule = "host"
+)
+
+// Decision is the credential chosen for a request. At most one of App and PAT
+// is set; neither is when nothing matched.
+type Decision struct {
+	App *config.GitHubApp
+	PAT *config.PersonalAccessToken
+	// Pattern is the configured pattern that matched, empty when the app was
+	// chosen by its IDs alone
+	Pattern string
+	Rule    Rule
+}
+
+// Found reports whether a credential was chosen
+func (d Decision) Found() bool {
+	return d.App != nil || d.PAT != nil
+}
+
+// String describes the decision for diagnostics
+func (d Decision) String() string {
+	switch {
+	case d.App != nil && d.Pattern != "":
+		return fmt.Sprintf("GitHub App %q (ID: %d) by %s %q", d.App.Name, d.App.AppID, d.Rule, d.Pattern)
+	case d.App != nil:
+		return fmt.Sprintf("GitHub App %q (ID: %d) by %s", d.App.Name, d.App.AppID, d.Rule)
+	case d.PAT != nil:
+		return fmt.Sprintf("PAT %q by %s %q", d.PAT.Name, d.Rule, d.Pattern)
+	}
+	return "no credential"
+}
+
+// Resolve chooses the credential for request among those of cfg. The returned
+// app or PAT points into cfg. An unmatched request is not an error.
+func Resolve(cfg *config.Config, request Request) (Decision, error) {
+	apps := make([]*config.GitHubApp, len(cfg.GitHubApps))
+	for i := range cfg.GitHubApps {
+		apps[i] = &cfg.GitHubApps[i]
+	}
+	if request.AppID != 0 || request.InstallationID != 0 {
+		return resolveSelectors(apps, request)
+	}
+
+	pats := make([]*config.PersonalAccessToken, len(cfg.PATs))
+	for i := range cfg.PATs {
+		pats[i] = &cfg.PATs[i]
+	}
+	target, rule := resolveTarget(request)
+	if target == "" {
+		return Decision{}, nil
+	}
+	if decision := longestPrefix(apps, pats, target); decision.Found() {
+		if rule != "" {
+			decision.Rule = rule
+		}
+		return decision, nil
+	}
+	if !strings.Contains(target, "/") {
+		return matchHost(apps, target), nil
+	}
+	return Decision{}, nil
+}
+
+// resolveSelectors chooses among the apps with the requested IDs (rule 1)
+func resolveSelectors(apps []*config.GitHubApp, request Request) (Decision, error) {
+	candidates := selectorCandidates(apps, request)
+	switch {
+	case len(candidates) == 0:
+		return Decision{}, fmt.Errorf("no configured GitHub App matches %s", describeSelectors(request))
+	case len(candidates) == 1:
+		return Decision{App: candidates[0], Rule: RuleSelector}, nil
+	}
+
+	if request.URL != "" {
+		if decision := longestPrefix(candidates, nil, repositoryPath(request.URL)); decision.Found() {
+			return decision, nil
+		}
+	}
+	return Decision{}, fmt.Errorf("%w %s", ErrAmbiguous, describeSelectors(request))
+}
+
+// selectorCandidates returns the apps with the requested IDs. With both IDs,
+// apps with another installation are still candidates when none has it, so
+// that a token can be requested for any installation of a configured app.
+func selectorCandidates(apps []*config.GitHubApp, request Request) []*config.GitHubApp {
+	var candidates, exact []*config.GitHubApp
+	for _, app := range apps {
+		if request.AppID != 0 && app.AppID != request.AppID {
+			continue
+		}
+		if request.AppID == 0 && app.InstallationID != request.InstallationID {
+			continue
+		}
+		candidates = append(candidates, app)
+		if request.InstallationID != 0 && app.InstallationID == request.InstallationID {
+			exact = append(exact, app)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return candidates
+}
+
+// describeSelectors names the IDs of a request for error messages
+func describeSelectors(request Request) string {
+	switch {
+	case request.AppID != 0 && request.InstallationID != 0:
+		return fmt.Sprintf("app ID %d and installation ID %d", request.AppID, request.InstallationID)
+	case request.AppID != 0:
+		return fmt.Sprintf("app ID %d", request.AppID)
+	default:
+		return fmt.Sprintf("installation ID %d", request.InstallationID)
+	}
+}
+
+// resolveTarget returns the normalized path to match patterns against, and
+// RulePatternHint when the pattern hint stands in for the URL (rule 2). The
+// path is empty when the URL is outside the hint.
+func resolveTarget(request Request) (string, Rule) {
+	target := repositoryPath(request.URL)
+	hint := patterns.Normalize(request.Pattern)
+	switch {
+	case hint == "" || patterns.HasPathPrefix(target, hint):
+		return target, ""
+	case target == "" || strings.HasPrefix(hint, target+"/"):
+		// The hint covers everything below it
+		return strings.TrimSuffix(hint, "/") + "/", RulePatternHint
+	}
+	return "", ""
+}
+
+// longestPrefix chooses the app or PAT with the longest pattern matching
+// target (rules 3 and 4)
+func longestPrefix(apps []*config.GitHubApp, pats []*config.PersonalAccessToken, target string) Decision {
+	var best Decision
+	bestLength, bestPriority := 0, 0
+
+	consider := func(pattern string, priority int, decide func() Decision) {
+		prefix := patterns.Normalize(pattern)
+		if prefix == "" || !patterns.HasPathPrefix(target, prefix) {
+			return
+		}
+		if len(prefix) > bestLength || (len(prefix) == bestLength && priority > bestPriority) {
+			best = decide()
+			best.Pattern = pattern
+			bestLength, bestPriority = len(prefix), priority
+		}
+	}
+
+	for _, app := range apps {
+		if !matcher.InScope(app, target) {
+			continue
+		}
+		for _, pattern := range app.Patterns {
+			consider(pattern, app.Priority, func() Decision {
+				return Decision{App: app, Rule: RuleLongestPrefix}
+			})
+		}
+	}
+	for _, pat := range pats {
+		for _, pattern := range pat.Patterns {
+			consider(pattern, pat.Priority, func() Decision {
+				return Decision{PAT: pat, Rule: RuleLongestPrefix}
+			})
+		}
+	}
+	return best
+}
+
+// matchHost chooses the first app with a pattern on host (rule 5)
+func matchHost(apps []*config.GitHubApp, host string) Decision {
+	for _, app := range apps {
+		for _, pattern := range app.Patterns {
+			prefix := patterns.Normalize(pattern)
+			if prefix == host || strings.HasPrefix(prefix, host+"/") {
+				return Decision{App: app, Pattern: pattern, Rule: RuleHost}
+			}
+		}
+	}
+	return Decision{}
+}
+
+// repositoryPath normalizes a repository URL to host/owner/repo, or a bare
+// URL to its host
+func repositoryPath(repoURL string) string {
+	repoURL = strings.TrimSpace(repoURL)
+	if repoURL == "" {
+		return ""
+	}
+	if info, err := matcher.GetRepositoryInfo(repoURL); err == nil {
+		return info.FullPath
+	}
+	return strings.TrimSuffix(patterns.Normalize(repoURL), "/")
+}
@@ -0,0 +1,121 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil"
+)
+
+func TestResolve_Conformance(t *testing.T) {
+	for _, tt := range testutil.ResolutionCases() {
+		t.Run(tt.Name, func(t *testing.T) {
+			cfg := testutil.ResolutionConfig()
+			decision, err := Resolve(cfg, Request{
+				URL: tt.URL, Pattern: tt.Pattern, AppID: tt.AppID, InstallationID: tt.InstallationID,
+			})
+			if tt.WantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.WantErr) {
+					t.Fatalf("Resolve() error = %v, want containing %q", err, tt.WantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			var gotApp, gotPAT string
+			if decision.App != nil {
+				gotApp = decision.App.Name
+			}
+			if decision.PAT != nil {
+				gotPAT = decision.PAT.Name
+			}
+			if gotApp != tt.WantApp || gotPAT != tt.WantPAT {
+				t.Errorf("Resolve() = %s, want app %q, PAT %q", decision, tt.WantApp, tt.WantPAT)
+			}
+		})
+	}
+}
+
+func TestResolve_Decision(t *testing.T) {
+	cfg := testutil.ResolutionConfig()
+
+	tests := []struct {
+		name        string
+		request     Request
+		wantRule    Rule
+		wantPattern string
+	}{
+		{
+			name:        "longest prefix",
+			request:     Request{URL: "https://ghes.example.com/team/repo"},
+			wantRule:    RuleLongestPrefix,
+			wantPattern: "https://ghes.example.com/team/*",
+		},
+		{
+			name:        "pattern hint",
+			request:     Request{URL: "github.com", Pattern: "https://github.com/org-b"},
+			wantRule:    RulePatternHint,
+			wantPattern: "github.com/org-b/",
+		},
+		{
+			name:     "selector",
+			request:  Request{AppID: 400},
+			wantRule: RuleSelector,
+		},
+		{
+			name:        "host",
+			request:     Request{URL: "https://ghes.example.com/"},
+			wantRule:    RuleHost,
+			wantPattern: "https://ghes.example.com/team/*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := Resolve(cfg, tt.request)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if decision.Rule != tt.wantRule || decision.Pattern != tt.wantPattern {
+				t.Errorf("Resolve() = %s, want rule %q and pattern %q", decision, tt.wantRule, tt.wantPattern)
+			}
+		})
+	}
+}
+
+func TestResolve_PointsIntoConfig(t *testing.T) {
+	cfg := testutil.ResolutionConfig()
+	before := make([]string, len(cfg.GitHubApps))
+	for i, app := range cfg.GitHubApps {
+		before[i] = app.Name
+	}
+
+	decision, err := Resolve(cfg, Request{URL: "https://github.com/org-b/repo", Pattern: "https://github.com/org-b"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if decision.App != &cfg.GitHubApps[1] {
+		t.Errorf("Resolve() app = %p, want a pointer to the configured entry", decision.App)
+	}
+	for i, app := range cfg.GitHubApps {
+		if app.Name != before[i] {
+			t.Fatalf("Resolve() reordered the configuration: %q at %d, want %q", app.Name, i, before[i])
+		}
+	}
+}
+
+func TestResolve_AmbiguousError(t *testing.T) {
+	cfg := &config.Config{GitHubApps: []config.GitHubApp{
+		{Name: "a", AppID: 1, InstallationID: 10, Patterns: []string{"github.com/a/"}},
+		{Name: "b", AppID: 1, InstallationID: 20, Patterns: []string{"github.com/b/"}},
+	}}
+
+	_, err := Resolve(cfg, Request{URL: "github.com/c/repo", AppID: 1})
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Resolve() error = %v, want %v", err, ErrAmbiguous)
+	}
+}
@@ -2,15 +2,19 @@ package scope
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/transport"
 	"github.com/cli/go-gh/v2/pkg/api"
 )
 
 // Manager handles installation scope detection and caching
 type Manager struct {
 	clientFactory func(api.ClientOptions) (*api.RESTClient, error)
+	// transport builds HTTP clients honouring per-host proxy and TLS settings
+	transport *transport.Factory
 }
 
 // NewManager creates a new scope manager
@@ -20,22 +24,25 @@ func NewManager() *Manager {
 	}
 }
 
-// FetchScope retrieves and caches installation scope information
+// SetTransport makes API requests use the proxy, TLS and timeout settings
+// configured for their host
+func (m *Manager) SetTransport(factory *transport.Factory) {
+	m.transport = factory
+}
+
+// FetchScope retrieves and caches installation scope information. The API is
+// reached at the app's api_url, or at the REST endpoint of its patterns' host.
 func (m *Manager) FetchScope(app *config.GitHubApp, jwtToken string) error {
+	apiBaseURL := app.APIBaseURL("")
+
 	// Create API client with JWT
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "Bearer " + jwtToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
+	client, err := m.newClient(apiBaseURL, "Bearer", jwtToken)
 	if err != nil {
 		return fmt.Errorf("failed to create API client: %w", err)
 	}
 
 	// Fetch installation details
-	installation, err := m.getInstallation(client, app.InstallationID)
+	installation, err := m.getInstallation(client, apiBaseURL, app.InstallationID)
 	if err != nil {
 		return fmt.Errorf("failed to get installation: %w", err)
 	}
@@ -52,7 +59,7 @@ func (m *Manager) FetchScope(app *config.GitHubApp, jwtToken string) error {
 
 	// If "selected", fetch repository list
 	if installation.RepositorySelection == "selected" {
-		repos, err := m.getRepositories(app.InstallationID, jwtToken)
+		repos, err := m.getRepositories(apiBaseURL, app.InstallationID, jwtToken)
 		if err != nil {
 			return fmt.Errorf("failed to get repositories: %w", err)
 		}
@@ -63,10 +70,38 @@ func (m *Manager) FetchScope(app *config.GitHubApp, jwtToken string) error {
 	return nil
 }
 
+// newClient creates a REST client for apiBaseURL that authenticates with the
+// given scheme ("Bearer" for JWTs, "token" for installation tokens)
+func (m *Manager) newClient(apiBaseURL, scheme, token string) (*api.RESTClient, error) {
+	u, err := url.Parse(apiBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL %q: %w", apiBaseURL, err)
+	}
+	httpClient, err := m.transport.Client(apiBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setting Host and AuthToken stops go-gh from resolving gh's own
+	// credentials; the explicit Authorization header takes precedence
+	return m.clientFactory(api.ClientOptions{
+		Headers: map[string]string{
+			"Authorization": scheme + " " + token,
+			"Accept":        "application/vnd.github+json",
+		},
+		Host:      u.Hostname(),
+		AuthToken: token,
+		Transport: httpClient.Transport,
+		Timeout:   httpClient.Timeout,
+	})
+}
+
 // getInstallation fetches installation metadata
-func (m *Manager) getInstallation(client *api.RESTClient, installationID int64) (*InstallationResponse, error) {
+func (m *Manager) getInstallation(
+	client *api.RESTClient, apiBaseURL string, installationID int64,
+) (*InstallationResponse, error) {
 	var installation InstallationResponse
-	err := client.Get(fmt.Sprintf("app/installations/%d", installationID), &installation)
+	err := client.Get(fmt.Sprintf("%s/app/installations/%d", apiBaseURL, installationID), &installation)
 	if err != nil {
 		return nil, err
 	}
@@ -74,22 +109,18 @@ func (m *Manager) getInstallation(client *api.RESTClient, installationID int64)
 }
 
 // getRepositories fetches repository list for "selected" installations
-func (m *Manager) getRepositories(installationID int64, jwtToken string) ([]config.RepositoryInfo, error) {
+func (m *Manager) getRepositories(
+	apiBaseURL string, installationID int64, jwtToken string,
+) ([]config.RepositoryInfo, error) {
 	// This requires an installation access token, not JWT
 	// We need to generate one first
-	installToken, err := m.getInstallationToken(jwtToken, installationID)
+	installToken, err := m.getInstallationToken(apiBaseURL, jwtToken, installationID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create client with installation token
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "token " + installToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
+	client, err := m.newClient(apiBaseURL, "token", installToken)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +133,7 @@ func (m *Manager) getRepositories(installationID int64, jwtToken string) ([]conf
 	for {
 		var response RepositoriesResponse
 		err := client.Get(
-			fmt.Sprintf("installation/repositories?per_page=%d&page=%d", perPage, page),
+			fmt.Sprintf("%s/installation/repositories?per_page=%d&page=%d", apiBaseURL, perPage, page),
 			&response,
 		)
 		if err != nil {
@@ -127,14 +158,8 @@ func (m *Manager) getRepositories(installationID int64, jwtToken string) ([]conf
 }
 
 // getInstallationToken exchanges JWT for installation access token
-func (m *Manager) getInstallationToken(jwtToken string, installationID int64) (string, error) {
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "Bearer " + jwtToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
+func (m *Manager) getInstallationToken(apiBaseURL, jwtToken string, installationID int64) (string, error) {
+	client, err := m.newClient(apiBaseURL, "Bearer", jwtToken)
 	if err != nil {
 		return "", err
 	}
@@ -144,7 +169,7 @@ func (m *Manager) getInstallationToken(jwtToken string, installationID int64) (s
 	}
 
 	err = client.Post(
-		fmt.Sprintf("app/installations/%d/access_tokens", installationID),
+		fmt.Sprintf("%s/app/installations/%d/access_tokens", apiBaseURL, installationID),
 		nil,
 		&response,
 	)
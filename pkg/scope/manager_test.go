@@ -1,6 +1,9 @@
 package scope
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -182,3 +185,52 @@ func TestManager_FetchScope_Selected(t *testing.T) {
 // Note: Full integration tests with HTTP mocking are complex due to go-gh's internal auth requirements.
 // The NeedsRefresh and data structure tests above provide good coverage of the core logic.
 // Integration tests should be done manually or with real GitHub API in CI/CD.
+
+func TestManager_FetchScope_APIURL(t *testing.T) {
+	// An enterprise-style server: every endpoint lives under /api/v3
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v3/app/installations/42":
+			_, _ = w.Write([]byte(`{"id":42,"account":{"login":"corp","type":"Organization"},"repository_selection":"selected"}`))
+		case "/api/v3/app/installations/42/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token":"ghs_scope"}`))
+		case "/api/v3/installation/repositories":
+			_, _ = w.Write([]byte(`{"total_count":1,"repositories":[{"full_name":"corp/tools","private":true}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	mgr := NewManager()
+	app := &config.GitHubApp{
+		AppID:          1,
+		InstallationID: 42,
+		Patterns:       []string{"ghes.example.com/corp/"},
+		APIURL:         server.URL + "/api/v3/",
+	}
+
+	if err := mgr.FetchScope(app, "jwt-token"); err != nil {
+		t.Fatalf("FetchScope() error = %v", err)
+	}
+
+	if app.Scope == nil || app.Scope.AccountLogin != "corp" || app.Scope.RepositorySelection != "selected" {
+		t.Fatalf("Scope = %+v, want selected scope for corp", app.Scope)
+	}
+	if len(app.Scope.Repositories) != 1 || app.Scope.Repositories[0].FullName != "corp/tools" {
+		t.Errorf("Repositories = %+v, want [corp/tools]", app.Scope.Repositories)
+	}
+
+	want := []string{
+		"GET /api/v3/app/installations/42 Bearer jwt-token",
+		"POST /api/v3/app/installations/42/access_tokens Bearer jwt-token",
+		"GET /api/v3/installation/repositories token ghs_scope",
+	}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests =\n%s\nwant\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+	}
+}
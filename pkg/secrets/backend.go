@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ErrUnsupported is returned by backends that cannot perform an operation,
+// such as listing the OS keyring
+var ErrUnsupported = errors.New("operation not supported by secret backend")
+
+// Backend stores secrets in one storage system. Secrets are addressed by the
+// name of the app or PAT they belong to and their type.
+type Backend interface {
+	// Name returns the name the backend is registered under
+	Name() string
+	// Available reports whether the backend can currently be used
+	Available() bool
+	// Get returns a secret, or ErrNotFound when it does not exist
+	Get(name string, secretType SecretType) (string, error)
+	// Store creates or replaces a secret
+	Store(name string, secretType SecretType, value string) error
+	// Delete removes a secret, returning ErrNotFound when it does not exist
+	Delete(name string, secretType SecretType) error
+	// List returns the secrets held by the backend
+	List() ([]SecretRef, error)
+}
+
+// SecretRef identifies a secret held by a backend
+type SecretRef struct {
+	Name string     `json:"name"`
+	Type SecretType `json:"type"`
+}
+
+// BackendOptions are passed to a BackendFactory
+type BackendOptions struct {
+	// ConfigDir is the extension configuration directory
+	ConfigDir string
+	// Settings are the backend's entries from the secret_backends section of
+	// the configuration
+	Settings map[string]string
+	// HTTPClient returns the client for requests to a URL, with the proxy and
+	// TLS settings of its host. Nil means a plain client.
+	HTTPClient HTTPClientFactory
+}
+
+// HTTPClientFactory returns the HTTP client to use for requests to rawURL
+type HTTPClientFactory func(rawURL string) (*http.Client, error)
+
+// BackendFactory creates a backend from its options
+type BackendFactory func(options BackendOptions) (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]BackendFactory)
+)
+
+func init() {
+	Register(string(StorageBackendKeyring), newKeyringBackend)
+	Register(string(StorageBackendFilesystem), newFilesystemBackend)
+	Register(string(StorageBackendEncryptedFilesystem), newEncryptedFilesystemBackend)
+	Register(string(StorageBackendVault), newVaultBackend)
+}
+
+// Register makes a backend available under name, so it can be selected with
+// private_key_source. It panics if name is empty or already registered.
+func Register(name string, factory BackendFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("secrets: Register requires a name and a factory")
+	}
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("secrets: backend %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// IsRegistered reports whether a backend is registered under name
+func IsRegistered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[name]
+	return ok
+}
+
+// RegisteredBackends returns the sorted names of all registered backends
+func RegisteredBackends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates the backend registered under name
+func NewBackend(name string, options BackendOptions) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown secret backend: %s", name)
+	}
+	backend, err := factory(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s secret backend: %w", name, err)
+	}
+	return backend, nil
+}
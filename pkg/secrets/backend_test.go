@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"errors"
+	"testing"
+)
+
+// memoryBackend is a Backend kept in memory, registered to test pluggability
+type memoryBackend struct {
+	values map[SecretRef]string
+}
+
+func (b *memoryBackend) Name() string    { return "memory-test" }
+func (b *memoryBackend) Available() bool { return true }
+
+func (b *memoryBackend) Get(name string, secretType SecretType) (string, error) {
+	value, ok := b.values[SecretRef{Name: name, Type: secretType}]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (b *memoryBackend) Store(name string, secretType SecretType, value string) error {
+	b.values[SecretRef{Name: name, Type: secretType}] = value
+	return nil
+}
+
+func (b *memoryBackend) Delete(name string, secretType SecretType) error {
+	delete(b.values, SecretRef{Name: name, Type: secretType})
+	return nil
+}
+
+func (b *memoryBackend) List() ([]SecretRef, error) {
+	refs := make([]SecretRef, 0, len(b.values))
+	for ref := range b.values {
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func TestRegister(t *testing.T) {
+	var received BackendOptions
+	Register("memory-test", func(options BackendOptions) (Backend, error) {
+		received = options
+		return &memoryBackend{values: make(map[SecretRef]string)}, nil
+	})
+
+	if !IsRegistered("memory-test") {
+		t.Fatal("Expected memory-test to be registered")
+	}
+	for _, name := range []string{"keyring", "filesystem", "vault"} {
+		if !IsRegistered(name) {
+			t.Errorf("Expected built-in backend %s to be registered", name)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected duplicate registration to panic")
+			}
+		}()
+		Register("memory-test", func(BackendOptions) (Backend, error) { return nil, nil })
+	}()
+
+	mgr := NewManager(t.TempDir())
+	mgr.Configure(map[string]map[string]string{"memory-test": {"region": "eu"}})
+
+	backend, err := mgr.Backend("memory-test")
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+	if received.Settings["region"] != "eu" {
+		t.Errorf("factory settings = %v, want configured settings", received.Settings)
+	}
+	if err := backend.Store("app", SecretTypePrivateKey, "key"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	again, _ := mgr.Backend("memory-test")
+	if value, err := again.Get("app", SecretTypePrivateKey); err != nil || value != "key" {
+		t.Errorf("Get() from reused backend = %q, %v, want key", value, err)
+	}
+
+	if _, err := mgr.Backend("missing"); err == nil {
+		t.Error("Expected error for unregistered backend")
+	}
+}
+
+func TestFilesystemBackend_List(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	backend, err := mgr.Backend("filesystem")
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+
+	refs, err := backend.List()
+	if err != nil || len(refs) != 0 {
+		t.Fatalf("List() before any secret = %v, %v, want empty", refs, err)
+	}
+
+	if err := backend.Store("my.app", SecretTypePrivateKey, "key"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := backend.Store("other", SecretTypePAT, "token"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	refs, err = backend.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []SecretRef{{Name: "my.app", Type: SecretTypePrivateKey}, {Name: "other", Type: SecretTypePAT}}
+	if len(refs) != len(want) || refs[0] != want[0] || refs[1] != want[1] {
+		t.Errorf("List() = %v, want %v", refs, want)
+	}
+}
+
+func TestKeyringBackend_ListUnsupported(t *testing.T) {
+	backend, err := NewManager(t.TempDir()).Backend("keyring")
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+	if _, err := backend.List(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("List() error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCommandFailed is returned when a secret command cannot be run, exits
+// with an error or prints nothing
+var ErrCommandFailed = errors.New("secret command failed")
+
+const (
+	// DefaultCommandTimeout bounds secret commands without an explicit timeout
+	DefaultCommandTimeout = 30 * time.Second
+	// maxCommandOutput bounds what is read from a secret command's stdout
+	maxCommandOutput = 1 << 20
+	// maxCommandStderr bounds the stderr kept for error messages
+	maxCommandStderr = 1024
+	// commandWaitDelay is how long to wait for the output pipes to close once
+	// the command has exited or been killed
+	commandWaitDelay = time.Second
+)
+
+// Command describes an external program that prints a secret on stdout, such
+// as `op read op://vault/item/field` or `pass show github/token`. Args are
+// executed directly, without a shell.
+type Command struct {
+	Args []string
+	// Timeout bounds the command; DefaultCommandTimeout applies when zero
+	Timeout time.Duration
+	// CacheTTL keeps the output in memory for this long, so a long-running
+	// process such as the agent does not run the command for every request
+	CacheTTL time.Duration
+}
+
+// commandResult is a memoised command output
+type commandResult struct {
+	value   string
+	expires time.Time
+}
+
+// commandCache memoises command outputs by argv
+type commandCache struct {
+	mu      sync.Mutex
+	results map[string]commandResult
+}
+
+// RunCommand runs command and returns its trimmed stdout. Outputs of commands
+// with a CacheTTL are reused until it elapses.
+func (m *Manager) RunCommand(command Command) (string, error) {
+	if command.CacheTTL <= 0 {
+		return runSecretCommand(command)
+	}
+
+	key := strings.Join(command.Args, "\x00")
+	if value, ok := m.commands.get(key); ok {
+		return value, nil
+	}
+	value, err := runSecretCommand(command)
+	if err != nil {
+		return "", err
+	}
+	m.commands.put(key, value, command.CacheTTL)
+	return value, nil
+}
+
+func (c *commandCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, found := c.results[key]
+	if !found {
+		return "", false
+	}
+	if time.Now().After(result.expires) {
+		delete(c.results, key)
+		return "", false
+	}
+	return result.value, true
+}
+
+func (c *commandCache) put(key, value string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.results == nil {
+		c.results = make(map[string]commandResult)
+	}
+	c.results[key] = commandResult{value: value, expires: time.Now().Add(ttl)}
+}
+
+// runSecretCommand executes command and returns its stdout without
+// surrounding whitespace. Stderr is only used to explain failures.
+func runSecretCommand(command Command) (string, error) {
+	if len(command.Args) == 0 || command.Args[0] == "" {
+		return "", fmt.Errorf("%w: no command configured", ErrCommandFailed)
+	}
+
+	timeout := command.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = maxCommandOutput, maxCommandStderr
+
+	// #nosec G204 -- The command comes from the user's configuration and is executed directly without a shell.
+	child := exec.CommandContext(ctx, command.Args[0], command.Args[1:]...)
+	child.Stdout = &stdout
+	child.Stderr = &stderr
+	child.WaitDelay = commandWaitDelay
+
+	err := child.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("%w: %s timed out after %s%s",
+			ErrCommandFailed, command.Args[0], timeout, stderr.diagnostic())
+	case err != nil:
+		return "", fmt.Errorf("%w: %s: %v%s", ErrCommandFailed, command.Args[0], err, stderr.diagnostic())
+	case stdout.truncated:
+		return "", fmt.Errorf("%w: %s printed more than %d bytes", ErrCommandFailed, command.Args[0], maxCommandOutput)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("%w: %s printed nothing%s", ErrCommandFailed, command.Args[0], stderr.diagnostic())
+	}
+	return value, nil
+}
+
+// limitedBuffer keeps at most limit bytes and discards the rest, so a
+// misbehaving command cannot exhaust memory
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer, always reporting the full length so the
+// command is not killed by a broken pipe
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			_, _ = b.Buffer.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// diagnostic formats captured stderr for an error message
+func (b *limitedBuffer) diagnostic() string {
+	message := strings.TrimSpace(b.String())
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// commandHelperEnv makes the test binary act as a secret command
+const commandHelperEnv = "GH_APP_AUTH_TEST_SECRET_COMMAND"
+
+// TestSecretCommandHelper is not a test: it is the program run by the
+// command tests, selected by the arguments after "--"
+func TestSecretCommandHelper(t *testing.T) {
+	if os.Getenv(commandHelperEnv) == "" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		os.Exit(2)
+	}
+
+	switch args[1] {
+	case "print":
+		fmt.Println(args[2])
+	case "count":
+		// Records each run so memoisation can be observed
+		file, err := os.OpenFile(args[2], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			os.Exit(3)
+		}
+		_, _ = file.WriteString("run\n")
+		_ = file.Close()
+		fmt.Println("counted-secret")
+	case "fail":
+		fmt.Fprintln(os.Stderr, "[ERROR] You are not currently signed in.")
+		os.Exit(1)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	case "empty":
+	}
+	os.Exit(0)
+}
+
+// helperCommand returns the argv running the helper in the given mode
+func helperCommand(t *testing.T, args ...string) []string {
+	t.Helper()
+	t.Setenv(commandHelperEnv, "1")
+	return append([]string{os.Args[0], "-test.run=^TestSecretCommandHelper$", "--"}, args...)
+}
+
+func TestRunCommand(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+
+	value, err := mgr.RunCommand(Command{Args: helperCommand(t, "print", "ghp_from_command")})
+	if err != nil || value != "ghp_from_command" {
+		t.Errorf("RunCommand() = %q, %v, want trimmed stdout", value, err)
+	}
+
+	_, err = mgr.RunCommand(Command{Args: helperCommand(t, "fail")})
+	if !errors.Is(err, ErrCommandFailed) || !strings.Contains(err.Error(), "not currently signed in") {
+		t.Errorf("RunCommand() error = %v, want ErrCommandFailed with stderr", err)
+	}
+
+	_, err = mgr.RunCommand(Command{Args: helperCommand(t, "empty")})
+	if !errors.Is(err, ErrCommandFailed) || !strings.Contains(err.Error(), "printed nothing") {
+		t.Errorf("RunCommand() error = %v, want error for empty output", err)
+	}
+
+	start := time.Now()
+	_, err = mgr.RunCommand(Command{Args: helperCommand(t, "sleep"), Timeout: 200 * time.Millisecond})
+	if !errors.Is(err, ErrCommandFailed) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("RunCommand() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunCommand() took %s, want the command killed at the timeout", elapsed)
+	}
+
+	if _, err := mgr.RunCommand(Command{}); !errors.Is(err, ErrCommandFailed) {
+		t.Errorf("RunCommand() without args error = %v, want ErrCommandFailed", err)
+	}
+	if _, err := mgr.RunCommand(Command{Args: []string{"gh-app-auth-no-such-program"}}); err == nil {
+		t.Error("Expected error for a missing program")
+	}
+}
+
+func TestRunCommand_Cache(t *testing.T) {
+	runs := t.TempDir() + "/runs"
+	countRuns := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+
+	mgr := NewManager(t.TempDir())
+	uncached := Command{Args: helperCommand(t, "count", runs)}
+	for i := 0; i < 2; i++ {
+		if _, err := mgr.RunCommand(uncached); err != nil {
+			t.Fatalf("RunCommand() error = %v", err)
+		}
+	}
+	if got := countRuns(); got != 2 {
+		t.Errorf("command ran %d times without a cache, want 2", got)
+	}
+
+	cached := Command{Args: uncached.Args, CacheTTL: time.Hour}
+	for i := 0; i < 3; i++ {
+		if value, err := mgr.RunCommand(cached); err != nil || value != "counted-secret" {
+			t.Fatalf("RunCommand() = %q, %v", value, err)
+		}
+	}
+	if got := countRuns(); got != 3 {
+		t.Errorf("command ran %d times, want one more run for the cached command", got)
+	}
+
+	if _, err := NewManager(t.TempDir()).RunCommand(cached); err != nil {
+		t.Fatalf("RunCommand() error = %v", err)
+	}
+	if got := countRuns(); got != 4 {
+		t.Errorf("command ran %d times, want the cache kept per manager", got)
+	}
+}
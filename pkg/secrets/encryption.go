@@ -0,0 +1,124 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Errors returned when reading encrypted secrets
+var (
+	ErrPassphraseRequired = errors.New("secret is encrypted and no passphrase is available")
+	ErrDecryptionFailed   = errors.New("failed to decrypt secret (wrong passphrase?)")
+)
+
+// encryptedFormat identifies the encrypted file format and its algorithms
+const encryptedFormat = "gh-app-auth/scrypt-aes256gcm/v1"
+
+// scrypt parameters for new files, as recommended for interactive use. They
+// are stored with each file, so they can be raised without breaking reads.
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+const (
+	scryptSaltSize = 16
+	aesKeySize     = 32
+	// maxScryptN bounds the work a tampered file can ask for
+	maxScryptN = 1 << 20
+)
+
+// encryptedSecret is the on-disk form of an encrypted secret
+type encryptedSecret struct {
+	Format     string `json:"format"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// encryptSecret encrypts plaintext with a key derived from passphrase. The
+// associated data binds the ciphertext to the secret it was written for, so
+// encrypted files cannot be swapped between secrets.
+func encryptSecret(passphrase string, plaintext, associatedData []byte) ([]byte, error) {
+	secret := encryptedSecret{
+		Format: encryptedFormat,
+		N:      scryptN,
+		R:      scryptR,
+		P:      scryptP,
+		Salt:   make([]byte, scryptSaltSize),
+	}
+	if _, err := rand.Read(secret.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := secret.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	secret.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(secret.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	secret.Ciphertext = aead.Seal(nil, secret.Nonce, plaintext, associatedData)
+
+	return json.Marshal(secret)
+}
+
+// decryptSecret decrypts data written by encryptSecret
+func decryptSecret(passphrase string, data, associatedData []byte) ([]byte, error) {
+	var secret encryptedSecret
+	if err := json.Unmarshal(data, &secret); err != nil || secret.Format != encryptedFormat {
+		return nil, fmt.Errorf("unrecognized encrypted secret format")
+	}
+	if secret.N <= 1 || secret.N > maxScryptN || secret.R <= 0 || secret.P <= 0 {
+		return nil, fmt.Errorf("invalid scrypt parameters in encrypted secret")
+	}
+
+	aead, err := secret.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce in encrypted secret")
+	}
+	plaintext, err := aead.Open(nil, secret.Nonce, secret.Ciphertext, associatedData)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// isEncryptedSecret reports whether data was written by encryptSecret
+func isEncryptedSecret(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return false
+	}
+	var header struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(data, &header) == nil && header.Format == encryptedFormat
+}
+
+// aead derives the AES-256-GCM cipher for passphrase and the secret's salt
+func (s *encryptedSecret) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), s.Salt, s.N, s.R, s.P, aesKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
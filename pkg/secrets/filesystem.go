@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// filesystemBackend stores secrets as owner-readable files in the secrets
+// directory of the extension configuration directory. Secrets are encrypted
+// with a passphrase whenever one is configured; plaintext files written
+// before that remain readable.
+type filesystemBackend struct {
+	dir        string
+	passphrase *passphraseSource
+	// requireEncryption refuses to write plaintext files
+	requireEncryption bool
+}
+
+func newFilesystemBackend(options BackendOptions) (Backend, error) {
+	return &filesystemBackend{
+		dir:        filepath.Join(options.ConfigDir, "secrets"),
+		passphrase: &passphraseSource{},
+	}, nil
+}
+
+func newEncryptedFilesystemBackend(options BackendOptions) (Backend, error) {
+	return &filesystemBackend{
+		dir:               filepath.Join(options.ConfigDir, "secrets"),
+		passphrase:        &passphraseSource{},
+		requireEncryption: true,
+	}, nil
+}
+
+// Name implements Backend
+func (b *filesystemBackend) Name() string {
+	if b.requireEncryption {
+		return string(StorageBackendEncryptedFilesystem)
+	}
+	return string(StorageBackendFilesystem)
+}
+
+// Available reports true unless encryption is required and no passphrase is
+// configured: the directory is created on first use
+func (b *filesystemBackend) Available() bool {
+	return !b.requireEncryption || b.passphrase.configured()
+}
+
+// Store stores a secret on the filesystem with secure permissions
+func (b *filesystemBackend) Store(name string, secretType SecretType, value string) error {
+	path := b.path(name, secretType)
+
+	data := []byte(value)
+	if b.requireEncryption || b.passphrase.configured() {
+		passphrase, err := b.passphrase.get()
+		if err != nil {
+			return err
+		}
+		if data, err = encryptSecret(passphrase, data, associatedData(name, secretType)); err != nil {
+			return err
+		}
+	}
+
+	// Ensure directory exists with secure permissions
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	// Remove any previous version first: it is read-only and cannot be truncated
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace secret file: %w", err)
+	}
+
+	// Write with secure permissions (owner read-only)
+	if err := os.WriteFile(path, data, 0400); err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a secret from the filesystem
+func (b *filesystemBackend) Get(name string, secretType SecretType) (string, error) {
+	data, err := os.ReadFile(b.path(name, secretType))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	if !isEncryptedSecret(data) {
+		return string(data), nil
+	}
+
+	passphrase, err := b.passphrase.get()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := decryptSecret(passphrase, data, associatedData(name, secretType))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Encrypted reports whether the file holding a secret is encrypted
+func (b *filesystemBackend) Encrypted(name string, secretType SecretType) (bool, error) {
+	data, err := os.ReadFile(b.path(name, secretType))
+	if os.IsNotExist(err) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return isEncryptedSecret(data), nil
+}
+
+// Delete removes a secret from the filesystem
+func (b *filesystemBackend) Delete(name string, secretType SecretType) error {
+	err := os.Remove(b.path(name, secretType))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// List returns the secrets in the secrets directory
+func (b *filesystemBackend) List() ([]SecretRef, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	var refs []SecretRef
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// Files are named <name>.<type>; names may contain dots, types do not
+		dot := strings.LastIndex(entry.Name(), ".")
+		if dot <= 0 {
+			continue
+		}
+		refs = append(refs, SecretRef{
+			Name: entry.Name()[:dot],
+			Type: SecretType(entry.Name()[dot+1:]),
+		})
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Name != refs[j].Name {
+			return refs[i].Name < refs[j].Name
+		}
+		return refs[i].Type < refs[j].Type
+	})
+	return refs, nil
+}
+
+// associatedData binds an encrypted file to the secret it holds
+func associatedData(name string, secretType SecretType) []byte {
+	return []byte(fmt.Sprintf("%s/%s", filepath.Base(name), secretType))
+}
+
+// path returns the filesystem path for a secret
+func (b *filesystemBackend) path(name string, secretType SecretType) string {
+	// Sanitize app name to be filesystem-safe
+	safeName := filepath.Base(name)
+	filename := fmt.Sprintf("%s.%s", safeName, secretType)
+	return filepath.Join(b.dir, filename)
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables supplying the passphrase of the encrypted filesystem store
+const (
+	// PassphraseEnv holds the passphrase itself
+	PassphraseEnv = "GH_APP_AUTH_PASSPHRASE"
+	// PassphraseFDEnv names an open file descriptor to read the passphrase
+	// from, so it does not appear in the environment of child processes
+	PassphraseFDEnv = "GH_APP_AUTH_PASSPHRASE_FD"
+)
+
+// maxPassphraseSize bounds how much is read from the passphrase descriptor
+const maxPassphraseSize = 4096
+
+// PassphrasePrompt asks the user for the passphrase of the encrypted
+// filesystem store
+type PassphrasePrompt func() (string, error)
+
+// passphraseSource resolves the passphrase once per process, from the
+// environment, a file descriptor or a prompt, in that order
+type passphraseSource struct {
+	mu       sync.Mutex
+	prompt   PassphrasePrompt
+	resolved bool
+	value    string
+}
+
+// configured reports whether a passphrase can be obtained without failing
+// outright, i.e. whether new secrets should be encrypted
+func (s *passphraseSource) configured() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resolved || os.Getenv(PassphraseEnv) != "" || os.Getenv(PassphraseFDEnv) != "" || s.prompt != nil
+}
+
+// setPrompt sets the prompt used when neither environment variable is set
+func (s *passphraseSource) setPrompt(prompt PassphrasePrompt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prompt = prompt
+}
+
+// get returns the passphrase, resolving it on first use
+func (s *passphraseSource) get() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resolved {
+		return s.value, nil
+	}
+
+	value, err := s.resolve()
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("%w: passphrase is empty", ErrPassphraseRequired)
+	}
+	s.value, s.resolved = value, true
+	return value, nil
+}
+
+func (s *passphraseSource) resolve() (string, error) {
+	if value := os.Getenv(PassphraseEnv); value != "" {
+		return value, nil
+	}
+	if fd := os.Getenv(PassphraseFDEnv); fd != "" {
+		return readPassphraseFD(fd)
+	}
+	if s.prompt != nil {
+		return s.prompt()
+	}
+	return "", fmt.Errorf("%w: set %s or %s", ErrPassphraseRequired, PassphraseEnv, PassphraseFDEnv)
+}
+
+// readPassphraseFD reads the passphrase from an inherited file descriptor,
+// up to the first newline
+func readPassphraseFD(fd string) (string, error) {
+	number, err := strconv.Atoi(fd)
+	if err != nil || number < 0 {
+		return "", fmt.Errorf("invalid %s %q: must be a file descriptor number", PassphraseFDEnv, fd)
+	}
+
+	file := os.NewFile(uintptr(number), "passphrase")
+	if file == nil {
+		return "", fmt.Errorf("invalid %s %q", PassphraseFDEnv, fd)
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPassphraseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase from file descriptor %d: %w", number, err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
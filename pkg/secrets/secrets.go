@@ -1,15 +1,12 @@
 // Package secrets provides secure storage for sensitive data using OS-native keyrings
-// with automatic fallback to filesystem storage.
+// with automatic fallback to filesystem storage. Other storage systems plug in
+// as registered backends.
 package secrets
 
 import (
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"time"
-
-	"github.com/zalando/go-keyring"
+	"sync"
 )
 
 // Common errors returned by the secrets manager
@@ -41,59 +38,168 @@ const (
 	StorageBackendKeyring StorageBackend = "keyring"
 	// StorageBackendFilesystem indicates the secret is on the filesystem
 	StorageBackendFilesystem StorageBackend = "filesystem"
+	// StorageBackendEncryptedFilesystem indicates the secret is in a
+	// passphrase-encrypted file
+	StorageBackendEncryptedFilesystem StorageBackend = "encrypted-filesystem"
+	// StorageBackendVault indicates the secret is in a HashiCorp Vault KV v2 engine
+	StorageBackendVault StorageBackend = "vault"
 )
 
-// Manager handles secure storage and retrieval of secrets
+// Manager handles secure storage and retrieval of secrets. Store, Get and
+// Delete use the OS keyring with a filesystem fallback; Backend gives access to
+// any registered backend.
 type Manager struct {
-	keyringTimeout time.Duration
-	fallbackDir    string
+	fallbackDir string
+	keyring     Backend
+	filesystem  *filesystemBackend
+	// encrypted shares the filesystem directory and passphrase, but refuses
+	// to write plaintext
+	encrypted *filesystemBackend
+
+	mu         sync.Mutex
+	settings   map[string]map[string]string
+	httpClient HTTPClientFactory
+	backends   map[string]Backend
+
+	// commands memoises the output of secret commands with a cache TTL
+	commands commandCache
 }
 
 // NewManager creates a new secrets manager with the specified fallback directory
 func NewManager(fallbackDir string) *Manager {
+	options := BackendOptions{ConfigDir: fallbackDir}
+	keyringStore, _ := newKeyringBackend(options)
+	filesystemStore, _ := newFilesystemBackend(options)
+	encryptedStore, _ := newEncryptedFilesystemBackend(options)
+
+	filesystem := filesystemStore.(*filesystemBackend)
+	encrypted := encryptedStore.(*filesystemBackend)
+	encrypted.passphrase = filesystem.passphrase
+
 	return &Manager{
-		keyringTimeout: 3 * time.Second,
-		fallbackDir:    fallbackDir,
+		fallbackDir: fallbackDir,
+		keyring:     keyringStore,
+		filesystem:  filesystem,
+		encrypted:   encrypted,
+		backends:    make(map[string]Backend),
+	}
+}
+
+// SetPassphrasePrompt sets how the passphrase of the encrypted filesystem
+// store is asked for when neither GH_APP_AUTH_PASSPHRASE nor
+// GH_APP_AUTH_PASSPHRASE_FD is set. Interactive commands set a terminal
+// prompt; without one, filesystem secrets are only encrypted when a
+// passphrase is supplied through the environment.
+func (m *Manager) SetPassphrasePrompt(prompt PassphrasePrompt) {
+	m.filesystem.passphrase.setPrompt(prompt)
+}
+
+// Configure sets the per-backend settings from the secret_backends section of
+// the configuration. Backends already created keep their settings.
+func (m *Manager) Configure(settings map[string]map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings = settings
+}
+
+// SetHTTPClientFactory sets how backends reached over HTTP, such as Vault,
+// build their clients, so that they honour the per-host transport settings.
+// Backends already created keep their client.
+func (m *Manager) SetHTTPClientFactory(factory HTTPClientFactory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpClient = factory
+}
+
+// Backend returns the backend registered under name, creating it on first use
+func (m *Manager) Backend(name string) (Backend, error) {
+	switch StorageBackend(name) {
+	case StorageBackendKeyring:
+		return m.keyring, nil
+	case StorageBackendFilesystem:
+		return m.filesystem, nil
+	case StorageBackendEncryptedFilesystem:
+		return m.encrypted, nil
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if backend, found := m.backends[name]; found {
+		return backend, nil
+	}
+	backend, err := NewBackend(name, BackendOptions{
+		ConfigDir:  m.fallbackDir,
+		Settings:   m.settings[name],
+		HTTPClient: m.httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.backends[name] = backend
+	return backend, nil
 }
 
 // Store attempts to store a secret in the OS keyring first, falling back to
 // filesystem if keyring is unavailable. Returns the storage backend used.
 func (m *Manager) Store(appName string, secretType SecretType, value string) (StorageBackend, error) {
 	// Try encrypted storage first
-	if err := m.storeInKeyring(appName, secretType, value); err == nil {
+	if err := m.keyring.Store(appName, secretType, value); err == nil {
 		// Success! Clean up any filesystem version
-		_ = m.deleteFromFilesystem(appName, secretType)
+		_ = m.filesystem.Delete(appName, secretType)
 		return StorageBackendKeyring, nil
 	}
 
 	// Fallback to filesystem
-	if err := m.storeInFilesystem(appName, secretType, value); err != nil {
+	if err := m.filesystem.Store(appName, secretType, value); err != nil {
 		return "", fmt.Errorf("failed to store in both keyring and filesystem: %w", err)
 	}
 
 	return StorageBackendFilesystem, nil
 }
 
+// StoreEncrypted stores a secret like Store, but never as plaintext: without
+// a keyring the secret goes to the encrypted filesystem store, and
+// ErrStorageUnavailable is returned when no passphrase is configured for it.
+func (m *Manager) StoreEncrypted(appName string, secretType SecretType, value string) (StorageBackend, error) {
+	if err := m.keyring.Store(appName, secretType, value); err == nil {
+		_ = m.filesystem.Delete(appName, secretType)
+		return StorageBackendKeyring, nil
+	}
+
+	if !m.encrypted.Available() {
+		return "", fmt.Errorf("%w: no OS keyring and no passphrase for the filesystem store", ErrStorageUnavailable)
+	}
+	if err := m.encrypted.Store(appName, secretType, value); err != nil {
+		return "", fmt.Errorf("failed to store in encrypted filesystem: %w", err)
+	}
+	return StorageBackendEncryptedFilesystem, nil
+}
+
 // Get retrieves a secret, trying keyring first then filesystem
 func (m *Manager) Get(appName string, secretType SecretType) (string, StorageBackend, error) {
 	// Try keyring first
-	if value, err := m.getFromKeyring(appName, secretType); err == nil {
+	if value, err := m.keyring.Get(appName, secretType); err == nil {
 		return value, StorageBackendKeyring, nil
 	}
 
 	// Try filesystem
-	if value, err := m.getFromFilesystem(appName, secretType); err == nil {
+	value, err := m.filesystem.Get(appName, secretType)
+	if err == nil {
 		return value, StorageBackendFilesystem, nil
 	}
+	if errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrDecryptionFailed) {
+		// The secret exists but is encrypted; say why it cannot be read
+		return "", "", err
+	}
 
 	return "", "", ErrNotFound
 }
 
 // Delete removes a secret from both keyring and filesystem
 func (m *Manager) Delete(appName string, secretType SecretType) error {
-	keyringErr := m.deleteFromKeyring(appName, secretType)
-	filesystemErr := m.deleteFromFilesystem(appName, secretType)
+	keyringErr := m.keyring.Delete(appName, secretType)
+	filesystemErr := m.filesystem.Delete(appName, secretType)
 
 	// If both fail, return the first error
 	if keyringErr != nil && filesystemErr != nil {
@@ -106,153 +212,57 @@ func (m *Manager) Delete(appName string, secretType SecretType) error {
 
 // IsAvailable checks if encrypted keyring storage is available
 func (m *Manager) IsAvailable() bool {
-	// Test keyring availability with a quick operation
-	testService := "gh-app-auth:availability-test"
-	testUser := "test"
-	testValue := "test"
-
-	ch := make(chan bool, 1)
-	go func() {
-		defer close(ch)
-		if err := keyring.Set(testService, testUser, testValue); err != nil {
-			ch <- false
-			return
-		}
-		_ = keyring.Delete(testService, testUser)
-		ch <- true
-	}()
-
-	select {
-	case available := <-ch:
-		return available
-	case <-time.After(m.keyringTimeout):
-		return false
-	}
+	return m.keyring.Available()
 }
 
-// storeInKeyring stores a secret in the OS keyring with timeout protection
-func (m *Manager) storeInKeyring(appName string, secretType SecretType, value string) error {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan error, 1)
-	go func() {
-		defer close(ch)
-		ch <- keyring.Set(service, user, value)
-	}()
-
-	select {
-	case err := <-ch:
-		return err
-	case <-time.After(m.keyringTimeout):
-		return ErrTimeout
-	}
+// FallbackSecrets returns the secrets held by the filesystem fallback store.
+// The OS keyring cannot be listed.
+func (m *Manager) FallbackSecrets() ([]SecretRef, error) {
+	return m.filesystem.List()
 }
 
-// getFromKeyring retrieves a secret from the OS keyring with timeout protection
-func (m *Manager) getFromKeyring(appName string, secretType SecretType) (string, error) {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan struct {
-		val string
-		err error
-	}, 1)
-
-	go func() {
-		defer close(ch)
-		val, err := keyring.Get(service, user)
-		ch <- struct {
-			val string
-			err error
-		}{val, err}
-	}()
-
-	select {
-	case res := <-ch:
-		if errors.Is(res.err, keyring.ErrNotFound) {
-			return "", ErrNotFound
-		}
-		return res.val, res.err
-	case <-time.After(m.keyringTimeout):
-		return "", ErrTimeout
+// UnencryptedSecrets returns the secrets of the filesystem fallback store
+// that are still stored as plaintext
+func (m *Manager) UnencryptedSecrets() ([]SecretRef, error) {
+	refs, err := m.filesystem.List()
+	if err != nil {
+		return nil, err
 	}
-}
 
-// deleteFromKeyring removes a secret from the OS keyring with timeout protection
-func (m *Manager) deleteFromKeyring(appName string, secretType SecretType) error {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan error, 1)
-	go func() {
-		defer close(ch)
-		ch <- keyring.Delete(service, user)
-	}()
-
-	select {
-	case err := <-ch:
-		if errors.Is(err, keyring.ErrNotFound) {
-			return ErrNotFound
+	var plaintext []SecretRef
+	for _, ref := range refs {
+		encrypted, err := m.filesystem.Encrypted(ref.Name, ref.Type)
+		if err != nil {
+			return nil, err
+		}
+		if !encrypted {
+			plaintext = append(plaintext, ref)
 		}
-		return err
-	case <-time.After(m.keyringTimeout):
-		return ErrTimeout
-	}
-}
-
-// storeInFilesystem stores a secret on the filesystem with secure permissions
-func (m *Manager) storeInFilesystem(appName string, secretType SecretType, value string) error {
-	path := m.filesystemPath(appName, secretType)
-
-	// Ensure directory exists with secure permissions
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create secrets directory: %w", err)
-	}
-
-	// Write with secure permissions (owner read-only)
-	if err := os.WriteFile(path, []byte(value), 0400); err != nil {
-		return fmt.Errorf("failed to write secret file: %w", err)
 	}
-
-	return nil
+	return plaintext, nil
 }
 
-// getFromFilesystem retrieves a secret from the filesystem
-func (m *Manager) getFromFilesystem(appName string, secretType SecretType) (string, error) {
-	path := m.filesystemPath(appName, secretType)
-
-	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) {
-		return "", ErrNotFound
-	}
+// EncryptFilesystemSecrets encrypts the plaintext secrets of the filesystem
+// fallback store in place and returns how many were converted
+func (m *Manager) EncryptFilesystemSecrets() (int, error) {
+	plaintext, err := m.UnencryptedSecrets()
 	if err != nil {
-		return "", fmt.Errorf("failed to read secret file: %w", err)
+		return 0, err
 	}
 
-	return string(data), nil
-}
-
-// deleteFromFilesystem removes a secret from the filesystem
-func (m *Manager) deleteFromFilesystem(appName string, secretType SecretType) error {
-	path := m.filesystemPath(appName, secretType)
-	err := os.Remove(path)
-	if os.IsNotExist(err) {
-		return ErrNotFound
+	for i, ref := range plaintext {
+		value, err := m.filesystem.Get(ref.Name, ref.Type)
+		if err != nil {
+			return i, fmt.Errorf("failed to read %s %s: %w", ref.Name, ref.Type, err)
+		}
+		if err := m.encrypted.Store(ref.Name, ref.Type, value); err != nil {
+			return i, fmt.Errorf("failed to encrypt %s %s: %w", ref.Name, ref.Type, err)
+		}
 	}
-	return err
-}
-
-// keyringService returns the keyring service name for an app
-func (m *Manager) keyringService(appName string) string {
-	return fmt.Sprintf("gh-app-auth:%s", appName)
+	return len(plaintext), nil
 }
 
 // filesystemPath returns the filesystem path for a secret
 func (m *Manager) filesystemPath(appName string, secretType SecretType) string {
-	// Sanitize app name to be filesystem-safe
-	safeAppName := filepath.Base(appName)
-	filename := fmt.Sprintf("%s.%s", safeAppName, secretType)
-	return filepath.Join(m.fallbackDir, "secrets", filename)
+	return m.filesystem.path(appName, secretType)
 }
@@ -0,0 +1,343 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Vault defaults, used for settings missing from secret_backends.vault
+const (
+	defaultVaultMount    = "secret"
+	defaultVaultPrefix   = "gh-app-auth"
+	defaultVaultTokenEnv = "VAULT_TOKEN"
+	vaultRequestTimeout  = 10 * time.Second
+)
+
+// vaultBackend stores secrets in a HashiCorp Vault KV version 2 engine. Each
+// app or PAT is one Vault secret at <mount>/data/<prefix>/<name>, holding one
+// field per secret type (e.g. private_key).
+//
+// The token is read from the environment (VAULT_TOKEN by default) or from
+// ~/.vault-token on every request, so tokens renewed by the Vault agent or
+// CLI are picked up; it is never stored in the configuration.
+type vaultBackend struct {
+	address   string
+	mount     string
+	prefix    string
+	namespace string
+	tokenEnv  string
+	client    *http.Client
+}
+
+// vaultSecret is the response to reading a KV v2 secret
+type vaultSecret struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+func newVaultBackend(options BackendOptions) (Backend, error) {
+	setting := func(key, envName, fallback string) string {
+		if value := options.Settings[key]; value != "" {
+			return value
+		}
+		if value := os.Getenv(envName); envName != "" && value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	address := strings.TrimRight(setting("address", "VAULT_ADDR", ""), "/")
+	if address == "" {
+		return nil, fmt.Errorf("address is required (secret_backends.vault.address or VAULT_ADDR)")
+	}
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid address %q: must be an http or https URL", address)
+	}
+
+	client, err := newVaultClient(options.HTTPClient, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultBackend{
+		address:   address,
+		mount:     strings.Trim(setting("mount", "", defaultVaultMount), "/"),
+		prefix:    strings.Trim(setting("prefix", "", defaultVaultPrefix), "/"),
+		namespace: setting("namespace", "VAULT_NAMESPACE", ""),
+		tokenEnv:  setting("token_env", "", defaultVaultTokenEnv),
+		client:    client,
+	}, nil
+}
+
+// newVaultClient returns a client for address from factory, bounded by
+// vaultRequestTimeout unless its transport settings set a timeout
+func newVaultClient(factory HTTPClientFactory, address string) (*http.Client, error) {
+	if factory == nil {
+		return &http.Client{Timeout: vaultRequestTimeout}, nil
+	}
+	shared, err := factory(address)
+	if err != nil {
+		return nil, err
+	}
+	// The factory shares clients between callers; set the timeout on a copy
+	client := *shared
+	if client.Timeout == 0 {
+		client.Timeout = vaultRequestTimeout
+	}
+	return &client, nil
+}
+
+// Name implements Backend
+func (b *vaultBackend) Name() string {
+	return string(StorageBackendVault)
+}
+
+// Available reports whether Vault accepts the current token
+func (b *vaultBackend) Available() bool {
+	resp, err := b.do(http.MethodGet, "/v1/auth/token/lookup-self", nil)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Get returns one field of the Vault secret for name
+func (b *vaultBackend) Get(name string, secretType SecretType) (string, error) {
+	data, _, err := b.read(name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[string(secretType)].(string)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Store sets one field of the Vault secret for name, keeping the others. The
+// write is check-and-set against the version read, so concurrent updates of
+// other fields are not lost silently.
+func (b *vaultBackend) Store(name string, secretType SecretType, value string) error {
+	data, version, err := b.read(name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data[string(secretType)] = value
+	return b.write(name, data, version)
+}
+
+// Delete removes one field of the Vault secret for name, deleting the secret
+// once no field is left
+func (b *vaultBackend) Delete(name string, secretType SecretType) error {
+	data, version, err := b.read(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := data[string(secretType)]; !ok {
+		return ErrNotFound
+	}
+	delete(data, string(secretType))
+	if len(data) > 0 {
+		return b.write(name, data, version)
+	}
+
+	resp, err := b.do(http.MethodDelete, b.secretPath("data", name), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return checkVaultResponse(resp)
+}
+
+// List returns every field of every secret under the prefix
+func (b *vaultBackend) List() ([]SecretRef, error) {
+	resp, err := b.do("LIST", b.secretPath("metadata", ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := checkVaultResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var listing struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	var refs []SecretRef
+	for _, key := range listing.Data.Keys {
+		// Keys ending in a slash are folders, not secrets written by this backend
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		data, _, err := b.read(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for field := range data {
+			refs = append(refs, SecretRef{Name: key, Type: SecretType(field)})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Name != refs[j].Name {
+			return refs[i].Name < refs[j].Name
+		}
+		return refs[i].Type < refs[j].Type
+	})
+	return refs, nil
+}
+
+// read returns the fields and version of the Vault secret for name. Deleted
+// and missing secrets return ErrNotFound with version 0, or with the version
+// of the deletion so that a following write passes check-and-set.
+func (b *vaultBackend) read(name string) (map[string]interface{}, int, error) {
+	resp, err := b.do(http.MethodGet, b.secretPath("data", name), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var secret vaultSecret
+	if resp.StatusCode == http.StatusNotFound {
+		// Soft-deleted secrets answer 404 with their metadata
+		_ = json.NewDecoder(resp.Body).Decode(&secret)
+		return nil, secret.Data.Metadata.Version, ErrNotFound
+	}
+	if err := checkVaultResponse(resp); err != nil {
+		return nil, 0, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	if secret.Data.Data == nil {
+		return nil, secret.Data.Metadata.Version, ErrNotFound
+	}
+	return secret.Data.Data, secret.Data.Metadata.Version, nil
+}
+
+// write replaces the fields of the Vault secret for name if it is still at version
+func (b *vaultBackend) write(name string, data map[string]interface{}, version int) error {
+	body := map[string]interface{}{
+		"options": map[string]int{"cas": version},
+		"data":    data,
+	}
+	resp, err := b.do(http.MethodPost, b.secretPath("data", name), body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return checkVaultResponse(resp)
+}
+
+// do sends an authenticated request to the Vault API
+func (b *vaultBackend) do(method, path string, body interface{}) (*http.Response, error) {
+	token, err := b.token()
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode vault request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, b.address+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if b.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// token returns the Vault token from the environment or ~/.vault-token
+func (b *vaultBackend) token() (string, error) {
+	if token := os.Getenv(b.tokenEnv); token != "" {
+		return token, nil
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		// #nosec G304 -- fixed file name in the user's home directory, as used by the vault CLI
+		if data, err := os.ReadFile(filepath.Join(homeDir, ".vault-token")); err == nil {
+			if token := strings.TrimSpace(string(data)); token != "" {
+				return token, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: no vault token in %s or ~/.vault-token", ErrStorageUnavailable, b.tokenEnv)
+}
+
+// secretPath returns the API path of the secret for name under the data or
+// metadata endpoint of the engine
+func (b *vaultBackend) secretPath(endpoint, name string) string {
+	segments := []string{"/v1", b.mount, endpoint}
+	if b.prefix != "" {
+		segments = append(segments, b.prefix)
+	}
+	if name != "" {
+		segments = append(segments, url.PathEscape(name))
+	}
+	return strings.Join(segments, "/")
+}
+
+// checkVaultResponse turns an unsuccessful Vault response into an error
+func checkVaultResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	var failure struct {
+		Errors []string `json:"errors"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&failure)
+	if len(failure.Errors) > 0 {
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(failure.Errors, "; "))
+	}
+	return fmt.Errorf("vault returned %s", resp.Status)
+}
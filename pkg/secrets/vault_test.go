@@ -0,0 +1,301 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testVaultToken = "test-vault-token"
+
+// fakeVault is a minimal stand-in for a Vault KV v2 engine mounted at secret/
+type fakeVault struct {
+	mu        sync.Mutex
+	secrets   map[string]map[string]interface{}
+	versions  map[string]int
+	namespace string
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	vault := &fakeVault{
+		secrets:  make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+	}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return vault, server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	reply := func(status int, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if body != nil {
+			_ = json.NewEncoder(w).Encode(body)
+		}
+	}
+
+	if r.Header.Get("X-Vault-Token") != testVaultToken {
+		reply(http.StatusForbidden, map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	v.namespace = r.Header.Get("X-Vault-Namespace")
+
+	if r.URL.Path == "/v1/auth/token/lookup-self" {
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]string{"id": testVaultToken}})
+		return
+	}
+
+	if r.Method == "LIST" && r.URL.Path == "/v1/secret/metadata/gh-app-auth" {
+		keys := make([]string, 0, len(v.versions))
+		for key := range v.versions {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		keys = append(keys, "folder/")
+		reply(http.StatusOK, map[string]interface{}{"data": map[string][]string{"keys": keys}})
+		return
+	}
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/gh-app-auth/")
+	if !ok {
+		reply(http.StatusNotFound, map[string][]string{"errors": {}})
+		return
+	}
+	metadata := map[string]int{"version": v.versions[name]}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, found := v.secrets[name]
+		if !found {
+			reply(http.StatusNotFound, map[string]interface{}{"data": map[string]interface{}{"metadata": metadata}})
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": data, "metadata": metadata}})
+	case http.MethodPost:
+		var body struct {
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			reply(http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+			return
+		}
+		if body.Options.CAS != v.versions[name] {
+			reply(http.StatusBadRequest, map[string][]string{
+				"errors": {"check-and-set parameter did not match the current version"},
+			})
+			return
+		}
+		v.versions[name]++
+		v.secrets[name] = body.Data
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]int{"version": v.versions[name]}})
+	case http.MethodDelete:
+		delete(v.secrets, name)
+		reply(http.StatusNoContent, nil)
+	default:
+		reply(http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func newTestVaultBackend(t *testing.T, address string) Backend {
+	t.Helper()
+	backend, err := NewBackend("vault", BackendOptions{Settings: map[string]string{"address": address}})
+	if err != nil {
+		t.Fatalf("NewBackend() error = %v", err)
+	}
+	return backend
+}
+
+func TestVaultBackend_StoreGetDelete(t *testing.T) {
+	vault, server := newFakeVault(t)
+	t.Setenv("VAULT_TOKEN", testVaultToken)
+	t.Setenv("VAULT_NAMESPACE", "team-a")
+	backend := newTestVaultBackend(t, server.URL)
+
+	if !backend.Available() {
+		t.Fatal("Expected backend to be available")
+	}
+	if _, err := backend.Get("my-app", SecretTypePrivateKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() error = %v, want ErrNotFound", err)
+	}
+
+	if err := backend.Store("my-app", SecretTypePrivateKey, "pem-data"); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := backend.Store("my-app", SecretTypeInstallToken, "ghs_token"); err != nil {
+		t.Fatalf("Store() second field error = %v", err)
+	}
+	if vault.namespace != "team-a" {
+		t.Errorf("X-Vault-Namespace = %q, want team-a", vault.namespace)
+	}
+
+	value, err := backend.Get("my-app", SecretTypePrivateKey)
+	if err != nil || value != "pem-data" {
+		t.Errorf("Get() = %q, %v, want pem-data kept after storing another field", value, err)
+	}
+
+	if err := backend.Delete("my-app", SecretTypePrivateKey); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := backend.Get("my-app", SecretTypePrivateKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if value, _ := backend.Get("my-app", SecretTypeInstallToken); value != "ghs_token" {
+		t.Errorf("Get() other field = %q, want it kept", value)
+	}
+
+	if err := backend.Delete("my-app", SecretTypeInstallToken); err != nil {
+		t.Fatalf("Delete() last field error = %v", err)
+	}
+	if _, found := vault.secrets["my-app"]; found {
+		t.Error("Expected secret to be deleted once empty")
+	}
+	if err := backend.Delete("my-app", SecretTypeInstallToken); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() missing secret error = %v, want ErrNotFound", err)
+	}
+
+	// A deleted secret keeps its version, which the next write must match
+	if err := backend.Store("my-app", SecretTypePrivateKey, "new-pem"); err != nil {
+		t.Fatalf("Store() after deletion error = %v", err)
+	}
+}
+
+func TestVaultBackend_List(t *testing.T) {
+	_, server := newFakeVault(t)
+	t.Setenv("VAULT_TOKEN", testVaultToken)
+	backend := newTestVaultBackend(t, server.URL)
+
+	refs, err := backend.List()
+	if err != nil || len(refs) != 0 {
+		t.Fatalf("List() = %v, %v, want empty", refs, err)
+	}
+
+	for _, ref := range []SecretRef{
+		{Name: "app-b", Type: SecretTypePrivateKey},
+		{Name: "app-a", Type: SecretTypePAT},
+		{Name: "app-a", Type: SecretTypePrivateKey},
+	} {
+		if err := backend.Store(ref.Name, ref.Type, "value"); err != nil {
+			t.Fatalf("Store(%v) error = %v", ref, err)
+		}
+	}
+
+	refs, err = backend.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []SecretRef{
+		{Name: "app-a", Type: SecretTypePAT},
+		{Name: "app-a", Type: SecretTypePrivateKey},
+		{Name: "app-b", Type: SecretTypePrivateKey},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("List() = %v, want %v", refs, want)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("List()[%d] = %v, want %v", i, refs[i], want[i])
+		}
+	}
+}
+
+func TestVaultBackend_Token(t *testing.T) {
+	_, server := newFakeVault(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("VAULT_TOKEN", "")
+	backend := newTestVaultBackend(t, server.URL)
+
+	if backend.Available() {
+		t.Error("Expected backend to be unavailable without a token")
+	}
+	if _, err := backend.Get("my-app", SecretTypePrivateKey); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("Get() error = %v, want ErrStorageUnavailable", err)
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong-token")
+	_, err := backend.Get("my-app", SecretTypePrivateKey)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Get() error = %v, want vault's permission error", err)
+	}
+
+	t.Setenv("CUSTOM_VAULT_TOKEN", testVaultToken)
+	custom, err := NewBackend("vault", BackendOptions{Settings: map[string]string{
+		"address":   server.URL,
+		"token_env": "CUSTOM_VAULT_TOKEN",
+	}})
+	if err != nil {
+		t.Fatalf("NewBackend() error = %v", err)
+	}
+	if !custom.Available() {
+		t.Error("Expected token_env to select the token variable")
+	}
+}
+
+func TestNewVaultBackend_Address(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+
+	if _, err := NewBackend("vault", BackendOptions{}); err == nil {
+		t.Error("Expected error without address")
+	}
+	if _, err := NewBackend("vault", BackendOptions{Settings: map[string]string{"address": "vault:8200"}}); err == nil {
+		t.Error("Expected error for address without scheme")
+	}
+
+	t.Setenv("VAULT_ADDR", "https://vault.example.com:8200/")
+	backend, err := NewBackend("vault", BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() with VAULT_ADDR error = %v", err)
+	}
+	if got := backend.(*vaultBackend).address; got != "https://vault.example.com:8200" {
+		t.Errorf("address = %q, want VAULT_ADDR without trailing slash", got)
+	}
+}
+
+func TestVaultBackend_HTTPClientFactory(t *testing.T) {
+	// Only the client from the factory trusts the test server's certificate
+	server := httptest.NewTLSServer(&fakeVault{
+		secrets:  make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+	})
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", testVaultToken)
+
+	plain := newTestVaultBackend(t, server.URL)
+	if plain.Available() {
+		t.Fatal("Expected a plain client to reject the test certificate")
+	}
+
+	var requested string
+	manager := NewManager(t.TempDir())
+	manager.Configure(map[string]map[string]string{"vault": {"address": server.URL}})
+	manager.SetHTTPClientFactory(func(rawURL string) (*http.Client, error) {
+		requested = rawURL
+		return server.Client(), nil
+	})
+	backend, err := manager.Backend("vault")
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+	if !backend.Available() {
+		t.Error("Expected the factory's client to reach the server")
+	}
+	if requested != server.URL {
+		t.Errorf("factory asked for %q, want %q", requested, server.URL)
+	}
+	if backend.(*vaultBackend).client.Timeout != vaultRequestTimeout {
+		t.Errorf("client timeout = %v, want %v", backend.(*vaultBackend).client.Timeout, vaultRequestTimeout)
+	}
+}
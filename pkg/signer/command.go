@@ -0,0 +1,191 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandProtocolVersion is the version of the external signer protocol.
+//
+// The signer program is run once per operation with a single JSON request
+// on stdin and must print a single JSON response on stdout:
+//
+//	{"version":1,"operation":"sign","algorithm":"RS256","digest":"<base64 SHA-256 digest>"}
+//	→ {"signature":"<base64 RSASSA-PKCS1-v1_5 signature>"}
+//
+//	{"version":1,"operation":"public-key"}
+//	→ {"public_key":"<PEM public key>"}
+//
+// Failures are reported with a non-zero exit status; stderr, or an "error"
+// field in the response, explains them.
+const CommandProtocolVersion = 1
+
+// DefaultCommandTimeout bounds signer programs without an explicit timeout
+const DefaultCommandTimeout = 30 * time.Second
+
+const (
+	// maxResponseSize bounds what is read from a signer program
+	maxResponseSize = 64 << 10
+	// maxStderrSize bounds the stderr kept for error messages
+	maxStderrSize = 1024
+)
+
+// commandRequest is sent to the signer program
+type commandRequest struct {
+	Version   int    `json:"version"`
+	Operation string `json:"operation"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Digest    []byte `json:"digest,omitempty"`
+}
+
+// commandResponse is printed by the signer program
+type commandResponse struct {
+	Signature []byte `json:"signature,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CommandSigner signs with an external program speaking the protocol
+// described by CommandProtocolVersion
+type CommandSigner struct {
+	args    []string
+	timeout time.Duration
+
+	mu        sync.Mutex
+	public    crypto.PublicKey
+	publicErr error
+	loaded    bool
+}
+
+// NewCommandSigner returns a signer running args, without a shell, for each
+// operation. A zero timeout means DefaultCommandTimeout.
+func NewCommandSigner(args []string, timeout time.Duration) *CommandSigner {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	return &CommandSigner{args: args, timeout: timeout}
+}
+
+// Public returns the public key reported by the program, or nil when it
+// cannot report one
+func (s *CommandSigner) Public() crypto.PublicKey {
+	public, _ := s.PublicKey()
+	return public
+}
+
+// PublicKey asks the program for its public key once and remembers the answer
+func (s *CommandSigner) PublicKey() (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		s.public, s.publicErr = s.fetchPublicKey()
+		s.loaded = true
+	}
+	return s.public, s.publicErr
+}
+
+func (s *CommandSigner) fetchPublicKey() (crypto.PublicKey, error) {
+	response, err := s.run(commandRequest{Version: CommandProtocolVersion, Operation: "public-key"})
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(response.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("signer program returned no PEM public key")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// Sign implements crypto.Signer for RSASSA-PKCS1-v1_5 with SHA-256, the only
+// algorithm GitHub accepts for App JWTs
+func (s *CommandSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, pss := opts.(*rsa.PSSOptions); pss || opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("external signer only supports RS256")
+	}
+	response, err := s.run(commandRequest{
+		Version:   CommandProtocolVersion,
+		Operation: "sign",
+		Algorithm: "RS256",
+		Digest:    digest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Signature) == 0 {
+		return nil, fmt.Errorf("signer program returned no signature")
+	}
+	return response.Signature, nil
+}
+
+// run executes the program with one request and decodes its response
+func (s *CommandSigner) run(request commandRequest) (*commandResponse, error) {
+	if len(s.args) == 0 || s.args[0] == "" {
+		return nil, fmt.Errorf("no signer command configured")
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	// #nosec G204 -- The signer comes from the user's configuration and is executed directly without a shell.
+	child := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	child.Stdin = bytes.NewReader(input)
+	child.WaitDelay = time.Second
+	output, err := child.Output()
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("signer %s timed out after %s", s.args[0], s.timeout)
+	case errors.As(err, &exitErr):
+		return nil, fmt.Errorf("signer %s failed: %v%s", s.args[0], err, diagnostic(output, exitErr.Stderr))
+	case err != nil:
+		return nil, fmt.Errorf("failed to run signer %s: %w", s.args[0], err)
+	case len(output) > maxResponseSize:
+		return nil, fmt.Errorf("signer %s printed more than %d bytes", s.args[0], maxResponseSize)
+	}
+
+	var response commandResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("signer %s printed an invalid response: %w", s.args[0], err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("signer %s failed: %s", s.args[0], response.Error)
+	}
+	return &response, nil
+}
+
+// diagnostic explains a failed run with the response's error field or stderr
+func diagnostic(stdout, stderr []byte) string {
+	var response commandResponse
+	if json.Unmarshal(stdout, &response) == nil && response.Error != "" {
+		return ": " + response.Error
+	}
+	message := strings.TrimSpace(string(stderr))
+	if len(message) > maxStderrSize {
+		message = message[:maxStderrSize]
+	}
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
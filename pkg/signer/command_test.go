@@ -0,0 +1,174 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/test/testutil/testkeys"
+)
+
+// signerHelperEnv makes the test binary act as a signer program
+const signerHelperEnv = "GH_APP_AUTH_TEST_SIGNER"
+
+// TestSignerCommandHelper is not a test: it is the signer program run by the
+// command signer tests, selected by the arguments after "--"
+func TestSignerCommandHelper(t *testing.T) {
+	if os.Getenv(signerHelperEnv) == "" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		os.Exit(2)
+	}
+
+	switch args[1] {
+	case "sign":
+		serveSignRequest(args[2])
+	case "error":
+		fmt.Println(`{"error":"token is locked"}`)
+	case "fail":
+		fmt.Fprintln(os.Stderr, "cannot reach signing service")
+		os.Exit(1)
+	case "garbage":
+		fmt.Println("not json")
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	}
+	os.Exit(0)
+}
+
+// serveSignRequest answers one protocol request with the key in keyFile
+func serveSignRequest(keyFile string) {
+	data, err := os.ReadFile(keyFile) // #nosec G304 -- test fixture
+	if err != nil {
+		os.Exit(3)
+	}
+	block, _ := pem.Decode(data)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		os.Exit(3)
+	}
+
+	var request commandRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil || request.Version != CommandProtocolVersion {
+		os.Exit(4)
+	}
+	var response commandResponse
+	switch request.Operation {
+	case "public-key":
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		response.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	case "sign":
+		if request.Algorithm != "RS256" {
+			os.Exit(5)
+		}
+		response.Signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, request.Digest)
+		if err != nil {
+			os.Exit(5)
+		}
+	default:
+		os.Exit(6)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(response)
+}
+
+// helperSigner returns a command signer running the helper in the given mode
+func helperSigner(t *testing.T, timeout time.Duration, args ...string) *CommandSigner {
+	t.Helper()
+	t.Setenv(signerHelperEnv, "1")
+	argv := append([]string{os.Args[0], "-test.run=^TestSignerCommandHelper$", "--"}, args...)
+	return NewCommandSigner(argv, timeout)
+}
+
+// writeTestKey writes a fresh RSA key for the helper and returns it
+func writeTestKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, data := testkeys.RSAKey(t)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return key, path
+}
+
+func TestCommandSigner_Sign(t *testing.T) {
+	key, keyFile := writeTestKey(t)
+	signer := helperSigner(t, 0, "sign", keyFile)
+
+	digest := sha256.Sum256([]byte("header.payload"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	public, ok := signer.Public().(*rsa.PublicKey)
+	if !ok || !public.Equal(&key.PublicKey) {
+		t.Errorf("Public() = %v, want the helper's key", signer.Public())
+	}
+}
+
+func TestCommandSigner_RejectsOtherAlgorithms(t *testing.T) {
+	_, keyFile := writeTestKey(t)
+	signer := helperSigner(t, 0, "sign", keyFile)
+
+	digest := sha256.Sum256([]byte("data"))
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256}); err == nil {
+		t.Error("Sign() with PSS should fail")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA512); err == nil {
+		t.Error("Sign() with SHA-512 should fail")
+	}
+}
+
+func TestCommandSigner_Failures(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		timeout time.Duration
+		wantErr string
+	}{
+		{name: "error field", mode: "error", wantErr: "token is locked"},
+		{name: "non-zero exit", mode: "fail", wantErr: "cannot reach signing service"},
+		{name: "invalid response", mode: "garbage", wantErr: "invalid response"},
+		{name: "timeout", mode: "sleep", timeout: 200 * time.Millisecond, wantErr: "timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := helperSigner(t, tt.timeout, tt.mode)
+			digest := sha256.Sum256([]byte("data"))
+			_, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Sign() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if signer.Public() != nil {
+				t.Error("Public() should be nil when the program fails")
+			}
+		})
+	}
+}
+
+func TestCommandSigner_NoCommand(t *testing.T) {
+	signer := NewCommandSigner(nil, 0)
+	digest := sha256.Sum256([]byte("data"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+		t.Error("Sign() without a command should fail")
+	}
+}
@@ -0,0 +1,211 @@
+//go:build pkcs11 && cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// pkcs11Supported reports whether this binary can open PKCS#11 URIs
+const pkcs11Supported = true
+
+// sha256DigestInfo is the DER prefix of a SHA-256 DigestInfo, which
+// CKM_RSA_PKCS expects in front of the digest
+var sha256DigestInfo = []byte{
+	0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20,
+}
+
+// pkcs11Signer signs with an RSA key that never leaves its token
+type pkcs11Signer struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	public  *rsa.PublicKey
+}
+
+// openPKCS11 loads the module, logs into the token and finds the key
+func openPKCS11(uri *PKCS11URI) (crypto.Signer, error) {
+	ctx := pkcs11.New(uri.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", uri.ModulePath)
+	}
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+
+	signer, err := openPKCS11Key(ctx, uri)
+	if err != nil {
+		_ = ctx.Finalize()
+		ctx.Destroy()
+		return nil, fmt.Errorf("%s: %w", uri, err)
+	}
+	return signer, nil
+}
+
+func openPKCS11Key(ctx *pkcs11.Ctx, uri *PKCS11URI) (*pkcs11Signer, error) {
+	slot, err := findSlot(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	if uri.PIN != "" {
+		err := ctx.Login(session, pkcs11.CKU_USER, uri.PIN)
+		if err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			_ = ctx.CloseSession(session)
+			return nil, fmt.Errorf("failed to log in to token: %w", err)
+		}
+	}
+
+	key, err := findObject(ctx, session, pkcs11.CKO_PRIVATE_KEY, uri)
+	if err != nil {
+		_ = ctx.CloseSession(session)
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+
+	signer := &pkcs11Signer{ctx: ctx, session: session, key: key}
+	// The public key is optional: it only lets callers check the key type
+	if public, err := findObject(ctx, session, pkcs11.CKO_PUBLIC_KEY, uri); err == nil {
+		signer.public, _ = readRSAPublicKey(ctx, session, public)
+	}
+	return signer, nil
+}
+
+// findSlot returns the slot holding the token named by the URI
+func findSlot(ctx *pkcs11.Ctx, uri *PKCS11URI) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list slots: %w", err)
+	}
+	for _, slot := range slots {
+		if uri.SlotID >= 0 && slot != uint(uri.SlotID) {
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if uri.Token != "" && info.Label != uri.Token {
+			continue
+		}
+		if uri.Serial != "" && info.SerialNumber != uri.Serial {
+			continue
+		}
+		return slot, nil
+	}
+	return 0, errors.New("token not found")
+}
+
+// findObject returns the single object of class matching the URI's label and ID
+func findObject(
+	ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, uri *PKCS11URI,
+) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if uri.Object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.Object))
+	}
+	if len(uri.ID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.ID))
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("failed to search objects: %w", err)
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	_ = ctx.FindObjectsFinal(session)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search objects: %w", err)
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, errors.New("object not found")
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.New("URI matches several objects; add id or object")
+	}
+}
+
+// readRSAPublicKey reads the modulus and exponent of a public key object
+func readRSAPublicKey(
+	ctx *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle,
+) (*rsa.PublicKey, error) {
+	attributes, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil || len(attributes) != 2 {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(attributes[1].Value)
+	if !exponent.IsInt64() {
+		return nil, errors.New("public exponent out of range")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attributes[0].Value),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// Public returns the RSA public key, or nil when the token holds none
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	if s.public == nil {
+		return nil
+	}
+	return s.public
+}
+
+// Sign implements crypto.Signer for RSASSA-PKCS1-v1_5 with SHA-256
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, pss := opts.(*rsa.PSSOptions); pss || opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("PKCS#11 signer only supports RS256")
+	}
+	if len(digest) != crypto.SHA256.Size() {
+		return nil, errors.New("invalid SHA-256 digest length")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := s.ctx.SignInit(s.session, mechanism, s.key); err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign init failed: %w", err)
+	}
+	signature, err := s.ctx.Sign(s.session, append(append([]byte{}, sha256DigestInfo...), digest...))
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	return signature, nil
+}
+
+// Close logs out and unloads the module
+func (s *pkcs11Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = s.ctx.Logout(s.session)
+	err := s.ctx.CloseSession(s.session)
+	_ = s.ctx.Finalize()
+	s.ctx.Destroy()
+	return err
+}
+
+// isPKCS11Error reports whether err is the PKCS#11 return value code
+func isPKCS11Error(err error, code uint) bool {
+	var pkcs11Err pkcs11.Error
+	return errors.As(err, &pkcs11Err) && uint(pkcs11Err) == code
+}
@@ -0,0 +1,13 @@
+//go:build !pkcs11 || !cgo
+
+package signer
+
+import "crypto"
+
+// pkcs11Supported reports whether this binary can open PKCS#11 URIs
+const pkcs11Supported = false
+
+// openPKCS11 reports that this binary cannot talk to PKCS#11 modules
+func openPKCS11(uri *PKCS11URI) (crypto.Signer, error) {
+	return nil, ErrPKCS11Unsupported
+}
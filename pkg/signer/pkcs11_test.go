@@ -0,0 +1,47 @@
+//go:build pkcs11 && cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"os"
+	"testing"
+)
+
+// pkcs11TestURIEnv names an RSA key in a configured token, e.g. one created
+// with softhsm2-util and pkcs11-tool --keypairgen --key-type rsa:2048
+const pkcs11TestURIEnv = "GH_APP_AUTH_TEST_PKCS11_URI"
+
+func TestPKCS11Signer_SoftHSM(t *testing.T) {
+	uri := os.Getenv(pkcs11TestURIEnv)
+	if uri == "" {
+		t.Skipf("%s not set; set it and %s to run against SoftHSM", pkcs11TestURIEnv, PKCS11ModuleEnv)
+	}
+
+	signer, err := Open(uri)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() {
+		if err := Close(signer); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	}()
+
+	public, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("Public() = %T, want the token's RSA public key", signer.Public())
+	}
+
+	digest := sha256.Sum256([]byte("header.payload"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+// Package signer provides crypto.Signer implementations for GitHub App keys
+// that are never loaded into process memory: keys held in a PKCS#11 token
+// (an HSM or a software token such as SoftHSM) and keys behind an external
+// signer program.
+package signer
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPKCS11Unsupported is returned when a PKCS#11 URI is opened by a binary
+// built without PKCS#11 support, such as every release binary
+var ErrPKCS11Unsupported = errors.New("PKCS#11 support not compiled in: release binaries are built without cgo; " +
+	"build from source with CGO_ENABLED=1 and -tags pkcs11 (make build-pkcs11)")
+
+// Open returns a signer for the key identified by uri. Only pkcs11: URIs
+// (RFC 7512) are supported.
+func Open(uri string) (crypto.Signer, error) {
+	if !strings.HasPrefix(uri, "pkcs11:") {
+		return nil, fmt.Errorf("unsupported key URI %q: expected a pkcs11: URI", uri)
+	}
+	parsed, err := ParsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return openPKCS11(parsed)
+}
+
+// Close releases the resources held by a signer returned by Open or
+// NewCommandSigner, if any
+func Close(s crypto.Signer) error {
+	if closer, ok := s.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package signer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("4321\n"), 0600); err != nil {
+		t.Fatalf("failed to write pin file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		uri     string
+		env     map[string]string
+		want    PKCS11URI
+		wantErr string
+	}{
+		{
+			name: "token and object with query module and pin",
+			uri:  "pkcs11:token=ci;object=app%20key;type=private?module-path=/usr/lib/softhsm.so&pin-value=1234",
+			want: PKCS11URI{Token: "ci", Object: "app key", SlotID: -1, ModulePath: "/usr/lib/softhsm.so", PIN: "1234"},
+		},
+		{
+			name: "module and pin from environment",
+			uri:  "pkcs11:serial=abc;id=%01%02",
+			env:  map[string]string{PKCS11ModuleEnv: "/opt/hsm.so", PKCS11PINEnv: "0000"},
+			want: PKCS11URI{Serial: "abc", ID: []byte{1, 2}, SlotID: -1, ModulePath: "/opt/hsm.so", PIN: "0000"},
+		},
+		{
+			name: "pin source file",
+			uri:  "pkcs11:slot-id=3;object=k?module-path=/m.so&pin-source=file://" + pinFile,
+			want: PKCS11URI{SlotID: 3, Object: "k", ModulePath: "/m.so", PIN: "4321"},
+		},
+		{name: "wrong scheme", uri: "file:///key.pem", wantErr: "missing pkcs11: scheme"},
+		{name: "no object", uri: "pkcs11:token=ci?module-path=/m.so", wantErr: "object or id is required"},
+		{name: "no token", uri: "pkcs11:object=k?module-path=/m.so", wantErr: "token, serial or slot-id"},
+		{name: "no module", uri: "pkcs11:token=ci;object=k", wantErr: PKCS11ModuleEnv},
+		{name: "public key type", uri: "pkcs11:token=ci;object=k;type=public?module-path=/m.so", wantErr: "type"},
+		{name: "bad slot", uri: "pkcs11:slot-id=x;object=k?module-path=/m.so", wantErr: "slot-id"},
+		{name: "bad escape", uri: "pkcs11:token=%zz;object=k?module-path=/m.so", wantErr: "token"},
+		{
+			name:    "missing pin source",
+			uri:     "pkcs11:token=ci;object=k?module-path=/m.so&pin-source=/nonexistent/pin",
+			wantErr: "pin-source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(PKCS11ModuleEnv, "")
+			t.Setenv(PKCS11PINEnv, "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			got, err := ParsePKCS11URI(tt.uri)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePKCS11URI() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePKCS11URI() error = %v", err)
+			}
+			if got.Token != tt.want.Token || got.Serial != tt.want.Serial || got.SlotID != tt.want.SlotID ||
+				got.Object != tt.want.Object || !bytes.Equal(got.ID, tt.want.ID) ||
+				got.ModulePath != tt.want.ModulePath || got.PIN != tt.want.PIN {
+				t.Errorf("ParsePKCS11URI() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPKCS11URI_StringOmitsPIN(t *testing.T) {
+	uri, err := ParsePKCS11URI("pkcs11:token=ci;object=app%20key?module-path=/m.so&pin-value=secret")
+	if err != nil {
+		t.Fatalf("ParsePKCS11URI() error = %v", err)
+	}
+	if got, want := uri.String(), "pkcs11:token=ci;object=app%20key"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestOpen_RejectsOtherSchemes(t *testing.T) {
+	if _, err := Open("file:///key.pem"); err == nil {
+		t.Error("Open() should reject non-pkcs11 URIs")
+	}
+}
+
+func TestOpen_WithoutPKCS11Support(t *testing.T) {
+	if pkcs11Supported {
+		t.Skip("built with PKCS#11 support")
+	}
+	_, err := Open("pkcs11:token=ci;object=k?module-path=/m.so")
+	if !errors.Is(err, ErrPKCS11Unsupported) {
+		t.Errorf("Open() error = %v, want ErrPKCS11Unsupported", err)
+	}
+}
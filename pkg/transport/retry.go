@@ -0,0 +1,235 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+)
+
+// Default retry limits, used for settings missing from the configuration
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryPolicy bounds how failed requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled for every
+	// further retry and randomised by up to half its value
+	InitialBackoff time.Duration
+	// MaxBackoff caps a single delay. When the server asks to wait longer the
+	// response is returned as is.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when nothing is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// RetryPolicyFromConfig returns the policy for the retry section of the
+// configuration, with defaults for missing or invalid settings
+func RetryPolicyFromConfig(retry *config.RetryConfig) RetryPolicy {
+	policy := DefaultRetryPolicy()
+	if retry == nil {
+		return policy
+	}
+	if retry.MaxAttempts > 0 {
+		policy.MaxAttempts = retry.MaxAttempts
+	}
+	if backoff, err := time.ParseDuration(retry.InitialBackoff); err == nil && backoff > 0 {
+		policy.InitialBackoff = backoff
+	}
+	if backoff, err := time.ParseDuration(retry.MaxBackoff); err == nil && backoff > 0 {
+		policy.MaxBackoff = backoff
+	}
+	return policy
+}
+
+// retryTransport retries requests that fail with a network error, a 5xx
+// status or a rate limit
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+	// now and sleep can be overridden for testing
+	now   func() time.Time
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+// NewRetryTransport wraps base (http.DefaultTransport when nil) so failed
+// requests are retried according to policy
+func NewRetryTransport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{
+		base:   base,
+		policy: policy,
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body cannot be sent twice
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		delay, retry := t.retryDelay(req.Context(), resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+
+		fields := map[string]interface{}{
+			"method":       req.Method,
+			"url":          logger.SanitizeURL(req.URL.String()),
+			"attempt":      attempt,
+			"max_attempts": t.policy.MaxAttempts,
+			"delay":        delay.String(),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			fields["status"] = resp.StatusCode
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		logger.FlowStep("http_retry", fields)
+
+		if sleepErr := t.sleep(req.Context(), delay); sleepErr != nil {
+			if err != nil {
+				return nil, err
+			}
+			return nil, sleepErr
+		}
+	}
+}
+
+// retryDelay decides whether a failed attempt is retried and how long to wait
+// before the next one
+func (t *retryTransport) retryDelay(
+	ctx context.Context, resp *http.Response, err error, attempt int,
+) (time.Duration, bool) {
+	if attempt >= t.policy.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		return t.backoff(attempt), true
+	}
+
+	if wait, limited := t.rateLimitDelay(resp); limited {
+		if wait > t.policy.MaxBackoff {
+			logger.FlowStep("http_rate_limited", map[string]interface{}{
+				"status": resp.StatusCode,
+				"wait":   wait.String(),
+			})
+			return 0, false
+		}
+		return wait, true
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented {
+		return t.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// rateLimitDelay reports whether resp is a rate limit response and how long
+// the server asked to wait. GitHub signals secondary rate limits with 403 or
+// 429 and Retry-After, and exhausted primary limits with X-RateLimit-Remaining: 0.
+func (t *retryTransport) rateLimitDelay(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return max(date.Sub(t.now()), 0), true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Unix(reset, 0).Sub(t.now()), 0), true
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return t.backoff(1), true
+	}
+	return 0, false
+}
+
+// backoff returns the exponential delay before retry number attempt, with
+// jitter so parallel clients do not retry in lockstep
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := t.policy.InitialBackoff << (attempt - 1)
+	if delay <= 0 || delay > t.policy.MaxBackoff {
+		delay = t.policy.MaxBackoff
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	// #nosec G404 -- jitter does not need a cryptographic source
+	return half + rand.N(half+1)
+}
+
+// rewindRequest returns the request to send for attempt, with a fresh body
+// for retries
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, nil
+}
+
+// sleepContext waits for delay or until ctx is done
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
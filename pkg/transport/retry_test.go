@@ -0,0 +1,254 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestRetryTransport returns a retry transport that records delays instead
+// of sleeping
+func newTestRetryTransport(base http.RoundTripper, policy RetryPolicy) (*retryTransport, *[]time.Duration) {
+	delays := &[]time.Duration{}
+	retrying := NewRetryTransport(base, policy).(*retryTransport)
+	retrying.sleep = func(ctx context.Context, delay time.Duration) error {
+		*delays = append(*delays, delay)
+		return ctx.Err()
+	}
+	return retrying, delays
+}
+
+func TestRetryTransport_RetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"repositories":["repo"]}` {
+			t.Errorf("attempt %d body = %q, want replayed body", attempts.Load()+1, body)
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	retrying, delays := newTestRetryTransport(nil, DefaultRetryPolicy())
+	client := &http.Client{Transport: retrying}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(`{"repositories":["repo"]}`)))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if attempts.Load() != 3 || len(*delays) != 2 {
+		t.Errorf("attempts = %d with %d delays, want 3 attempts and 2 delays", attempts.Load(), len(*delays))
+	}
+}
+
+func TestRetryTransport_GivesUpAfterMaxAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: time.Second}
+	retrying, _ := newTestRetryTransport(nil, policy)
+	resp, err := (&http.Client{Transport: retrying}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want last response", resp.StatusCode)
+	}
+	if attempts.Load() != 4 {
+		t.Errorf("attempts = %d, want 4", attempts.Load())
+	}
+}
+
+func TestRetryTransport_RateLimits(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		status       int
+		headers      map[string]string
+		wantAttempts int32
+		wantDelay    time.Duration
+	}{
+		{
+			name:         "secondary rate limit with Retry-After",
+			status:       http.StatusForbidden,
+			headers:      map[string]string{"Retry-After": "2"},
+			wantAttempts: 2,
+			wantDelay:    2 * time.Second,
+		},
+		{
+			name:         "Retry-After as HTTP date",
+			status:       http.StatusTooManyRequests,
+			headers:      map[string]string{"Retry-After": now.Add(3 * time.Second).Format(http.TimeFormat)},
+			wantAttempts: 2,
+			wantDelay:    3 * time.Second,
+		},
+		{
+			name:   "primary rate limit reset",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(5*time.Second).Unix(), 10),
+			},
+			wantAttempts: 2,
+			wantDelay:    5 * time.Second,
+		},
+		{
+			name:         "reset beyond max backoff is not waited for",
+			status:       http.StatusForbidden,
+			headers:      map[string]string{"Retry-After": "3600"},
+			wantAttempts: 1,
+		},
+		{
+			name:         "forbidden without rate limit headers",
+			status:       http.StatusForbidden,
+			wantAttempts: 1,
+		},
+		{
+			name:         "client error",
+			status:       http.StatusNotFound,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) > 1 {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				for name, value := range tt.headers {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			retrying, delays := newTestRetryTransport(nil, DefaultRetryPolicy())
+			retrying.now = func() time.Time { return now }
+
+			resp, err := (&http.Client{Transport: retrying}).Get(server.URL)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if attempts.Load() != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), tt.wantAttempts)
+			}
+			if tt.wantDelay > 0 && (len(*delays) != 1 || (*delays)[0] != tt.wantDelay) {
+				t.Errorf("delays = %v, want [%v]", *delays, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_NetworkErrors(t *testing.T) {
+	var attempts int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	retrying, delays := newTestRetryTransport(base, DefaultRetryPolicy())
+	resp, err := retrying.RoundTrip(httptest.NewRequest(http.MethodGet, "https://api.github.com/app", nil))
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts != 2 || len(*delays) != 1 {
+		t.Errorf("status %d after %d attempts and %d delays, want 200 after 2 and 1", resp.StatusCode, attempts, len(*delays))
+	}
+}
+
+func TestRetryTransport_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		cancel()
+		return nil, errors.New("connection refused")
+	})
+
+	retrying, _ := newTestRetryTransport(base, DefaultRetryPolicy())
+	req := httptest.NewRequest(http.MethodGet, "https://api.github.com/app", nil).WithContext(ctx)
+	if _, err := retrying.RoundTrip(req); err == nil {
+		t.Fatal("Expected error")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 once the context is cancelled", attempts)
+	}
+}
+
+func TestRetryTransport_Backoff(t *testing.T) {
+	retrying := NewRetryTransport(nil, RetryPolicy{
+		MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second,
+	}).(*retryTransport)
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 9: 5 * time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			delay := retrying.backoff(attempt)
+			if delay < ceiling/2 || delay > ceiling {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, delay, ceiling/2, ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	if got := RetryPolicyFromConfig(nil); got != DefaultRetryPolicy() {
+		t.Errorf("RetryPolicyFromConfig(nil) = %+v, want defaults", got)
+	}
+
+	got := RetryPolicyFromConfig(&config.RetryConfig{MaxAttempts: 5, InitialBackoff: "200ms", MaxBackoff: "1m"})
+	want := RetryPolicy{MaxAttempts: 5, InitialBackoff: 200 * time.Millisecond, MaxBackoff: time.Minute}
+	if got != want {
+		t.Errorf("RetryPolicyFromConfig() = %+v, want %+v", got, want)
+	}
+
+	got = RetryPolicyFromConfig(&config.RetryConfig{MaxAttempts: 1})
+	if got.MaxAttempts != 1 || got.InitialBackoff != DefaultInitialBackoff || got.MaxBackoff != DefaultMaxBackoff {
+		t.Errorf("RetryPolicyFromConfig() = %+v, want defaults with 1 attempt", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Package transport builds the HTTP clients used to reach GitHub APIs,
+// applying the per-host proxy, TLS and timeout settings from the transport
+// section of the configuration, and retrying transient failures according to
+// its retry section.
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/hosts"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+)
+
+// warningOutput receives the insecure_skip_verify warning (can be overridden for testing)
+var warningOutput io.Writer = os.Stderr
+
+// Factory creates HTTP clients for GitHub API URLs that retry failed requests.
+// A nil Factory is valid and creates plain clients.
+type Factory struct {
+	settings map[string]config.TransportConfig
+	retry    RetryPolicy
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// FromConfig creates a factory for the transport and retry sections of cfg
+func FromConfig(cfg *config.Config) *Factory {
+	factory := New(cfg.Transport)
+	factory.retry = RetryPolicyFromConfig(cfg.Retry)
+	return factory
+}
+
+// New creates a factory for per-host settings with the default retry policy
+func New(settings map[string]config.TransportConfig) *Factory {
+	normalized := make(map[string]config.TransportConfig, len(settings))
+	for host, hostSettings := range settings {
+		normalized[hosts.Normalize(host)] = hostSettings
+	}
+	return &Factory{
+		settings: normalized,
+		retry:    DefaultRetryPolicy(),
+		clients:  make(map[string]*http.Client),
+	}
+}
+
+// Lookup returns the configured host whose settings apply to rawURL. A host's
+// settings also cover its api. subdomain, so github.com settings apply to
+// https://api.github.com. The boolean is false when no settings apply.
+func (f *Factory) Lookup(rawURL string) (string, config.TransportConfig, bool) {
+	if f == nil {
+		return "", config.TransportConfig{}, false
+	}
+
+	host := hosts.Normalize(rawURL)
+	if settings, ok := f.settings[host]; ok {
+		return host, settings, true
+	}
+	if gitHost, ok := strings.CutPrefix(host, "api."); ok {
+		if settings, ok := f.settings[gitHost]; ok {
+			return gitHost, settings, true
+		}
+	}
+	return "", config.TransportConfig{}, false
+}
+
+// Client returns an HTTP client for requests to rawURL. Clients are built once
+// per configured host and reused; URLs without settings get a client with the
+// default transport.
+func (f *Factory) Client(rawURL string) (*http.Client, error) {
+	if f == nil {
+		return &http.Client{}, nil
+	}
+	host, settings, ok := f.Lookup(rawURL)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if client, found := f.clients[host]; found {
+		return client, nil
+	}
+
+	client := &http.Client{}
+	if ok {
+		var err error
+		if client, err = NewClient(host, settings); err != nil {
+			return nil, fmt.Errorf("transport settings for %s: %w", host, err)
+		}
+	}
+	client.Transport = NewRetryTransport(client.Transport, f.retry)
+	f.clients[host] = client
+	return client, nil
+}
+
+// NewClient builds an HTTP client for host from settings, loading the CA
+// bundle and client certificate they reference
+func NewClient(host string, settings config.TransportConfig) (*http.Client, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	settings, err := settings.WithExpandedPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.InsecureSkipVerify {
+		warnInsecure(host)
+	}
+
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected default HTTP transport %T", http.DefaultTransport)
+	}
+	roundTripper := base.Clone()
+	roundTripper.TLSClientConfig = tlsConfig
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		roundTripper.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   settings.TimeoutDuration(),
+	}, nil
+}
+
+// newTLSConfig returns the TLS configuration for settings, trusting the CA
+// bundle in addition to the system roots
+func newTLSConfig(settings config.TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- opt-in for testing, announced by warnInsecure
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s contains no PEM certificates", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// warnInsecure announces that certificate verification is disabled for host
+func warnInsecure(host string) {
+	_, _ = fmt.Fprintf(warningOutput,
+		"⚠️  WARNING: TLS certificate verification is DISABLED for %s (transport.insecure_skip_verify).\n"+
+			"   Tokens sent to this host can be intercepted. Do not use this outside of testing.\n", host)
+	logger.FlowStep("transport_insecure", map[string]interface{}{
+		"host": host,
+	})
+}
@@ -0,0 +1,90 @@
+package testutil
+
+import (
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// ResolutionCase is a credential resolution every command must agree on
+type ResolutionCase struct {
+	Name string
+	// URL, Pattern, AppID and InstallationID make up the request
+	URL            string
+	Pattern        string
+	AppID          int64
+	InstallationID int64
+	// WantApp and WantPAT name the expected credential; both are empty when
+	// nothing should match
+	WantApp string
+	WantPAT string
+	// WantErr is a substring of the expected error
+	WantErr string
+}
+
+// ResolutionConfig returns the configuration ResolutionCases resolve against
+func ResolutionConfig() *config.Config {
+	return &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{
+			{Name: "org", AppID: 100, InstallationID: 200, Patterns: []string{"github.com/myorg/*"}},
+			{Name: "org-b", AppID: 100, InstallationID: 300, Patterns: []string{"github.com/org-b/"}},
+			{Name: "special-repo", AppID: 400, InstallationID: 500, Patterns: []string{"github.com/myorg/special-repo"}},
+			{
+				Name: "scoped", AppID: 600, InstallationID: 700, Patterns: []string{"github.com/scoped/"},
+				Scope: &config.InstallationScope{
+					RepositorySelection: "selected",
+					AccountLogin:        "scoped",
+					Repositories:        []config.RepositoryInfo{{FullName: "scoped/allowed"}},
+				},
+			},
+			{Name: "enterprise", AppID: 800, InstallationID: 900, Patterns: []string{"https://ghes.example.com/team/*"}},
+			{Name: "tie-app", AppID: 1000, InstallationID: 1100, Patterns: []string{"github.com/tie/"}},
+			{Name: "default-tie-app", AppID: 1200, InstallationID: 1300, Patterns: []string{"github.com/default-tie/"}},
+			{Name: "github-wide", AppID: 1400, InstallationID: 1500, Patterns: []string{"https://github.com/*"}},
+		},
+		PATs: []config.PersonalAccessToken{
+			{Name: "github", Patterns: []string{"github.com/"}},
+			{Name: "pat-repo", Patterns: []string{"https://github.com/myorg/pat-repo"}},
+			{Name: "tie-pat", Patterns: []string{"github.com/tie/"}, Priority: 10},
+			{Name: "default-tie-pat", Patterns: []string{"github.com/default-tie/"}},
+			{Name: "bitbucket", Patterns: []string{"bitbucket.example.com/"}},
+		},
+	}
+}
+
+// ResolutionCases returns the shared conformance table of credential
+// resolution against ResolutionConfig
+func ResolutionCases() []ResolutionCase {
+	return []ResolutionCase{
+		{Name: "organization app", URL: "https://github.com/myorg/repo", WantApp: "org"},
+		{Name: "longest prefix wins", URL: "https://github.com/myorg/special-repo", WantApp: "special-repo"},
+		{Name: "SSH URL", URL: "git@github.com:myorg/special-repo.git", WantApp: "special-repo"},
+		{Name: "URL without scheme", URL: "github.com/myorg/repo", WantApp: "org"},
+		{Name: "shorter PAT as fallback", URL: "https://github.com/elsewhere/repo", WantPAT: "github"},
+		{Name: "longer PAT beats app", URL: "https://github.com/myorg/pat-repo", WantPAT: "pat-repo"},
+		{Name: "installation scope excludes", URL: "https://github.com/scoped/denied", WantPAT: "github"},
+		{Name: "installation scope includes", URL: "https://github.com/scoped/allowed", WantApp: "scoped"},
+		{Name: "scheme and wildcard ignored", URL: "https://ghes.example.com/team/repo", WantApp: "enterprise"},
+		{Name: "priority breaks ties", URL: "https://github.com/tie/repo", WantPAT: "tie-pat"},
+		{Name: "app wins full tie", URL: "https://github.com/default-tie/repo", WantApp: "default-tie-app"},
+		{Name: "non-GitHub host", URL: "https://bitbucket.example.com/scm/team/repo.git", WantPAT: "bitbucket"},
+		{Name: "no match", URL: "https://gitlab.com/group/project"},
+		{Name: "prefix ends at an owner boundary", URL: "https://github.com/myorg-evil/x", WantPAT: "github"},
+		{Name: "prefix ends at a host boundary", URL: "https://github.com.evil.net/myorg/repo"},
+		{
+			Name: "URL within pattern hint resolves on its own", URL: "https://github.com/myorg/special-repo",
+			Pattern: "https://github.com/myorg", WantApp: "special-repo",
+		},
+		{
+			Name: "pattern hint stands in for bare host", URL: "https://github.com",
+			Pattern: "https://github.com/myorg", WantApp: "org",
+		},
+		{Name: "URL outside pattern hint", URL: "https://github.com/myorg/repo", Pattern: "https://github.com/org-b"},
+		{Name: "bare host", URL: "ghes.example.com", WantApp: "enterprise"},
+		{Name: "installation ID", InstallationID: 300, WantApp: "org-b"},
+		{Name: "app and installation ID", AppID: 100, InstallationID: 200, WantApp: "org"},
+		{Name: "URL tells selected apps apart", URL: "github.com/org-b/repo", AppID: 100, WantApp: "org-b"},
+		{Name: "selectors ignore PATs", URL: "github.com/myorg/pat-repo", AppID: 100, WantApp: "org"},
+		{Name: "ambiguous app ID", AppID: 100, WantErr: "multiple GitHub App configurations match"},
+		{Name: "unknown installation", InstallationID: 999, WantErr: "no configured GitHub App matches"},
+	}
+}
@@ -0,0 +1,29 @@
+// Package testkeys generates RSA private keys for tests. It has no
+// dependencies on the rest of the module so that any package, including
+// pkg/config and pkg/signer, can use it from its internal tests.
+package testkeys
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+// RSAKey returns a fresh 2048-bit RSA private key and its PKCS#1 PEM encoding
+func RSAKey(t testing.TB) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// RSAKeyPEM returns a fresh PEM-encoded RSA private key
+func RSAKeyPEM(t testing.TB) string {
+	t.Helper()
+	_, keyPEM := RSAKey(t)
+	return keyPEM
+}